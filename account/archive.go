@@ -0,0 +1,168 @@
+package account
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+const (
+	ArchiveFormat  = "savorbook-account"
+	ArchiveVersion = 1
+	manifestPath   = "manifest.json"
+	tagsPath       = "tags.json"
+)
+
+// MaxArchiveSize is the largest archive that can be uploaded for import.
+const MaxArchiveSize = 256 << 20
+
+const (
+	//maxArchiveFile is the most that is read of any one file in an archive, whatever its header claims
+	maxArchiveFile = 32 << 20
+	//maxArchiveTotal is the most all of an archive's files may come to uncompressed
+	maxArchiveTotal = 1 << 30
+	maxArchiveFiles = 20000
+)
+
+// Manifest describes an account archive. Everything in it is named relative to the root of the zip.
+type Manifest struct {
+	Format     string          `json:"format"`
+	Version    int             `json:"version"`
+	ExportedAt string          `json:"exportedAt"`
+	Account    ManifestAccount `json:"account"`
+	Recipes    []string        `json:"recipes"`
+	Cookbooks  []string        `json:"cookbooks"`
+	Tags       string          `json:"tags"`
+	Images     []ManifestImage `json:"images"`
+}
+
+type ManifestAccount struct {
+	Username    string `json:"username"`
+	DisplayName string `json:"displayName"`
+}
+
+// ManifestImage is an uploaded image along with every reference to it in the archive.
+type ManifestImage struct {
+	File     string     `json:"file"`
+	MimeType string     `json:"mimeType"`
+	Refs     []ImageRef `json:"refs"`
+}
+
+// ImageRef is one of the ways recipes and cookbooks point at an image, by the url or
+// path of one of its renditions. On import the ref is swapped for the same rendition
+// of the re-uploaded image.
+type ImageRef struct {
+	Ref       string `json:"ref"`
+	Rendition string `json:"rendition"`
+	Field     string `json:"field"`
+}
+
+// ArchiveError lists what is wrong with an archive that can't be imported.
+type ArchiveError struct {
+	Problems []string
+}
+
+func (e *ArchiveError) Error() string {
+	return fmt.Sprintf("archive can't be imported: %d problems found", len(e.Problems))
+}
+
+func (e *ArchiveError) add(format string, args ...interface{}) {
+	e.Problems = append(e.Problems, fmt.Sprintf(format, args...))
+}
+
+// archiveWriter writes JSON compressed and images as they are, they are compressed already.
+type archiveWriter struct {
+	zip      *zip.Writer
+	modified time.Time
+}
+
+func (w *archiveWriter) writeJSON(name string, value interface{}) error {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	file, err := w.zip.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: w.modified})
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	return err
+}
+
+func (w *archiveWriter) writeFile(name string, reader io.Reader) error {
+	file, err := w.zip.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: w.modified})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, reader)
+	return err
+}
+
+// archiveReader finds files in an uploaded archive by name.
+type archiveReader struct {
+	files map[string]*zip.File
+}
+
+// newArchiveReader turns away archives with more files, or more in them, than an export could hold.
+func newArchiveReader(reader *zip.Reader) (*archiveReader, error) {
+	if len(reader.File) > maxArchiveFiles {
+		return nil, fmt.Errorf("archive has %d files, at most %d can be imported", len(reader.File), maxArchiveFiles)
+	}
+	files := make(map[string]*zip.File)
+	var total uint64
+	for _, file := range reader.File {
+		total += file.UncompressedSize64
+		if total > maxArchiveTotal {
+			return nil, fmt.Errorf("archive is larger than %d MB uncompressed", maxArchiveTotal>>20)
+		}
+		files[file.Name] = file
+	}
+	return &archiveReader{files: files}, nil
+}
+
+// check finds a file without reading it.
+func (r *archiveReader) check(name string) error {
+	file, ok := r.files[name]
+	if !ok {
+		return fmt.Errorf("%s is missing", name)
+	}
+	if file.UncompressedSize64 > maxArchiveFile {
+		return fmt.Errorf("%s is too large", name)
+	}
+	return nil
+}
+
+func (r *archiveReader) readFile(name string) ([]byte, error) {
+	if err := r.check(name); err != nil {
+		return nil, err
+	}
+
+	reader, err := r.files[name].Open()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	defer reader.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(reader, maxArchiveFile+1))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	if len(data) > maxArchiveFile {
+		return nil, fmt.Errorf("%s is too large", name)
+	}
+	return data, nil
+}
+
+func (r *archiveReader) readJSON(name string, value interface{}) error {
+	data, err := r.readFile(name)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, value); err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	return nil
+}
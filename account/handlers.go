@@ -0,0 +1,232 @@
+package account
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/anthonyhawkins/savorbook/middleware"
+	"github.com/anthonyhawkins/savorbook/responses"
+	"github.com/gofiber/fiber/v2"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"os"
+	"strconv"
+	"time"
+)
+
+func AccountExport(c *fiber.Ctx) error {
+
+	response := new(responses.StandardResponse)
+	response.Success = false
+	userID := middleware.AuthedUserId(c.Locals("user"))
+
+	//everything is loaded before the first byte goes out, so a failure can still be reported
+	export, err := GetExport(userID)
+	if err != nil {
+		response.Message = "Unable to Export Account"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	filename := fmt.Sprintf("savorbook-%s-%s.zip", export.Manifest.Account.Username, time.Now().UTC().Format("2006-01-02"))
+	c.Set(fiber.HeaderContentType, "application/zip")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
+
+	//Respond with Success
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		if err := export.WriteTo(context.Background(), w); err != nil {
+			fmt.Println("account export failed for user", userID, err)
+		}
+	})
+	return nil
+}
+
+// AccountImport imports an archive uploaded as "file". Archives larger than a
+// request may be are uploaded in parts instead, see AccountUploadStart.
+func AccountImport(c *fiber.Ctx) error {
+
+	response := new(responses.StandardResponse)
+	response.Success = false
+	userID := middleware.AuthedUserId(c.Locals("user"))
+
+	/**
+	Read in the uploaded archive
+	*/
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		response.Message = "Archive Required"
+		response.Errors = append(response.Errors, "upload an account export as file")
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	archive, err := ioutil.TempFile("", "savorbook-import-*.zip")
+	if err != nil {
+		response.Message = "Unable to Import Account"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+	defer os.Remove(archive.Name())
+
+	err = spool(fileHeader, archive)
+	if closeErr := archive.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		response.Message = "Unable to Import Account"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	result, err := Import(context.Background(), userID, archive.Name())
+	return importResponse(c, response, &result, err)
+}
+
+func spool(fileHeader *multipart.FileHeader, w io.Writer) error {
+	file, err := fileHeader.Open()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(w, file)
+	return err
+}
+
+func importResponse(c *fiber.Ctx, response *responses.StandardResponse, result *ImportResult, err error) error {
+	var archiveErr *ArchiveError
+	if errors.As(err, &archiveErr) {
+		response.Message = "Invalid Archive"
+		response.Errors = append(response.Errors, archiveErr.Problems...)
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+	if err != nil {
+		response.Message = "Unable to Import Account"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	var importResponse ImportResponse
+	importResponse.SerializeImport(result)
+
+	//Respond with Success
+	response.Success = true
+	response.Message = "Account Imported"
+	response.Data = importResponse
+	response.Warnings = result.Warnings
+	return c.Status(fiber.StatusCreated).JSON(response)
+}
+
+/**
+Archives too large for one request are uploaded in parts: start an upload, PUT
+each part with ?offset= the byte it starts at, then finish it to import.
+*/
+
+func AccountUploadStart(c *fiber.Ctx) error {
+
+	response := new(responses.StandardResponse)
+	response.Success = false
+	userID := middleware.AuthedUserId(c.Locals("user"))
+
+	upload, err := StartUpload(userID)
+	if err != nil {
+		response.Message = "Unable to Start Upload"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	var uploadResponse UploadResponse
+	uploadResponse.SerializeUpload(&upload)
+
+	//Respond with Success
+	response.Success = true
+	response.Message = "Upload Started"
+	response.Data = uploadResponse
+	return c.Status(fiber.StatusCreated).JSON(response)
+}
+
+func AccountUploadPart(c *fiber.Ctx) error {
+
+	response := new(responses.StandardResponse)
+	response.Success = false
+	userID := middleware.AuthedUserId(c.Locals("user"))
+
+	offset, err := strconv.ParseInt(c.Query("offset"), 10, 64)
+	if err != nil {
+		response.Message = "Offset Required"
+		response.Errors = append(response.Errors, "send the byte the part starts at as ?offset=")
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	upload, err := AppendUpload(userID, c.Params("id"), offset, c.Body())
+	var uploadResponse UploadResponse
+	uploadResponse.SerializeUpload(&upload)
+
+	var offsetErr *UploadOffsetError
+	if errors.Is(err, ErrUploadNotFound) {
+		response.Message = "Upload Not Found"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+	if errors.As(err, &offsetErr) {
+		response.Message = "Wrong Offset"
+		response.Errors = append(response.Errors, err.Error())
+		response.Data = uploadResponse
+		return c.Status(fiber.StatusConflict).JSON(response)
+	}
+	if errors.Is(err, ErrArchiveTooLarge) || errors.Is(err, ErrUploadPartTooBig) {
+		response.Message = "Archive Too Large"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(response)
+	}
+	if err != nil {
+		response.Message = "Unable to Upload Part"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	//Respond with Success
+	response.Success = true
+	response.Message = "Part Uploaded"
+	response.Data = uploadResponse
+	return c.JSON(response)
+}
+
+func AccountUploadFinish(c *fiber.Ctx) error {
+
+	response := new(responses.StandardResponse)
+	response.Success = false
+	userID := middleware.AuthedUserId(c.Locals("user"))
+
+	result, err := FinishUpload(context.Background(), userID, c.Params("id"))
+	if errors.Is(err, ErrUploadNotFound) {
+		response.Message = "Upload Not Found"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+	return importResponse(c, response, &result, err)
+}
+
+func AccountUploadCancel(c *fiber.Ctx) error {
+
+	response := new(responses.StandardResponse)
+	response.Success = false
+	userID := middleware.AuthedUserId(c.Locals("user"))
+
+	err := CancelUpload(userID, c.Params("id"))
+	if errors.Is(err, ErrUploadNotFound) {
+		response.Message = "Upload Not Found"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+	if err != nil {
+		response.Message = "Unable to Cancel Upload"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	//Respond with Success
+	response.Success = true
+	response.Message = "Upload Cancelled"
+	return c.JSON(response)
+}
@@ -0,0 +1,560 @@
+package account
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/anthonyhawkins/savorbook/images"
+	"github.com/anthonyhawkins/savorbook/images/storage"
+	"github.com/anthonyhawkins/savorbook/publish/cookbooks"
+	"github.com/anthonyhawkins/savorbook/publish/recipes"
+	"github.com/anthonyhawkins/savorbook/users"
+	"io"
+	"path"
+	"strconv"
+	"time"
+)
+
+// Export is everything in an account, loaded up front so the archive can be
+// streamed out without going back to the database.
+type Export struct {
+	Manifest  Manifest
+	Recipes   []recipes.RecipeResponse
+	Cookbooks []cookbooks.CookbookResponse
+	Tags      []string
+	//images line up with Manifest.Images
+	images []images.Image
+}
+
+// GetExport loads every recipe, in full with its dependencies, every cookbook with
+// its sections and pages, the tag list and the images any of them use.
+func GetExport(userID uint) (*Export, error) {
+	export := &Export{
+		Manifest: Manifest{
+			Format:     ArchiveFormat,
+			Version:    ArchiveVersion,
+			ExportedAt: time.Now().UTC().Format(time.RFC3339),
+			Recipes:    make([]string, 0),
+			Cookbooks:  make([]string, 0),
+			Tags:       tagsPath,
+			Images:     make([]ManifestImage, 0),
+		},
+		Tags: make([]string, 0),
+	}
+
+	user, err := users.FindOne(userID)
+	if err != nil {
+		return nil, err
+	}
+	export.Manifest.Account = ManifestAccount{Username: user.Username, DisplayName: user.DisplayName}
+
+	var refs []string
+
+	recipeIDs, err := recipes.GetRecipeIDs(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, recipeID := range recipeIDs {
+		model, err := recipes.GetRecipeFull(strconv.Itoa(int(recipeID)), userID)
+		if err != nil {
+			return nil, err
+		}
+		var recipeResponse recipes.RecipeResponse
+		recipeResponse.SerializeRecipe(&model)
+		export.Recipes = append(export.Recipes, recipeResponse)
+		export.Manifest.Recipes = append(export.Manifest.Recipes, fmt.Sprintf("recipes/%d.json", model.ID))
+
+		refs = append(refs, model.Image)
+		for _, step := range model.Steps {
+			for _, stepImage := range step.StepImages {
+				refs = append(refs, stepImage.Image)
+			}
+		}
+	}
+
+	cookbookModels, err := cookbooks.GetAllCookbooks(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, model := range cookbookModels {
+		var cookbookResponse cookbooks.CookbookResponse
+		cookbookResponse.SerializeCookbook(&model)
+		export.Cookbooks = append(export.Cookbooks, cookbookResponse)
+		export.Manifest.Cookbooks = append(export.Manifest.Cookbooks, fmt.Sprintf("cookbooks/%d.json", model.ID))
+		refs = append(refs, model.Images()...)
+	}
+
+	tags, err := recipes.GetTags(userID)
+	if err != nil {
+		return nil, err
+	}
+	export.Tags = append(export.Tags, recipes.SerializeTags(tags)...)
+
+	referenced, err := images.FindReferencedImages(userID, refs)
+	if err != nil {
+		return nil, err
+	}
+	for i, image := range referenced {
+		export.images = append(export.images, image)
+		export.Manifest.Images = append(export.Manifest.Images, ManifestImage{
+			File:     fmt.Sprintf("images/%d%s", i+1, path.Ext(image.Name)),
+			MimeType: image.MimeType,
+			Refs:     imageRefs(&image, refs),
+		})
+	}
+
+	return export, nil
+}
+
+// imageRefs works out which rendition, and which of its url or path, each ref to the image names.
+func imageRefs(image *images.Image, refs []string) []ImageRef {
+	imageRefs := make([]ImageRef, 0)
+	seen := make(map[string]bool)
+	renditions := append([]images.ImageRendition{image.Rendition("full")}, image.Renditions...)
+	for _, ref := range refs {
+		if ref == "" || seen[ref] {
+			continue
+		}
+		for _, rendition := range renditions {
+			field := ""
+			switch ref {
+			case rendition.Url:
+				field = "url"
+			case rendition.Path:
+				field = "path"
+			}
+			if field != "" {
+				seen[ref] = true
+				imageRefs = append(imageRefs, ImageRef{Ref: ref, Rendition: rendition.Name, Field: field})
+				break
+			}
+		}
+	}
+	return imageRefs
+}
+
+// WriteTo writes the archive: the manifest, a file per recipe and cookbook, the tag
+// list and the original of every image.
+func (export *Export) WriteTo(ctx context.Context, w io.Writer) error {
+	archive := &archiveWriter{zip: zip.NewWriter(w), modified: time.Now()}
+
+	if err := archive.writeJSON(manifestPath, export.Manifest); err != nil {
+		return err
+	}
+	for i, recipe := range export.Recipes {
+		if err := archive.writeJSON(export.Manifest.Recipes[i], recipe); err != nil {
+			return err
+		}
+	}
+	for i, cookbook := range export.Cookbooks {
+		if err := archive.writeJSON(export.Manifest.Cookbooks[i], cookbook); err != nil {
+			return err
+		}
+	}
+	if err := archive.writeJSON(tagsPath, export.Tags); err != nil {
+		return err
+	}
+
+	for i, image := range export.images {
+		reader, err := storage.GetStorage().Get(ctx, image.Name)
+		if err != nil {
+			return fmt.Errorf("image %d: %v", image.ID, err)
+		}
+		err = archive.writeFile(export.Manifest.Images[i].File, reader)
+		reader.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return archive.zip.Close()
+}
+
+// ImportResult maps the ids in the archive onto the ids of what was created from them.
+type ImportResult struct {
+	Recipes   map[uint]uint
+	Cookbooks map[uint]uint
+	Images    int
+	Warnings  []string
+}
+
+// importedRecipe is a recipe from the archive, validated but not yet saved.
+type importedRecipe struct {
+	file      string
+	id        uint
+	validator *recipes.RecipeValidator
+}
+
+type importedCookbook struct {
+	file      string
+	id        uint
+	validator *cookbooks.CookbookValidator
+}
+
+// Import recreates an archived account under userID. Everything is read and
+// validated before anything is written, an archive with problems fails with an
+// ArchiveError. Images are uploaded again, then recipes are created with the
+// recipes they depend on ahead of them so dependencies and section recipes can be
+// pointed at their new ids, then cookbooks. Everything comes in as a draft for the
+// author to publish again. Should a save fail part way, what was already created
+// is deleted again, images left behind unused are collected by the sweeper.
+func Import(ctx context.Context, userID uint, archivePath string) (ImportResult, error) {
+	result := ImportResult{
+		Recipes:   make(map[uint]uint),
+		Cookbooks: make(map[uint]uint),
+		Warnings:  make([]string, 0),
+	}
+	problems := &ArchiveError{}
+
+	zipReader, err := zip.OpenReader(archivePath)
+	if err != nil {
+		problems.add("not a zip archive: %v", err)
+		return result, problems
+	}
+	defer zipReader.Close()
+	archive, err := newArchiveReader(&zipReader.Reader)
+	if err != nil {
+		problems.add("%v", err)
+		return result, problems
+	}
+
+	var manifest Manifest
+	if err := archive.readJSON(manifestPath, &manifest); err != nil {
+		problems.add("%v", err)
+		return result, problems
+	}
+	if manifest.Format != ArchiveFormat {
+		problems.add("%s is not a %s archive", manifestPath, ArchiveFormat)
+		return result, problems
+	}
+	if manifest.Version > ArchiveVersion {
+		problems.add("archive version %d is newer than this server reads", manifest.Version)
+		return result, problems
+	}
+
+	/**
+	Read and validate everything before writing anything
+	*/
+	var recipeList []*importedRecipe
+	recipesByID := make(map[uint]*importedRecipe)
+	for _, file := range manifest.Recipes {
+		var recipeResponse recipes.RecipeResponse
+		if err := archive.readJSON(file, &recipeResponse); err != nil {
+			problems.add("%v", err)
+			continue
+		}
+		if _, duplicate := recipesByID[recipeResponse.ID]; duplicate || recipeResponse.ID == 0 {
+			problems.add("%s: recipe id %d is missing or used twice", file, recipeResponse.ID)
+			continue
+		}
+		recipe := &importedRecipe{file: file, id: recipeResponse.ID, validator: recipeValidator(&recipeResponse)}
+		if errs, err := recipe.validator.Validate(); err != nil {
+			for _, message := range errs {
+				problems.add("%s: %s", file, message)
+			}
+		}
+		recipesByID[recipe.id] = recipe
+		recipeList = append(recipeList, recipe)
+	}
+
+	//a dependency on a recipe that isn't in the archive can't be kept
+	for _, recipe := range recipeList {
+		kept := make([]recipes.RecipeDependencyValidator, 0)
+		for _, dependency := range recipe.validator.Recipe.DependentRecipes {
+			if _, ok := recipesByID[dependency.DependentRecipe]; !ok {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("%s: dependency on recipe %d left out, it isn't in the archive", recipe.file, dependency.DependentRecipe))
+				continue
+			}
+			kept = append(kept, dependency)
+		}
+		recipe.validator.Recipe.DependentRecipes = kept
+	}
+
+	recipeOrder, err := dependencyOrder(recipeList, recipesByID)
+	if err != nil {
+		problems.add("%v", err)
+	}
+
+	var cookbookList []*importedCookbook
+	for _, file := range manifest.Cookbooks {
+		var cookbookResponse cookbooks.CookbookResponse
+		if err := archive.readJSON(file, &cookbookResponse); err != nil {
+			problems.add("%v", err)
+			continue
+		}
+		cookbook := &importedCookbook{file: file, id: cookbookResponse.ID}
+		cookbook.validator = cookbookValidator(&cookbookResponse, recipesByID, file, &result.Warnings)
+		if errs, err := cookbook.validator.Validate(); err != nil {
+			for _, message := range errs {
+				problems.add("%s: %s", file, message)
+			}
+		}
+		cookbookList = append(cookbookList, cookbook)
+	}
+
+	//images are only read as they are uploaded, one at a time
+	for _, image := range manifest.Images {
+		if err := archive.check(image.File); err != nil {
+			problems.add("%v", err)
+		}
+	}
+
+	if len(problems.Problems) > 0 {
+		return result, problems
+	}
+
+	/**
+	Upload the images and swap references to the old ones for the new
+	*/
+	refs := make(map[string]string)
+	for _, manifestImage := range manifest.Images {
+		data, err := archive.readFile(manifestImage.File)
+		if err != nil {
+			return result, err
+		}
+		image, _, err := images.StoreImage(ctx, userID, data)
+		var invalid *images.InvalidImageError
+		if errors.As(err, &invalid) || errors.Is(err, images.ErrUnsupportedType) {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%s: %v, references to it are left as they were", manifestImage.File, err))
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+		result.Images++
+
+		for _, ref := range manifestImage.Refs {
+			rendition := image.Rendition(ref.Rendition)
+			newRef := rendition.Url
+			if ref.Field == "path" || newRef == "" {
+				newRef = rendition.Path
+			}
+			refs[ref.Ref] = newRef
+		}
+	}
+
+	/**
+	Create the recipes, then the cookbooks, undoing what was created if any fails
+	*/
+	var created []func()
+	undo := func() {
+		for i := len(created) - 1; i >= 0; i-- {
+			created[i]()
+		}
+	}
+
+	for _, recipe := range recipeOrder {
+		v := recipe.validator
+		v.Recipe.Image = remapRef(refs, v.Recipe.Image)
+		for i := range v.Recipe.Steps {
+			for j := range v.Recipe.Steps[i].StepImages {
+				v.Recipe.Steps[i].StepImages[j].Image = remapRef(refs, v.Recipe.Steps[i].StepImages[j].Image)
+			}
+		}
+		for i := range v.Recipe.DependentRecipes {
+			v.Recipe.DependentRecipes[i].DependentRecipe = result.Recipes[v.Recipe.DependentRecipes[i].DependentRecipe]
+		}
+
+		err := v.BindModel(userID)
+		if err == nil {
+			err = recipes.SaveRecipe(&v.Model)
+		}
+		if err != nil {
+			undo()
+			return result, fmt.Errorf("%s: %v", recipe.file, err)
+		}
+
+		newID := v.Model.ID
+		result.Recipes[recipe.id] = newID
+		created = append(created, func() {
+			recipes.DeleteRecipe(strconv.Itoa(int(newID)), userID, 0)
+		})
+	}
+
+	for _, cookbook := range cookbookList {
+		v := cookbook.validator
+		remapCookbook(v, refs, result.Recipes)
+
+		err := v.BindModel(userID)
+		if err == nil {
+			err = cookbooks.CreateCookbook(&v.Model)
+		}
+		if err != nil {
+			undo()
+			return result, fmt.Errorf("%s: %v", cookbook.file, err)
+		}
+
+		newID := v.Model.ID
+		result.Cookbooks[cookbook.id] = newID
+		created = append(created, func() {
+			cookbooks.DeleteCookbook(strconv.Itoa(int(newID)), userID, 0)
+		})
+	}
+
+	return result, nil
+}
+
+// recipeValidator reads an exported recipe back in the shape RecipeCreate accepts.
+// Dependencies keep their ids from the archive until they are remapped.
+func recipeValidator(recipe *recipes.RecipeResponse) *recipes.RecipeValidator {
+	v := recipes.NewRecipeValidator()
+	v.Recipe.Name = recipe.Name
+	v.Recipe.Image = recipe.Image
+	v.Recipe.Description = recipe.Description
+	v.Recipe.PrepTime = recipe.PrepTime
+	v.Recipe.Servings = recipe.Servings
+	v.Recipe.Tags = make([]string, 0)
+	v.Recipe.Tags = append(v.Recipe.Tags, recipe.Tags...)
+
+	v.Recipe.DependentRecipes = make([]recipes.RecipeDependencyValidator, 0)
+	for _, dependency := range recipe.DependentRecipes {
+		v.Recipe.DependentRecipes = append(v.Recipe.DependentRecipes, recipes.RecipeDependencyValidator{
+			DependentRecipe: dependency.DependentRecipe,
+			Qty:             dependency.Qty,
+		})
+	}
+
+	v.Recipe.IngredientGroups = make([]recipes.IngredientGroupValidator, 0)
+	for _, group := range recipe.IngredientGroups {
+		groupValidator := recipes.IngredientGroupValidator{
+			GroupName:   group.GroupName,
+			Ingredients: make([]recipes.IngredientValidator, 0),
+		}
+		for _, ingredient := range group.Ingredients {
+			groupValidator.Ingredients = append(groupValidator.Ingredients, recipes.IngredientValidator{
+				Name: ingredient.Name,
+				Qty:  ingredient.Qty,
+				Unit: ingredient.Unit,
+			})
+		}
+		v.Recipe.IngredientGroups = append(v.Recipe.IngredientGroups, groupValidator)
+	}
+
+	v.Recipe.Steps = make([]recipes.StepValidator, 0)
+	for _, step := range recipe.Steps {
+		stepValidator := recipes.StepValidator{
+			Type:       step.Type,
+			Text:       step.Text,
+			StepImages: make([]recipes.StepImageValidator, 0),
+		}
+		for _, stepImage := range step.StepImages {
+			stepValidator.StepImages = append(stepValidator.StepImages, recipes.StepImageValidator{
+				Image: stepImage.Image,
+				Text:  stepImage.Text,
+			})
+		}
+		v.Recipe.Steps = append(v.Recipe.Steps, stepValidator)
+	}
+
+	return v
+}
+
+// dependencyOrder puts each recipe after the recipes it depends on, they have to
+// exist before a recipe can depend on them.
+func dependencyOrder(recipeList []*importedRecipe, recipesByID map[uint]*importedRecipe) ([]*importedRecipe, error) {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[uint]int)
+	var order []*importedRecipe
+
+	var visit func(recipe *importedRecipe) error
+	visit = func(recipe *importedRecipe) error {
+		switch state[recipe.id] {
+		case done:
+			return nil
+		case visiting:
+			return fmt.Errorf("%s: recipe %d is part of a dependency cycle", recipe.file, recipe.id)
+		}
+		state[recipe.id] = visiting
+		for _, dependency := range recipe.validator.Recipe.DependentRecipes {
+			if err := visit(recipesByID[dependency.DependentRecipe]); err != nil {
+				return err
+			}
+		}
+		state[recipe.id] = done
+		order = append(order, recipe)
+		return nil
+	}
+
+	for _, recipe := range recipeList {
+		if err := visit(recipe); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// cookbookValidator reads an exported cookbook back in the shape CookbookCreate accepts.
+// A recipe page whose recipe isn't in the archive, because it was deleted after
+// being added, is left out.
+func cookbookValidator(cookbook *cookbooks.CookbookResponse, recipesByID map[uint]*importedRecipe, file string, warnings *[]string) *cookbooks.CookbookValidator {
+	v := cookbooks.NewCookbookValidator()
+	v.Cookbook.Title = cookbook.Title
+	v.Cookbook.SubTitle = cookbook.SubTitle
+	v.Cookbook.Blurb = cookbook.Blurb
+	v.Cookbook.Image = cookbook.Image
+	v.Cookbook.Sections = make([]cookbooks.SectionValidator, 0)
+
+	for _, section := range cookbook.Sections {
+		sectionValidator := cookbooks.SectionValidator{
+			Name:     section.Name,
+			Overview: section.Overview,
+			Pages:    make([]cookbooks.PageValidator, 0),
+		}
+
+		pages := section.Pages
+		if len(pages) == 0 {
+			//a section from before pages is its list of recipe ids
+			for _, recipeID := range section.Recipes {
+				pages = append(pages, cookbooks.PageValidator{
+					Type:    cookbooks.PageRecipe,
+					Content: &cookbooks.RecipePage{RecipeID: uint(recipeID)},
+				})
+			}
+		}
+
+		for _, page := range pages {
+			if recipePage, ok := page.Content.(*cookbooks.RecipePage); ok {
+				if _, exists := recipesByID[recipePage.RecipeID]; !exists {
+					*warnings = append(*warnings, fmt.Sprintf("%s: page for recipe %d left out of %q, it isn't in the archive", file, recipePage.RecipeID, section.Name))
+					continue
+				}
+			}
+			page.ID = 0
+			sectionValidator.Pages = append(sectionValidator.Pages, page)
+		}
+		v.Cookbook.Sections = append(v.Cookbook.Sections, sectionValidator)
+	}
+
+	return v
+}
+
+// remapCookbook points the cookbook's recipe pages, and so its sections' recipes, at
+// the recipes created from the archive and its images at the uploaded copies.
+func remapCookbook(v *cookbooks.CookbookValidator, refs map[string]string, recipeIDs map[uint]uint) {
+	v.Cookbook.Image = remapRef(refs, v.Cookbook.Image)
+	for _, section := range v.Cookbook.Sections {
+		for _, page := range section.Pages {
+			switch content := page.Content.(type) {
+			case *cookbooks.RecipePage:
+				content.RecipeID = recipeIDs[content.RecipeID]
+			case *cookbooks.IntroPage:
+				content.Image = remapRef(refs, content.Image)
+			case *cookbooks.PhotoSpreadPage:
+				for i := range content.Photos {
+					content.Photos[i].Src = remapRef(refs, content.Photos[i].Src)
+				}
+			}
+		}
+	}
+}
+
+func remapRef(refs map[string]string, ref string) string {
+	if newRef, ok := refs[ref]; ok {
+		return newRef
+	}
+	return ref
+}
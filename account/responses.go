@@ -0,0 +1,48 @@
+package account
+
+import (
+	"sort"
+)
+
+// ImportResponse maps the ids in the archive onto the ids of the recipes and cookbooks
+// created from them, for clients holding on to the old ids.
+type ImportResponse struct {
+	Recipes   []IDMapping `json:"recipes"`
+	Cookbooks []IDMapping `json:"cookbooks"`
+	Images    int         `json:"images"`
+}
+
+type IDMapping struct {
+	From uint `json:"from"`
+	To   uint `json:"to"`
+}
+
+func (r *ImportResponse) SerializeImport(result *ImportResult) {
+	r.Recipes = serializeIDs(result.Recipes)
+	r.Cookbooks = serializeIDs(result.Cookbooks)
+	r.Images = result.Images
+}
+
+func serializeIDs(ids map[uint]uint) []IDMapping {
+	mappings := make([]IDMapping, 0)
+	for from, to := range ids {
+		mappings = append(mappings, IDMapping{From: from, To: to})
+	}
+	sort.Slice(mappings, func(i, j int) bool { return mappings[i].From < mappings[j].From })
+	return mappings
+}
+
+// UploadResponse tells the client where the next part of an upload starts and how large parts and archives may be.
+type UploadResponse struct {
+	ID       string `json:"id"`
+	Size     int64  `json:"size"`
+	MaxSize  int64  `json:"maxSize"`
+	PartSize int    `json:"partSize"`
+}
+
+func (r *UploadResponse) SerializeUpload(upload *Upload) {
+	r.ID = upload.ID
+	r.Size = upload.Size
+	r.MaxSize = MaxArchiveSize
+	r.PartSize = MaxUploadPart
+}
@@ -0,0 +1,157 @@
+package account
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+/**
+Archives larger than a request body may be are uploaded in parts. Each part is
+written to a file in the temp directory at the offset it was sent for, and the
+finished file is imported from disk, so no more than one part is held in memory.
+*/
+
+// MaxUploadPart is the most one part may hold, the same as any other request body.
+const MaxUploadPart = 4 << 20
+
+// uploadExpiry is how long an upload may sit untouched before it's removed.
+const uploadExpiry = 24 * time.Hour
+
+var (
+	ErrUploadNotFound   = errors.New("upload not found")
+	ErrArchiveTooLarge  = fmt.Errorf("archives of up to %d MB can be imported", MaxArchiveSize>>20)
+	ErrUploadPartTooBig = fmt.Errorf("parts of up to %d MB can be uploaded", MaxUploadPart>>20)
+)
+
+// UploadOffsetError is returned for a part sent for anywhere but the end of the
+// upload. Size is how much has been received, where the next part should start.
+type UploadOffsetError struct {
+	Size int64
+}
+
+func (e *UploadOffsetError) Error() string {
+	return fmt.Sprintf("the next part starts at byte %d", e.Size)
+}
+
+type Upload struct {
+	ID   string
+	Size int64
+}
+
+var uploadIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// uploadPath is where the user's upload is kept, the user is part of the name so
+// nobody else can add to it or import it.
+func uploadPath(userID uint, uploadID string) (string, error) {
+	if !uploadIDPattern.MatchString(uploadID) {
+		return "", ErrUploadNotFound
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("savorbook-upload-%d-%s.zip", userID, uploadID)), nil
+}
+
+// StartUpload creates an empty upload for the user, clearing out uploads which were abandoned.
+func StartUpload(userID uint) (Upload, error) {
+	removeExpiredUploads(time.Now().Add(-uploadExpiry))
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return Upload{}, err
+	}
+	upload := Upload{ID: hex.EncodeToString(id)}
+
+	path, err := uploadPath(userID, upload.ID)
+	if err != nil {
+		return upload, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return upload, err
+	}
+	return upload, file.Close()
+}
+
+// AppendUpload writes part at offset, which has to be the end of what's been
+// received so far. Resending the last part after a lost response is harmless: it
+// fails with an UploadOffsetError giving the size to carry on from.
+func AppendUpload(userID uint, uploadID string, offset int64, part []byte) (Upload, error) {
+	upload := Upload{ID: uploadID}
+	if len(part) > MaxUploadPart {
+		return upload, ErrUploadPartTooBig
+	}
+
+	path, err := uploadPath(userID, uploadID)
+	if err != nil {
+		return upload, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY, 0600)
+	if os.IsNotExist(err) {
+		return upload, ErrUploadNotFound
+	}
+	if err != nil {
+		return upload, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return upload, err
+	}
+	upload.Size = info.Size()
+	if offset != upload.Size {
+		return upload, &UploadOffsetError{Size: upload.Size}
+	}
+	if upload.Size+int64(len(part)) > MaxArchiveSize {
+		return upload, ErrArchiveTooLarge
+	}
+
+	written, err := file.WriteAt(part, offset)
+	upload.Size += int64(written)
+	return upload, err
+}
+
+// FinishUpload imports the uploaded archive, see Import. The upload is removed
+// whether or not it imports, a broken archive has to be uploaded again.
+func FinishUpload(ctx context.Context, userID uint, uploadID string) (ImportResult, error) {
+	path, err := uploadPath(userID, uploadID)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return ImportResult{}, ErrUploadNotFound
+	}
+	defer os.Remove(path)
+
+	return Import(ctx, userID, path)
+}
+
+// CancelUpload removes an upload which won't be finished.
+func CancelUpload(userID uint, uploadID string) error {
+	path, err := uploadPath(userID, uploadID)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if os.IsNotExist(err) {
+		return ErrUploadNotFound
+	}
+	return err
+}
+
+func removeExpiredUploads(cutoff time.Time) {
+	paths, err := filepath.Glob(filepath.Join(os.TempDir(), "savorbook-upload-*.zip"))
+	if err != nil {
+		return
+	}
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil && info.ModTime().Before(cutoff) {
+			os.Remove(path)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package account
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// useTempDir points the uploads at a directory of the test's own.
+func useTempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "uploads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := os.Getenv("TMPDIR")
+	os.Setenv("TMPDIR", dir)
+	t.Cleanup(func() {
+		os.Setenv("TMPDIR", previous)
+		os.RemoveAll(dir)
+	})
+	return dir
+}
+
+func TestUploadParts(t *testing.T) {
+	useTempDir(t)
+
+	upload, err := StartUpload(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := [][]byte{bytes.Repeat([]byte("a"), MaxUploadPart), []byte("bcd")}
+	var offset int64
+	for _, part := range parts {
+		appended, err := AppendUpload(3, upload.ID, offset, part)
+		if err != nil {
+			t.Fatalf("AppendUpload at %d: %v", offset, err)
+		}
+		offset += int64(len(part))
+		if appended.Size != offset {
+			t.Fatalf("size: got %d, want %d", appended.Size, offset)
+		}
+	}
+
+	//the last part sent again, as after a lost response
+	_, err = AppendUpload(3, upload.ID, offset-3, []byte("bcd"))
+	var offsetErr *UploadOffsetError
+	if !errors.As(err, &offsetErr) || offsetErr.Size != offset {
+		t.Fatalf("resent part: got %v, want the size %d", err, offset)
+	}
+
+	path, _ := uploadPath(3, upload.ID)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, bytes.Join(parts, nil)) {
+		t.Errorf("the upload holds %d bytes, not the parts sent", len(data))
+	}
+
+	if _, err := AppendUpload(3, upload.ID, offset, make([]byte, MaxUploadPart+1)); !errors.Is(err, ErrUploadPartTooBig) {
+		t.Errorf("oversized part: got %v", err)
+	}
+
+	if err := CancelUpload(3, upload.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("cancelled upload is still there")
+	}
+}
+
+func TestUploadBelongsToUser(t *testing.T) {
+	useTempDir(t)
+
+	upload, err := StartUpload(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AppendUpload(4, upload.ID, 0, []byte("zip")); !errors.Is(err, ErrUploadNotFound) {
+		t.Errorf("another user's upload: got %v", err)
+	}
+	if err := CancelUpload(4, upload.ID); !errors.Is(err, ErrUploadNotFound) {
+		t.Errorf("cancelling another user's upload: got %v", err)
+	}
+	for _, id := range []string{"", "../../etc/passwd", upload.ID + "0"} {
+		if _, err := AppendUpload(3, id, 0, []byte("zip")); !errors.Is(err, ErrUploadNotFound) {
+			t.Errorf("upload %q: got %v", id, err)
+		}
+	}
+}
+
+func TestUploadTooLarge(t *testing.T) {
+	useTempDir(t)
+
+	upload, err := StartUpload(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, _ := uploadPath(3, upload.ID)
+	if err := os.Truncate(path, MaxArchiveSize-1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AppendUpload(3, upload.ID, MaxArchiveSize-1, []byte("ab")); !errors.Is(err, ErrArchiveTooLarge) {
+		t.Errorf("past the archive limit: got %v", err)
+	}
+}
+
+func TestStartUploadRemovesExpired(t *testing.T) {
+	dir := useTempDir(t)
+
+	abandoned := filepath.Join(dir, "savorbook-upload-3-"+string(bytes.Repeat([]byte("0"), 32))+".zip")
+	if err := ioutil.WriteFile(abandoned, []byte("zip"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-uploadExpiry - time.Hour)
+	if err := os.Chtimes(abandoned, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := StartUpload(3); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(abandoned); !os.IsNotExist(err) {
+		t.Errorf("abandoned upload was not removed")
+	}
+}
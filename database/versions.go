@@ -0,0 +1,39 @@
+package database
+
+import (
+	"errors"
+	"gorm.io/gorm"
+)
+
+var ErrVersionConflict = errors.New("this has been changed since it was loaded")
+
+// BumpVersion moves a row on to its next version, but only while it is still at
+// the version the caller loaded, which is what stops two devices from silently
+// overwriting each other. An expected version of 0 skips the check. Run it first
+// in a transaction; the update also locks the row until the transaction ends.
+func BumpVersion(tx *gorm.DB, model interface{}, id uint, expected int) (int, error) {
+	query := tx.Model(model).Where("id = ?", id)
+	if expected != 0 {
+		query = query.Where("version = ?", expected)
+	}
+
+	result := query.UpdateColumn("version", gorm.Expr("version + 1"))
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if result.RowsAffected == 0 {
+		if expected != 0 {
+			return 0, ErrVersionConflict
+		}
+		return 0, gorm.ErrRecordNotFound
+	}
+
+	var versions []int
+	if err := tx.Model(model).Where("id = ?", id).Pluck("version", &versions).Error; err != nil {
+		return 0, err
+	}
+	if len(versions) == 0 {
+		return 0, gorm.ErrRecordNotFound
+	}
+	return versions[0], nil
+}
@@ -0,0 +1,304 @@
+// Package epub writes EPUB 3 books from XHTML documents and the files they use,
+// generating the package document and navigation around them. It knows nothing
+// about cookbooks.
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	MimeType       = "application/epub+zip"
+	XHTMLMediaType = "application/xhtml+xml"
+	CSSMediaType   = "text/css"
+
+	//every file of the book other than the container lives under root
+	root        = "OEBPS"
+	packagePath = root + "/content.opf"
+	navPath     = "nav.xhtml"
+)
+
+// Book is built up file by file and written out once, with WriteTo. Hrefs are
+// relative to the book's root, like text/chapter-1.xhtml or images/cover.jpg.
+type Book struct {
+	Identifier string
+	Title      string
+	Language   string
+	Author     string
+	Modified   time.Time
+	//Stylesheet is linked from the generated navigation document, if set
+	Stylesheet string
+
+	files     []file
+	hrefs     map[string]bool
+	spine     []string
+	toc       []NavItem
+	index     []NavItem
+	indexName string
+	landmarks []Landmark
+}
+
+type file struct {
+	id         string
+	href       string
+	mediaType  string
+	properties string
+	data       []byte
+}
+
+// NavItem is an entry of the table of contents or of an index.
+type NavItem struct {
+	Title    string
+	Href     string
+	Children []NavItem
+}
+
+// Landmark points reading systems at a structural part of the book, Type being an
+// epub:type such as cover, toc or bodymatter.
+type Landmark struct {
+	Type  string
+	Title string
+	Href  string
+}
+
+func New(identifier string, title string) *Book {
+	return &Book{
+		Identifier: identifier,
+		Title:      title,
+		Language:   "en",
+		Modified:   time.Now(),
+		hrefs:      make(map[string]bool),
+	}
+}
+
+// AddFile adds a file the book's documents use, like an image or a stylesheet.
+// Adding the same href again is ignored.
+func (b *Book) AddFile(href string, mediaType string, data []byte) {
+	b.add(href, mediaType, "", data)
+}
+
+// AddCoverImage adds the image reading systems show for the book in their library.
+func (b *Book) AddCoverImage(href string, mediaType string, data []byte) {
+	b.add(href, mediaType, "cover-image", data)
+}
+
+// AddDocument adds an XHTML document to the end of the reading order.
+func (b *Book) AddDocument(href string, data []byte) {
+	if b.add(href, XHTMLMediaType, "", data) {
+		b.spine = append(b.spine, b.files[len(b.files)-1].id)
+	}
+}
+
+// AddNav adds the navigation document, which is generated from the table of
+// contents, index and landmarks, to the reading order at this point. Without
+// it, it's still in the book but left out of the reading order.
+func (b *Book) AddNav() {
+	b.spine = append(b.spine, "nav")
+}
+
+func (b *Book) SetTOC(items []NavItem) {
+	b.toc = items
+}
+
+// SetIndex adds an index, under the given heading, to the navigation document.
+func (b *Book) SetIndex(heading string, items []NavItem) {
+	b.indexName = heading
+	b.index = items
+}
+
+func (b *Book) SetLandmarks(landmarks []Landmark) {
+	b.landmarks = landmarks
+}
+
+func (b *Book) add(href string, mediaType string, properties string, data []byte) bool {
+	if b.hrefs[href] || href == navPath {
+		return false
+	}
+	b.hrefs[href] = true
+	b.files = append(b.files, file{
+		id:         fmt.Sprintf("item-%d", len(b.files)+1),
+		href:       href,
+		mediaType:  mediaType,
+		properties: properties,
+		data:       data,
+	})
+	return true
+}
+
+// WriteTo writes the book as an EPUB container.
+func (b *Book) WriteTo(w io.Writer) (int64, error) {
+	out := &counter{w: w}
+	archive := zip.NewWriter(out)
+
+	//the mimetype must come first and uncompressed, so it can be sniffed at a fixed offset
+	mimetype, err := archive.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return out.n, err
+	}
+	if _, err := mimetype.Write([]byte(MimeType)); err != nil {
+		return out.n, err
+	}
+
+	nav, err := b.navDocument()
+	if err != nil {
+		return out.n, err
+	}
+	opf, err := b.packageDocument()
+	if err != nil {
+		return out.n, err
+	}
+
+	entries := []struct {
+		name string
+		data []byte
+	}{
+		{"META-INF/container.xml", []byte(containerDocument)},
+		{packagePath, opf},
+		{path.Join(root, navPath), nav},
+	}
+	for _, f := range b.files {
+		entries = append(entries, struct {
+			name string
+			data []byte
+		}{path.Join(root, f.href), f.data})
+	}
+	for _, entry := range entries {
+		writer, err := archive.Create(entry.name)
+		if err != nil {
+			return out.n, err
+		}
+		if _, err := writer.Write(entry.data); err != nil {
+			return out.n, err
+		}
+	}
+
+	err = archive.Close()
+	return out.n, err
+}
+
+const containerDocument = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="` + packagePath + `" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`
+
+func (b *Book) packageDocument() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	buf.WriteString(`<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id">` + "\n")
+	buf.WriteString(`  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">` + "\n")
+	fmt.Fprintf(&buf, "    <dc:identifier id=\"book-id\">%s</dc:identifier>\n", escape(b.Identifier))
+	fmt.Fprintf(&buf, "    <dc:title>%s</dc:title>\n", escape(b.Title))
+	fmt.Fprintf(&buf, "    <dc:language>%s</dc:language>\n", escape(b.Language))
+	if b.Author != "" {
+		fmt.Fprintf(&buf, "    <dc:creator>%s</dc:creator>\n", escape(b.Author))
+	}
+	fmt.Fprintf(&buf, "    <meta property=\"dcterms:modified\">%s</meta>\n", b.Modified.UTC().Format(modifiedFormat))
+	buf.WriteString("  </metadata>\n  <manifest>\n")
+	fmt.Fprintf(&buf, "    <item id=\"nav\" href=\"%s\" media-type=\"%s\" properties=\"nav\"/>\n", navPath, XHTMLMediaType)
+	for _, f := range b.files {
+		properties := ""
+		if f.properties != "" {
+			properties = fmt.Sprintf(" properties=\"%s\"", f.properties)
+		}
+		fmt.Fprintf(&buf, "    <item id=\"%s\" href=\"%s\" media-type=\"%s\"%s/>\n", f.id, escape(f.href), f.mediaType, properties)
+	}
+	buf.WriteString("  </manifest>\n  <spine>\n")
+	for _, id := range b.spine {
+		fmt.Fprintf(&buf, "    <itemref idref=\"%s\"/>\n", id)
+	}
+	buf.WriteString("  </spine>\n</package>\n")
+	return buf.Bytes(), nil
+}
+
+const modifiedFormat = "2006-01-02T15:04:05Z"
+
+func (b *Book) navDocument() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	buf.WriteString(`<!DOCTYPE html>` + "\n")
+	fmt.Fprintf(&buf, "<html xmlns=\"http://www.w3.org/1999/xhtml\" xmlns:epub=\"http://www.idpf.org/2007/ops\" xml:lang=\"%s\" lang=\"%s\">\n", escape(b.Language), escape(b.Language))
+	fmt.Fprintf(&buf, "<head>\n<meta charset=\"utf-8\"/>\n<title>%s</title>\n", escape(b.Title))
+	if b.Stylesheet != "" {
+		fmt.Fprintf(&buf, "<link rel=\"stylesheet\" type=\"text/css\" href=\"%s\"/>\n", escape(b.Stylesheet))
+	}
+	buf.WriteString("</head>\n<body>\n")
+
+	//a list can't be empty, a book with nothing to list lists its first document
+	toc := b.toc
+	if len(toc) == 0 {
+		for _, f := range b.files {
+			if f.mediaType == XHTMLMediaType {
+				toc = []NavItem{{Title: b.Title, Href: f.href}}
+				break
+			}
+		}
+	}
+	buf.WriteString("<nav epub:type=\"toc\" id=\"toc\">\n<h1>Contents</h1>\n")
+	navList(&buf, toc)
+	buf.WriteString("</nav>\n")
+
+	if len(b.index) > 0 {
+		fmt.Fprintf(&buf, "<nav epub:type=\"index\" id=\"index\">\n<h1>%s</h1>\n", escape(b.indexName))
+		navList(&buf, b.index)
+		buf.WriteString("</nav>\n")
+	}
+
+	if len(b.landmarks) > 0 {
+		buf.WriteString("<nav epub:type=\"landmarks\" id=\"landmarks\" hidden=\"hidden\">\n<ol>\n")
+		for _, landmark := range b.landmarks {
+			fmt.Fprintf(&buf, "<li><a epub:type=\"%s\" href=\"%s\">%s</a></li>\n", escape(landmark.Type), escape(landmark.Href), escape(landmark.Title))
+		}
+		buf.WriteString("</ol>\n</nav>\n")
+	}
+
+	buf.WriteString("</body>\n</html>\n")
+	return buf.Bytes(), nil
+}
+
+// navList writes items as the nested ordered lists navigation documents are made of.
+func navList(buf *bytes.Buffer, items []NavItem) {
+	buf.WriteString("<ol>\n")
+	for _, item := range items {
+		fmt.Fprintf(buf, "<li><a href=\"%s\">%s</a>", escape(item.Href), escape(item.Title))
+		if len(item.Children) > 0 {
+			buf.WriteString("\n")
+			navList(buf, item.Children)
+		}
+		buf.WriteString("</li>\n")
+	}
+	buf.WriteString("</ol>\n")
+}
+
+// escape makes text safe to use in XML, dropping the characters XML can't hold at all.
+func escape(text string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(strings.Map(func(r rune) rune {
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' || r == 0xfffe || r == 0xffff {
+			return -1
+		}
+		return r
+	}, text)))
+	return buf.String()
+}
+
+// counter tracks how much has been written.
+type counter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *counter) Write(data []byte) (int, error) {
+	n, err := c.w.Write(data)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,376 @@
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	xhtmlNamespace = "http://www.w3.org/1999/xhtml"
+	opsNamespace   = "http://www.idpf.org/2007/ops"
+)
+
+type containerXML struct {
+	Rootfiles []struct {
+		FullPath  string `xml:"full-path,attr"`
+		MediaType string `xml:"media-type,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+type packageXML struct {
+	Version          string `xml:"version,attr"`
+	UniqueIdentifier string `xml:"unique-identifier,attr"`
+	Metadata         struct {
+		Identifiers []struct {
+			ID    string `xml:"id,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"identifier"`
+		Titles    []string `xml:"title"`
+		Languages []string `xml:"language"`
+		Metas     []struct {
+			Property string `xml:"property,attr"`
+			Value    string `xml:",chardata"`
+		} `xml:"meta"`
+	} `xml:"metadata"`
+	Items []struct {
+		ID         string `xml:"id,attr"`
+		Href       string `xml:"href,attr"`
+		MediaType  string `xml:"media-type,attr"`
+		Properties string `xml:"properties,attr"`
+	} `xml:"manifest>item"`
+	Itemrefs []struct {
+		IDRef string `xml:"idref,attr"`
+	} `xml:"spine>itemref"`
+}
+
+// link is a reference from one of the book's documents to another file of the book.
+type link struct {
+	from     string
+	target   string
+	fragment string
+}
+
+// Validate checks a book's structure the way epubcheck does: the container, the
+// package document, the manifest against what's in the archive, the reading order,
+// that every document is well formed XHTML and that links between them resolve.
+// Every problem found is returned. Books are checked with it in tests, not as
+// they are exported.
+func Validate(data []byte) ([]string, error) {
+	var problems []string
+	report := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return []string{"not a zip archive"}, err
+	}
+	files := make(map[string]*zip.File)
+	for _, f := range archive.File {
+		files[f.Name] = f
+	}
+
+	checkMimetype(data, archive, report)
+
+	var container containerXML
+	if err := readXML(files, "META-INF/container.xml", &container); err != nil {
+		report("META-INF/container.xml: %v", err)
+		return problems, fmt.Errorf("invalid epub")
+	}
+	if len(container.Rootfiles) == 0 || container.Rootfiles[0].MediaType != "application/oebps-package+xml" {
+		report("META-INF/container.xml: no package document listed")
+		return problems, fmt.Errorf("invalid epub")
+	}
+	opfPath := container.Rootfiles[0].FullPath
+
+	var opf packageXML
+	if err := readXML(files, opfPath, &opf); err != nil {
+		report("%s: %v", opfPath, err)
+		return problems, fmt.Errorf("invalid epub")
+	}
+	checkMetadata(opfPath, &opf, report)
+
+	//manifest, by id, and every file it declares, by its path in the archive
+	items := make(map[string]string)
+	declared := make(map[string]string)
+	navs, covers := 0, 0
+	for _, item := range opf.Items {
+		if _, duplicate := items[item.ID]; duplicate || item.ID == "" {
+			report("%s: manifest id %q is missing or not unique", opfPath, item.ID)
+		}
+		name, err := resolve(opfPath, item.Href)
+		if err != nil {
+			report("%s: manifest href %q is not a relative path", opfPath, item.Href)
+			continue
+		}
+		if files[name] == nil {
+			report("%s: manifest item %s is not in the archive", opfPath, name)
+		}
+		if _, duplicate := declared[name]; duplicate {
+			report("%s: %s is declared more than once", opfPath, name)
+		}
+		items[item.ID] = name
+		declared[name] = item.MediaType
+
+		properties := strings.Fields(item.Properties)
+		for _, property := range properties {
+			switch property {
+			case "nav":
+				navs++
+				if item.MediaType != XHTMLMediaType {
+					report("%s: the navigation document must be XHTML", opfPath)
+				}
+			case "cover-image":
+				covers++
+			}
+		}
+	}
+	if navs != 1 {
+		report("%s: there must be exactly one navigation document, found %d", opfPath, navs)
+	}
+	if covers > 1 {
+		report("%s: more than one cover image", opfPath)
+	}
+	for _, f := range archive.File {
+		if f.Name == "mimetype" || f.Name == opfPath || strings.HasPrefix(f.Name, "META-INF/") || strings.HasSuffix(f.Name, "/") {
+			continue
+		}
+		if _, ok := declared[f.Name]; !ok {
+			report("%s is in the archive but not in the manifest", f.Name)
+		}
+	}
+
+	if len(opf.Itemrefs) == 0 {
+		report("%s: the spine is empty", opfPath)
+	}
+	inSpine := make(map[string]bool)
+	for _, itemref := range opf.Itemrefs {
+		name, ok := items[itemref.IDRef]
+		switch {
+		case !ok:
+			report("%s: spine item %q is not in the manifest", opfPath, itemref.IDRef)
+		case inSpine[itemref.IDRef]:
+			report("%s: spine item %q is listed more than once", opfPath, itemref.IDRef)
+		case declared[name] != XHTMLMediaType:
+			report("%s: spine item %q is not an XHTML document", opfPath, itemref.IDRef)
+		}
+		inSpine[itemref.IDRef] = true
+	}
+
+	//every XHTML document parses, and what it links to exists
+	ids := make(map[string]map[string]bool)
+	var links []link
+	foundTOC := false
+	for _, item := range opf.Items {
+		name := items[item.ID]
+		if item.MediaType != XHTMLMediaType || files[name] == nil {
+			continue
+		}
+		documentIDs, documentLinks, toc, err := readXHTML(files[name], name)
+		if err != nil {
+			report("%s: %v", name, err)
+			continue
+		}
+		ids[name] = documentIDs
+		links = append(links, documentLinks...)
+		if strings.Contains(" "+item.Properties+" ", " nav ") {
+			foundTOC = toc
+		}
+	}
+	if navs == 1 && !foundTOC {
+		report("the navigation document has no table of contents, or it's empty")
+	}
+	for _, l := range links {
+		if _, ok := declared[l.target]; !ok {
+			report("%s: links to %s, which is not in the manifest", l.from, l.target)
+			continue
+		}
+		if l.fragment != "" && ids[l.target] != nil && !ids[l.target][l.fragment] {
+			report("%s: links to %s#%s, which has no such id", l.from, l.target, l.fragment)
+		}
+	}
+
+	if len(problems) > 0 {
+		return problems, fmt.Errorf("invalid epub")
+	}
+	return problems, nil
+}
+
+// checkMimetype checks the mimetype file comes first, uncompressed and with no extra
+// field, so that the type can be read straight from the start of the archive.
+func checkMimetype(data []byte, archive *zip.Reader, report func(string, ...interface{})) {
+	if len(archive.File) == 0 || archive.File[0].Name != "mimetype" {
+		report("mimetype is not the first file in the archive")
+		return
+	}
+	first := archive.File[0]
+	if first.Method != zip.Store {
+		report("mimetype is compressed")
+	}
+	if len(data) < 30 || binary.LittleEndian.Uint16(data[28:30]) != 0 {
+		report("mimetype has an extra field")
+	}
+	contents, err := readFile(first)
+	if err != nil || string(contents) != MimeType {
+		report("mimetype does not contain %s", MimeType)
+	}
+}
+
+func checkMetadata(opfPath string, opf *packageXML, report func(string, ...interface{})) {
+	if opf.Version != "3.0" {
+		report("%s: package version is %q, not 3.0", opfPath, opf.Version)
+	}
+	identified := false
+	for _, identifier := range opf.Metadata.Identifiers {
+		if identifier.ID == opf.UniqueIdentifier && strings.TrimSpace(identifier.Value) != "" {
+			identified = true
+		}
+	}
+	if !identified {
+		report("%s: no identifier matches unique-identifier %q", opfPath, opf.UniqueIdentifier)
+	}
+	if len(opf.Metadata.Titles) == 0 || strings.TrimSpace(opf.Metadata.Titles[0]) == "" {
+		report("%s: dc:title is missing", opfPath)
+	}
+	if len(opf.Metadata.Languages) == 0 || strings.TrimSpace(opf.Metadata.Languages[0]) == "" {
+		report("%s: dc:language is missing", opfPath)
+	}
+	modified := false
+	for _, meta := range opf.Metadata.Metas {
+		if meta.Property == "dcterms:modified" {
+			_, err := time.Parse(modifiedFormat, strings.TrimSpace(meta.Value))
+			modified = err == nil
+		}
+	}
+	if !modified {
+		report("%s: dcterms:modified is missing or not in the form CCYY-MM-DDThh:mm:ssZ", opfPath)
+	}
+}
+
+// readXHTML parses a document strictly, returning the ids it defines, what it links
+// to within the book, and whether it has a table of contents with entries in it.
+func readXHTML(f *zip.File, name string) (map[string]bool, []link, bool, error) {
+	ids := make(map[string]bool)
+	var links []link
+	toc, tocEntries, inTOC := false, 0, 0
+
+	reader, err := f.Open()
+	if err != nil {
+		return nil, nil, false, err
+	}
+	defer reader.Close()
+
+	decoder := xml.NewDecoder(reader)
+	decoder.Strict = true
+	rooted, depth := false, 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, false, err
+		}
+
+		switch element := token.(type) {
+		case xml.CharData:
+			if depth == 0 && len(bytes.TrimSpace(element)) > 0 {
+				return nil, nil, false, fmt.Errorf("text outside of the root element")
+			}
+		case xml.StartElement:
+			depth++
+			if depth == 1 && rooted {
+				return nil, nil, false, fmt.Errorf("more than one root element")
+			}
+			if !rooted {
+				if element.Name.Space != xhtmlNamespace || element.Name.Local != "html" {
+					return nil, nil, false, fmt.Errorf("root element is not an XHTML html element")
+				}
+				rooted = true
+			}
+			if inTOC > 0 {
+				inTOC++
+				if element.Name.Local == "a" {
+					tocEntries++
+				}
+			}
+			for _, attr := range element.Attr {
+				switch {
+				case attr.Name.Local == "id" && attr.Name.Space == "":
+					if ids[attr.Value] {
+						return nil, nil, false, fmt.Errorf("id %q is not unique", attr.Value)
+					}
+					ids[attr.Value] = true
+				case attr.Name.Local == "type" && attr.Name.Space == opsNamespace && element.Name.Local == "nav":
+					if strings.Contains(" "+attr.Value+" ", " toc ") {
+						toc, inTOC = true, 1
+					}
+				case (attr.Name.Local == "href" || attr.Name.Local == "src") && attr.Name.Space == "":
+					if l, internal := linkTo(name, attr.Value); internal {
+						links = append(links, l)
+					}
+				}
+			}
+		case xml.EndElement:
+			depth--
+			if inTOC > 0 {
+				inTOC--
+			}
+		}
+	}
+	if !rooted {
+		return nil, nil, false, fmt.Errorf("document is empty")
+	}
+	return ids, links, toc && tocEntries > 0, nil
+}
+
+// linkTo resolves a link made from the document at name, false for links out of the book.
+func linkTo(name string, value string) (link, bool) {
+	parsed, err := url.Parse(value)
+	if err != nil || parsed.Scheme != "" || parsed.Host != "" {
+		return link{}, false
+	}
+	target := name
+	if parsed.Path != "" {
+		target = path.Join(path.Dir(name), parsed.Path)
+	}
+	return link{from: name, target: target, fragment: parsed.Fragment}, true
+}
+
+func resolve(base string, href string) (string, error) {
+	parsed, err := url.Parse(href)
+	if err != nil || parsed.Scheme != "" || parsed.Host != "" || parsed.Path == "" {
+		return "", fmt.Errorf("not a relative path")
+	}
+	return path.Join(path.Dir(base), parsed.Path), nil
+}
+
+func readXML(files map[string]*zip.File, name string, v interface{}) error {
+	f, ok := files[name]
+	if !ok {
+		return fmt.Errorf("missing")
+	}
+	data, err := readFile(f)
+	if err != nil {
+		return err
+	}
+	return xml.Unmarshal(data, v)
+}
+
+func readFile(f *zip.File) ([]byte, error) {
+	reader, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return ioutil.ReadAll(reader)
+}
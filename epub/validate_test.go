@@ -0,0 +1,191 @@
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pixel is a 1x1 png.
+var pixel = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00\x1f\x15\xc4\x89" +
+	"\x00\x00\x00\rIDATx\x9cc\xf8\xff\xff?\x00\x05\xfe\x02\xfe\xa7\x35\x81\x84\x00\x00\x00\x00IEND\xaeB`\x82")
+
+func document(title string, body string) []byte {
+	return []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="en" lang="en">
+<head>
+<meta charset="utf-8"/>
+<title>` + title + `</title>
+<link rel="stylesheet" type="text/css" href="../styles/book.css"/>
+</head>
+<body>
+` + body + `
+</body>
+</html>
+`)
+}
+
+// testBook is a small book using everything Book can write: a cover image, a
+// stylesheet, documents linking to each other, and a contents, index and landmarks.
+func testBook() *Book {
+	book := New("urn:test:book", "Test & Book")
+	book.Author = "Tester"
+	book.Modified = time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	book.Stylesheet = "styles/book.css"
+	book.AddFile("styles/book.css", CSSMediaType, []byte("body { margin: 0; }"))
+	book.AddCoverImage("images/cover.png", "image/png", pixel)
+	book.AddDocument("text/cover.xhtml", document("Cover", `<img src="../images/cover.png" alt="Cover"/>`))
+	book.AddNav()
+	book.AddDocument("text/chapter-1.xhtml", document("Chapter", `<h1>Chapter</h1>
+<p><a href="recipe-1.xhtml#recipe">Bread</a></p>`))
+	book.AddDocument("text/recipe-1.xhtml", document("Bread", `<article id="recipe"><h1>Bread</h1></article>`))
+	book.SetTOC([]NavItem{{Title: "Chapter", Href: "text/chapter-1.xhtml", Children: []NavItem{
+		{Title: "Bread", Href: "text/recipe-1.xhtml"},
+	}}})
+	book.SetIndex("Recipe Index", []NavItem{{Title: "Bread", Href: "text/recipe-1.xhtml#recipe"}})
+	book.SetLandmarks([]Landmark{
+		{Type: "cover", Title: "Cover", Href: "text/cover.xhtml"},
+		{Type: "toc", Title: "Contents", Href: "nav.xhtml#toc"},
+		{Type: "bodymatter", Title: "Start", Href: "text/chapter-1.xhtml"},
+	})
+	return book
+}
+
+func write(t *testing.T, book *Book) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if _, err := book.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	return buf.Bytes()
+}
+
+type entry struct {
+	name   string
+	method uint16
+	data   []byte
+}
+
+func readEntries(t *testing.T, data []byte) []entry {
+	t.Helper()
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []entry
+	for _, f := range archive.File {
+		reader, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents, err := ioutil.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry{name: f.Name, method: f.Method, data: contents})
+	}
+	return entries
+}
+
+func writeEntries(t *testing.T, entries []entry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	out := zip.NewWriter(&buf)
+	for _, e := range entries {
+		writer, err := out.CreateHeader(&zip.FileHeader{Name: e.name, Method: e.method})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := writer.Write(e.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// rezip copies an archive, replacing files by name or, for nil, leaving them out.
+func rezip(t *testing.T, data []byte, replace map[string][]byte) []byte {
+	t.Helper()
+	var entries []entry
+	for _, e := range readEntries(t, data) {
+		if contents, ok := replace[e.name]; ok {
+			if contents == nil {
+				continue
+			}
+			e.data = contents
+		}
+		entries = append(entries, e)
+	}
+	return writeEntries(t, entries)
+}
+
+func expectProblem(t *testing.T, data []byte, want string) {
+	t.Helper()
+	problems, err := Validate(data)
+	if err == nil {
+		t.Fatalf("Validate passed, want a problem containing %q", want)
+	}
+	for _, problem := range problems {
+		if strings.Contains(problem, want) {
+			return
+		}
+	}
+	t.Fatalf("no problem contains %q, got %q", want, problems)
+}
+
+func TestValidateBook(t *testing.T) {
+	problems, err := Validate(write(t, testBook()))
+	if err != nil || len(problems) > 0 {
+		t.Fatalf("Validate: %v %q", err, problems)
+	}
+}
+
+func TestValidateMissingTitle(t *testing.T) {
+	book := testBook()
+	book.Title = ""
+	expectProblem(t, write(t, book), "dc:title is missing")
+}
+
+func TestValidateBrokenHref(t *testing.T) {
+	book := testBook()
+	book.AddDocument("text/chapter-2.xhtml", document("Chapter 2", `<p><a href="recipe-2.xhtml">Cake</a></p>`))
+	expectProblem(t, write(t, book), "links to OEBPS/text/recipe-2.xhtml, which is not in the manifest")
+}
+
+func TestValidateBrokenFragment(t *testing.T) {
+	book := testBook()
+	book.AddDocument("text/chapter-2.xhtml", document("Chapter 2", `<p><a href="recipe-1.xhtml#method">Bread</a></p>`))
+	expectProblem(t, write(t, book), "which has no such id")
+}
+
+func TestValidateMissingNav(t *testing.T) {
+	data := rezip(t, write(t, testBook()), map[string][]byte{"OEBPS/nav.xhtml": nil})
+	expectProblem(t, data, "manifest item OEBPS/nav.xhtml is not in the archive")
+}
+
+func TestValidateMalformedDocument(t *testing.T) {
+	data := rezip(t, write(t, testBook()), map[string][]byte{
+		"OEBPS/text/recipe-1.xhtml": []byte(`<?xml version="1.0"?><html xmlns="http://www.w3.org/1999/xhtml"><body><p>Bread</body></html>`),
+	})
+	expectProblem(t, data, "OEBPS/text/recipe-1.xhtml")
+}
+
+func TestValidateUndeclaredFile(t *testing.T) {
+	entries := readEntries(t, write(t, testBook()))
+	entries = append(entries, entry{name: "OEBPS/extra.txt", method: zip.Deflate, data: []byte("extra")})
+	expectProblem(t, writeEntries(t, entries), "OEBPS/extra.txt is in the archive but not in the manifest")
+}
+
+func TestValidateMimetypeFirst(t *testing.T) {
+	entries := readEntries(t, write(t, testBook()))
+	entries = append(entries[1:], entries[0])
+	expectProblem(t, writeEntries(t, entries), "mimetype")
+}
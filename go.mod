@@ -13,9 +13,10 @@ require (
 	github.com/klauspost/compress v1.11.6 // indirect
 	github.com/lib/pq v1.3.0
 	github.com/valyala/fasthttp v1.19.0 // indirect
-	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
+	golang.org/x/crypto v0.23.0
+	golang.org/x/image v0.18.0
+	golang.org/x/net v0.25.0
 	golang.org/x/oauth2 v0.0.0-20210113205817-d3ed898aa8a3
-	golang.org/x/sys v0.0.0-20210108172913-0df2131ae363 // indirect
 	google.golang.org/api v0.32.0
 	gorm.io/driver/postgres v1.0.6
 	gorm.io/gorm v1.20.10
@@ -1,39 +1,24 @@
 package images
 
 import (
-	"cloud.google.com/go/storage"
 	"context"
-	"crypto/sha1"
-	"encoding/hex"
-	"github.com/anthonyhawkins/savorbook/database"
+	"errors"
 	"github.com/anthonyhawkins/savorbook/middleware"
 	"github.com/anthonyhawkins/savorbook/responses"
 	"github.com/gofiber/fiber/v2"
-	"google.golang.org/api/option"
-	"io"
-	"math/rand"
-	"net/url"
-	"strconv"
-	"time"
+	"gorm.io/gorm"
+	"io/ioutil"
+	"strings"
 )
 
-var (
-	storageClient *storage.Client
-)
-
-func rangeIn(low, hi int) int {
-	return low + rand.Intn(hi-low)
-}
-
 func UploadImage(c *fiber.Ctx) error {
 
 	response := new(responses.StandardResponse)
 	response.Success = false
-	db := database.GetDB()
 	userId := middleware.AuthedUserId(c.Locals("user"))
 
 	/**
-	Read in the uploaded file and generate a unqiue name
+	Read in the uploaded file
 	*/
 	fileHeader, err := c.FormFile("image")
 	if err != nil {
@@ -42,52 +27,36 @@ func UploadImage(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(response)
 	}
 
-	//generate non-sequential-image-id
-	timeStamp := strconv.FormatInt(time.Now().Unix(), 10)
-	numStamp := strconv.Itoa(rangeIn(100000000000, 999999999999))
-	h := sha1.New()
-	h.Write([]byte(timeStamp))
-	hexHash := hex.EncodeToString(h.Sum(nil))
-
-	imageName := hexHash + "-" + numStamp + ".jpg"
-
-	//TODO - validate image, resize etc.
-	// validate image type via mimeType
-	// jpg / png / gif
-	// validate image size
-	//
-
 	/**
-	Upload the image to Google Cloud Storage
+	Read the upload, validate it and build each rendition
 	*/
-	ctx := context.Background()
-	storageClient, err = storage.NewClient(ctx, option.WithCredentialsFile(".googlekey.json"))
+	file, err := fileHeader.Open()
 	if err != nil {
 		response.Message = "Unable to Upload Image"
-		//TODO respond with actual error for now
 		response.Errors = append(response.Errors, err.Error())
 		return c.Status(fiber.StatusInternalServerError).JSON(response)
 	}
-	//create new storage-writer
-	sw := storageClient.Bucket("savorbook-dev").Object(imageName).NewWriter(ctx)
-
-	//copy file into storage-write aka upload the file
-	file, err := fileHeader.Open()
 	defer file.Close()
-	if _, err := io.Copy(sw, file); err != nil {
+
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
 		response.Message = "Unable to Upload Image"
-		//TODO respond with actual error for now
 		response.Errors = append(response.Errors, err.Error())
 		return c.Status(fiber.StatusInternalServerError).JSON(response)
 	}
-	if err := sw.Close(); err != nil {
-		response.Message = "Unable to Upload Image"
-		//TODO respond with actual error for now
+
+	image, existing, err := StoreImage(context.Background(), userId, data)
+	var invalid *InvalidImageError
+	if errors.Is(err, ErrUnsupportedType) {
+		response.Message = "Unsupported Image Type"
 		response.Errors = append(response.Errors, err.Error())
-		return c.Status(fiber.StatusInternalServerError).JSON(response)
+		return c.Status(fiber.StatusUnsupportedMediaType).JSON(response)
+	}
+	if errors.As(err, &invalid) {
+		response.Message = "Invalid Image"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
 	}
-
-	resource, err := url.Parse("/" + "savorbook-dev" + "/" + sw.Attrs().Name)
 	if err != nil {
 		response.Message = "Unable to Upload Image"
 		//TODO respond with actual error for now
@@ -95,22 +64,11 @@ func UploadImage(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(response)
 	}
 
-	/**
-	Create and Save the DB entry
-	*/
-	var image = new(Image)
-	image.UserID = userId
-	image.Name = imageName
-	image.Path = resource.Path
-	image.Used = true
-
-	result := db.Create(&image)
-
-	if result.RowsAffected == 0 {
-		response.Message = "Recipe Creation Failed"
-		//TODO - Should error be bubbled up DB error to client?
-		response.Errors = append(response.Errors, result.Error.Error())
-		return c.Status(fiber.StatusBadRequest).JSON(response)
+	if existing {
+		response.Success = true
+		response.Message = "Image has already been uploaded"
+		response.Data = image
+		return c.JSON(response)
 	}
 
 	response.Success = true
@@ -118,3 +76,70 @@ func UploadImage(c *fiber.Ctx) error {
 	response.Data = image
 	return c.Status(fiber.StatusCreated).JSON(response)
 }
+
+func ImageList(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+	userID := middleware.AuthedUserId(c.Locals("user"))
+	used := strings.ToLower(c.Query("used"))
+	pageNum := strings.ToLower(c.Query("page"))
+	pageSize := strings.ToLower(c.Query("page_size"))
+
+	images, err := GetImages(userID, used, pageNum, pageSize)
+	if err != nil {
+		response.Success = true
+		response.Data = make([]Image, 0)
+		response.Message = "No Images Found"
+		response.Errors = append(response.Errors, response.Message)
+		return c.JSON(response)
+	}
+
+	response.Success = true
+	response.Data = images
+	return c.JSON(response)
+}
+
+func ImageDelete(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+
+	imageID := c.Params("id")
+	userID := middleware.AuthedUserId(c.Locals("user"))
+
+	image, err := GetImage(imageID, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response.Message = "Image Not Found"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	if err != nil {
+		response.Message = "Unable to Retrieve Image"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	if image.Used {
+		response.Message = "Unable to Delete Image."
+		response.Errors = append(response.Errors, "this image is used by a recipe or cookbook")
+		response.Data = image
+		return c.Status(fiber.StatusConflict).JSON(response)
+	}
+
+	err = image.Delete(context.Background())
+	//deleted by another request since it was loaded
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response.Message = "Image Not Found"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	if err != nil {
+		response.Message = "Unable to Delete Image."
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	response.Success = true
+	return c.JSON(response)
+}
@@ -1,15 +1,449 @@
 package images
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/anthonyhawkins/savorbook/config"
 	"github.com/anthonyhawkins/savorbook/database"
+	"github.com/anthonyhawkins/savorbook/images/storage"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"io"
+	"strings"
+	"time"
 )
 
 type Image struct {
 	database.BaseModel
-	RecipeID uint   `json:"recipeId"`
-	UserID   uint   `json:"userId"`
-	Url      string `json:"url"`
+	RecipeID    uint             `json:"recipeId"`
+	UserID      uint             `json:"userId"`
+	Url         string           `json:"url"`
+	Name        string           `json:"name"`
+	Path        string           `json:"path"`
+	MimeType    string           `json:"mimeType"`
+	Width       int              `json:"width"`
+	Height      int              `json:"height"`
+	ContentHash string           `gorm:"index" json:"contentHash"`
+	RefCount    int              `gorm:"default:1" json:"refCount"`
+	Used        bool             `json:"used"`
+	UnusedSince *time.Time       `gorm:"index" json:"unusedSince"`
+	Renditions  []ImageRendition `gorm:"foreignKey:ImageID;constraint:OnDelete:CASCADE" json:"renditions"`
+}
+
+type ImageRendition struct {
+	database.BaseModel
+	ImageID  uint   `json:"-"`
 	Name     string `json:"name"`
+	Object   string `json:"object"`
+	Url      string `json:"url"`
 	Path     string `json:"path"`
-	Used     bool   `json:"used"`
+	MimeType string `json:"mimeType"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	Size     int    `json:"size"`
+}
+
+// Rendition returns the named rendition, falling back to the full size image.
+func (image *Image) Rendition(name string) ImageRendition {
+	for _, rendition := range image.Renditions {
+		if rendition.Name == name {
+			return rendition
+		}
+	}
+	return ImageRendition{Name: name, Object: image.Name, Url: image.Url, Path: image.Path, MimeType: image.MimeType, Width: image.Width, Height: image.Height}
+}
+
+// Retain records another upload of the same content by the image's owner. It
+// returns gorm.ErrRecordNotFound when the image was deleted in the meantime.
+func (image *Image) Retain() error {
+	db := database.GetDB()
+	updates := map[string]interface{}{"ref_count": gorm.Expr("ref_count + 1")}
+
+	//give an unattached upload a fresh grace period before the sweeper collects it
+	if !image.Used {
+		now := time.Now()
+		image.UnusedSince = &now
+		updates["unused_since"] = now
+	}
+
+	result := db.Model(image).Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	//deleted since it was found
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	image.RefCount++
+	return nil
+}
+
+// CopyFor gives another user their own row pointing at this image's stored objects.
+func (image *Image) CopyFor(userID uint) Image {
+	now := time.Now()
+	copied := Image{
+		UserID:      userID,
+		Url:         image.Url,
+		Name:        image.Name,
+		Path:        image.Path,
+		MimeType:    image.MimeType,
+		Width:       image.Width,
+		Height:      image.Height,
+		ContentHash: image.ContentHash,
+		RefCount:    1,
+		Used:        false,
+		UnusedSince: &now,
+	}
+	for _, rendition := range image.Renditions {
+		rendition.ID = 0
+		rendition.ImageID = 0
+		copied.Renditions = append(copied.Renditions, rendition)
+	}
+	return copied
+}
+
+// Delete drops one reference to the image and purges it once none are left.
+func (image *Image) Delete(ctx context.Context) error {
+	db := database.GetDB()
+
+	//the decrement locks the row, so a concurrent upload can't retain an image that is going
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var refCount int
+		result := tx.Raw("UPDATE images SET ref_count = ref_count - 1 WHERE id = ? RETURNING ref_count", image.ID).Scan(&refCount)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		image.RefCount = refCount
+		if refCount > 0 {
+			return nil
+		}
+		return deleteRows(tx, image)
+	})
+	if err != nil || image.RefCount > 0 {
+		return err
+	}
+	return image.deleteObjects(ctx)
+}
+
+// Purge removes the image's rows and, when no other row shares its content,
+// every stored rendition. An image retained or released since it was loaded is
+// left alone and Purge reports false.
+func (image *Image) Purge(ctx context.Context) (bool, error) {
+	db := database.GetDB()
+	purged := false
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var current Image
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "ref_count").Where("id = ?", image.ID).First(&current).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if current.RefCount != image.RefCount {
+			return nil
+		}
+		purged = true
+		return deleteRows(tx, image)
+	})
+	if err != nil || !purged {
+		return false, err
+	}
+	return true, image.deleteObjects(ctx)
+}
+
+func deleteRows(tx *gorm.DB, image *Image) error {
+	if err := tx.Where("image_id = ?", image.ID).Delete(&ImageRendition{}).Error; err != nil {
+		return err
+	}
+	return tx.Delete(image).Error
+}
+
+// deleteObjects removes the image's stored renditions unless another row still shares its content.
+func (image *Image) deleteObjects(ctx context.Context) error {
+	if image.ContentHash != "" {
+		inUse, err := hashInUse(image.ContentHash)
+		if err != nil || inUse {
+			return err
+		}
+	}
+
+	store := storage.GetStorage()
+	objects := []string{image.Name}
+	for _, rendition := range image.Renditions {
+		if rendition.Object != image.Name {
+			objects = append(objects, rendition.Object)
+		}
+	}
+
+	for _, object := range objects {
+		if err := store.Delete(ctx, object); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+func hashInUse(contentHash string) (bool, error) {
+	db := database.GetDB()
+	var count int64
+	result := db.Model(&Image{}).Where("content_hash = ?", contentHash).Count(&count)
+	return count > 0, result.Error
+}
+
+// sharedDedupe reports whether uploads are deduplicated across users (IMAGE_DEDUPE=global) rather than per user.
+func sharedDedupe() bool {
+	return strings.ToLower(config.Get("IMAGE_DEDUPE")) == "global"
+}
+
+// FindImageByHash finds an upload with the given content, owned by userID or by anyone when userID is 0.
+func FindImageByHash(contentHash string, userID uint) (Image, error) {
+	db := database.GetDB()
+	var image Image
+
+	query := db.Where("content_hash = ?", contentHash)
+	if userID != 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	result := query.Preload("Renditions").First(&image)
+	return image, result.Error
+}
+
+func GetImage(imageID string, userID uint) (Image, error) {
+	db := database.GetDB()
+	var image Image
+
+	result := db.Where(map[string]interface{}{
+		"id":      imageID,
+		"user_id": userID,
+	}).Preload("Renditions").First(&image)
+
+	return image, result.Error
+}
+
+func GetImages(userID uint, used string, pageNum string, pageSize string) ([]Image, error) {
+	db := database.GetDB()
+	images := make([]Image, 0)
+
+	query := db.Scopes(database.Paginate(pageNum, pageSize)).Where(map[string]interface{}{
+		"user_id": userID,
+	})
+	switch used {
+	case "true":
+		query = query.Where("used = ?", true)
+	case "false":
+		query = query.Where("used = ?", false)
+	}
+
+	result := query.Order("id desc").Preload("Renditions").Find(&images)
+	return images, result.Error
+}
+
+// OpenReference opens the stored upload a recipe or cookbook reference points at,
+// for exports that need the image itself rather than a link to it. The original is
+// opened, whichever rendition ref names, as it's the largest there is.
+func OpenReference(ctx context.Context, userID uint, ref string) (io.ReadCloser, Image, error) {
+	db := database.GetDB()
+	var image Image
+
+	result := referencedBy(db, userID, []string{ref}).First(&image)
+	if result.Error != nil {
+		return nil, image, result.Error
+	}
+
+	reader, err := storage.GetStorage().Get(ctx, image.Name)
+	return reader, image, err
+}
+
+// referencedBy matches the user's images by any of the forms a reference can take.
+// Recipes, step images and cookbooks store an image's path or url, or one of its renditions'.
+func referencedBy(db *gorm.DB, userID uint, refs []string) *gorm.DB {
+	return db.Model(&Image{}).Where("user_id = ?", userID).Where(
+		db.Where("path IN ?", refs).Or("url IN ?", refs).Or(
+			"id IN (?)", db.Model(&ImageRendition{}).Select("image_id").Where("path IN ? OR url IN ?", refs, refs),
+		),
+	)
+}
+
+// LinkRecipeImages attaches the uploads a recipe references to it and releases
+// the ones it no longer references so the sweeper can collect them.
+func LinkRecipeImages(tx *gorm.DB, userID uint, recipeID uint, refs []string) error {
+	refs = nonEmpty(refs)
+
+	release := tx.Model(&Image{}).Where(map[string]interface{}{
+		"user_id":   userID,
+		"recipe_id": recipeID,
+	})
+	if len(refs) > 0 {
+		release = release.Where("id NOT IN (?)", referencedBy(tx, userID, refs).Select("id"))
+	}
+	if err := release.Updates(map[string]interface{}{
+		"recipe_id":    0,
+		"used":         false,
+		"unused_since": time.Now(),
+	}).Error; err != nil {
+		return err
+	}
+
+	if len(refs) == 0 {
+		return nil
+	}
+
+	return referencedBy(tx, userID, refs).Updates(map[string]interface{}{
+		"recipe_id":    recipeID,
+		"used":         true,
+		"unused_since": nil,
+	}).Error
+}
+
+// MarkImagesUsed keeps uploads referenced outside of recipes, i.e. cookbook covers, from being collected.
+func MarkImagesUsed(tx *gorm.DB, userID uint, refs []string) error {
+	refs = nonEmpty(refs)
+	if len(refs) == 0 {
+		return nil
+	}
+
+	return referencedBy(tx, userID, refs).Updates(map[string]interface{}{
+		"used":         true,
+		"unused_since": nil,
+	}).Error
+}
+
+// ReleaseImages marks uploads as unused. The sweeper re-checks every reference before deleting anything.
+func ReleaseImages(tx *gorm.DB, userID uint, refs []string) error {
+	refs = nonEmpty(refs)
+	if len(refs) == 0 {
+		return nil
+	}
+
+	return referencedBy(tx, userID, refs).Updates(map[string]interface{}{
+		"used":         false,
+		"unused_since": time.Now(),
+	}).Error
+}
+
+func nonEmpty(values []string) []string {
+	var filtered []string
+	for _, value := range values {
+		if value != "" {
+			filtered = append(filtered, value)
+		}
+	}
+	return filtered
+}
+
+// InvalidImageError is returned by StoreImage when the upload can't be read as an image.
+type InvalidImageError struct {
+	Err error
+}
+
+func (e *InvalidImageError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *InvalidImageError) Unwrap() error {
+	return e.Err
+}
+
+// StoreImage validates an upload, builds its renditions and stores them for the user.
+// Identical content is stored once: objects are named after the hash of the upload,
+// so uploading it again reuses the blobs already in storage. existing is true when
+// the user had already uploaded the same image and it has been retained instead.
+func StoreImage(ctx context.Context, userID uint, data []byte) (Image, bool, error) {
+	db := database.GetDB()
+	sum := sha256.Sum256(data)
+	contentHash := hex.EncodeToString(sum[:])
+
+	existing, err := FindImageByHash(contentHash, userID)
+	if err == nil {
+		err = existing.Retain()
+		//a deleted image is stored again like any new upload
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return existing, true, err
+		}
+	}
+
+	if sharedDedupe() {
+		if shared, err := FindImageByHash(contentHash, 0); err == nil {
+			image := shared.CopyFor(userID)
+			return image, false, db.Create(&image).Error
+		}
+	}
+
+	processed, err := ProcessImage(data)
+	if err != nil {
+		return Image{}, false, &InvalidImageError{Err: err}
+	}
+
+	/**
+	Upload every rendition to the configured storage backend
+	*/
+	var image Image
+	image.UserID = userID
+	image.ContentHash = contentHash
+	image.RefCount = 1
+	image.MimeType = processed.MimeType
+	image.Width = processed.Width
+	image.Height = processed.Height
+
+	store := storage.GetStorage()
+	for _, output := range processed.Renditions {
+		objectName := contentHash + "-" + output.Name + output.Extension
+		object, err := store.Put(ctx, objectName, bytes.NewReader(output.Data), output.MimeType)
+		if err != nil {
+			//the objects may already belong to another user's copy of the same content
+			if inUse, err := hashInUse(contentHash); err == nil && !inUse {
+				for _, uploaded := range image.Renditions {
+					store.Delete(ctx, uploaded.Object)
+				}
+			}
+			return image, false, err
+		}
+
+		image.Renditions = append(image.Renditions, ImageRendition{
+			Name:     output.Name,
+			Object:   object.Name,
+			Url:      object.Url,
+			Path:     object.Path,
+			MimeType: output.MimeType,
+			Width:    output.Width,
+			Height:   output.Height,
+			Size:     len(output.Data),
+		})
+	}
+
+	/**
+	Create and Save the DB entry
+	*/
+	full := image.Rendition("full")
+	image.Name = full.Object
+	image.Path = full.Path
+	image.Url = full.Url
+	//not used until a recipe or cookbook references it
+	now := time.Now()
+	image.Used = false
+	image.UnusedSince = &now
+
+	return image, false, db.Create(&image).Error
+}
+
+// FindReferencedImages loads the user's images, with their renditions, that any of refs point at.
+func FindReferencedImages(userID uint, refs []string) ([]Image, error) {
+	db := database.GetDB()
+	var images []Image
+
+	refs = nonEmpty(refs)
+	if len(refs) == 0 {
+		return images, nil
+	}
+	result := referencedBy(db, userID, refs).Preload("Renditions").Order("id").Find(&images)
+	return images, result.Error
 }
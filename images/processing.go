@@ -0,0 +1,309 @@
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"golang.org/x/image/webp"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+const (
+	MaxDimension = 8000
+	MaxPixels    = 40000000
+	jpegQuality  = 85
+)
+
+var (
+	ErrUnsupportedType = errors.New("image must be a jpeg, png, gif or webp")
+	ErrImageTooLarge   = errors.New("image dimensions are too large")
+	ErrInvalidImage    = errors.New("image could not be read")
+)
+
+type Rendition struct {
+	Name    string
+	MaxEdge int
+}
+
+// Renditions are produced for every upload, smallest first. "full" is what Image.Path points at.
+var Renditions = []Rendition{
+	{Name: "thumbnail", MaxEdge: 200},
+	{Name: "card", MaxEdge: 600},
+	{Name: "full", MaxEdge: 1600},
+}
+
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+type ProcessedImage struct {
+	MimeType   string
+	Width      int
+	Height     int
+	Renditions []ProcessedRendition
+}
+
+type ProcessedRendition struct {
+	Name      string
+	MimeType  string
+	Extension string
+	Width     int
+	Height    int
+	Data      []byte
+}
+
+// ProcessImage sniffs the real type of an upload, rejects anything that is not an
+// accepted image or is too large, and re-encodes it into each rendition. Encoding
+// from decoded pixels drops EXIF/GPS and any other metadata along the way.
+func ProcessImage(data []byte) (*ProcessedImage, error) {
+	mimeType := http.DetectContentType(data)
+	if _, ok := imageExtensions[mimeType]; !ok {
+		return nil, ErrUnsupportedType
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	if err := checkDimensions(config.Width, config.Height); err != nil {
+		return nil, err
+	}
+
+	var src image.Image
+	switch mimeType {
+	case "image/jpeg":
+		src, err = jpeg.Decode(bytes.NewReader(data))
+	case "image/png":
+		src, err = png.Decode(bytes.NewReader(data))
+	case "image/gif":
+		//only the first frame of an animated gif is kept
+		src, err = gif.Decode(bytes.NewReader(data))
+	case "image/webp":
+		src, err = webp.Decode(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+
+	if mimeType == "image/jpeg" {
+		src = applyOrientation(src, jpegOrientation(data))
+	}
+
+	processed := &ProcessedImage{
+		MimeType: mimeType,
+		Width:    src.Bounds().Dx(),
+		Height:   src.Bounds().Dy(),
+	}
+
+	for _, rendition := range Renditions {
+		resized := resize(src, rendition.MaxEdge)
+
+		var buf bytes.Buffer
+		output := ProcessedRendition{
+			Name:   rendition.Name,
+			Width:  resized.Bounds().Dx(),
+			Height: resized.Bounds().Dy(),
+		}
+
+		//jpegs stay jpegs, png, gif and webp become png so transparency survives
+		if mimeType == "image/jpeg" {
+			output.MimeType = "image/jpeg"
+			err = jpeg.Encode(&buf, resized, &jpeg.Options{Quality: jpegQuality})
+		} else {
+			output.MimeType = "image/png"
+			err = png.Encode(&buf, resized)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		output.Extension = imageExtensions[output.MimeType]
+		output.Data = buf.Bytes()
+		processed.Renditions = append(processed.Renditions, output)
+	}
+
+	return processed, nil
+}
+
+func checkDimensions(width int, height int) error {
+	if width <= 0 || height <= 0 {
+		return ErrInvalidImage
+	}
+	if width > MaxDimension || height > MaxDimension || width*height > MaxPixels {
+		return ErrImageTooLarge
+	}
+	return nil
+}
+
+// resize scales the image down so its longest edge fits maxEdge by averaging the
+// source pixels behind each destination pixel. Images are never scaled up.
+func resize(src image.Image, maxEdge int) image.Image {
+	bounds := src.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+
+	rgba := image.NewRGBA(image.Rect(0, 0, srcW, srcH))
+	draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+
+	if srcW <= maxEdge && srcH <= maxEdge {
+		return rgba
+	}
+
+	dstW, dstH := maxEdge, maxEdge
+	if srcW > srcH {
+		dstH = srcH * maxEdge / srcW
+	} else {
+		dstW = srcW * maxEdge / srcH
+	}
+	if dstW < 1 {
+		dstW = 1
+	}
+	if dstH < 1 {
+		dstH = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := 0; y < dstH; y++ {
+		y0 := y * srcH / dstH
+		y1 := (y + 1) * srcH / dstH
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < dstW; x++ {
+			x0 := x * srcW / dstW
+			x1 := (x + 1) * srcW / dstW
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, b, a, count uint32
+			for sy := y0; sy < y1; sy++ {
+				offset := rgba.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += uint32(rgba.Pix[offset])
+					g += uint32(rgba.Pix[offset+1])
+					b += uint32(rgba.Pix[offset+2])
+					a += uint32(rgba.Pix[offset+3])
+					offset += 4
+					count++
+				}
+			}
+
+			offset := dst.PixOffset(x, y)
+			dst.Pix[offset] = uint8(r / count)
+			dst.Pix[offset+1] = uint8(g / count)
+			dst.Pix[offset+2] = uint8(b / count)
+			dst.Pix[offset+3] = uint8(a / count)
+		}
+	}
+
+	return dst
+}
+
+// jpegOrientation reads the EXIF orientation tag. The tag is dropped when the
+// image is re-encoded, so the rotation it describes has to be applied first.
+func jpegOrientation(data []byte) int {
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return 1
+		}
+		marker := data[pos+1]
+		if marker == 0xDA || marker == 0xD9 {
+			return 1
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		segment := pos + 4
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			return 1
+		}
+
+		if marker == 0xE1 && end-segment > 14 && string(data[segment:segment+6]) == "Exif\x00\x00" {
+			return exifOrientation(data[segment+6 : end])
+		}
+		pos = end
+	}
+	return 1
+}
+
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			orientation := int(order.Uint16(tiff[entry+8:]))
+			if orientation < 1 || orientation > 8 {
+				return 1
+			}
+			return orientation
+		}
+	}
+	return 1
+}
+
+func applyOrientation(src image.Image, orientation int) image.Image {
+	if orientation <= 1 {
+		return src
+	}
+
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	dstW, dstH := w, h
+	if orientation >= 5 {
+		dstW, dstH = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, src.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+	return dst
+}
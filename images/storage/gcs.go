@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"cloud.google.com/go/storage"
+	"context"
+	"errors"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/option"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"time"
+)
+
+const gcsHost = "https://storage.googleapis.com"
+
+type GCSStorage struct {
+	Bucket     string
+	client     *storage.Client
+	accessID   string
+	privateKey []byte
+}
+
+func NewGCSStorage(bucket string, keyFile string) (*GCSStorage, error) {
+	ctx := context.Background()
+	client, err := storage.NewClient(ctx, option.WithCredentialsFile(keyFile))
+	if err != nil {
+		return nil, err
+	}
+
+	/**
+	Signing URLs needs the service account's email and private key which
+	the client does not expose, so read them from the key file directly.
+	*/
+	keyJSON, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	jwtConfig, err := google.JWTConfigFromJSON(keyJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GCSStorage{
+		Bucket:     bucket,
+		client:     client,
+		accessID:   jwtConfig.Email,
+		privateKey: jwtConfig.PrivateKey,
+	}, nil
+}
+
+func (s *GCSStorage) Put(ctx context.Context, name string, reader io.Reader, contentType string) (Object, error) {
+	sw := s.client.Bucket(s.Bucket).Object(name).NewWriter(ctx)
+	sw.ContentType = contentType
+
+	if _, err := io.Copy(sw, reader); err != nil {
+		sw.Close()
+		return Object{}, err
+	}
+	if err := sw.Close(); err != nil {
+		return Object{}, err
+	}
+
+	resource, err := url.Parse("/" + s.Bucket + "/" + sw.Attrs().Name)
+	if err != nil {
+		return Object{}, err
+	}
+
+	return Object{
+		Name: name,
+		Path: resource.Path,
+		Url:  gcsHost + resource.EscapedPath(),
+	}, nil
+}
+
+func (s *GCSStorage) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	reader, err := s.client.Bucket(s.Bucket).Object(name).NewReader(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, ErrNotFound
+	}
+	return reader, err
+}
+
+func (s *GCSStorage) Delete(ctx context.Context, name string) error {
+	err := s.client.Bucket(s.Bucket).Object(name).Delete(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s *GCSStorage) SignedURL(ctx context.Context, name string, expires time.Duration) (string, error) {
+	return storage.SignedURL(s.Bucket, name, &storage.SignedURLOptions{
+		GoogleAccessID: s.accessID,
+		PrivateKey:     s.privateKey,
+		Method:         "GET",
+		Expires:        time.Now().Add(expires),
+		Scheme:         storage.SigningSchemeV4,
+	})
+}
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// LocalStorage writes objects to a directory on disk. The router serves that
+// directory as a static route under Prefix, so objects are always public.
+type LocalStorage struct {
+	Dir     string
+	Prefix  string
+	BaseUrl string
+}
+
+func NewLocalStorage(dir string, prefix string, baseUrl string) (*LocalStorage, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &LocalStorage{
+		Dir:     dir,
+		Prefix:  "/" + strings.Trim(prefix, "/"),
+		BaseUrl: strings.TrimRight(baseUrl, "/"),
+	}, nil
+}
+
+func (s *LocalStorage) Put(ctx context.Context, name string, reader io.Reader, contentType string) (Object, error) {
+	fullPath, err := s.filePath(name)
+	if err != nil {
+		return Object{}, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return Object{}, err
+	}
+
+	//write to a temp file first so a failed upload never leaves a partial object behind
+	tmp, err := ioutil.TempFile(filepath.Dir(fullPath), ".upload-*")
+	if err != nil {
+		return Object{}, err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, reader); err != nil {
+		tmp.Close()
+		return Object{}, err
+	}
+	if err := tmp.Close(); err != nil {
+		return Object{}, err
+	}
+	if err := os.Rename(tmp.Name(), fullPath); err != nil {
+		return Object{}, err
+	}
+
+	objectPath := path.Join(s.Prefix, name)
+	return Object{
+		Name: name,
+		Path: objectPath,
+		Url:  s.BaseUrl + objectPath,
+	}, nil
+}
+
+func (s *LocalStorage) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	fullPath, err := s.filePath(name)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(fullPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return file, err
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, name string) error {
+	fullPath, err := s.filePath(name)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(fullPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// SignedURL returns the plain URL, local objects are served publicly.
+func (s *LocalStorage) SignedURL(ctx context.Context, name string, expires time.Duration) (string, error) {
+	if _, err := s.filePath(name); err != nil {
+		return "", err
+	}
+	return s.BaseUrl + path.Join(s.Prefix, name), nil
+}
+
+func (s *LocalStorage) filePath(name string) (string, error) {
+	cleaned := path.Clean("/" + name)
+	if cleaned == "/" || cleaned != "/"+name {
+		return "", errors.New("invalid object name")
+	}
+	return filepath.Join(s.Dir, filepath.FromSlash(cleaned)), nil
+}
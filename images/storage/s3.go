@@ -0,0 +1,288 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	s3Algorithm       = "AWS4-HMAC-SHA256"
+	s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+	s3TimeFormat      = "20060102T150405Z"
+	s3DateFormat      = "20060102"
+)
+
+type S3Config struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	PublicUrl string
+	PathStyle bool
+}
+
+// S3Storage talks to any S3 compatible API (AWS, MinIO, R2, Spaces etc.) using
+// plain HTTP requests signed with AWS Signature Version 4.
+type S3Storage struct {
+	S3Config
+	endpoint *url.URL
+	client   *http.Client
+}
+
+func NewS3Storage(s3Config S3Config) (*S3Storage, error) {
+	if s3Config.Endpoint == "" {
+		s3Config.Endpoint = "https://s3." + s3Config.Region + ".amazonaws.com"
+	}
+	if s3Config.Bucket == "" || s3Config.AccessKey == "" || s3Config.SecretKey == "" {
+		return nil, errors.New("s3 storage requires a bucket, access key and secret key")
+	}
+
+	endpoint, err := url.Parse(strings.TrimRight(s3Config.Endpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &S3Storage{
+		S3Config: s3Config,
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: 60 * time.Second},
+	}, nil
+}
+
+func (s *S3Storage) Put(ctx context.Context, name string, reader io.Reader, contentType string) (Object, error) {
+	//S3 needs a content length up front, uploads are small enough to buffer
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return Object{}, err
+	}
+
+	objectURL := s.objectURL(name)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, objectURL.String(), bytes.NewReader(body))
+	if err != nil {
+		return Object{}, err
+	}
+	req.ContentLength = int64(len(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	s.sign(req, hashHex(body), time.Now().UTC())
+
+	if _, err := s.do(req); err != nil {
+		return Object{}, err
+	}
+
+	objectPath := objectURL.EscapedPath()
+	publicUrl := objectURL.String()
+	if s.PublicUrl != "" {
+		objectPath = "/" + uriEncode(name, false)
+		publicUrl = strings.TrimRight(s.PublicUrl, "/") + objectPath
+	}
+
+	return Object{
+		Name: name,
+		Path: objectPath,
+		Url:  publicUrl,
+	}, nil
+}
+
+func (s *S3Storage) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.objectURL(name).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	s.sign(req, hashHex(nil), time.Now().UTC())
+
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *S3Storage) Delete(ctx context.Context, name string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.objectURL(name).String(), nil)
+	if err != nil {
+		return err
+	}
+	s.sign(req, hashHex(nil), time.Now().UTC())
+
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3Storage) SignedURL(ctx context.Context, name string, expires time.Duration) (string, error) {
+	now := time.Now().UTC()
+	objectURL := s.objectURL(name)
+
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", s3Algorithm)
+	query.Set("X-Amz-Credential", s.AccessKey+"/"+s.scope(now))
+	query.Set("X-Amz-Date", now.Format(s3TimeFormat))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expires.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+	objectURL.RawQuery = canonicalQuery(query)
+
+	canonicalRequest := strings.Join([]string{
+		http.MethodGet,
+		objectURL.EscapedPath(),
+		objectURL.RawQuery,
+		"host:" + objectURL.Host + "\n",
+		"host",
+		s3UnsignedPayload,
+	}, "\n")
+
+	objectURL.RawQuery += "&X-Amz-Signature=" + s.signature(now, canonicalRequest)
+	return objectURL.String(), nil
+}
+
+func (s *S3Storage) objectURL(name string) *url.URL {
+	objectURL := *s.endpoint
+	key := "/" + uriEncode(name, false)
+	if s.PathStyle {
+		objectURL.Path = s.endpoint.Path + "/" + s.Bucket + "/" + name
+		objectURL.RawPath = s.endpoint.Path + "/" + uriEncode(s.Bucket, true) + key
+	} else {
+		objectURL.Host = s.Bucket + "." + s.endpoint.Host
+		objectURL.Path = s.endpoint.Path + "/" + name
+		objectURL.RawPath = s.endpoint.Path + key
+	}
+	return &objectURL
+}
+
+func (s *S3Storage) do(req *http.Request) (*http.Response, error) {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+
+	if resp.StatusCode >= 300 {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("s3 %s failed with %d: %s", req.Method, resp.StatusCode, message)
+	}
+
+	return resp, nil
+}
+
+func (s *S3Storage) sign(req *http.Request, payloadHash string, now time.Time) {
+	req.Header.Set("X-Amz-Date", now.Format(s3TimeFormat))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for key, values := range req.Header {
+		headers[strings.ToLower(key)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, s.AccessKey, s.scope(now), signedHeaders, s.signature(now, canonicalRequest),
+	))
+}
+
+func (s *S3Storage) scope(now time.Time) string {
+	return now.Format(s3DateFormat) + "/" + s.Region + "/s3/aws4_request"
+}
+
+func (s *S3Storage) signature(now time.Time, canonicalRequest string) string {
+	stringToSign := strings.Join([]string{
+		s3Algorithm,
+		now.Format(s3TimeFormat),
+		s.scope(now),
+		hashHex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), now.Format(s3DateFormat))
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func canonicalQuery(values url.Values) string {
+	var keys []string
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, key := range keys {
+		for _, value := range values[key] {
+			pairs = append(pairs, uriEncode(key, true)+"="+uriEncode(value, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode follows the SigV4 rules: only unreserved characters are left as-is
+// and, unless encodeSlash is set, "/" is kept so object keys keep their path.
+func uriEncode(value string, encodeSlash bool) string {
+	var encoded strings.Builder
+	for _, b := range []byte(value) {
+		switch {
+		case (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9'),
+			b == '-', b == '_', b == '.', b == '~':
+			encoded.WriteByte(b)
+		case b == '/' && !encodeSlash:
+			encoded.WriteByte(b)
+		default:
+			encoded.WriteString(fmt.Sprintf("%%%02X", b))
+		}
+	}
+	return encoded.String()
+}
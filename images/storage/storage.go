@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/anthonyhawkins/savorbook/config"
+	"io"
+	"strings"
+	"time"
+)
+
+// Storage is implemented by each image storage backend. The active backend is
+// chosen by the STORAGE_DRIVER setting: local, s3 or gcs.
+type Storage interface {
+	Put(ctx context.Context, name string, reader io.Reader, contentType string) (Object, error)
+	Get(ctx context.Context, name string) (io.ReadCloser, error)
+	Delete(ctx context.Context, name string) error
+	SignedURL(ctx context.Context, name string, expires time.Duration) (string, error)
+}
+
+// Object describes where a stored file can be found once it has been written.
+type Object struct {
+	Name string
+	Path string
+	Url  string
+}
+
+var active Storage
+
+var ErrNotFound = errors.New("object not found")
+
+func Init() (Storage, error) {
+	driver := strings.ToLower(config.Get("STORAGE_DRIVER"))
+
+	var err error
+	switch driver {
+	case "", "local":
+		active, err = NewLocalStorage(
+			configOr("STORAGE_LOCAL_DIR", "./uploads"),
+			configOr("STORAGE_LOCAL_PREFIX", "/media"),
+			config.Get("STORAGE_LOCAL_BASE_URL"),
+		)
+	case "s3":
+		active, err = NewS3Storage(S3Config{
+			Endpoint:  config.Get("S3_ENDPOINT"),
+			Region:    configOr("S3_REGION", "us-east-1"),
+			Bucket:    configOr("STORAGE_BUCKET", "savorbook-dev"),
+			AccessKey: config.Get("S3_ACCESS_KEY"),
+			SecretKey: config.Get("S3_SECRET_KEY"),
+			PublicUrl: config.Get("S3_PUBLIC_URL"),
+			PathStyle: config.Get("S3_PATH_STYLE") == "true",
+		})
+	case "gcs":
+		active, err = NewGCSStorage(
+			configOr("STORAGE_BUCKET", "savorbook-dev"),
+			configOr("GCS_KEY_FILE", ".googlekey.json"),
+		)
+	default:
+		err = fmt.Errorf("unknown storage driver %q", driver)
+	}
+
+	return active, err
+}
+
+func GetStorage() Storage {
+	return active
+}
+
+func configOr(key string, fallback string) string {
+	if value := config.Get(key); value != "" {
+		return value
+	}
+	return fallback
+}
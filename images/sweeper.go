@@ -0,0 +1,149 @@
+package images
+
+import (
+	"context"
+	"fmt"
+	"github.com/anthonyhawkins/savorbook/config"
+	"github.com/anthonyhawkins/savorbook/database"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Sweeper periodically deletes uploads which have stayed unreferenced for longer
+// than the grace period. The grace period also covers the gap between uploading
+// an image and saving the recipe or cookbook that uses it.
+type Sweeper struct {
+	Interval    time.Duration
+	GracePeriod time.Duration
+}
+
+func NewSweeper(interval time.Duration, gracePeriod time.Duration) *Sweeper {
+	return &Sweeper{
+		Interval:    interval,
+		GracePeriod: gracePeriod,
+	}
+}
+
+// NewSweeperFromConfig reads IMAGE_SWEEP_INTERVAL and IMAGE_GRACE_PERIOD, i.e. "1h" and "24h".
+func NewSweeperFromConfig() *Sweeper {
+	return NewSweeper(
+		durationOr(config.Get("IMAGE_SWEEP_INTERVAL"), time.Hour),
+		durationOr(config.Get("IMAGE_GRACE_PERIOD"), 24*time.Hour),
+	)
+}
+
+func durationOr(value string, fallback time.Duration) time.Duration {
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return fallback
+	}
+	return duration
+}
+
+func (s *Sweeper) Start() {
+	go func() {
+		ticker := time.NewTicker(s.Interval)
+		defer ticker.Stop()
+		for {
+			if removed, err := s.Sweep(context.Background()); err != nil {
+				fmt.Println("Image Sweep Error: ", err)
+			} else if removed > 0 {
+				fmt.Println("Image Sweep removed", removed, "images")
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+func (s *Sweeper) Sweep(ctx context.Context) (int, error) {
+	db := database.GetDB()
+	cutoff := time.Now().Add(-s.GracePeriod)
+
+	var candidates []Image
+	result := db.Where("used = ?", false).Where(
+		db.Where("unused_since < ?", cutoff).Or("unused_since IS NULL AND created_at < ?", cutoff),
+	).Preload("Renditions").Find(&candidates)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	removed := 0
+	for _, image := range candidates {
+		/**
+		Recipes only release images they stop referencing, so another recipe or
+		a cookbook might still point at this one. Check before deleting.
+		*/
+		recipeID, referenced, err := findReference(db, &image)
+		if err != nil {
+			return removed, err
+		}
+		if referenced {
+			db.Model(&image).Updates(map[string]interface{}{
+				"recipe_id":    recipeID,
+				"used":         true,
+				"unused_since": nil,
+			})
+			continue
+		}
+
+		//nothing references it, so every upload of it can go at once
+		purged, err := image.Purge(ctx)
+		if err != nil {
+			return removed, err
+		}
+		if purged {
+			removed++
+		}
+	}
+
+	return removed, nil
+}
+
+func findReference(db *gorm.DB, image *Image) (uint, bool, error) {
+	refs := []string{image.Path, image.Url}
+	for _, rendition := range image.Renditions {
+		refs = append(refs, rendition.Path, rendition.Url)
+	}
+	refs = nonEmpty(refs)
+
+	var recipeIDs []uint
+	result := db.Raw(
+		`SELECT id FROM recipe_models
+		WHERE user_id = ? AND deleted_at IS NULL AND image IN ?
+		UNION
+		SELECT step_models.recipe_id FROM step_image_models
+		JOIN step_models ON step_models.id = step_image_models.step_id
+		JOIN recipe_models ON recipe_models.id = step_models.recipe_id
+		WHERE recipe_models.user_id = ? AND recipe_models.deleted_at IS NULL
+		AND step_models.deleted_at IS NULL AND step_image_models.deleted_at IS NULL
+		AND step_image_models.image IN ?`,
+		image.UserID, refs, image.UserID, refs,
+	).Scan(&recipeIDs)
+	if result.Error != nil {
+		return 0, false, result.Error
+	}
+	if len(recipeIDs) > 0 {
+		return recipeIDs[0], true, nil
+	}
+
+	var cookbooks int64
+	result = db.Table("cookbook_models").Where(
+		"user_id = ? AND deleted_at IS NULL AND image IN ?", image.UserID, refs,
+	).Count(&cookbooks)
+	if result.Error != nil || cookbooks > 0 {
+		return 0, cookbooks > 0, result.Error
+	}
+
+	//cookbook pages, i.e. chapter intros and photo spreads
+	var pages int64
+	result = db.Table("page_models").Joins(
+		"JOIN section_models ON section_models.id = page_models.section_id AND section_models.deleted_at IS NULL",
+	).Joins(
+		"JOIN cookbook_models ON cookbook_models.id = section_models.cookbook_id AND cookbook_models.deleted_at IS NULL",
+	).Where(
+		"page_models.user_id = ? AND page_models.deleted_at IS NULL", image.UserID,
+	).Where(
+		"page_models.image IN ? OR EXISTS (SELECT 1 FROM jsonb_array_elements(page_models.photos) AS photo WHERE photo->>'src' IN ?)", refs, refs,
+	).Count(&pages)
+	return 0, pages > 0, result.Error
+}
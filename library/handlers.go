@@ -0,0 +1,364 @@
+package library
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/anthonyhawkins/savorbook/middleware"
+	"github.com/anthonyhawkins/savorbook/publish/cookbooks"
+	"github.com/anthonyhawkins/savorbook/publish/recipes"
+	"github.com/anthonyhawkins/savorbook/responses"
+	"github.com/anthonyhawkins/savorbook/store"
+	"github.com/anthonyhawkins/savorbook/users"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"net/url"
+	"strings"
+)
+
+func AuthorGet(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+
+	author, err := users.FindByUsername(c.Params("username"))
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response.Message = "Author Not Found"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	if err != nil {
+		response.Message = "Unable to Retrieve Author"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	//an author has a handful of cookbooks, so page and page_size page through the recipes
+	cookbookCards, err := BrowseCookbooks(BrowseOptions{AuthorID: author.ID, PageSize: "100"})
+	if err != nil {
+		response.Message = "Unable to Retrieve Cookbooks"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	recipeCards, err := GetRecipeCards(author.ID, strings.ToLower(c.Query("page")), strings.ToLower(c.Query("page_size")))
+	if err != nil {
+		response.Message = "Unable to Retrieve Recipes"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	var authorResponse AuthorPageResponse
+	authorResponse.Author.SerializeProfile(author)
+	authorResponse.Cookbooks = SerializeCookbookCards(cookbookCards)
+	authorResponse.Recipes = make([]RecipeCardResponse, 0)
+	for _, card := range recipeCards {
+		var cardResponse RecipeCardResponse
+		cardResponse.SerializeCard(&card)
+		authorResponse.Recipes = append(authorResponse.Recipes, cardResponse)
+	}
+
+	//Respond with Success
+	response.Success = true
+	response.Data = authorResponse
+	return c.JSON(response)
+}
+
+func AuthorRecipeGet(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+
+	author, err := users.FindByUsername(c.Params("username"))
+	if err != nil {
+		response.Message = "Recipe Not Found"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	model, revision, err := recipes.GetPublishedRecipe(c.Params("id"), author.ID)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response.Message = "Recipe Not Found"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	if err != nil {
+		response.Message = "Unable to Retrieve Recipe"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	snapshot, err := revision.Recipe()
+	if err != nil {
+		response.Message = "Unable to Retrieve Recipe"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	var publishedResponse recipes.PublishedRecipeResponse
+	publishedResponse.SerializePublished(&model, &revision, &snapshot)
+
+	//Respond with Success
+	response.Success = true
+	response.Data = publishedResponse
+	return c.JSON(response)
+}
+
+// AuthorRecipePage is a published recipe as a standalone HTML page for sharing,
+// with schema.org JSON-LD for rich results and Open Graph and Twitter card tags
+// for link previews.
+func AuthorRecipePage(c *fiber.Ctx) error {
+	return publicRecipe(c, func(snapshot *recipes.RecipeSnapshot, dependencies []recipes.PublishedDependency, page recipes.SchemaPage) error {
+		var document bytes.Buffer
+		if err := recipes.WriteRecipePage(&document, snapshot, dependencies, page); err != nil {
+			return err
+		}
+
+		//Respond with Success
+		c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+		return c.Send(document.Bytes())
+	})
+}
+
+// AuthorRecipeSchema is the schema.org Recipe JSON-LD embedded in AuthorRecipePage, on its own.
+func AuthorRecipeSchema(c *fiber.Ctx) error {
+	return publicRecipe(c, func(snapshot *recipes.RecipeSnapshot, dependencies []recipes.PublishedDependency, page recipes.SchemaPage) error {
+		schema, err := json.Marshal(recipes.NewSchemaRecipe(snapshot, dependencies, page))
+		if err != nil {
+			return err
+		}
+
+		//Respond with Success
+		c.Set(fiber.HeaderContentType, "application/ld+json")
+		return c.Send(schema)
+	})
+}
+
+// publicRecipe loads the published revision of an author's recipe, with its published
+// dependencies, and hands it to render along with where its page can be found.
+func publicRecipe(c *fiber.Ctx, render func(*recipes.RecipeSnapshot, []recipes.PublishedDependency, recipes.SchemaPage) error) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+
+	author, err := users.FindByUsername(c.Params("username"))
+	if err != nil {
+		response.Message = "Recipe Not Found"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	model, revision, snapshot, err := recipes.GetPublishedSnapshot(c.Params("id"), author.ID)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response.Message = "Recipe Not Found"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	if err != nil {
+		response.Message = "Unable to Retrieve Recipe"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	dependencies, err := recipes.GetPublishedDependencies(&snapshot, author.ID)
+	if err != nil {
+		response.Message = "Unable to Retrieve Recipe"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	authorName := author.DisplayName
+	if authorName == "" {
+		authorName = author.Username
+	}
+
+	page := recipes.SchemaPage{
+		URL:           fmt.Sprintf("%s/api/library/authors/%s/recipes/%d/page", c.BaseURL(), url.PathEscape(author.Username), model.ID),
+		BaseURL:       c.BaseURL() + "/",
+		Author:        authorName,
+		DatePublished: model.PublishedAt,
+		DateModified:  revision.CreatedAt,
+	}
+
+	if err := render(&snapshot, dependencies, page); err != nil {
+		response.Message = "Unable to Render Recipe"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+	return nil
+}
+
+func LibraryCookbookList(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+
+	options := BrowseOptions{
+		Query:    c.Query("q"),
+		PageNum:  strings.ToLower(c.Query("page")),
+		PageSize: strings.ToLower(c.Query("page_size")),
+	}
+
+	if username := c.Query("author"); username != "" {
+		author, err := users.FindByUsername(username)
+		if err != nil {
+			//nobody by that name has published anything
+			response.Success = true
+			response.Data = make([]CookbookCardResponse, 0)
+			return c.JSON(response)
+		}
+		options.AuthorID = author.ID
+	}
+
+	cards, err := BrowseCookbooks(options)
+	if err != nil {
+		response.Message = "Unable to Retrieve Cookbooks"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	//Respond with Success
+	response.Success = true
+	response.Data = SerializeCookbookCards(cards)
+	return c.JSON(response)
+}
+
+func LibraryCookbookGet(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+
+	model, publication, err := cookbooks.GetPublicCookbook(c.Params("id"))
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response.Message = "Cookbook Not Found"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	if err != nil {
+		response.Message = "Unable to Retrieve Cookbook"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	snapshot, err := publication.Cookbook()
+	if err != nil {
+		response.Message = "Unable to Retrieve Cookbook"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	unlocked, listing, err := store.Unlocked(middleware.ViewerId(c), &model)
+	if err != nil {
+		response.Message = "Unable to Retrieve Cookbook"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+	if !unlocked {
+		snapshot = snapshot.Preview()
+	}
+
+	var cookbookResponse LibraryCookbookResponse
+	cookbookResponse.SerializePublished(&model, &publication, &snapshot)
+	cookbookResponse.Locked = !unlocked
+	if listing != nil {
+		cookbookResponse.Listing = new(store.ListingResponse)
+		cookbookResponse.Listing.SerializeListing(listing)
+	}
+	if author, err := users.FindOne(model.UserID); err == nil {
+		cookbookResponse.Author = AuthorResponse{Username: author.Username, DisplayName: author.DisplayName}
+	}
+
+	//Respond with Success
+	response.Success = true
+	response.Data = cookbookResponse
+	return c.JSON(response)
+}
+
+func SavedCookbookList(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+	userID := middleware.AuthedUserId(c.Locals("user"))
+
+	cards, err := BrowseCookbooks(BrowseOptions{
+		SavedBy:  userID,
+		Query:    c.Query("q"),
+		PageNum:  strings.ToLower(c.Query("page")),
+		PageSize: strings.ToLower(c.Query("page_size")),
+	})
+	if err != nil {
+		response.Message = "Unable to Retrieve Library"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	//Respond with Success
+	response.Success = true
+	response.Data = SerializeCookbookCards(cards)
+	return c.JSON(response)
+}
+
+func SavedCookbookAdd(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+	userID := middleware.AuthedUserId(c.Locals("user"))
+
+	model, _, err := cookbooks.GetPublicCookbook(c.Params("id"))
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response.Message = "Cookbook Not Found"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	if err != nil {
+		response.Message = "Unable to Retrieve Cookbook"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	if model.UserID == userID {
+		response.Message = "Unable to Save Cookbook"
+		response.Errors = append(response.Errors, "your own cookbooks are already yours")
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	if err := SaveCookbook(userID, model.ID); err != nil {
+		response.Message = "Unable to Save Cookbook"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	//Respond with Success
+	response.Success = true
+	response.Message = fmt.Sprintf("Saved %q to your library", model.Title)
+	return c.JSON(response)
+}
+
+func SavedCookbookRemove(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+	userID := middleware.AuthedUserId(c.Locals("user"))
+
+	err := RemoveSavedCookbook(userID, c.Params("id"))
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response.Message = "Cookbook Not In Library"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	if err != nil {
+		response.Message = "Unable to Remove Cookbook"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	//Respond with Success
+	response.Success = true
+	response.Message = "Cookbook Removed From Library"
+	return c.JSON(response)
+}
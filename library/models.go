@@ -0,0 +1,183 @@
+package library
+
+import (
+	"encoding/json"
+	"github.com/anthonyhawkins/savorbook/database"
+	"github.com/anthonyhawkins/savorbook/publish/recipes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// SavedCookbookModel is a published cookbook a reader has kept in their library.
+type SavedCookbookModel struct {
+	gorm.Model
+	UserID     uint `gorm:"uniqueIndex:idx_saved_cookbook"`
+	CookbookID uint `gorm:"uniqueIndex:idx_saved_cookbook"`
+}
+
+// CookbookCard is a published cookbook as it's listed, read from its publication rather than the author's draft.
+type CookbookCard struct {
+	ID          uint
+	UserID      uint
+	Username    string
+	DisplayName string
+	Title       string
+	SubTitle    string
+	Blurb       string
+	Image       string
+	RecipeCount int
+	PublishedAt time.Time
+	Rank        float64
+	SavedAt     *time.Time
+	//Price is nil for a free cookbook
+	Price    *int64
+	Currency string
+	Owned    bool
+}
+
+// RecipeCard is a published recipe as it's listed, read from its published revision.
+type RecipeCard struct {
+	ID          uint
+	Name        string
+	Image       string
+	Description string
+	PrepTime    string
+	Servings    string
+	Tags        string
+	PublishedAt time.Time
+}
+
+type BrowseOptions struct {
+	Query    string
+	AuthorID uint
+	//SavedBy lists only the cookbooks this user has saved or bought
+	SavedBy  uint
+	PageNum  string
+	PageSize string
+}
+
+const cookbookCardSQL = `cookbook_models.id, cookbook_models.user_id,
+user_models.username, user_models.display_name,
+cookbook_publication_models.snapshot->>'title' AS title,
+cookbook_publication_models.snapshot->>'subTitle' AS sub_title,
+cookbook_publication_models.snapshot->>'blurb' AS blurb,
+cookbook_publication_models.snapshot->>'image' AS image,
+(
+	SELECT count(*) FROM jsonb_array_elements(cookbook_publication_models.snapshot->'sections') AS section,
+	jsonb_array_elements(section->'recipes')
+) AS recipe_count,
+cookbook_models.published_at,
+listing_models.price, listing_models.currency`
+
+// BrowseCookbooks lists published cookbooks across every author, newest first, or
+// ranked by how well they match Query. Only what was published is searched, so a
+// draft edit never shows up in the library before it's published.
+func BrowseCookbooks(options BrowseOptions) ([]CookbookCard, error) {
+	db := database.GetDB()
+	cards := make([]CookbookCard, 0)
+
+	selects := cookbookCardSQL
+	query := db.Table("cookbook_publication_models").Scopes(
+		database.Paginate(options.PageNum, options.PageSize),
+	).Joins(
+		"JOIN cookbook_models ON cookbook_models.id = cookbook_publication_models.cookbook_id "+
+			"AND cookbook_models.deleted_at IS NULL AND cookbook_models.status = ?", recipes.StatusPublished,
+	).Joins(
+		"JOIN user_models ON user_models.id = cookbook_models.user_id AND user_models.deleted_at IS NULL",
+	).Joins(
+		"LEFT JOIN listing_models ON listing_models.cookbook_id = cookbook_models.id AND listing_models.deleted_at IS NULL",
+	).Where("cookbook_publication_models.deleted_at IS NULL")
+
+	if options.AuthorID != 0 {
+		query = query.Where("cookbook_models.user_id = ?", options.AuthorID)
+	}
+
+	if options.SavedBy != 0 {
+		//a bought cookbook is in the library whether or not it was also saved
+		selects += ", coalesce(saved_cookbook_models.created_at, entitlement_models.created_at) AS saved_at" +
+			", entitlement_models.id IS NOT NULL AS owned"
+		query = query.Joins(
+			"LEFT JOIN saved_cookbook_models ON saved_cookbook_models.cookbook_id = cookbook_models.id "+
+				"AND saved_cookbook_models.user_id = ? AND saved_cookbook_models.deleted_at IS NULL", options.SavedBy,
+		).Joins(
+			"LEFT JOIN entitlement_models ON entitlement_models.cookbook_id = cookbook_models.id "+
+				"AND entitlement_models.user_id = ? AND entitlement_models.revoked_at IS NULL "+
+				"AND entitlement_models.deleted_at IS NULL", options.SavedBy,
+		).Where("saved_cookbook_models.id IS NOT NULL OR entitlement_models.id IS NOT NULL")
+	}
+
+	if terms := recipes.PrefixQuery(options.Query); terms != "" {
+		selects += ", ts_rank('{0.2, 0.4, 0.7, 1.0}', cookbook_publication_models.search_vector, query) AS rank"
+		query = query.Joins(
+			"CROSS JOIN to_tsquery('"+recipes.SearchConfig+"', ?) AS query", terms,
+		).Where("cookbook_publication_models.search_vector @@ query").Order("rank DESC")
+	}
+	if options.SavedBy != 0 {
+		query = query.Order("saved_at DESC")
+	}
+
+	err := query.Select(selects).Order("cookbook_models.published_at DESC").Scan(&cards).Error
+	return cards, err
+}
+
+// GetRecipeCards lists an author's published recipes, newest first.
+func GetRecipeCards(authorID uint, pageNum string, pageSize string) ([]RecipeCard, error) {
+	db := database.GetDB()
+	cards := make([]RecipeCard, 0)
+
+	err := db.Table("recipe_models").Scopes(database.Paginate(pageNum, pageSize)).Select(
+		`recipe_models.id,
+		recipe_revision_models.snapshot->>'name' AS name,
+		recipe_revision_models.snapshot->>'image' AS image,
+		recipe_revision_models.snapshot->>'description' AS description,
+		recipe_revision_models.snapshot->>'prepTime' AS prep_time,
+		recipe_revision_models.snapshot->>'servings' AS servings,
+		recipe_revision_models.snapshot->'tags' AS tags,
+		recipe_models.published_at`,
+	).Joins(
+		"JOIN recipe_revision_models ON recipe_revision_models.recipe_id = recipe_models.id " +
+			"AND recipe_revision_models.number = recipe_models.published_revision",
+	).Where(map[string]interface{}{
+		"recipe_models.user_id":    authorID,
+		"recipe_models.status":     recipes.StatusPublished,
+		"recipe_models.deleted_at": nil,
+	}).Order("recipe_models.published_at DESC").Scan(&cards).Error
+
+	return cards, err
+}
+
+func (card *RecipeCard) TagList() []string {
+	tags := make([]string, 0)
+	if card.Tags != "" {
+		json.Unmarshal([]byte(card.Tags), &tags)
+	}
+	return tags
+}
+
+// SaveCookbook adds the cookbook to the user's library. Saving one that's already there changes nothing.
+func SaveCookbook(userID uint, cookbookID uint) error {
+	db := database.GetDB()
+	return db.Clauses(clause.OnConflict{DoNothing: true}).Create(&SavedCookbookModel{
+		UserID:     userID,
+		CookbookID: cookbookID,
+	}).Error
+}
+
+// RemoveSavedCookbook deletes outright so the cookbook can be saved again later.
+func RemoveSavedCookbook(userID uint, cookbookID string) error {
+	db := database.GetDB()
+
+	result := db.Unscoped().Where(map[string]interface{}{
+		"user_id":     userID,
+		"cookbook_id": cookbookID,
+	}).Delete(&SavedCookbookModel{})
+
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
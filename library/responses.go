@@ -0,0 +1,92 @@
+package library
+
+import (
+	"github.com/anthonyhawkins/savorbook/publish/cookbooks"
+	"github.com/anthonyhawkins/savorbook/store"
+	"github.com/anthonyhawkins/savorbook/users"
+)
+
+type AuthorResponse struct {
+	Username    string `json:"username"`
+	DisplayName string `json:"displayName"`
+}
+
+type CookbookCardResponse struct {
+	ID          uint           `json:"id"`
+	Title       string         `json:"title"`
+	SubTitle    string         `json:"subTitle"`
+	Blurb       string         `json:"blurb"`
+	Image       string         `json:"image"`
+	RecipeCount int            `json:"recipeCount"`
+	PublishedAt string         `json:"publishedAt"`
+	Author      AuthorResponse `json:"author"`
+	Rank        float64        `json:"rank,omitempty"`
+	SavedAt     string         `json:"savedAt,omitempty"`
+	Price       *int64         `json:"price,omitempty"`
+	Currency    string         `json:"currency,omitempty"`
+	Owned       bool           `json:"owned,omitempty"`
+}
+
+type RecipeCardResponse struct {
+	ID          uint     `json:"id"`
+	Name        string   `json:"name"`
+	Image       string   `json:"image"`
+	Description string   `json:"description"`
+	PrepTime    string   `json:"prepTime"`
+	Servings    string   `json:"servings"`
+	Tags        []string `json:"tags"`
+	PublishedAt string   `json:"publishedAt"`
+}
+
+type AuthorPageResponse struct {
+	Author    users.ProfileResponse  `json:"author"`
+	Cookbooks []CookbookCardResponse `json:"cookbooks"`
+	Recipes   []RecipeCardResponse   `json:"recipes"`
+}
+
+type LibraryCookbookResponse struct {
+	cookbooks.PublishedCookbookResponse
+	Author AuthorResponse `json:"author"`
+	//Locked is true while the reader only sees a preview, see CookbookSnapshot.Preview
+	Locked  bool                   `json:"locked"`
+	Listing *store.ListingResponse `json:"listing,omitempty"`
+}
+
+func (r *CookbookCardResponse) SerializeCard(card *CookbookCard) {
+	r.ID = card.ID
+	r.Title = card.Title
+	r.SubTitle = card.SubTitle
+	r.Blurb = card.Blurb
+	r.Image = card.Image
+	r.RecipeCount = card.RecipeCount
+	r.PublishedAt = card.PublishedAt.Format("2006-01-02T15:04:05Z07:00")
+	r.Author = AuthorResponse{Username: card.Username, DisplayName: card.DisplayName}
+	r.Rank = card.Rank
+	if card.SavedAt != nil {
+		r.SavedAt = card.SavedAt.Format("2006-01-02T15:04:05Z07:00")
+	}
+	r.Price = card.Price
+	r.Currency = card.Currency
+	r.Owned = card.Owned
+}
+
+func SerializeCookbookCards(cards []CookbookCard) []CookbookCardResponse {
+	cardList := make([]CookbookCardResponse, 0)
+	for _, card := range cards {
+		var cardResponse CookbookCardResponse
+		cardResponse.SerializeCard(&card)
+		cardList = append(cardList, cardResponse)
+	}
+	return cardList
+}
+
+func (r *RecipeCardResponse) SerializeCard(card *RecipeCard) {
+	r.ID = card.ID
+	r.Name = card.Name
+	r.Image = card.Image
+	r.Description = card.Description
+	r.PrepTime = card.PrepTime
+	r.Servings = card.Servings
+	r.Tags = card.TagList()
+	r.PublishedAt = card.PublishedAt.Format("2006-01-02T15:04:05Z07:00")
+}
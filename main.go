@@ -1,16 +1,24 @@
 package main
 
 import (
+	"fmt"
 	"github.com/anthonyhawkins/savorbook/database"
 	"github.com/anthonyhawkins/savorbook/images"
+	"github.com/anthonyhawkins/savorbook/images/storage"
+	"github.com/anthonyhawkins/savorbook/library"
+	"github.com/anthonyhawkins/savorbook/pantry"
 	"github.com/anthonyhawkins/savorbook/publish/cookbooks"
 	"github.com/anthonyhawkins/savorbook/publish/recipes"
 	"github.com/anthonyhawkins/savorbook/router"
+	"github.com/anthonyhawkins/savorbook/sharing"
+	"github.com/anthonyhawkins/savorbook/shopping"
+	"github.com/anthonyhawkins/savorbook/store"
 	"github.com/anthonyhawkins/savorbook/users"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"gorm.io/gorm"
+	"log"
 )
 
 func Migrate(db *gorm.DB) {
@@ -35,13 +43,48 @@ func Migrate(db *gorm.DB) {
 	db.AutoMigrate(&recipes.TagModel{})
 	db.AutoMigrate(&recipes.IngredientGroupModel{})
 	db.AutoMigrate(&recipes.IngredientModel{})
+	if err := recipes.MigrateIngredientAmounts(db); err != nil {
+		fmt.Println("Migration Error: ", err)
+	}
 	db.AutoMigrate(&recipes.StepModel{})
 	db.AutoMigrate(&recipes.StepImageModel{})
 	db.AutoMigrate(&recipes.RecipeDependencyModel{})
+	if err := recipes.MigrateSearchIndex(db); err != nil {
+		fmt.Println("Migration Error: ", err)
+	}
+	db.AutoMigrate(&recipes.RecipeRevisionModel{})
+	if err := recipes.MigrateRecipeRevisions(db); err != nil {
+		fmt.Println("Migration Error: ", err)
+	}
 	db.AutoMigrate(&images.Image{})
+	db.AutoMigrate(&images.ImageRendition{})
 
 	db.AutoMigrate(&cookbooks.CookbookModel{})
 	db.AutoMigrate(&cookbooks.SectionModel{})
+	db.AutoMigrate(&cookbooks.PageModel{})
+	if err := cookbooks.MigrateSectionPages(db); err != nil {
+		fmt.Println("Migration Error: ", err)
+	}
+	db.AutoMigrate(&cookbooks.CookbookPublicationModel{})
+	if err := cookbooks.MigratePublicationSearch(db); err != nil {
+		fmt.Println("Migration Error: ", err)
+	}
+
+	db.AutoMigrate(&shopping.ShoppingListModel{})
+	db.AutoMigrate(&shopping.ShoppingListItemModel{})
+
+	db.AutoMigrate(&pantry.PantryItemModel{})
+
+	db.AutoMigrate(&sharing.ShareLinkModel{})
+
+	db.AutoMigrate(&library.SavedCookbookModel{})
+
+	db.AutoMigrate(&store.ListingModel{})
+	db.AutoMigrate(&store.OrderModel{})
+	if err := store.MigrateOrders(db); err != nil {
+		fmt.Println("Migration Error: ", err)
+	}
+	db.AutoMigrate(&store.EntitlementModel{})
 }
 
 func main() {
@@ -52,6 +95,19 @@ func main() {
 	sqlDB := database.GetSqlDB(db)
 	defer sqlDB.Close()
 
+	if _, err := storage.Init(); err != nil {
+		log.Fatal("Storage Error: ", err)
+	}
+
+	if _, err := store.Init(); err != nil {
+		log.Fatal("Payment Provider Error: ", err)
+	}
+
+	//only the parent process sweeps, prefork children would race each other
+	if !fiber.IsChild() {
+		images.NewSweeperFromConfig().Start()
+	}
+
 	app := fiber.New(fiber.Config{
 		Prefork:       true,
 		CaseSensitive: true,
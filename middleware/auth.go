@@ -18,6 +18,18 @@ func Protected() fiber.Handler {
 	})
 }
 
+// OptionalAuth is Protected for public routes that show a signed in user more. A
+// request without a token goes through, one with a bad token is still refused.
+func OptionalAuth() fiber.Handler {
+	return jwtware.New(jwtware.Config{
+		SigningKey:   []byte(config.Get("SIGNING_SECRET")),
+		ErrorHandler: jwtError,
+		Filter: func(c *fiber.Ctx) bool {
+			return c.Get(fiber.HeaderAuthorization) == ""
+		},
+	})
+}
+
 func jwtError(c *fiber.Ctx, err error) error {
 
 	response := responses.StandardResponse{
@@ -49,7 +61,7 @@ func AuthedUserId(token interface{}) uint {
 	claims := userToken.Claims.(jwt.MapClaims)
 	switch v := claims["sub"].(type) {
 	default:
-		fmt.Println("Unknown Type %T", v)
+		fmt.Printf("Unknown Type %T\n", v)
 		//TODO do something if type not recognized
 		return 0
 	case string:
@@ -60,3 +72,12 @@ func AuthedUserId(token interface{}) uint {
 	}
 
 }
+
+// ViewerId is AuthedUserId behind OptionalAuth, 0 when nobody is signed in.
+func ViewerId(c *fiber.Ctx) uint {
+	token := c.Locals("user")
+	if token == nil {
+		return 0
+	}
+	return AuthedUserId(token)
+}
@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"github.com/anthonyhawkins/savorbook/database"
+	"github.com/gofiber/fiber/v2"
+	"strconv"
+	"strings"
+)
+
+var ErrVersionRequired = errors.New("send the version being changed as an If-Match header or a version field")
+
+// ETag is the weak entity tag for a version. Representations which also depend on
+// something outside the URL, such as the user's preferred units, pass it as a variant.
+func ETag(version int, variant string) string {
+	if variant != "" {
+		return fmt.Sprintf(`W/"%d-%s"`, version, variant)
+	}
+	return fmt.Sprintf(`W/"%d"`, version)
+}
+
+// NotModified sets the ETag and reports whether it matches If-None-Match, in which
+// case the caller answers 304 without a body.
+func NotModified(c *fiber.Ctx, etag string) bool {
+	c.Set(fiber.HeaderETag, etag)
+
+	for _, candidate := range strings.Split(c.Get(fiber.HeaderIfNoneMatch), ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// ExpectedVersion is the version a write was based on, from If-Match or else the
+// version the client sent in the body or query. If-Match may list several tags, in
+// which case the current version only has to be one of them.
+func ExpectedVersion(c *fiber.Ctx, current int, sentVersion int) (int, error) {
+	ifMatch := strings.TrimSpace(c.Get(fiber.HeaderIfMatch))
+	if ifMatch == "*" {
+		return current, nil
+	}
+
+	if ifMatch != "" {
+		expected := 0
+		for _, candidate := range strings.Split(ifMatch, ",") {
+			version, ok := parseETag(candidate)
+			if !ok {
+				continue
+			}
+			if version == current {
+				return version, nil
+			}
+			expected = version
+		}
+		if expected == 0 {
+			return 0, ErrVersionRequired
+		}
+		return expected, database.ErrVersionConflict
+	}
+
+	if sentVersion == 0 {
+		return 0, ErrVersionRequired
+	}
+	if sentVersion != current {
+		return sentVersion, database.ErrVersionConflict
+	}
+	return sentVersion, nil
+}
+
+// VersionStatus is 428 when no version was sent, and for a stale one 412 if it came from If-Match, 409 otherwise.
+func VersionStatus(c *fiber.Ctx, err error) int {
+	switch {
+	case errors.Is(err, ErrVersionRequired):
+		return fiber.StatusPreconditionRequired
+	case c.Get(fiber.HeaderIfMatch) != "":
+		return fiber.StatusPreconditionFailed
+	}
+	return fiber.StatusConflict
+}
+
+// parseETag reads the version back out of a tag made by ETag.
+func parseETag(etag string) (int, bool) {
+	etag = strings.Trim(strings.TrimPrefix(strings.TrimSpace(etag), "W/"), `"`)
+	if i := strings.Index(etag, "-"); i != -1 {
+		etag = etag[:i]
+	}
+	version, err := strconv.Atoi(etag)
+	return version, err == nil && version > 0
+}
@@ -0,0 +1,301 @@
+package pantry
+
+import (
+	"errors"
+	"github.com/anthonyhawkins/savorbook/database"
+	"github.com/anthonyhawkins/savorbook/middleware"
+	"github.com/anthonyhawkins/savorbook/publish/recipes"
+	"github.com/anthonyhawkins/savorbook/responses"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"strconv"
+	"strings"
+)
+
+func PantryItemCreate(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+
+	userID := middleware.AuthedUserId(c.Locals("user"))
+
+	itemValidator := NewPantryItemValidator()
+	if err := c.BodyParser(itemValidator); err != nil {
+		response.Message = "Invalid JSON"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	errs, err := itemValidator.Validate()
+	if err != nil {
+		response.Message = "Validation Errors"
+		response.Errors = errs
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	if err := itemValidator.BindModel(userID); err != nil {
+		response.Message = "Unable to Create Pantry Item"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	if err := CreatePantryItem(&itemValidator.Model); err != nil {
+		response.Message = "Unable to Create Pantry Item"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	var itemResponse PantryItemResponse
+	itemResponse.SerializePantryItem(&itemValidator.Model)
+
+	//Respond with Success
+	response.Success = true
+	response.Data = itemResponse
+	return c.Status(fiber.StatusCreated).JSON(response)
+}
+
+func PantryItemList(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+	userID := middleware.AuthedUserId(c.Locals("user"))
+	pageNum := strings.ToLower(c.Query("page"))
+	pageSize := strings.ToLower(c.Query("page_size"))
+
+	itemList := make([]PantryItemResponse, 0)
+
+	items, err := GetPantryItems(userID, pageNum, pageSize)
+
+	if err != nil {
+		response.Success = true
+		response.Data = itemList
+		response.Message = "No Pantry Items Found"
+		response.Errors = append(response.Errors, response.Message)
+		return c.JSON(response)
+	}
+
+	for _, item := range items {
+		var itemResponse PantryItemResponse
+		itemResponse.SerializePantryItem(&item)
+		itemList = append(itemList, itemResponse)
+	}
+
+	//Respond with Success
+	response.Success = true
+	response.Data = itemList
+	return c.JSON(response)
+}
+
+func PantryItemUpdate(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+
+	itemID := c.Params("id")
+	userID := middleware.AuthedUserId(c.Locals("user"))
+	existingItem, err := GetPantryItem(itemID, userID)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response.Message = "Pantry Item Not Found"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	if err != nil {
+		response.Message = "Unable to Retrieve Pantry Item"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	itemValidator := NewPantryItemValidator()
+	if err := c.BodyParser(itemValidator); err != nil {
+		response.Message = "Invalid JSON"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	validationErrors, err := itemValidator.Validate()
+	if err != nil {
+		response.Message = "Validation Errors"
+		response.Errors = validationErrors
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	if err := itemValidator.BindModel(userID); err != nil {
+		response.Message = "Unable to Update Pantry Item"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	itemValidator.Model.ID = existingItem.ID
+	itemValidator.Model.CreatedAt = existingItem.CreatedAt
+
+	if err := itemValidator.Model.Update(); err != nil {
+		response.Message = "Unable to Update Pantry Item"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	var itemResponse PantryItemResponse
+	itemResponse.SerializePantryItem(&itemValidator.Model)
+
+	//Respond with Success
+	response.Success = true
+	response.Data = itemResponse
+	return c.JSON(response)
+}
+
+func PantryItemDelete(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+
+	itemID := c.Params("id")
+	userID := middleware.AuthedUserId(c.Locals("user"))
+
+	err := DeletePantryItem(itemID, userID)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response.Message = "Pantry Item Not Found"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	if err != nil {
+		response.Message = "Unable to Delete Pantry Item"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	response.Success = true
+	response.Message = "Pantry Item Deleted"
+	return c.JSON(response)
+}
+
+// newMatcher loads everything needed to check the user's recipes against their pantry.
+func newMatcher(userID uint) (*Matcher, error) {
+	recipeModels, err := recipes.GetRecipesWithIngredients(userID)
+	if err != nil {
+		return nil, err
+	}
+	graph, err := recipes.LoadDependencyGraph(database.GetDB(), userID)
+	if err != nil {
+		return nil, err
+	}
+	pantry, err := GetPantry(userID)
+	if err != nil {
+		return nil, err
+	}
+	return NewMatcher(graph, recipeModels, pantry), nil
+}
+
+// WhatCanICook ranks every recipe by how much of it the pantry covers, best first.
+// min_coverage, between 0 and 1, drops recipes which are too far off, i.e. 1 for
+// only the recipes which can be cooked right now.
+func WhatCanICook(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+	userID := middleware.AuthedUserId(c.Locals("user"))
+
+	minCoverage := 0.0
+	if text := c.Query("min_coverage"); text != "" {
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil || value < 0 || value > 1 {
+			response.Message = "Invalid Coverage"
+			response.Errors = append(response.Errors, "min_coverage must be between 0 and 1")
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+		}
+		minCoverage = value
+	}
+
+	matcher, err := newMatcher(userID)
+	if err != nil {
+		response.Message = "Unable to Check Pantry"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	planList := make([]PlanResponse, 0)
+	for _, plan := range matcher.Rank() {
+		if plan.Coverage < minCoverage {
+			continue
+		}
+		var planResponse PlanResponse
+		planResponse.SerializePlan(&plan)
+		planList = append(planList, planResponse)
+	}
+
+	//Respond with Success
+	response.Success = true
+	response.Data = planList
+	return c.JSON(response)
+}
+
+// CookRecipe shows what a recipe takes from the pantry and, with deduct set, takes it.
+func CookRecipe(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+
+	recipeID := c.Params("id")
+	userID := middleware.AuthedUserId(c.Locals("user"))
+
+	cookValidator := NewCookValidator()
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(cookValidator); err != nil {
+			response.Message = "Invalid JSON"
+			response.Errors = append(response.Errors, err.Error())
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+		}
+	}
+
+	validationErrors, err := cookValidator.Validate()
+	if err != nil {
+		response.Message = "Validation Errors"
+		response.Errors = validationErrors
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	recipe, err := recipes.GetRecipe(recipeID, userID)
+	if err == nil && recipe.ID == 0 {
+		err = gorm.ErrRecordNotFound
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response.Message = "Recipe Not Found"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	if err != nil {
+		response.Message = "Unable to Retrieve Recipe"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	factor, err := recipe.ScaleFactor(cookValidator.Cook.Servings, cookValidator.Cook.Scale)
+	if err != nil {
+		response.Message = "Unable to Scale Recipe"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	matcher, err := newMatcher(userID)
+	if err != nil {
+		response.Message = "Unable to Check Pantry"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+	plan := matcher.Plan(recipe.ID, factor)
+
+	if cookValidator.Cook.Deduct {
+		if err := Deduct(userID, plan.Lines); err != nil {
+			response.Message = "Unable to Update Pantry"
+			response.Errors = append(response.Errors, err.Error())
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+		}
+	}
+
+	var cookResponse CookResponse
+	cookResponse.SerializeCook(&plan, cookValidator.Cook.Deduct)
+
+	//Respond with Success
+	response.Success = true
+	response.Data = cookResponse
+	return c.JSON(response)
+}
@@ -0,0 +1,292 @@
+package pantry
+
+import (
+	"github.com/anthonyhawkins/savorbook/publish/recipes"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PlanLine is one ingredient, or ready made sub-recipe, a recipe needs and how much of it the pantry covers.
+type PlanLine struct {
+	Name      string
+	Qty       string
+	Unit      string
+	Recipe    string
+	SubRecipe bool
+	Coverage  float64
+	Expired   bool
+	//PantryItemID is the item drawn on, Use is how much of it in the item's own unit
+	PantryItemID uint
+	PantryItem   string
+	Use          float64
+}
+
+type Plan struct {
+	Recipe   recipes.RecipeModel
+	Lines    []PlanLine
+	Coverage float64
+}
+
+// Missing lists the lines the pantry doesn't fully cover.
+func (plan Plan) Missing() []PlanLine {
+	missing := make([]PlanLine, 0)
+	for _, line := range plan.Lines {
+		if line.Coverage < 1 {
+			missing = append(missing, line)
+		}
+	}
+	return missing
+}
+
+// Matcher checks recipes against a pantry. Sub-recipes are expanded into their own
+// ingredients, unless the pantry already holds the sub-recipe itself, i.e. a jar of
+// the pesto a pasta depends on. Each plan draws down its own copy of the pantry so
+// two recipes needing the same eggs don't both count them.
+type Matcher struct {
+	Graph   recipes.DependencyGraph
+	Recipes map[uint]recipes.RecipeModel
+	Pantry  []PantryItemModel
+	Now     time.Time
+
+	remaining map[uint]float64
+}
+
+func NewMatcher(graph recipes.DependencyGraph, recipeModels []recipes.RecipeModel, pantry []PantryItemModel) *Matcher {
+	byID := make(map[uint]recipes.RecipeModel)
+	for _, recipe := range recipeModels {
+		byID[recipe.ID] = recipe
+	}
+	return &Matcher{
+		Graph:   graph,
+		Recipes: byID,
+		Pantry:  pantry,
+		Now:     time.Now(),
+	}
+}
+
+// Plan works out what cooking the recipe factor times over takes from the pantry.
+func (m *Matcher) Plan(recipeID uint, factor float64) Plan {
+	m.remaining = make(map[uint]float64)
+	for _, item := range m.Pantry {
+		if item.Amount != nil {
+			m.remaining[item.ID] = *item.Amount
+		}
+	}
+
+	plan := Plan{
+		Recipe: m.Recipes[recipeID],
+		Lines:  make([]PlanLine, 0),
+	}
+	m.walk(m.Graph.Tree(recipeID), factor, &plan)
+
+	if len(plan.Lines) == 0 {
+		plan.Coverage = 1
+		return plan
+	}
+	total := 0.0
+	for _, line := range plan.Lines {
+		total += line.Coverage
+	}
+	plan.Coverage = total / float64(len(plan.Lines))
+	return plan
+}
+
+func (m *Matcher) walk(node recipes.GraphNode, factor float64, plan *Plan) {
+	recipe := m.Recipes[node.RecipeID]
+	multiplier := node.Batches * factor
+
+	for _, group := range recipe.IngredientGroups {
+		for _, ingredient := range group.Ingredients {
+			amount := ingredient.Amount
+			if ingredient.AmountMax != nil {
+				amount = ingredient.AmountMax
+			}
+			var need *float64
+			if amount != nil {
+				scaled := *amount * multiplier
+				need = &scaled
+			}
+			line := PlanLine{
+				Name:   ingredient.Name,
+				Qty:    recipes.ScaleQuantityText(ingredient.Qty, multiplier),
+				Unit:   ingredient.Unit,
+				Recipe: recipe.Name,
+			}
+			m.match(&line, need, ingredient.CanonicalUnit)
+			plan.Lines = append(plan.Lines, line)
+		}
+	}
+
+	for _, child := range node.Dependent {
+		if child.Cycle {
+			continue
+		}
+
+		//a sub-recipe already made and sitting in the pantry stands in for all its ingredients
+		if index, expired := m.find(child.Name); index >= 0 && !expired {
+			line := PlanLine{
+				Name:      child.Name,
+				Qty:       recipes.ScaleQuantityText(child.Total, factor),
+				Recipe:    recipe.Name,
+				SubRecipe: true,
+			}
+			var need *float64
+			canonicalUnit := ""
+			if quantity, unit := recipes.ParseAmount(line.Qty, ""); quantity != nil {
+				need = &quantity.Max
+				if unit != nil {
+					canonicalUnit = unit.Name
+				}
+			}
+			m.match(&line, need, canonicalUnit)
+			plan.Lines = append(plan.Lines, line)
+			continue
+		}
+
+		m.walk(child, factor, plan)
+	}
+}
+
+// match finds the pantry item for the line and draws down as much of the need as it can.
+func (m *Matcher) match(line *PlanLine, need *float64, needUnit string) {
+	index, expired := m.find(line.Name)
+	if index < 0 {
+		return
+	}
+	if expired {
+		line.Expired = true
+		return
+	}
+
+	item := m.Pantry[index]
+	line.PantryItemID = item.ID
+	line.PantryItem = item.Name
+	line.Coverage = 1
+
+	have, measured := m.remaining[item.ID]
+	if need == nil || !measured {
+		//without both amounts there is no telling if it's enough, having some will do
+		return
+	}
+
+	needBase, haveFactor, ok := comparable(*need, needUnit, item.CanonicalUnit, line.Name)
+	if !ok || needBase <= 0 {
+		return
+	}
+
+	haveBase := have * haveFactor
+	if haveBase < needBase {
+		line.Coverage = haveBase / needBase
+		needBase = haveBase
+	}
+	line.Use = needBase / haveFactor
+	m.remaining[item.ID] = have - line.Use
+}
+
+// comparable brings a needed amount and a pantry amount into the same base unit.
+// It returns the need in that base and the factor which turns the pantry item's
+// amount into it. Volumes are weighed when one side is by weight and the other by
+// volume, provided the ingredient's density is known.
+func comparable(need float64, needUnit string, haveUnit string, name string) (float64, float64, bool) {
+	if needUnit == haveUnit {
+		return need, 1, true
+	}
+
+	from, fromOk := recipes.GetUnit(needUnit)
+	to, toOk := recipes.GetUnit(haveUnit)
+	if !fromOk || !toOk || from.Kind == recipes.Count || to.Kind == recipes.Count ||
+		from.Kind == recipes.Temperature || to.Kind == recipes.Temperature {
+		return 0, 0, false
+	}
+
+	if from.Kind == to.Kind {
+		return need * from.Factor, to.Factor, true
+	}
+
+	density, ok := recipes.IngredientDensity(name)
+	if !ok {
+		return 0, 0, false
+	}
+	if from.Kind == recipes.Volume {
+		return need * from.Factor * density, to.Factor, true
+	}
+	return need * from.Factor, to.Factor * density, true
+}
+
+// find picks the pantry item for an ingredient name: an exact match first, then an
+// item whose name is a whole word part of the ingredient, or the other way around,
+// so "flour" in the pantry covers "all-purpose flour". Unexpired items win, and
+// among those the one expiring soonest, as the pantry is ordered by expiry.
+func (m *Matcher) find(name string) (int, bool) {
+	target := normalizeName(name)
+	if target == "" {
+		return -1, false
+	}
+
+	best, bestScore, bestExpired := -1, 0, false
+	for i, item := range m.Pantry {
+		candidate := normalizeName(item.Name)
+		score := 0
+		switch {
+		case candidate == target:
+			score = 3
+		case containsWords(target, candidate) || containsWords(candidate, target):
+			score = 2
+		default:
+			continue
+		}
+
+		expired := item.Expired(m.Now)
+		if !expired {
+			score += 10
+		}
+		if score > bestScore {
+			best, bestScore, bestExpired = i, score, expired
+		}
+	}
+	return best, bestExpired
+}
+
+var nonWord = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+
+// normalizeName lower cases and singularises every word so "Large Eggs" and "large egg" agree.
+func normalizeName(name string) string {
+	words := strings.Fields(nonWord.ReplaceAllString(strings.ToLower(name), " "))
+	for i, word := range words {
+		switch {
+		case len(word) > 3 && strings.HasSuffix(word, "ies"):
+			words[i] = strings.TrimSuffix(word, "ies") + "y"
+		case len(word) > 3 && strings.HasSuffix(word, "oes"):
+			words[i] = strings.TrimSuffix(word, "es")
+		case len(word) > 2 && strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss"):
+			words[i] = strings.TrimSuffix(word, "s")
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+func containsWords(text string, words string) bool {
+	return strings.Contains(" "+text+" ", " "+words+" ")
+}
+
+// Rank plans every recipe and orders them by how much of each the pantry covers.
+func (m *Matcher) Rank() []Plan {
+	plans := make([]Plan, 0)
+	for id := range m.Recipes {
+		plans = append(plans, m.Plan(id, 1))
+	}
+
+	sort.Slice(plans, func(i, j int) bool {
+		if plans[i].Coverage != plans[j].Coverage {
+			return plans[i].Coverage > plans[j].Coverage
+		}
+		left, right := len(plans[i].Missing()), len(plans[j].Missing())
+		if left != right {
+			return left < right
+		}
+		return plans[i].Recipe.Name < plans[j].Recipe.Name
+	})
+	return plans
+}
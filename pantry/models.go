@@ -0,0 +1,153 @@
+package pantry
+
+import (
+	"github.com/anthonyhawkins/savorbook/database"
+	"github.com/anthonyhawkins/savorbook/publish/recipes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+type PantryItemModel struct {
+	gorm.Model
+	UserID        uint
+	Name          string
+	Qty           string
+	Unit          string
+	Amount        *float64
+	CanonicalUnit string
+	Expires       *time.Time
+}
+
+// parseAmount fills in the structured amount the same way recipe ingredients are parsed.
+func (model *PantryItemModel) parseAmount() {
+	model.Amount = nil
+	model.CanonicalUnit = ""
+
+	quantity, unit := recipes.ParseAmount(model.Qty, model.Unit)
+	if quantity != nil {
+		amount := quantity.Max
+		model.Amount = &amount
+	}
+	if unit != nil {
+		model.CanonicalUnit = unit.Name
+	}
+}
+
+func (model *PantryItemModel) Expired(now time.Time) bool {
+	return model.Expires != nil && model.Expires.Before(now)
+}
+
+func CreatePantryItem(item *PantryItemModel) error {
+	db := database.GetDB()
+	return db.Create(item).Error
+}
+
+func GetPantryItem(itemID string, userID uint) (PantryItemModel, error) {
+	db := database.GetDB()
+	var item PantryItemModel
+
+	result := db.Where(map[string]interface{}{
+		"id":      itemID,
+		"user_id": userID,
+	}).First(&item)
+
+	return item, result.Error
+}
+
+func GetPantryItems(userID uint, pageNum string, pageSize string) ([]PantryItemModel, error) {
+	db := database.GetDB()
+	var items []PantryItemModel
+
+	result := db.Scopes(database.Paginate(pageNum, pageSize)).Where(map[string]interface{}{
+		"user_id": userID,
+	}).Order("expires IS NULL, expires, name").Find(&items)
+
+	return items, result.Error
+}
+
+// GetPantry is the whole pantry, for matching against recipes.
+func GetPantry(userID uint) ([]PantryItemModel, error) {
+	db := database.GetDB()
+	var items []PantryItemModel
+
+	result := db.Where(map[string]interface{}{
+		"user_id": userID,
+	}).Order("expires IS NULL, expires, id").Find(&items)
+
+	return items, result.Error
+}
+
+func (model *PantryItemModel) Update() error {
+	db := database.GetDB()
+	return db.Model(model).Select(
+		"Name", "Qty", "Unit", "Amount", "CanonicalUnit", "Expires",
+	).Updates(model).Error
+}
+
+func DeletePantryItem(itemID string, userID uint) error {
+	db := database.GetDB()
+
+	result := db.Where(map[string]interface{}{
+		"id":      itemID,
+		"user_id": userID,
+	}).Delete(&PantryItemModel{})
+
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// Deduct takes what a cook used out of the pantry in one transaction. Items which
+// run out are removed, items which were never measured are left alone as there
+// is no telling how much is left.
+func Deduct(userID uint, lines []PlanLine) error {
+	db := database.GetDB()
+
+	used := make(map[uint]float64)
+	for _, line := range lines {
+		if line.PantryItemID != 0 && line.Use > 0 {
+			used[line.PantryItemID] += line.Use
+		}
+	}
+	if len(used) == 0 {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for itemID, use := range used {
+			//locked so two cooks deducting at once both come off the amount
+			var item PantryItemModel
+			result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where(map[string]interface{}{
+				"id":      itemID,
+				"user_id": userID,
+			}).First(&item)
+			if result.Error != nil {
+				return result.Error
+			}
+			if item.Amount == nil {
+				continue
+			}
+
+			left := *item.Amount - use
+			if left <= 0.0001 {
+				if err := tx.Delete(&item).Error; err != nil {
+					return err
+				}
+				continue
+			}
+
+			item.Amount = &left
+			//a unit typed into the quantity, i.e. "2 cups", stays with it
+			item.Qty = recipes.ReplaceQuantityText(item.Qty, left)
+			if err := tx.Model(&item).Select("Qty", "Amount").Updates(&item).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,87 @@
+package pantry
+
+import "time"
+
+type PantryItemResponse struct {
+	ID            uint     `json:"id"`
+	Name          string   `json:"name"`
+	Qty           string   `json:"qty"`
+	Unit          string   `json:"unit"`
+	Amount        *float64 `json:"amount"`
+	CanonicalUnit string   `json:"canonicalUnit"`
+	Expires       string   `json:"expires"`
+	Expired       bool     `json:"expired"`
+}
+
+type PlanResponse struct {
+	ID       uint           `json:"id"`
+	Name     string         `json:"name"`
+	Image    string         `json:"image"`
+	Coverage float64        `json:"coverage"`
+	Have     int            `json:"have"`
+	Total    int            `json:"total"`
+	Missing  []LineResponse `json:"missing"`
+}
+
+type CookResponse struct {
+	PlanResponse
+	Lines    []LineResponse `json:"lines"`
+	Deducted bool           `json:"deducted"`
+}
+
+type LineResponse struct {
+	Name       string  `json:"name"`
+	Qty        string  `json:"qty"`
+	Unit       string  `json:"unit"`
+	Recipe     string  `json:"recipe"`
+	SubRecipe  bool    `json:"subRecipe,omitempty"`
+	Coverage   float64 `json:"coverage"`
+	Expired    bool    `json:"expired,omitempty"`
+	PantryItem string  `json:"pantryItem,omitempty"`
+}
+
+func (r *PantryItemResponse) SerializePantryItem(model *PantryItemModel) {
+	r.ID = model.ID
+	r.Name = model.Name
+	r.Qty = model.Qty
+	r.Unit = model.Unit
+	r.Amount = model.Amount
+	r.CanonicalUnit = model.CanonicalUnit
+	if model.Expires != nil {
+		r.Expires = model.Expires.Format("2006-01-02")
+	}
+	r.Expired = model.Expired(time.Now())
+}
+
+func (r *PlanResponse) SerializePlan(plan *Plan) {
+	r.ID = plan.Recipe.ID
+	r.Name = plan.Recipe.Name
+	r.Image = plan.Recipe.Image
+	r.Coverage = plan.Coverage
+	r.Total = len(plan.Lines)
+	r.Missing = serializeLines(plan.Missing())
+	r.Have = r.Total - len(r.Missing)
+}
+
+func (r *CookResponse) SerializeCook(plan *Plan, deducted bool) {
+	r.SerializePlan(plan)
+	r.Lines = serializeLines(plan.Lines)
+	r.Deducted = deducted
+}
+
+func serializeLines(planLines []PlanLine) []LineResponse {
+	lines := make([]LineResponse, 0)
+	for _, planLine := range planLines {
+		var line LineResponse
+		line.Name = planLine.Name
+		line.Qty = planLine.Qty
+		line.Unit = planLine.Unit
+		line.Recipe = planLine.Recipe
+		line.SubRecipe = planLine.SubRecipe
+		line.Coverage = planLine.Coverage
+		line.Expired = planLine.Expired
+		line.PantryItem = planLine.PantryItem
+		lines = append(lines, line)
+	}
+	return lines
+}
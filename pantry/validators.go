@@ -0,0 +1,74 @@
+package pantry
+
+import (
+	"github.com/go-playground/validator/v10"
+	"time"
+)
+
+type PantryItemValidator struct {
+	Item struct {
+		Name    string `json:"name"    validate:"required,max=75"`
+		Qty     string `json:"qty"     validate:"max=12"`
+		Unit    string `json:"unit"    validate:"max=12"`
+		Expires string `json:"expires" validate:"omitempty,datetime=2006-01-02"`
+	} `json:"item"`
+	Model PantryItemModel `json:"-"`
+}
+
+type CookValidator struct {
+	Cook struct {
+		Servings string `json:"servings" validate:"omitempty,max=12"`
+		Scale    string `json:"scale"    validate:"omitempty,max=12"`
+		Deduct   bool   `json:"deduct"`
+	} `json:"cook"`
+}
+
+func NewPantryItemValidator() *PantryItemValidator {
+	return &PantryItemValidator{}
+}
+
+func NewCookValidator() *CookValidator {
+	return &CookValidator{}
+}
+
+func validate(v interface{}) ([]string, error) {
+	var errors []string
+	validate := validator.New()
+	err := validate.Struct(v)
+	if err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			message := err.Field() + " = " + err.Tag()
+			errors = append(errors, message)
+		}
+	}
+
+	return errors, err
+}
+
+func (v *PantryItemValidator) Validate() ([]string, error) {
+	return validate(v)
+}
+
+func (v *CookValidator) Validate() ([]string, error) {
+	return validate(v)
+}
+
+func (v *PantryItemValidator) BindModel(userID uint) error {
+	v.Model.UserID = userID
+	v.Model.Name = v.Item.Name
+	v.Model.Qty = v.Item.Qty
+	v.Model.Unit = v.Item.Unit
+	v.Model.parseAmount()
+
+	v.Model.Expires = nil
+	if v.Item.Expires != "" {
+		expires, err := time.Parse("2006-01-02", v.Item.Expires)
+		if err != nil {
+			return err
+		}
+		//good until the end of the day
+		expires = expires.Add(24*time.Hour - time.Second)
+		v.Model.Expires = &expires
+	}
+	return nil
+}
@@ -0,0 +1,404 @@
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	JSONPatchType  = "application/json-patch+json"
+	MergePatchType = "application/merge-patch+json"
+)
+
+var (
+	ErrUnsupportedType = errors.New("patch must be application/json-patch+json or application/merge-patch+json")
+	ErrInvalidPatch    = errors.New("invalid patch")
+	ErrTestFailed      = errors.New("patch test failed")
+)
+
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Apply patches the JSON document with body, read as RFC 6902 JSON Patch or
+// RFC 7386 JSON Merge Patch depending on the content type. Plain application/json
+// is taken as a JSON Patch when it's an array and a merge patch otherwise. The
+// patched document is returned along with whether anything actually changed.
+func Apply(contentType string, document []byte, body []byte) ([]byte, bool, error) {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	if mediaType == "application/json" {
+		mediaType = MergePatchType
+		if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+			mediaType = JSONPatchType
+		}
+	}
+
+	original, err := decode(document)
+	if err != nil {
+		return nil, false, err
+	}
+	target, err := decode(document)
+	if err != nil {
+		return nil, false, err
+	}
+
+	switch mediaType {
+	case JSONPatchType:
+		var operations []Operation
+		if err := json.Unmarshal(body, &operations); err != nil {
+			return nil, false, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+		}
+		target, err = ApplyJSONPatch(target, operations)
+	case MergePatchType:
+		var mergePatch interface{}
+		if mergePatch, err = decode(body); err != nil {
+			return nil, false, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+		}
+		target = ApplyMergePatch(target, mergePatch)
+	default:
+		return nil, false, ErrUnsupportedType
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	patched, err := json.Marshal(target)
+	if err != nil {
+		return nil, false, err
+	}
+	return patched, !equal(original, target), nil
+}
+
+// decode keeps numbers as written so ids and quantities survive the round trip untouched.
+func decode(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func ApplyJSONPatch(document interface{}, operations []Operation) (interface{}, error) {
+	var err error
+	for i, operation := range operations {
+		if document, err = applyOperation(document, operation); err != nil {
+			if errors.Is(err, ErrTestFailed) {
+				return nil, fmt.Errorf("%w: operation %d at %q", err, i, operation.Path)
+			}
+			return nil, fmt.Errorf("%w: operation %d (%s %q): %v", ErrInvalidPatch, i, operation.Op, operation.Path, err)
+		}
+	}
+	return document, nil
+}
+
+func applyOperation(document interface{}, operation Operation) (interface{}, error) {
+	path, err := parsePointer(operation.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	value := func() (interface{}, error) {
+		if len(operation.Value) == 0 {
+			return nil, errors.New("value is required")
+		}
+		return decode(operation.Value)
+	}
+
+	switch operation.Op {
+	case "add":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		return add(document, path, v)
+	case "remove":
+		_, document, err = remove(document, path)
+		return document, err
+	case "replace":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		if len(path) == 0 {
+			return v, nil
+		}
+		if _, document, err = remove(document, path); err != nil {
+			return nil, err
+		}
+		return add(document, path, v)
+	case "move", "copy":
+		from, err := parsePointer(operation.From)
+		if err != nil {
+			return nil, err
+		}
+		if operation.Op == "move" {
+			if isPrefix(from, path) && len(from) < len(path) {
+				return nil, errors.New("can not move a value into itself")
+			}
+			var v interface{}
+			if v, document, err = remove(document, from); err != nil {
+				return nil, err
+			}
+			return add(document, path, v)
+		}
+		v, err := get(document, from)
+		if err != nil {
+			return nil, err
+		}
+		copied, err := decodeCopy(v)
+		if err != nil {
+			return nil, err
+		}
+		return add(document, path, copied)
+	case "test":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		current, err := get(document, path)
+		if err != nil || !equal(current, v) {
+			return nil, ErrTestFailed
+		}
+		return document, nil
+	}
+	return nil, fmt.Errorf("unknown op %q", operation.Op)
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into its unescaped tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("path %q must start with /", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+func isPrefix(prefix []string, path []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func arrayIndex(token string, length int, appending bool) (int, error) {
+	if appending && token == "-" {
+		return length, nil
+	}
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	max := length - 1
+	if appending {
+		max = length
+	}
+	if index > max {
+		return 0, fmt.Errorf("array index %d out of range", index)
+	}
+	return index, nil
+}
+
+func get(node interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch container := node.(type) {
+		case map[string]interface{}:
+			value, ok := container[token]
+			if !ok {
+				return nil, fmt.Errorf("%q does not exist", token)
+			}
+			node = value
+		case []interface{}:
+			index, err := arrayIndex(token, len(container), false)
+			if err != nil {
+				return nil, err
+			}
+			node = container[index]
+		default:
+			return nil, fmt.Errorf("%q does not exist", token)
+		}
+	}
+	return node, nil
+}
+
+// update walks down to the parent of the last token and hands it to change, then
+// writes whatever change returns back up the path. Arrays change length when
+// added to or removed from, so every level is reassigned on the way back.
+func update(node interface{}, path []string, change func(parent interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return change(node, path[0])
+	}
+
+	child, err := get(node, path[:1])
+	if err != nil {
+		return nil, err
+	}
+	child, err = update(child, path[1:], change)
+	if err != nil {
+		return nil, err
+	}
+
+	switch container := node.(type) {
+	case map[string]interface{}:
+		container[path[0]] = child
+	case []interface{}:
+		index, _ := arrayIndex(path[0], len(container), false)
+		container[index] = child
+	}
+	return node, nil
+}
+
+func add(document interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return update(document, path, func(parent interface{}, token string) (interface{}, error) {
+		switch container := parent.(type) {
+		case map[string]interface{}:
+			container[token] = value
+			return container, nil
+		case []interface{}:
+			index, err := arrayIndex(token, len(container), true)
+			if err != nil {
+				return nil, err
+			}
+			container = append(container, nil)
+			copy(container[index+1:], container[index:])
+			container[index] = value
+			return container, nil
+		}
+		return nil, fmt.Errorf("can not add %q to a value", token)
+	})
+}
+
+func remove(document interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil, errors.New("can not remove the whole document")
+	}
+	var removed interface{}
+	document, err := update(document, path, func(parent interface{}, token string) (interface{}, error) {
+		switch container := parent.(type) {
+		case map[string]interface{}:
+			value, ok := container[token]
+			if !ok {
+				return nil, fmt.Errorf("%q does not exist", token)
+			}
+			removed = value
+			delete(container, token)
+			return container, nil
+		case []interface{}:
+			index, err := arrayIndex(token, len(container), false)
+			if err != nil {
+				return nil, err
+			}
+			removed = container[index]
+			return append(container[:index:index], container[index+1:]...), nil
+		}
+		return nil, fmt.Errorf("%q does not exist", token)
+	})
+	return removed, document, err
+}
+
+func decodeCopy(value interface{}) (interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return decode(data)
+}
+
+// ApplyMergePatch follows RFC 7386: objects merge key by key, null removes a key and anything else replaces.
+func ApplyMergePatch(target interface{}, mergePatch interface{}) interface{} {
+	patchObject, ok := mergePatch.(map[string]interface{})
+	if !ok {
+		return mergePatch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = make(map[string]interface{})
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = ApplyMergePatch(targetObject[key], value)
+	}
+	return targetObject
+}
+
+// equal compares decoded JSON, treating 1 and 1.0 as the same number.
+func equal(a interface{}, b interface{}) bool {
+	switch left := a.(type) {
+	case map[string]interface{}:
+		right, ok := b.(map[string]interface{})
+		if !ok || len(left) != len(right) {
+			return false
+		}
+		for key, value := range left {
+			other, ok := right[key]
+			if !ok || !equal(value, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		right, ok := b.([]interface{})
+		if !ok || len(left) != len(right) {
+			return false
+		}
+		for i := range left {
+			if !equal(left[i], right[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		right, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		x, errX := left.Float64()
+		y, errY := right.Float64()
+		if errX != nil || errY != nil {
+			return left == right
+		}
+		return x == y
+	}
+	return a == b
+}
+
+// Status is the HTTP status a failed patch should be answered with.
+func Status(err error) int {
+	switch {
+	case errors.Is(err, ErrUnsupportedType):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, ErrTestFailed):
+		return http.StatusConflict
+	}
+	return http.StatusUnprocessableEntity
+}
@@ -0,0 +1,309 @@
+package patch
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestApplyJSONPatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		patch    string
+		want     string
+	}{
+		{
+			name:     "add member",
+			document: `{"foo":"bar"}`,
+			patch:    `[{"op":"add","path":"/baz","value":"qux"}]`,
+			want:     `{"foo":"bar","baz":"qux"}`,
+		},
+		{
+			name:     "add replaces member",
+			document: `{"foo":"bar"}`,
+			patch:    `[{"op":"add","path":"/foo","value":"qux"}]`,
+			want:     `{"foo":"qux"}`,
+		},
+		{
+			name:     "add inserts into array",
+			document: `{"foo":["bar","baz"]}`,
+			patch:    `[{"op":"add","path":"/foo/1","value":"qux"}]`,
+			want:     `{"foo":["bar","qux","baz"]}`,
+		},
+		{
+			name:     "add appends with dash",
+			document: `{"foo":["bar"]}`,
+			patch:    `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`,
+			want:     `{"foo":["bar",["abc","def"]]}`,
+		},
+		{
+			name:     "add nested member",
+			document: `{"foo":{"bar":1}}`,
+			patch:    `[{"op":"add","path":"/foo/baz","value":{"qux":null}}]`,
+			want:     `{"foo":{"bar":1,"baz":{"qux":null}}}`,
+		},
+		{
+			name:     "add whole document",
+			document: `{"foo":"bar"}`,
+			patch:    `[{"op":"add","path":"","value":[1,2]}]`,
+			want:     `[1,2]`,
+		},
+		{
+			name:     "remove member",
+			document: `{"baz":"qux","foo":"bar"}`,
+			patch:    `[{"op":"remove","path":"/baz"}]`,
+			want:     `{"foo":"bar"}`,
+		},
+		{
+			name:     "remove array element",
+			document: `{"foo":["bar","qux","baz"]}`,
+			patch:    `[{"op":"remove","path":"/foo/1"}]`,
+			want:     `{"foo":["bar","baz"]}`,
+		},
+		{
+			name:     "replace member",
+			document: `{"baz":"qux","foo":"bar"}`,
+			patch:    `[{"op":"replace","path":"/baz","value":"boo"}]`,
+			want:     `{"baz":"boo","foo":"bar"}`,
+		},
+		{
+			name:     "replace array element",
+			document: `{"foo":[1,2,3]}`,
+			patch:    `[{"op":"replace","path":"/foo/0","value":9}]`,
+			want:     `{"foo":[9,2,3]}`,
+		},
+		{
+			name:     "move member",
+			document: `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+			patch:    `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			want:     `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`,
+		},
+		{
+			name:     "move array element",
+			document: `{"foo":["all","grass","cows","eat"]}`,
+			patch:    `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`,
+			want:     `{"foo":["all","cows","eat","grass"]}`,
+		},
+		{
+			name:     "copy member",
+			document: `{"foo":{"bar":[1]}}`,
+			patch:    `[{"op":"copy","from":"/foo/bar","path":"/baz"},{"op":"add","path":"/baz/-","value":2}]`,
+			want:     `{"foo":{"bar":[1]},"baz":[1,2]}`,
+		},
+		{
+			name:     "test passes",
+			document: `{"baz":"qux","foo":["a",2,"c"]}`,
+			patch:    `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2.0}]`,
+			want:     `{"baz":"qux","foo":["a",2,"c"]}`,
+		},
+		{
+			name:     "escaped slash",
+			document: `{"a/b":1}`,
+			patch:    `[{"op":"replace","path":"/a~1b","value":2}]`,
+			want:     `{"a/b":2}`,
+		},
+		{
+			name:     "escaped tilde",
+			document: `{"m~n":1,"m~1n":3}`,
+			patch:    `[{"op":"remove","path":"/m~0n"},{"op":"test","path":"/m~01n","value":3}]`,
+			want:     `{"m~1n":3}`,
+		},
+		{
+			name:     "operations apply in order",
+			document: `{"name":"Bread","tags":["loaf"]}`,
+			patch:    `[{"op":"replace","path":"/name","value":"Rye"},{"op":"add","path":"/tags/0","value":"rye"},{"op":"remove","path":"/tags/1"}]`,
+			want:     `{"name":"Rye","tags":["rye"]}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			patched, _, err := Apply(JSONPatchType, []byte(test.document), []byte(test.patch))
+			if err != nil {
+				t.Fatalf("Apply: %v", err)
+			}
+			expectJSON(t, patched, test.want)
+		})
+	}
+}
+
+func TestApplyJSONPatchErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		patch    string
+		want     error
+		status   int
+	}{
+		{
+			name:     "test fails",
+			document: `{"baz":"qux"}`,
+			patch:    `[{"op":"test","path":"/baz","value":"bar"}]`,
+			want:     ErrTestFailed,
+			status:   http.StatusConflict,
+		},
+		{
+			name:     "failed test undoes earlier operations",
+			document: `{"baz":"qux"}`,
+			patch:    `[{"op":"add","path":"/foo","value":1},{"op":"test","path":"/foo","value":2}]`,
+			want:     ErrTestFailed,
+			status:   http.StatusConflict,
+		},
+		{
+			name:     "remove missing member",
+			document: `{"foo":"bar"}`,
+			patch:    `[{"op":"remove","path":"/baz"}]`,
+			want:     ErrInvalidPatch,
+			status:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "replace missing member",
+			document: `{"foo":"bar"}`,
+			patch:    `[{"op":"replace","path":"/baz","value":1}]`,
+			want:     ErrInvalidPatch,
+			status:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "add to missing parent",
+			document: `{"foo":"bar"}`,
+			patch:    `[{"op":"add","path":"/baz/bat","value":"qux"}]`,
+			want:     ErrInvalidPatch,
+			status:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "array index out of range",
+			document: `{"foo":["bar"]}`,
+			patch:    `[{"op":"add","path":"/foo/5","value":"qux"}]`,
+			want:     ErrInvalidPatch,
+			status:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "dash only appends",
+			document: `{"foo":["bar"]}`,
+			patch:    `[{"op":"remove","path":"/foo/-"}]`,
+			want:     ErrInvalidPatch,
+			status:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "leading zero index",
+			document: `{"foo":["bar","baz"]}`,
+			patch:    `[{"op":"remove","path":"/foo/01"}]`,
+			want:     ErrInvalidPatch,
+			status:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "pointer without slash",
+			document: `{"foo":"bar"}`,
+			patch:    `[{"op":"remove","path":"foo"}]`,
+			want:     ErrInvalidPatch,
+			status:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "move into itself",
+			document: `{"foo":{"bar":1}}`,
+			patch:    `[{"op":"move","from":"/foo","path":"/foo/bar"}]`,
+			want:     ErrInvalidPatch,
+			status:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "unknown op",
+			document: `{"foo":"bar"}`,
+			patch:    `[{"op":"frob","path":"/foo"}]`,
+			want:     ErrInvalidPatch,
+			status:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "patch is not an array",
+			document: `{"foo":"bar"}`,
+			patch:    `{"op":"remove","path":"/foo"}`,
+			want:     ErrInvalidPatch,
+			status:   http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, _, err := Apply(JSONPatchType, []byte(test.document), []byte(test.patch))
+			if !errors.Is(err, test.want) {
+				t.Fatalf("Apply: got %v, want %v", err, test.want)
+			}
+			if status := Status(err); status != test.status {
+				t.Errorf("Status: got %d, want %d", status, test.status)
+			}
+		})
+	}
+}
+
+func TestApplyMergePatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		patch    string
+		want     string
+	}{
+		{name: "replace member", document: `{"a":"b"}`, patch: `{"a":"c"}`, want: `{"a":"c"}`},
+		{name: "add member", document: `{"a":"b"}`, patch: `{"b":"c"}`, want: `{"a":"b","b":"c"}`},
+		{name: "null deletes member", document: `{"a":"b"}`, patch: `{"a":null}`, want: `{}`},
+		{name: "null deletes one of several", document: `{"a":"b","b":"c"}`, patch: `{"a":null}`, want: `{"b":"c"}`},
+		{name: "null for missing member", document: `{"a":"b"}`, patch: `{"c":null}`, want: `{"a":"b"}`},
+		{name: "array replaces array", document: `{"a":["b"]}`, patch: `{"a":"c"}`, want: `{"a":"c"}`},
+		{name: "value replaces array", document: `{"a":"c"}`, patch: `{"a":["b"]}`, want: `{"a":["b"]}`},
+		{name: "nested null deletes", document: `{"a":{"b":"c"}}`, patch: `{"a":{"b":"d","c":null}}`, want: `{"a":{"b":"d"}}`},
+		{name: "arrays are not merged", document: `{"a":[{"b":"c"}]}`, patch: `{"a":[1]}`, want: `{"a":[1]}`},
+		{name: "null inside new object", document: `{}`, patch: `{"a":{"bb":{"ccc":null}}}`, want: `{"a":{"bb":{}}}`},
+		{name: "object replaces value", document: `{"a":"foo"}`, patch: `{"a":{"b":"c"}}`, want: `{"a":{"b":"c"}}`},
+		{name: "number kept as written", document: `{"id":12345678901234567890}`, patch: `{"name":"Bread"}`, want: `{"id":12345678901234567890,"name":"Bread"}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			patched, _, err := Apply(MergePatchType, []byte(test.document), []byte(test.patch))
+			if err != nil {
+				t.Fatalf("Apply: %v", err)
+			}
+			expectJSON(t, patched, test.want)
+		})
+	}
+}
+
+func TestApplyContentType(t *testing.T) {
+	document := []byte(`{"name":"Bread"}`)
+
+	patched, changed, err := Apply("application/json; charset=utf-8", document, []byte(`[{"op":"replace","path":"/name","value":"Rye"}]`))
+	if err != nil || !changed {
+		t.Fatalf("JSON Patch sent as application/json: %v %v", changed, err)
+	}
+	expectJSON(t, patched, `{"name":"Rye"}`)
+
+	patched, changed, err = Apply("application/json", document, []byte(`{"name":"Rye"}`))
+	if err != nil || !changed {
+		t.Fatalf("merge patch sent as application/json: %v %v", changed, err)
+	}
+	expectJSON(t, patched, `{"name":"Rye"}`)
+
+	_, changed, err = Apply(MergePatchType, document, []byte(`{"name":"Bread"}`))
+	if err != nil || changed {
+		t.Fatalf("a patch that changes nothing: %v %v", changed, err)
+	}
+
+	_, _, err = Apply("text/plain", document, []byte(`{"name":"Rye"}`))
+	if !errors.Is(err, ErrUnsupportedType) || Status(err) != http.StatusUnsupportedMediaType {
+		t.Fatalf("text/plain: %v", err)
+	}
+}
+
+func expectJSON(t *testing.T, got []byte, want string) {
+	t.Helper()
+	gotValue, err := decode(got)
+	if err != nil {
+		t.Fatalf("patched document: %v", err)
+	}
+	wantValue, err := decode([]byte(want))
+	if err != nil {
+		t.Fatalf("want: %v", err)
+	}
+	if !equal(gotValue, wantValue) {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,288 @@
+// Package pdf writes PDF documents made of text, filled shapes and JPEG images,
+// which is all a printed cookbook needs. It knows nothing about cookbooks.
+package pdf
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Document is built page by page and written out once, with WriteTo. Positions are
+// in points from the top left corner of the trimmed page, y growing downwards.
+// Anything drawn outside the trim, no further out than Bleed, still prints and is
+// cut off when the printed sheet is trimmed.
+type Document struct {
+	Width  float64
+	Height float64
+	Bleed  float64
+	Title  string
+	Author string
+
+	pages     []*Page
+	images    []*Image
+	bookmarks []*bookmark
+}
+
+type bookmark struct {
+	title    string
+	page     *Page
+	children []*bookmark
+}
+
+// New starts a document with pages of width by height points once trimmed.
+func New(width float64, height float64, bleed float64) *Document {
+	return &Document{Width: width, Height: height, Bleed: bleed}
+}
+
+// AddPage adds a blank page at the end of the document.
+func (d *Document) AddPage() *Page {
+	page := &Page{doc: d, number: len(d.pages) + 1, images: make(map[*Image]bool)}
+	d.pages = append(d.pages, page)
+	return page
+}
+
+// PageCount is how many pages have been added so far.
+func (d *Document) PageCount() int {
+	return len(d.pages)
+}
+
+// Bookmark adds an entry to the outline readers show beside the document. Level 0
+// entries are top level, level 1 entries nest under the last level 0 entry.
+func (d *Document) Bookmark(title string, page *Page, level int) {
+	entry := &bookmark{title: title, page: page}
+	if level > 0 && len(d.bookmarks) > 0 {
+		parent := d.bookmarks[len(d.bookmarks)-1]
+		parent.children = append(parent.children, entry)
+		return
+	}
+	d.bookmarks = append(d.bookmarks, entry)
+}
+
+// WriteTo writes the finished document.
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	out := &counter{w: bufio.NewWriter(w)}
+	objects := d.objects()
+
+	out.printf("%%PDF-1.4\n%%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int64, len(objects))
+	for i, object := range objects {
+		offsets[i] = out.n
+		out.printf("%d 0 obj\n", i+1)
+		out.write(object)
+		out.printf("\nendobj\n")
+	}
+
+	xref := out.n
+	out.printf("xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		out.printf("%010d 00000 n \n", offset)
+	}
+	out.printf("trailer\n<< /Size %d /Root 1 0 R /Info 3 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	if out.err != nil {
+		return out.n, out.err
+	}
+	return out.n, out.w.(*bufio.Writer).Flush()
+}
+
+// objects renders every object in the document, object number i+1 at index i. The
+// catalog, page tree and info dictionary are always objects 1 to 3.
+func (d *Document) objects() [][]byte {
+	next := 3
+	number := func() int {
+		next++
+		return next
+	}
+
+	fontObjects := make(map[string]int)
+	for _, font := range fonts {
+		fontObjects[font.resource] = number()
+	}
+	imageObjects := make(map[*Image]int)
+	for _, image := range d.images {
+		imageObjects[image] = number()
+	}
+	pageObjects := make(map[*Page]int)
+	contentObjects := make(map[*Page]int)
+	linkObjects := make(map[*Page][]int)
+	for _, page := range d.pages {
+		pageObjects[page] = number()
+		contentObjects[page] = number()
+		for range page.links {
+			linkObjects[page] = append(linkObjects[page], number())
+		}
+	}
+	outlineObject := 0
+	bookmarkObjects := make(map[*bookmark]int)
+	if len(d.bookmarks) > 0 {
+		outlineObject = number()
+		for _, entry := range d.bookmarks {
+			bookmarkObjects[entry] = number()
+			for _, child := range entry.children {
+				bookmarkObjects[child] = number()
+			}
+		}
+	}
+
+	objects := make([][]byte, next)
+	set := func(object int, format string, args ...interface{}) {
+		objects[object-1] = []byte(fmt.Sprintf(format, args...))
+	}
+
+	catalog := "<< /Type /Catalog /Pages 2 0 R"
+	if outlineObject != 0 {
+		catalog += fmt.Sprintf(" /Outlines %d 0 R /PageMode /UseOutlines", outlineObject)
+	}
+	set(1, "%s >>", catalog)
+
+	kids := make([]string, 0, len(d.pages))
+	for _, page := range d.pages {
+		kids = append(kids, ref(pageObjects[page]))
+	}
+	set(2, "<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages))
+	set(3, "<< /Title %s /Author %s /Producer (savorbook) >>", text(d.Title), text(d.Author))
+
+	var fontResources []string
+	for _, font := range fonts {
+		set(fontObjects[font.resource], "<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", font.name)
+		fontResources = append(fontResources, fmt.Sprintf("/%s %s", font.resource, ref(fontObjects[font.resource])))
+	}
+
+	for _, image := range d.images {
+		objects[imageObjects[image]-1] = image.object()
+	}
+
+	media := d.mediaBox()
+	trim := fmt.Sprintf("[%s %s %s %s]", num(d.Bleed), num(d.Bleed), num(d.Bleed+d.Width), num(d.Bleed+d.Height))
+	for _, page := range d.pages {
+		var imageResources []string
+		for _, image := range d.images {
+			if page.images[image] {
+				imageResources = append(imageResources, fmt.Sprintf("/%s %s", image.resource, ref(imageObjects[image])))
+			}
+		}
+		var annots []string
+		for i, link := range page.links {
+			annots = append(annots, ref(linkObjects[page][i]))
+			set(linkObjects[page][i], "<< /Type /Annot /Subtype /Link /Rect [%s] /Border [0 0 0] /Dest [%s /Fit] >>",
+				link.rect, ref(pageObjects[link.target]))
+		}
+
+		set(pageObjects[page], "<< /Type /Page /Parent 2 0 R /MediaBox %s /BleedBox %s /TrimBox %s "+
+			"/Resources << /Font << %s >> /XObject << %s >> >> /Contents %s /Annots [%s] >>",
+			media, media, trim, strings.Join(fontResources, " "), strings.Join(imageResources, " "),
+			ref(contentObjects[page]), strings.Join(annots, " "))
+		objects[contentObjects[page]-1] = stream(page.content.Bytes())
+	}
+
+	if outlineObject != 0 {
+		count := len(d.bookmarks)
+		for _, entry := range d.bookmarks {
+			count += len(entry.children)
+		}
+		set(outlineObject, "<< /Type /Outlines /First %s /Last %s /Count %d >>",
+			ref(bookmarkObjects[d.bookmarks[0]]), ref(bookmarkObjects[d.bookmarks[len(d.bookmarks)-1]]), count)
+		outline(set, outlineObject, d.bookmarks, bookmarkObjects, pageObjects)
+	}
+	return objects
+}
+
+// outline writes one level of bookmarks, all with the same parent, and the levels below them.
+// Nested levels start closed.
+func outline(set func(int, string, ...interface{}), parent int, entries []*bookmark, objects map[*bookmark]int, pageObjects map[*Page]int) {
+	for i, entry := range entries {
+		links := ""
+		if i > 0 {
+			links += " /Prev " + ref(objects[entries[i-1]])
+		}
+		if i < len(entries)-1 {
+			links += " /Next " + ref(objects[entries[i+1]])
+		}
+		if len(entry.children) > 0 {
+			links += fmt.Sprintf(" /First %s /Last %s /Count -%d",
+				ref(objects[entry.children[0]]), ref(objects[entry.children[len(entry.children)-1]]), len(entry.children))
+			outline(set, objects[entry], entry.children, objects, pageObjects)
+		}
+		set(objects[entry], "<< /Title %s /Parent %s%s /Dest [%s /Fit] >>",
+			text(entry.title), ref(parent), links, ref(pageObjects[entry.page]))
+	}
+}
+
+func (d *Document) mediaBox() string {
+	return fmt.Sprintf("[0 0 %s %s]", num(d.Width+2*d.Bleed), num(d.Height+2*d.Bleed))
+}
+
+func ref(object int) string {
+	return strconv.Itoa(object) + " 0 R"
+}
+
+// num formats a number the way PDF expects, with no exponent and at most three decimals.
+func num(value float64) string {
+	formatted := strconv.FormatFloat(value, 'f', 3, 64)
+	formatted = strings.TrimRight(strings.TrimRight(formatted, "0"), ".")
+	if formatted == "" || formatted == "-0" {
+		return "0"
+	}
+	return formatted
+}
+
+// text is a PDF string literal holding text in WinAnsiEncoding.
+func text(value string) string {
+	var buf bytes.Buffer
+	buf.WriteByte('(')
+	for _, c := range winAnsi(value) {
+		switch {
+		case c == '(' || c == ')' || c == '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case c >= 0x80:
+			fmt.Fprintf(&buf, "\\%03o", c)
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	buf.WriteByte(')')
+	return buf.String()
+}
+
+// stream is a compressed stream object holding data.
+func stream(data []byte) []byte {
+	var compressed bytes.Buffer
+	writer := zlib.NewWriter(&compressed)
+	writer.Write(data)
+	writer.Close()
+	return streamObject("/Filter /FlateDecode", compressed.Bytes())
+}
+
+func streamObject(entries string, data []byte) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "<< %s /Length %d >>\nstream\n", entries, len(data))
+	buf.Write(data)
+	buf.WriteString("\nendstream")
+	return buf.Bytes()
+}
+
+// counter tracks how much has been written, for the cross reference table, and the first error.
+type counter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *counter) write(data []byte) {
+	if c.err != nil {
+		return
+	}
+	n, err := c.w.Write(data)
+	c.n += int64(n)
+	c.err = err
+}
+
+func (c *counter) printf(format string, args ...interface{}) {
+	c.write([]byte(fmt.Sprintf(format, args...)))
+}
@@ -0,0 +1,187 @@
+package pdf
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Font is one of the standard PDF fonts every reader has built in, so nothing needs
+// embedding. Text is written in WinAnsiEncoding.
+type Font struct {
+	name     string
+	resource string
+	widths   *[256]int
+}
+
+var (
+	Helvetica            = Font{name: "Helvetica", resource: "F1", widths: &helveticaWidths}
+	HelveticaBold        = Font{name: "Helvetica-Bold", resource: "F2", widths: &helveticaBoldWidths}
+	HelveticaOblique     = Font{name: "Helvetica-Oblique", resource: "F3", widths: &helveticaWidths}
+	HelveticaBoldOblique = Font{name: "Helvetica-BoldOblique", resource: "F4", widths: &helveticaBoldWidths}
+)
+
+var fonts = []Font{Helvetica, HelveticaBold, HelveticaOblique, HelveticaBoldOblique}
+
+// Width is how wide text is set in the font at size, in points.
+func (f Font) Width(text string, size float64) float64 {
+	total := 0
+	for _, c := range winAnsi(text) {
+		total += f.widths[c]
+	}
+	return float64(total) * size / 1000
+}
+
+// Wrap breaks text into lines no wider than width. Newlines start a new line and a
+// word too long for a line of its own is broken wherever it has to be.
+func (f Font) Wrap(text string, size float64, width float64) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			candidate := word
+			if line != "" {
+				candidate = line + " " + word
+			}
+			if f.Width(candidate, size) <= width {
+				line = candidate
+				continue
+			}
+			if line != "" {
+				lines = append(lines, line)
+			}
+			for f.Width(word, size) > width {
+				cut := f.fit(word, size, width)
+				lines = append(lines, word[:cut])
+				word = word[cut:]
+			}
+			line = word
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// fit is how many bytes of word fit in width, always at least one rune.
+func (f Font) fit(word string, size float64, width float64) int {
+	cut := 0
+	for i, r := range word {
+		next := i + utf8.RuneLen(r)
+		if cut > 0 && f.Width(word[:next], size) > width {
+			break
+		}
+		cut = next
+	}
+	return cut
+}
+
+// winAnsiRunes maps the characters outside Latin-1 that WinAnsiEncoding has room for.
+var winAnsiRunes = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87, 'ˆ': 0x88,
+	'‰': 0x89, 'Š': 0x8a, '‹': 0x8b, 'Œ': 0x8c, 'Ž': 0x8e, '‘': 0x91, '’': 0x92, '“': 0x93,
+	'”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '˜': 0x98, '™': 0x99, 'š': 0x9a, '›': 0x9b,
+	'œ': 0x9c, 'ž': 0x9e, 'Ÿ': 0x9f,
+}
+
+// winAnsiSubstitutes spell out the fractions recipes use, which WinAnsiEncoding has no characters for.
+var winAnsiSubstitutes = map[rune]string{
+	'⅓': "1/3", '⅔': "2/3", '⅕': "1/5", '⅖': "2/5", '⅗': "3/5", '⅘': "4/5",
+	'⅙': "1/6", '⅚': "5/6", '⅛': "1/8", '⅜': "3/8", '⅝': "5/8", '⅞': "7/8",
+	'\t': " ", ' ': " ", ' ': " ", '⁄': "/", '−': "-",
+}
+
+func winAnsi(text string) []byte {
+	encoded := make([]byte, 0, len(text))
+	for _, r := range text {
+		switch {
+		case r >= 0x20 && r < 0x7f, r >= 0xa0 && r <= 0xff:
+			encoded = append(encoded, byte(r))
+		case winAnsiRunes[r] != 0:
+			encoded = append(encoded, winAnsiRunes[r])
+		case winAnsiSubstitutes[r] != "":
+			encoded = append(encoded, winAnsiSubstitutes[r]...)
+		default:
+			encoded = append(encoded, '?')
+		}
+	}
+	return encoded
+}
+
+var helveticaWidths = widths(556, []int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278, // space to /
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556, // 0 to ?
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778, // @ to O
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556, // P to _
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556, // ` to o
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584, // p to ~
+}, map[byte]int{
+	0x80: 556, 0x85: 1000, 0x91: 222, 0x92: 222, 0x93: 333, 0x94: 333, 0x95: 350, 0x96: 556,
+	0x97: 1000, 0x99: 1000, 0xa0: 278, 0xb0: 400, 0xb7: 278, 0xbc: 834, 0xbd: 834, 0xbe: 834,
+	0xd7: 584, 0xdf: 611,
+}, 667, 722, 278, 778, 500, 278)
+
+var helveticaBoldWidths = widths(556, []int{
+	278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278, // space to /
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611, // 0 to ?
+	975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778, // @ to O
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556, // P to _
+	333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611, // ` to o
+	611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584, // p to ~
+}, map[byte]int{
+	0x80: 556, 0x85: 1000, 0x91: 278, 0x92: 278, 0x93: 500, 0x94: 500, 0x95: 350, 0x96: 556,
+	0x97: 1000, 0x99: 1000, 0xa0: 278, 0xb0: 400, 0xb7: 278, 0xbc: 834, 0xbd: 834, 0xbe: 834,
+	0xd7: 584, 0xdf: 611,
+}, 722, 722, 278, 778, 556, 278)
+
+// widths builds a width table from the printable ASCII widths, the few others that
+// matter and the widths of accented capitals (À-Å, Ç, È-Ï, Ñ-Ö, Ù-Ü, Ý) and of
+// accented lower case vowels and consonants (à-ÿ), in that order.
+func widths(fallback int, ascii []int, extra map[byte]int, upperA int, upperC int, upperI int, upperO int, lowerC int, lowerI int) [256]int {
+	var table [256]int
+	for i := range table {
+		table[i] = fallback
+	}
+	for i, width := range ascii {
+		table[0x20+i] = width
+	}
+	for c := 0xc0; c <= 0xc5; c++ {
+		table[c] = upperA
+	}
+	table[0xc7] = upperC
+	for c := 0xc8; c <= 0xcb; c++ {
+		table[c] = table['E']
+	}
+	for c := 0xcc; c <= 0xcf; c++ {
+		table[c] = upperI
+	}
+	table[0xd1] = table['N']
+	for c := 0xd2; c <= 0xd6; c++ {
+		table[c] = upperO
+	}
+	for c := 0xd9; c <= 0xdc; c++ {
+		table[c] = table['U']
+	}
+	table[0xdd] = table['Y']
+	for c := 0xe0; c <= 0xe5; c++ {
+		table[c] = table['a']
+	}
+	table[0xe7] = lowerC
+	for c := 0xe8; c <= 0xeb; c++ {
+		table[c] = table['e']
+	}
+	for c := 0xec; c <= 0xef; c++ {
+		table[c] = lowerI
+	}
+	table[0xf1] = table['n']
+	for c := 0xf2; c <= 0xf6; c++ {
+		table[c] = table['o']
+	}
+	for c := 0xf9; c <= 0xfc; c++ {
+		table[c] = table['u']
+	}
+	table[0xfd] = table['y']
+	table[0xff] = table['y']
+	for c, width := range extra {
+		table[c] = width
+	}
+	return table
+}
@@ -0,0 +1,84 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+)
+
+var ErrUnsupportedImage = errors.New("image can't be placed in a pdf")
+
+// Image is an image added to a Document, which can be drawn on any number of pages
+// while only being stored once. Width and Height are in pixels.
+type Image struct {
+	Width  int
+	Height int
+
+	resource   string
+	colorSpace string
+	decode     string
+	data       []byte
+}
+
+// AddJPEG adds a JPEG as it is, PDF readers decode JPEGs themselves.
+func (d *Document) AddJPEG(data []byte) (*Image, error) {
+	config, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	added := &Image{
+		Width:    config.Width,
+		Height:   config.Height,
+		resource: fmt.Sprintf("Im%d", len(d.images)+1),
+		data:     data,
+	}
+	switch config.ColorModel {
+	case color.GrayModel:
+		added.colorSpace = "/DeviceGray"
+	case color.CMYKModel:
+		//CMYK JPEGs are almost always written by Adobe software, which stores them inverted
+		added.colorSpace = "/DeviceCMYK"
+		added.decode = " /Decode [1 0 1 0 1 0 1 0]"
+	case color.YCbCrModel, color.RGBAModel:
+		added.colorSpace = "/DeviceRGB"
+	default:
+		return nil, ErrUnsupportedImage
+	}
+
+	d.images = append(d.images, added)
+	return added, nil
+}
+
+// AddImage adds an already decoded image, which is stored as a JPEG. Transparent
+// areas come out white, like the paper they're printed on.
+func (d *Document) AddImage(src image.Image) (*Image, error) {
+	bounds := src.Bounds()
+	flat := image.NewRGBA(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := src.At(x, y).RGBA()
+			flat.Set(x, y, color.RGBA{
+				R: uint8((r + (0xffff - a)) >> 8),
+				G: uint8((g + (0xffff - a)) >> 8),
+				B: uint8((b + (0xffff - a)) >> 8),
+				A: 0xff,
+			})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, flat, &jpeg.Options{Quality: 92}); err != nil {
+		return nil, err
+	}
+	return d.AddJPEG(buf.Bytes())
+}
+
+func (image *Image) object() []byte {
+	entries := fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace %s /BitsPerComponent 8%s /Filter /DCTDecode",
+		image.Width, image.Height, image.colorSpace, image.decode)
+	return streamObject(entries, image.data)
+}
@@ -0,0 +1,101 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Color is an RGB color, each component from 0 to 1.
+type Color struct {
+	R float64
+	G float64
+	B float64
+}
+
+var (
+	Black = Color{0, 0, 0}
+	White = Color{1, 1, 1}
+)
+
+// Gray is a shade of gray, 0 being black and 1 white.
+func Gray(level float64) Color {
+	return Color{level, level, level}
+}
+
+// Page is one page of a Document. Pages can be drawn on in any order, a page added
+// early can be filled in once later pages are laid out.
+type Page struct {
+	doc     *Document
+	number  int
+	content bytes.Buffer
+	images  map[*Image]bool
+	links   []link
+}
+
+type link struct {
+	rect   string
+	target *Page
+}
+
+// Number is the page's position in the document, counting from 1.
+func (p *Page) Number() int {
+	return p.number
+}
+
+// Text draws a single line of text with its baseline at y.
+func (p *Page) Text(font Font, size float64, color Color, x float64, y float64, value string) {
+	fmt.Fprintf(&p.content, "%s rg BT /%s %s Tf %s %s Td %s Tj ET\n",
+		color.components(), font.resource, num(size), num(p.x(x)), num(p.y(y)), text(value))
+}
+
+// Rect fills a rectangle whose top left corner is at x, y.
+func (p *Page) Rect(x float64, y float64, width float64, height float64, color Color) {
+	fmt.Fprintf(&p.content, "%s rg %s %s %s %s re f\n",
+		color.components(), num(p.x(x)), num(p.y(y+height)), num(width), num(height))
+}
+
+// Line strokes a straight line from x1, y1 to x2, y2.
+func (p *Page) Line(x1 float64, y1 float64, x2 float64, y2 float64, width float64, color Color) {
+	fmt.Fprintf(&p.content, "%s RG %s w %s %s m %s %s l S\n",
+		color.components(), num(width), num(p.x(x1)), num(p.y(y1)), num(p.x(x2)), num(p.y(y2)))
+}
+
+// Image draws image stretched to fill the box whose top left corner is at x, y.
+func (p *Page) Image(image *Image, x float64, y float64, width float64, height float64) {
+	p.images[image] = true
+	fmt.Fprintf(&p.content, "q %s 0 0 %s %s %s cm /%s Do Q\n",
+		num(width), num(height), num(p.x(x)), num(p.y(y+height)), image.resource)
+}
+
+// ImageCover fills the box with image, keeping its proportions and cropping
+// whatever overflows the box evenly from both sides.
+func (p *Page) ImageCover(image *Image, x float64, y float64, width float64, height float64) {
+	scale := width / float64(image.Width)
+	if h := height / float64(image.Height); h > scale {
+		scale = h
+	}
+	drawnWidth, drawnHeight := float64(image.Width)*scale, float64(image.Height)*scale
+
+	fmt.Fprintf(&p.content, "q %s %s %s %s re W n\n", num(p.x(x)), num(p.y(y+height)), num(width), num(height))
+	p.Image(image, x-(drawnWidth-width)/2, y-(drawnHeight-height)/2, drawnWidth, drawnHeight)
+	p.content.WriteString("Q\n")
+}
+
+// Link makes the box whose top left corner is at x, y go to target when clicked.
+func (p *Page) Link(x float64, y float64, width float64, height float64, target *Page) {
+	rect := fmt.Sprintf("%s %s %s %s", num(p.x(x)), num(p.y(y+height)), num(p.x(x+width)), num(p.y(y)))
+	p.links = append(p.links, link{rect: rect, target: target})
+}
+
+// x and y turn positions on the trimmed page into PDF's, which start from the bottom left of the bleed.
+func (p *Page) x(x float64) float64 {
+	return p.doc.Bleed + x
+}
+
+func (p *Page) y(y float64) float64 {
+	return p.doc.Bleed + p.doc.Height - y
+}
+
+func (c Color) components() string {
+	return fmt.Sprintf("%s %s %s", num(c.R), num(c.G), num(c.B))
+}
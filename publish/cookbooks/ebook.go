@@ -0,0 +1,518 @@
+package cookbooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"github.com/anthonyhawkins/savorbook/epub"
+	"github.com/anthonyhawkins/savorbook/publish/recipes"
+	"html/template"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ebookImageTypes are the image types every EPUB 3 reading system has to support,
+// by their extension in the book.
+var ebookImageTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+const ebookStylesheet = `body { font-family: serif; line-height: 1.4; margin: 0 1em; }
+h1, h2, h3, .label { font-family: sans-serif; }
+h2, .label { color: #993d1f; font-size: 0.8em; letter-spacing: 0.08em; text-transform: uppercase; }
+img { max-width: 100%; }
+figure { margin: 1em 0; text-align: center; }
+figcaption, .details { color: #6b6b6b; font-size: 0.85em; font-style: italic; }
+.cover { text-align: center; }
+.quantity { font-weight: bold; }
+.ingredients { list-style: none; padding: 0; }
+.step-number { color: #993d1f; font-family: sans-serif; font-weight: bold; margin-right: 0.5em; }
+.tip { background: #f7efe6; margin: 1em 0; padding: 0.5em 1em; }
+.image-left figure { float: left; margin: 0 1em 0.5em 0; width: 40%; }
+.image-right figure { float: right; margin: 0 0 0.5em 1em; width: 40%; }
+.step { clear: both; overflow: hidden; }
+.images figure { display: inline-block; vertical-align: top; margin: 0.5em 1%; }
+.images-2 figure { width: 47%; }
+.images-3 figure { width: 31%; }
+`
+
+var ebookTemplates = template.Must(template.New("ebook").Parse(`
+{{define "head"}}<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="en" lang="en">
+<head>
+<meta charset="utf-8"/>
+<title>{{.}}</title>
+<link rel="stylesheet" type="text/css" href="../styles/book.css"/>
+</head>
+{{end}}
+
+{{define "figure"}}<figure>
+<img src="{{.Src}}" alt="{{.Caption}}"/>
+{{if .Caption}}<figcaption>{{.Caption}}</figcaption>
+{{end}}</figure>
+{{end}}
+
+{{define "paragraphs"}}{{range .}}<p>{{.}}</p>
+{{end}}{{end}}
+
+{{define "cover"}}{{template "head" .Title}}<body epub:type="cover">
+<section class="cover">
+{{if .Image}}<img src="{{.Image}}" alt="{{.Title}}"/>
+{{end}}<h1>{{.Title}}</h1>
+{{if .SubTitle}}<p class="subtitle">{{.SubTitle}}</p>
+{{end}}{{if .Author}}<p class="label">{{.Author}}</p>
+{{end}}{{template "paragraphs" .Blurb}}</section>
+</body>
+</html>
+{{end}}
+
+{{define "section"}}{{template "head" .Title}}<body>
+<section epub:type="chapter">
+<p class="label">Section {{.Number}}</p>
+<h1>{{.Title}}</h1>
+{{template "paragraphs" .Overview}}{{if .Entries}}<ul>
+{{range .Entries}}<li><a href="{{.Href}}">{{.Title}}</a></li>
+{{end}}</ul>
+{{end}}</section>
+</body>
+</html>
+{{end}}
+
+{{define "page"}}{{template "head" .Title}}<body>
+<section>
+{{if .Image}}{{template "figure" .Image}}{{end}}{{if .Title}}<h1>{{.Title}}</h1>
+{{end}}{{template "paragraphs" .Body}}{{range .Photos}}{{template "figure" .}}{{end}}</section>
+</body>
+</html>
+{{end}}
+
+{{define "recipe"}}{{template "head" .Name}}<body>
+<article id="recipe">
+<h1>{{.Name}}</h1>
+{{if .Details}}<p class="details">{{.Details}}</p>
+{{end}}{{template "paragraphs" .Description}}{{if .Image}}{{template "figure" .Image}}{{end}}{{if .Needs}}<section>
+<h2>You'll need</h2>
+<ul>
+{{range .Needs}}<li>{{if .Href}}<a href="{{.Href}}">{{.Title}}</a>{{else}}{{.Title}}{{end}}</li>
+{{end}}</ul>
+</section>
+{{end}}{{if .Groups}}<section>
+<h2>Ingredients</h2>
+{{range .Groups}}{{if .Name}}<h3>{{.Name}}</h3>
+{{end}}<ul class="ingredients">
+{{range .Ingredients}}<li>{{if .Qty}}<span class="quantity">{{.Qty}}</span> {{end}}{{.Name}}</li>
+{{end}}</ul>
+{{end}}</section>
+{{end}}{{if .Steps}}<section>
+<h2>Method</h2>
+{{range .Steps}}{{if eq .Type "tipText"}}<aside class="tip" epub:type="tip">
+<p class="label">Tip</p>
+{{template "paragraphs" .Text}}</aside>
+{{else}}<div class="step{{if .Class}} {{.Class}}{{end}}">
+{{if .Side}}{{template "figure" index .Images 0}}{{end}}<p><span class="step-number">{{.Number}}</span>{{index .Text 0}}</p>
+{{template "paragraphs" slice .Text 1}}{{if not .Side}}{{if .Images}}<div class="images {{.Row}}">
+{{range .Images}}{{template "figure" .}}{{end}}</div>
+{{end}}{{end}}</div>
+{{end}}{{end}}</section>
+{{end}}</article>
+</body>
+</html>
+{{end}}
+`))
+
+type ebookLink struct {
+	Title string
+	Href  string
+}
+
+type ebookFigure struct {
+	Src     string
+	Caption string
+}
+
+type ebookStep struct {
+	Number int
+	Type   string
+	Class  string
+	Row    string
+	//Side steps have their one image beside the text rather than in a row below it
+	Side   bool
+	Text   []string
+	Images []ebookFigure
+}
+
+type ebookGroup struct {
+	Name        string
+	Ingredients []struct {
+		Qty  string
+		Name string
+	}
+}
+
+// ebook builds the EPUB, keeping track of which images and recipes are already in it.
+type ebook struct {
+	ctx     context.Context
+	userID  uint
+	book    *epub.Book
+	images  map[string]string
+	recipes map[uint]recipes.RecipeModel
+	//recipeDocs is where each recipe is, recipes in more than one section are only in the book once
+	recipeDocs map[uint]string
+	written    map[string]bool
+	//readImage loads an image by its ref, tests swap in images of their own
+	readImage func(ctx context.Context, userID uint, ref string) ([]byte, error)
+}
+
+// WriteEbook writes the cookbook as an EPUB 3 book. Each section is a chapter
+// linking to its pages, and each page and recipe is a document of its own, in
+// section order. The navigation document lists every section and titled page and
+// has an index of the recipes. Images that can't be loaded are left out.
+func WriteEbook(ctx context.Context, model *CookbookModel, author string, w io.Writer) error {
+	pageRecipes, err := GetPageRecipes(model)
+	if err != nil {
+		return err
+	}
+	return newEbook(ctx, model, pageRecipes).write(model, author, w)
+}
+
+func newEbook(ctx context.Context, model *CookbookModel, pageRecipes map[uint]recipes.RecipeModel) *ebook {
+	return &ebook{
+		ctx:        ctx,
+		userID:     model.UserID,
+		book:       epub.New("urn:savorbook:cookbook:"+strconv.Itoa(int(model.ID)), model.Title),
+		images:     make(map[string]string),
+		recipes:    pageRecipes,
+		recipeDocs: make(map[uint]string),
+		written:    make(map[string]bool),
+		readImage:  readImage,
+	}
+}
+
+func (e *ebook) write(model *CookbookModel, author string, w io.Writer) error {
+	e.book.Author = author
+	e.book.Stylesheet = "styles/book.css"
+	if !model.UpdatedAt.IsZero() {
+		e.book.Modified = model.UpdatedAt
+	}
+	if e.book.Title == "" {
+		e.book.Title = "Untitled Cookbook"
+	}
+	e.book.AddFile("styles/book.css", epub.CSSMediaType, []byte(ebookStylesheet))
+
+	if err := e.cover(model, author); err != nil {
+		return err
+	}
+	e.book.AddNav()
+
+	//recipe documents are named up front, so sections can link to recipes printed in later sections
+	for _, section := range model.Sections {
+		for _, page := range section.Pages {
+			if _, ok := e.recipes[page.RecipeID]; ok && page.PageType == PageRecipe {
+				if _, named := e.recipeDocs[page.RecipeID]; !named {
+					e.recipeDocs[page.RecipeID] = fmt.Sprintf("text/recipe-%d.xhtml", page.RecipeID)
+				}
+			}
+		}
+	}
+
+	toc := make([]epub.NavItem, 0)
+	for i, section := range model.Sections {
+		item, err := e.section(&section, i)
+		if err != nil {
+			return err
+		}
+		toc = append(toc, item)
+	}
+	e.book.SetTOC(toc)
+	e.book.SetIndex("Recipe Index", e.recipeIndex())
+
+	landmarks := []epub.Landmark{
+		{Type: "cover", Title: "Cover", Href: "text/cover.xhtml"},
+		{Type: "toc", Title: "Contents", Href: "nav.xhtml#toc"},
+	}
+	if len(toc) > 0 {
+		landmarks = append(landmarks, epub.Landmark{Type: "bodymatter", Title: "Start", Href: toc[0].Href})
+	}
+	if len(e.recipes) > 0 {
+		landmarks = append(landmarks, epub.Landmark{Type: "index", Title: "Recipe Index", Href: "nav.xhtml#index"})
+	}
+	e.book.SetLandmarks(landmarks)
+
+	_, err := e.book.WriteTo(w)
+	return err
+}
+
+// render executes one of ebookTemplates. The XML declaration is written here as
+// html/template would escape it.
+func (e *ebook) render(name string, data interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	err := ebookTemplates.ExecuteTemplate(&buf, name, data)
+	return buf.Bytes(), err
+}
+
+func (e *ebook) cover(model *CookbookModel, author string) error {
+	href := e.image(model.Image, true)
+	data, err := e.render("cover", map[string]interface{}{
+		"Title":    xmlText(e.book.Title),
+		"SubTitle": xmlText(model.SubTitle),
+		"Author":   xmlText(author),
+		"Blurb":    paragraphs(model.Blurb),
+		"Image":    href,
+	})
+	if err != nil {
+		return err
+	}
+	e.book.AddDocument("text/cover.xhtml", data)
+	return nil
+}
+
+// section adds the section's chapter and then its pages, returning its entry in the table of contents.
+func (e *ebook) section(section *SectionModel, index int) (epub.NavItem, error) {
+	href := fmt.Sprintf("text/section-%d.xhtml", index+1)
+	item := epub.NavItem{Title: sectionTitle(section, index), Href: href}
+
+	var entries []ebookLink
+	var documents []func() error
+	for _, page := range section.Pages {
+		page := page
+		docHref := fmt.Sprintf("text/page-%d.xhtml", page.ID)
+		if page.PageType == PageRecipe {
+			recipe, ok := e.recipes[page.RecipeID]
+			if !ok {
+				continue
+			}
+			docHref = e.recipeDocs[page.RecipeID]
+			if !e.written[docHref] {
+				e.written[docHref] = true
+				documents = append(documents, func() error { return e.recipe(&recipe, docHref) })
+			}
+		} else {
+			documents = append(documents, func() error { return e.page(&page, docHref) })
+		}
+
+		if title := pageTitle(&page, e.recipes); title != "" {
+			entries = append(entries, ebookLink{Title: xmlText(title), Href: fromText(docHref)})
+			item.Children = append(item.Children, epub.NavItem{Title: title, Href: docHref})
+		}
+	}
+
+	data, err := e.render("section", map[string]interface{}{
+		"Number":   index + 1,
+		"Title":    xmlText(item.Title),
+		"Overview": paragraphs(section.Overview),
+		"Entries":  entries,
+	})
+	if err != nil {
+		return item, err
+	}
+	e.book.AddDocument(href, data)
+
+	for _, document := range documents {
+		if err := document(); err != nil {
+			return item, err
+		}
+	}
+	return item, nil
+}
+
+func (e *ebook) page(page *PageModel, href string) error {
+	serialized, err := SerializePage(page)
+	if err != nil {
+		return err
+	}
+
+	view := map[string]interface{}{
+		"Title": xmlText(page.Title),
+		"Body":  paragraphs(page.Body),
+	}
+	switch content := serialized.Content.(type) {
+	case *IntroPage:
+		if src := e.image(content.Image, false); src != "" {
+			view["Image"] = ebookFigure{Src: src, Caption: xmlText(content.Title)}
+		}
+	case *PhotoSpreadPage:
+		var photos []ebookFigure
+		for _, photo := range content.Photos {
+			if src := e.image(photo.Src, false); src != "" {
+				photos = append(photos, ebookFigure{Src: src, Caption: xmlText(photo.Caption)})
+			}
+		}
+		view["Photos"] = photos
+	}
+
+	data, err := e.render("page", view)
+	if err != nil {
+		return err
+	}
+	e.book.AddDocument(href, data)
+	return nil
+}
+
+func (e *ebook) recipe(recipe *recipes.RecipeModel, href string) error {
+	var details []string
+	if recipe.PrepTime != "" {
+		details = append(details, "Prep "+recipe.PrepTime)
+	}
+	if recipe.Servings != "" {
+		details = append(details, "Serves "+recipe.Servings)
+	}
+	view := map[string]interface{}{
+		"Name":        xmlText(recipe.Name),
+		"Details":     xmlText(strings.Join(details, " · ")),
+		"Description": paragraphs(recipe.Description),
+	}
+	if src := e.image(recipe.Image, false); src != "" {
+		view["Image"] = ebookFigure{Src: src, Caption: xmlText(recipe.Name)}
+	}
+
+	var needs []ebookLink
+	for _, dependency := range recipe.DependentRecipes {
+		need := ebookLink{Title: xmlText(strings.TrimSpace(dependency.Qty + " " + dependency.RecipeName))}
+		if doc, ok := e.recipeDocs[dependency.DependentRecipe]; ok {
+			need.Href = fromText(doc) + "#recipe"
+		}
+		needs = append(needs, need)
+	}
+	view["Needs"] = needs
+
+	var groups []ebookGroup
+	for _, group := range recipe.IngredientGroups {
+		view := ebookGroup{Name: xmlText(group.GroupName)}
+		for _, ingredient := range group.Ingredients {
+			view.Ingredients = append(view.Ingredients, struct {
+				Qty  string
+				Name string
+			}{xmlText(quantity(&ingredient)), xmlText(ingredient.Name)})
+		}
+		groups = append(groups, view)
+	}
+	view["Groups"] = groups
+	view["Steps"] = e.steps(recipe.Steps)
+
+	data, err := e.render("recipe", view)
+	if err != nil {
+		return err
+	}
+	e.book.AddDocument(href, data)
+	return nil
+}
+
+// steps numbers every step but tips, like the printed cookbook.
+func (e *ebook) steps(steps []recipes.StepModel) []ebookStep {
+	var views []ebookStep
+	number := 0
+	for _, step := range steps {
+		view := ebookStep{Type: step.Type, Text: paragraphs(step.Text)}
+		if len(view.Text) == 0 {
+			view.Text = []string{""}
+		}
+		if step.Type != "tipText" {
+			number++
+			view.Number = number
+		}
+
+		for _, stepImage := range step.StepImages {
+			if src := e.image(stepImage.Image, false); src != "" {
+				view.Images = append(view.Images, ebookFigure{Src: src, Caption: xmlText(stepImage.Text)})
+			}
+		}
+		switch step.Type {
+		case "imageLeft":
+			view.Class, view.Side = "image-left", len(view.Images) > 0
+		case "imageRight":
+			view.Class, view.Side = "image-right", len(view.Images) > 0
+		case "imageDouble":
+			view.Row = "images-2"
+		case "imageTriple":
+			view.Row = "images-3"
+		}
+		if view.Side {
+			view.Images = view.Images[:1]
+		}
+		views = append(views, view)
+	}
+	return views
+}
+
+// image adds the image ref points at to the book, once, returning where the book's
+// documents find it or nothing if it can't be added.
+func (e *ebook) image(ref string, cover bool) string {
+	if ref == "" {
+		return ""
+	}
+	if href, ok := e.images[ref]; ok {
+		return href
+	}
+	e.images[ref] = ""
+
+	data, err := e.readImage(e.ctx, e.userID, ref)
+	if err != nil {
+		return ""
+	}
+	mediaType := http.DetectContentType(data)
+	extension, ok := ebookImageTypes[mediaType]
+	if !ok {
+		return ""
+	}
+
+	href := fmt.Sprintf("images/image-%d%s", len(e.images), extension)
+	if cover {
+		e.book.AddCoverImage(href, mediaType, data)
+	} else {
+		e.book.AddFile(href, mediaType, data)
+	}
+	e.images[ref] = "../" + href
+	return e.images[ref]
+}
+
+// recipeIndex lists the book's recipes alphabetically.
+func (e *ebook) recipeIndex() []epub.NavItem {
+	index := make([]epub.NavItem, 0)
+	for recipeID, href := range e.recipeDocs {
+		index = append(index, epub.NavItem{Title: e.recipes[recipeID].Name, Href: href})
+	}
+	sort.Slice(index, func(i, j int) bool {
+		if a, b := strings.ToLower(index[i].Title), strings.ToLower(index[j].Title); a != b {
+			return a < b
+		}
+		return index[i].Href < index[j].Href
+	})
+	return index
+}
+
+// fromText makes a book href relative to the documents, which are all in text/.
+func fromText(href string) string {
+	if href == "" || strings.HasPrefix(href, "../") {
+		return href
+	}
+	return strings.TrimPrefix(href, "text/")
+}
+
+// paragraphs splits text on blank lines, dropping what XML can't hold.
+func paragraphs(text string) []string {
+	var split []string
+	for _, paragraph := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n\n") {
+		if paragraph = strings.TrimSpace(xmlText(paragraph)); paragraph != "" {
+			split = append(split, paragraph)
+		}
+	}
+	return split
+}
+
+// xmlText drops the control characters XML documents can't contain.
+func xmlText(text string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' || r == 0xfffe || r == 0xffff {
+			return -1
+		}
+		return r
+	}, text)
+}
@@ -0,0 +1,197 @@
+package cookbooks
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"github.com/anthonyhawkins/savorbook/epub"
+	"github.com/anthonyhawkins/savorbook/publish/recipes"
+	"gorm.io/gorm"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pixel is a 1x1 png.
+var pixel = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00\x1f\x15\xc4\x89" +
+	"\x00\x00\x00\rIDATx\x9cc\xf8\xff\xff?\x00\x05\xfe\x02\xfe\xa7\x35\x81\x84\x00\x00\x00\x00IEND\xaeB`\x82")
+
+// testImages stands in for image storage, refs it doesn't know can't be loaded.
+func testImages(ctx context.Context, userID uint, ref string) ([]byte, error) {
+	switch ref {
+	case "/images/cover.png", "/images/intro.png", "/images/photo-1.png", "/images/photo-2.png", "/images/bread.png", "/images/step.png":
+		return pixel, nil
+	case "/images/note.txt":
+		return []byte("not an image"), nil
+	}
+	return nil, errors.New("image not found")
+}
+
+func testCookbook() (*CookbookModel, map[uint]recipes.RecipeModel) {
+	bread := recipes.RecipeModel{
+		Model:       gorm.Model{ID: 1},
+		Name:        "Country Bread",
+		Image:       "/images/bread.png",
+		Description: "A crusty loaf.\n\nBest the day it's baked.",
+		PrepTime:    "4 hrs",
+		Servings:    "1 loaf",
+		DependentRecipes: []recipes.RecipeDependencyModel{
+			{RecipeID: 1, DependentRecipe: 2, RecipeName: "Starter", Qty: "100 g"},
+			{RecipeID: 1, DependentRecipe: 99, RecipeName: "Butter", Qty: "1 pat"},
+		},
+		IngredientGroups: []recipes.IngredientGroupModel{{
+			GroupName: "Dough",
+			Ingredients: []recipes.IngredientModel{
+				{Name: "flour", Qty: "500", Unit: "g"},
+				{Name: "salt & water"},
+			},
+		}},
+		Steps: []recipes.StepModel{
+			{Type: "text", Text: "Mix <everything>."},
+			{Type: "imageLeft", Text: "Shape the loaf.", StepImages: []recipes.StepImageModel{{Image: "/images/step.png", Text: "Shaped"}}},
+			{Type: "imageDouble", Text: "Score it.", StepImages: []recipes.StepImageModel{{Image: "/images/step.png"}, {Image: "/images/missing.png"}}},
+			{Type: "tipText", Text: "Use a razor."},
+		},
+	}
+	starter := recipes.RecipeModel{
+		Model: gorm.Model{ID: 2},
+		Name:  "Starter",
+		Steps: []recipes.StepModel{{Type: "text", Text: "Feed daily."}},
+	}
+
+	model := &CookbookModel{
+		Model:    gorm.Model{ID: 7, UpdatedAt: time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)},
+		UserID:   3,
+		Title:    "Bread & Butter",
+		SubTitle: "Baking at home",
+		Image:    "/images/cover.png",
+		Blurb:    "Loaves for every day.",
+		Sections: []SectionModel{
+			{
+				Name:     "Basics",
+				Overview: "Where to start.",
+				Pages: []PageModel{
+					{Model: gorm.Model{ID: 10}, PageType: PageIntro, Title: "Welcome", Body: "Let's bake.", Image: "/images/intro.png"},
+					{Model: gorm.Model{ID: 11}, PageType: PageGuide, Title: "Kneading", Body: "Push.\n\nFold.\n\nTurn."},
+					{Model: gorm.Model{ID: 12}, PageType: PageRecipe, RecipeID: 2},
+				},
+			},
+			{
+				Name: "Loaves",
+				Pages: []PageModel{
+					{Model: gorm.Model{ID: 20}, PageType: PageRecipe, RecipeID: 1},
+					//the recipe was deleted after being added
+					{Model: gorm.Model{ID: 21}, PageType: PageRecipe, RecipeID: 50},
+					{Model: gorm.Model{ID: 22}, PageType: PagePhotos, Title: "Crumb", Photos: `[{"src":"/images/photo-1.png","caption":"Open"},{"src":"/images/photo-2.png","caption":"Tight"},{"src":"/images/note.txt"},{"src":"/images/gone.png"}]`},
+					//in a second section too, it's only in the book once
+					{Model: gorm.Model{ID: 23}, PageType: PageRecipe, RecipeID: 2},
+				},
+			},
+			{Name: ""},
+		},
+	}
+	return model, map[uint]recipes.RecipeModel{1: bread, 2: starter}
+}
+
+func writeTestEbook(t *testing.T, model *CookbookModel, pageRecipes map[uint]recipes.RecipeModel) []byte {
+	t.Helper()
+	book := newEbook(context.Background(), model, pageRecipes)
+	book.readImage = testImages
+	var buf bytes.Buffer
+	if err := book.write(model, "A. Baker", &buf); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func ebookFiles(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	for _, f := range archive.File {
+		reader, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents, err := ioutil.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name] = string(contents)
+	}
+	return files
+}
+
+func TestEbookValidates(t *testing.T) {
+	model, pageRecipes := testCookbook()
+	data := writeTestEbook(t, model, pageRecipes)
+
+	problems, err := epub.Validate(data)
+	if err != nil || len(problems) > 0 {
+		t.Fatalf("Validate: %v %q", err, problems)
+	}
+
+	files := ebookFiles(t, data)
+	for _, name := range []string{
+		"OEBPS/text/cover.xhtml",
+		"OEBPS/text/section-1.xhtml",
+		"OEBPS/text/section-2.xhtml",
+		"OEBPS/text/section-3.xhtml",
+		"OEBPS/text/page-10.xhtml",
+		"OEBPS/text/page-11.xhtml",
+		"OEBPS/text/page-22.xhtml",
+		"OEBPS/text/recipe-1.xhtml",
+		"OEBPS/text/recipe-2.xhtml",
+	} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("%s is missing", name)
+		}
+	}
+	if _, ok := files["OEBPS/text/recipe-50.xhtml"]; ok {
+		t.Errorf("the deleted recipe has a document")
+	}
+
+	opf := files["OEBPS/content.opf"]
+	if strings.Count(opf, "recipe-2.xhtml") != 1 {
+		t.Errorf("a recipe in two sections should be in the book once:\n%s", opf)
+	}
+	if !strings.Contains(opf, `properties="cover-image"`) {
+		t.Errorf("no cover image:\n%s", opf)
+	}
+
+	photos := files["OEBPS/text/page-22.xhtml"]
+	if strings.Count(photos, "<figure>") != 2 {
+		t.Errorf("photos that can't be loaded should be left out:\n%s", photos)
+	}
+
+	recipe := files["OEBPS/text/recipe-1.xhtml"]
+	for _, want := range []string{
+		`<a href="recipe-2.xhtml#recipe">100 g Starter</a>`,
+		"<li>1 pat Butter</li>",
+		"Mix &lt;everything&gt;.",
+		`epub:type="tip"`,
+	} {
+		if !strings.Contains(recipe, want) {
+			t.Errorf("recipe document has no %q:\n%s", want, recipe)
+		}
+	}
+
+	nav := files["OEBPS/nav.xhtml"]
+	if !strings.Contains(nav, `epub:type="index"`) || !strings.Contains(nav, "Country Bread") {
+		t.Errorf("navigation has no recipe index:\n%s", nav)
+	}
+}
+
+func TestEbookWithoutTitleValidates(t *testing.T) {
+	model := &CookbookModel{Model: gorm.Model{ID: 8}}
+	problems, err := epub.Validate(writeTestEbook(t, model, map[uint]recipes.RecipeModel{}))
+	if err != nil || len(problems) > 0 {
+		t.Fatalf("Validate: %v %q", err, problems)
+	}
+}
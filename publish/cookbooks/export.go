@@ -0,0 +1,27 @@
+package cookbooks
+
+import (
+	"context"
+	"github.com/anthonyhawkins/savorbook/images"
+	"github.com/anthonyhawkins/savorbook/publish/recipes"
+	"io/ioutil"
+)
+
+// readImage reads the stored upload a cookbook, page or recipe refers to, for the
+// exports that carry their images with them.
+func readImage(ctx context.Context, userID uint, ref string) ([]byte, error) {
+	reader, _, err := images.OpenReference(ctx, userID, ref)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return ioutil.ReadAll(reader)
+}
+
+// pageTitle is how a page is listed in an export's contents, pages without a title aren't listed.
+func pageTitle(page *PageModel, pageRecipes map[uint]recipes.RecipeModel) string {
+	if page.PageType == PageRecipe {
+		return pageRecipes[page.RecipeID].Name
+	}
+	return page.Title
+}
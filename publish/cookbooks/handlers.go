@@ -1,12 +1,19 @@
 package cookbooks
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
+	"github.com/anthonyhawkins/savorbook/database"
+	"github.com/anthonyhawkins/savorbook/epub"
 	"github.com/anthonyhawkins/savorbook/middleware"
+	"github.com/anthonyhawkins/savorbook/patch"
 	"github.com/anthonyhawkins/savorbook/publish/recipes"
 	"github.com/anthonyhawkins/savorbook/responses"
+	"github.com/anthonyhawkins/savorbook/users"
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
+	"strconv"
 	"strings"
 )
 
@@ -45,6 +52,7 @@ func CookbookCreate(c *fiber.Ctx) error {
 
 	var cookbookResponse CookbookResponse
 	cookbookResponse.SerializeCookbook(&cookbookValidator.Model)
+	c.Set(fiber.HeaderETag, middleware.ETag(cookbookValidator.Model.Version, ""))
 
 	//Respond with Success
 	response.Success = true
@@ -73,6 +81,10 @@ func CookbookGet(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(response)
 	}
 
+	if middleware.NotModified(c, middleware.ETag(model.Version, "")) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
 	var cookbookResponse CookbookResponse
 	cookbookResponse.SerializeCookbook(&model)
 	response.Success = true
@@ -81,6 +93,7 @@ func CookbookGet(c *fiber.Ctx) error {
 
 }
 
+// SectionRecipesGet lists the recipes on the section's recipe pages, in page order. SectionPagesGet lists every page.
 func SectionRecipesGet(c *fiber.Ctx) error {
 	response := new(responses.StandardResponse)
 	response.Success = false
@@ -143,6 +156,11 @@ func CookbookUpdate(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
 	}
 
+	expectedVersion, err := middleware.ExpectedVersion(c, existingCookbook.Version, cookbookValidator.Cookbook.Version)
+	if err != nil {
+		return versionError(c, response, err, cookbookID, userID)
+	}
+
 	validationErrors, err := cookbookValidator.Validate()
 	if err != nil {
 		response.Message = "Validation Errors"
@@ -157,8 +175,13 @@ func CookbookUpdate(c *fiber.Ctx) error {
 	}
 
 	cookbookValidator.Model.ID = existingCookbook.ID
+	cookbookValidator.Model.Version = expectedVersion
 
-	if err := cookbookValidator.Model.Update(); err != nil {
+	err = cookbookValidator.Model.Update()
+	if errors.Is(err, database.ErrVersionConflict) {
+		return versionError(c, response, err, cookbookID, userID)
+	}
+	if err != nil {
 		response.Message = "Unable to Update Cookbook"
 		response.Errors = append(response.Errors, err.Error())
 		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
@@ -166,6 +189,100 @@ func CookbookUpdate(c *fiber.Ctx) error {
 
 	var cookbookResponse CookbookResponse
 	cookbookResponse.SerializeCookbook(&cookbookValidator.Model)
+	c.Set(fiber.HeaderETag, middleware.ETag(cookbookValidator.Model.Version, ""))
+
+	//Respond with Success
+	response.Success = true
+	response.Data = cookbookResponse
+	return c.JSON(response)
+}
+
+func CookbookPatch(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+
+	cookbookID := c.Params("id")
+	userID := middleware.AuthedUserId(c.Locals("user"))
+	existingCookbook, err := GetCookbook(cookbookID, userID)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response.Message = "Cookbook Not Found"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	if err != nil {
+		response.Message = "Unable to Retrieve Cookbook"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	document, err := existingCookbook.PatchDocument()
+	if err != nil {
+		response.Message = "Unable to Retrieve Cookbook"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	patched, changed, err := patch.Apply(c.Get(fiber.HeaderContentType), document, c.Body())
+	if err != nil {
+		response.Message = "Unable to Apply Patch"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(patch.Status(err)).JSON(response)
+	}
+
+	cookbookValidator := NewCookbookValidator()
+	if err := json.Unmarshal(patched, cookbookValidator); err != nil {
+		response.Message = "Invalid JSON"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	//the stored document has no version, so one in the result was put there by the patch
+	expectedVersion, err := middleware.ExpectedVersion(c, existingCookbook.Version, cookbookValidator.Cookbook.Version)
+	if err != nil {
+		return versionError(c, response, err, cookbookID, userID)
+	}
+
+	var cookbookResponse CookbookResponse
+	if !changed {
+		cookbookResponse.SerializeCookbook(&existingCookbook)
+		c.Set(fiber.HeaderETag, middleware.ETag(existingCookbook.Version, ""))
+
+		//Respond with Success
+		response.Success = true
+		response.Data = cookbookResponse
+		return c.JSON(response)
+	}
+
+	validationErrors, err := cookbookValidator.Validate()
+	if err != nil {
+		response.Message = "Validation Errors"
+		response.Errors = validationErrors
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	if err := cookbookValidator.BindModel(userID); err != nil {
+		response.Message = "Unable to Update Cookbook"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	cookbookValidator.Model.ID = existingCookbook.ID
+	cookbookValidator.Model.Version = expectedVersion
+
+	err = cookbookValidator.Model.Update()
+	if errors.Is(err, database.ErrVersionConflict) {
+		return versionError(c, response, err, cookbookID, userID)
+	}
+	if err != nil {
+		response.Message = "Unable to Update Cookbook"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	cookbookResponse.SerializeCookbook(&cookbookValidator.Model)
+	c.Set(fiber.HeaderETag, middleware.ETag(cookbookValidator.Model.Version, ""))
 
 	//Respond with Success
 	response.Success = true
@@ -182,7 +299,14 @@ func CookbookList(c *fiber.Ctx) error {
 
 	cookbookList := make([]CookbookResponse, 0)
 
-	recipes, err := GetCookbooks(userID, pageNum, pageSize)
+	statuses, err := recipes.ParseStatus(c.Query("status"))
+	if err != nil {
+		response.Message = "Invalid Status"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	cookbookModels, err := GetCookbooks(userID, statuses, pageNum, pageSize)
 
 	if err != nil {
 		response.Success = true
@@ -192,9 +316,9 @@ func CookbookList(c *fiber.Ctx) error {
 		return c.JSON(response)
 	}
 
-	for _, recipe := range recipes {
+	for _, cookbook := range cookbookModels {
 		var cookbookResponse CookbookResponse
-		cookbookResponse.SerializeCookbook(&recipe)
+		cookbookResponse.SerializeCookbook(&cookbook)
 		cookbookList = append(cookbookList, cookbookResponse)
 	}
 
@@ -211,7 +335,32 @@ func CookbookDelete(c *fiber.Ctx) error {
 	recipeId := c.Params("id")
 	userId := middleware.AuthedUserId(c.Locals("user"))
 
-	err := DeleteCookbook(recipeId, userId)
+	existingCookbook, err := GetCookbook(recipeId, userId)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response.Message = "Cookbook Not Found"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	if err != nil {
+		response.Message = "Unable to Retrieve Cookbook"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	//a DELETE has no body, so the version comes from If-Match or ?version=
+	version, _ := strconv.Atoi(c.Query("version"))
+	expectedVersion, err := middleware.ExpectedVersion(c, existingCookbook.Version, version)
+	if err != nil {
+		return versionError(c, response, err, recipeId, userId)
+	}
+
+	err = DeleteCookbook(recipeId, userId, expectedVersion)
+
+	if errors.Is(err, database.ErrVersionConflict) {
+		return versionError(c, response, err, recipeId, userId)
+	}
 
 	if err != nil {
 		response.Message = "Unable to Delete Cookbook."
@@ -224,3 +373,260 @@ func CookbookDelete(c *fiber.Ctx) error {
 	return c.JSON(response)
 
 }
+
+// versionError answers a write that was based on a stale version, or on no version
+// at all, with the cookbook as it is now so the client can merge and try again.
+func versionError(c *fiber.Ctx, response *responses.StandardResponse, err error, cookbookID string, userID uint) error {
+	response.Message = "Version Conflict"
+	if errors.Is(err, middleware.ErrVersionRequired) {
+		response.Message = "Version Required"
+	}
+	response.Errors = append(response.Errors, err.Error())
+
+	if current, err := GetCookbook(cookbookID, userID); err == nil {
+		var cookbookResponse CookbookResponse
+		cookbookResponse.SerializeCookbook(&current)
+		response.Data = cookbookResponse
+		c.Set(fiber.HeaderETag, middleware.ETag(current.Version, ""))
+	}
+	return c.Status(middleware.VersionStatus(c, err)).JSON(response)
+}
+
+func CookbookPublish(c *fiber.Ctx) error {
+	return changeStatus(c, PublishCookbook)
+}
+
+func CookbookUnpublish(c *fiber.Ctx) error {
+	return changeStatus(c, UnpublishCookbook)
+}
+
+func CookbookArchive(c *fiber.Ctx) error {
+	return changeStatus(c, ArchiveCookbook)
+}
+
+// changeStatus runs one of the lifecycle changes. If-Match is optional here but is
+// checked when sent, so an author can publish exactly the version they reviewed.
+func changeStatus(c *fiber.Ctx, change func(cookbookID string, userID uint, version int) error) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+
+	cookbookID := c.Params("id")
+	userID := middleware.AuthedUserId(c.Locals("user"))
+
+	expectedVersion := 0
+	if c.Get(fiber.HeaderIfMatch) != "" {
+		existingCookbook, err := GetCookbook(cookbookID, userID)
+		if err != nil {
+			response.Message = "Cookbook Not Found"
+			response.Errors = append(response.Errors, response.Message)
+			return c.Status(fiber.StatusNotFound).JSON(response)
+		}
+		expectedVersion, err = middleware.ExpectedVersion(c, existingCookbook.Version, 0)
+		if err != nil {
+			return versionError(c, response, err, cookbookID, userID)
+		}
+	}
+
+	err := change(cookbookID, userID, expectedVersion)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response.Message = "Cookbook Not Found"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	if errors.Is(err, database.ErrVersionConflict) {
+		return versionError(c, response, err, cookbookID, userID)
+	}
+
+	if err != nil {
+		response.Message = "Unable to Change Cookbook Status"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	model, err := GetCookbook(cookbookID, userID)
+	if err != nil {
+		response.Message = "Unable to Retrieve Cookbook"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	var cookbookResponse CookbookResponse
+	cookbookResponse.SerializeCookbook(&model)
+	c.Set(fiber.HeaderETag, middleware.ETag(model.Version, ""))
+
+	//Respond with Success
+	response.Success = true
+	response.Data = cookbookResponse
+	return c.JSON(response)
+}
+
+func CookbookPublishedGet(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+
+	cookbookID := c.Params("id")
+	userID := middleware.AuthedUserId(c.Locals("user"))
+
+	model, publication, err := GetPublishedCookbook(cookbookID, userID)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response.Message = "Cookbook Not Published"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	if err != nil {
+		response.Message = "Unable to Retrieve Cookbook"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	snapshot, err := publication.Cookbook()
+	if err != nil {
+		response.Message = "Unable to Retrieve Cookbook"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	var publishedResponse PublishedCookbookResponse
+	publishedResponse.SerializePublished(&model, &publication, &snapshot)
+
+	//Respond with Success
+	response.Success = true
+	response.Data = publishedResponse
+	return c.JSON(response)
+}
+
+func SectionPagesGet(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+	sectionID := c.Params("id")
+	userID := middleware.AuthedUserId(c.Locals("user"))
+
+	pageList := make([]PageResponse, 0)
+
+	pageModels, pageRecipes, err := GetSectionPages(sectionID, userID)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response.Message = "Section Not Found"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	if err != nil {
+		response.Message = "Unable to Retrieve Section"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	for _, pageModel := range pageModels {
+		var recipe *recipes.RecipeModel
+		if pageRecipe, ok := pageRecipes[pageModel.RecipeID]; ok && pageModel.PageType == PageRecipe {
+			recipe = &pageRecipe
+		}
+
+		var pageResponse PageResponse
+		if err := pageResponse.SerializePage(&pageModel, recipe); err != nil {
+			response.Warnings = append(response.Warnings, err.Error())
+			continue
+		}
+		pageList = append(pageList, pageResponse)
+	}
+
+	//Respond with Success
+	response.Success = true
+	response.Data = pageList
+	return c.JSON(response)
+}
+
+// CookbookExportPDF prints the cookbook as it is now, drafts included, see PrintCookbook.
+func CookbookExportPDF(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+
+	cookbookID := c.Params("id")
+	userID := middleware.AuthedUserId(c.Locals("user"))
+
+	options, err := ParsePrintOptions(c.Query("page_size"), c.Query("bleed"))
+	if err != nil {
+		response.Message = "Invalid Print Options"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	model, err := GetCookbook(cookbookID, userID)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response.Message = "Cookbook Not Found"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	if err != nil {
+		response.Message = "Unable to Retrieve Cookbook"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	var document bytes.Buffer
+	if err := PrintCookbook(c.Context(), &model, authorName(userID), options, &document); err != nil {
+		response.Message = "Unable to Export Cookbook"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	//Respond with Success
+	c.Set(fiber.HeaderContentType, "application/pdf")
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="cookbook-`+strconv.Itoa(int(model.ID))+`.pdf"`)
+	return c.Send(document.Bytes())
+}
+
+// CookbookExportEPUB packages the cookbook as it is now as an EPUB, see WriteEbook. The
+// whole book is built before anything is sent, so a failure is still answered with an error.
+func CookbookExportEPUB(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+
+	cookbookID := c.Params("id")
+	userID := middleware.AuthedUserId(c.Locals("user"))
+
+	model, err := GetCookbook(cookbookID, userID)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response.Message = "Cookbook Not Found"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	if err != nil {
+		response.Message = "Unable to Retrieve Cookbook"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	var book bytes.Buffer
+	if err := WriteEbook(c.Context(), &model, authorName(userID), &book); err != nil {
+		response.Message = "Unable to Export Cookbook"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	//Respond with Success
+	c.Set(fiber.HeaderContentType, epub.MimeType)
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="cookbook-`+strconv.Itoa(int(model.ID))+`.epub"`)
+	return c.Send(book.Bytes())
+}
+
+// authorName is how the author is credited in exports, by display name if they have one.
+func authorName(userID uint) string {
+	user, err := users.FindOne(userID)
+	if err != nil {
+		return ""
+	}
+	if user.DisplayName != "" {
+		return user.DisplayName
+	}
+	return user.Username
+}
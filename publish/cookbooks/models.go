@@ -3,11 +3,13 @@ package cookbooks
 import (
 	"errors"
 	"github.com/anthonyhawkins/savorbook/database"
+	"github.com/anthonyhawkins/savorbook/images"
 	"github.com/anthonyhawkins/savorbook/publish/recipes"
 	"github.com/lib/pq"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 	"strconv"
+	"time"
 )
 
 type CookbookModel struct {
@@ -18,47 +20,76 @@ type CookbookModel struct {
 	Image    string
 	Blurb    string
 	Sections []SectionModel `gorm:"foreignKey:CookbookID;constraint:OnDelete:CASCADE"`
+	Version  int            `gorm:"not null;default:1"`
+	//Status is draft, published or archived, readers only ever see the CookbookPublicationModel
+	Status           string `gorm:"not null;default:'draft';index"`
+	PublishedVersion int
+	PublishedAt      *time.Time
 }
 
 type SectionModel struct {
 	gorm.Model
-	UserID     uint
-	Name       string
-	Overview   string
+	UserID   uint
+	Name     string
+	Overview string
+	//Recipes are the ids of the section's recipe pages in page order, for everything that only wants the recipes
 	Recipes    pq.Int64Array `gorm:"type:integer[]"`
 	CookbookID uint
+	Position   int
+	Pages      []PageModel `gorm:"foreignKey:SectionID"`
 }
 
-//TODO - There could be a use for a "page type" abstraction to help with keeping the order in which
-// a recipe appears in a section or cookbook
-// A page could also be an interface in which multiple entities could satisfy, i.e. a Recipe, Guide, etc..
-/*type PageModel struct {
-	gorm.Model
-	UserID uint
-	PageType string
-	Location string
-	ItemID uint
-}*/
-
 func (model *CookbookModel) setSections(userID uint, sectionValidators []SectionValidator) error {
 	var sections []SectionModel
-	for _, sectionValidator := range sectionValidators {
+	for i, sectionValidator := range sectionValidators {
 		var section SectionModel
+		section.ID = sectionValidator.ID
+		section.Position = i
 		section.UserID = userID
 		section.Name = sectionValidator.Name
 		section.Overview = sectionValidator.Overview
 
-		existingRecipes, err := recipes.GetRecipesByIDs(userID, sectionValidator.Recipes)
-		if err != nil {
-			return err
+		pageValidators := sectionValidator.Pages
+		if len(pageValidators) == 0 {
+			//a section sent as a list of recipe ids is a section of recipe pages
+			for _, recipeID := range sectionValidator.Recipes {
+				pageValidators = append(pageValidators, PageValidator{
+					Type:    PageRecipe,
+					Content: &RecipePage{RecipeID: recipeID},
+				})
+			}
+		} else if len(sectionValidator.Recipes) > 0 {
+			return errors.New("a section takes either pages or recipes, not both")
+		}
+
+		var pageRecipes []uint
+		for j, pageValidator := range pageValidators {
+			var page PageModel
+			if err := pageValidator.BindPage(&page); err != nil {
+				return err
+			}
+			page.UserID = userID
+			page.Position = j
+			if page.PageType == PageRecipe {
+				pageRecipes = append(pageRecipes, page.RecipeID)
+			}
+			section.Pages = append(section.Pages, page)
 		}
 
-		if len(existingRecipes) != len(sectionValidator.Recipes) {
-			return errors.New("one or more recipes do not exist")
+		//an empty list of ids would find every recipe, a section of guides has nothing to check
+		if len(pageRecipes) > 0 {
+			existingRecipes, err := recipes.GetRecipesByIDs(userID, pageRecipes)
+			if err != nil {
+				return err
+			}
+
+			if len(existingRecipes) != len(pageRecipes) {
+				return errors.New("one or more recipes do not exist")
+			}
 		}
 
 		var recipeIDs []int64
-		for _, recipeID := range sectionValidator.Recipes {
+		for _, recipeID := range pageRecipes {
 			recipeIDs = append(recipeIDs, int64(recipeID))
 		}
 
@@ -69,26 +100,63 @@ func (model *CookbookModel) setSections(userID uint, sectionValidators []Section
 	return nil
 }
 
-func DeleteCookbook(cookbookID string, userID uint) error {
+// DeleteCookbook only deletes the cookbook while it is still at version, unless version is 0.
+func DeleteCookbook(cookbookID string, userID uint, version int) error {
 	db := database.GetDB()
 
-	result := db.Where(map[string]interface{}{
+	var existing CookbookModel
+	db.Select("id", "image").Where(map[string]interface{}{
 		"id":      cookbookID,
 		"user_id": userID,
-	}).Delete(&CookbookModel{})
+	}).Find(&existing)
+	existingImages, err := cookbookImages(db, &existing)
+	if err != nil {
+		return err
+	}
+
+	query := db.Where(map[string]interface{}{
+		"id":      cookbookID,
+		"user_id": userID,
+	})
+	if version != 0 {
+		query = query.Where("version = ?", version)
+	}
+	result := query.Delete(&CookbookModel{})
 
 	if result.Error != nil {
 		return errors.New("unable to delete cookbook")
 	}
+	if result.RowsAffected == 0 && version != 0 {
+		return database.ErrVersionConflict
+	}
+
+	images.ReleaseImages(db, userID, existingImages)
 
 	return nil
 }
 
 func CreateCookbook(cookbook *CookbookModel) error {
 	db := database.GetDB()
+	cookbook.Version = 1
+	cookbook.Status = recipes.StatusDraft
+
+	//ids only mean something when updating
+	for i := range cookbook.Sections {
+		cookbook.Sections[i].ID = 0
+		for j := range cookbook.Sections[i].Pages {
+			cookbook.Sections[i].Pages[j].ID = 0
+		}
+	}
 
-	err := db.Create(cookbook).Error
-	return err
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Create(cookbook).Error; err != nil {
+			return err
+		}
+		if err := cookbook.syncSections(tx); err != nil {
+			return err
+		}
+		return images.MarkImagesUsed(tx, cookbook.UserID, cookbook.Images())
+	})
 }
 
 func GetCookbook(cookbookID string, userID uint) (CookbookModel, error) {
@@ -98,12 +166,37 @@ func GetCookbook(cookbookID string, userID uint) (CookbookModel, error) {
 	result := db.Where(map[string]interface{}{
 		"id":      cookbookID,
 		"user_id": userID,
-	}).Preload("Sections").First(&model)
+	}).Preload("Sections", orderedSections).Preload("Sections.Pages", orderedPages).First(&model)
 
 	return model, result.Error
 
 }
 
+// GetPageRecipes loads every recipe the cookbook's recipe pages show, in full and
+// by id, skipping recipes deleted since they were added to a section.
+func GetPageRecipes(model *CookbookModel) (map[uint]recipes.RecipeModel, error) {
+	pageRecipes := make(map[uint]recipes.RecipeModel)
+	for _, section := range model.Sections {
+		for _, page := range section.Pages {
+			if page.PageType != PageRecipe {
+				continue
+			}
+			if _, loaded := pageRecipes[page.RecipeID]; loaded {
+				continue
+			}
+			recipe, err := recipes.GetRecipeFull(strconv.Itoa(int(page.RecipeID)), model.UserID)
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				continue
+			}
+			if err != nil {
+				return pageRecipes, err
+			}
+			pageRecipes[page.RecipeID] = recipe
+		}
+	}
+	return pageRecipes, nil
+}
+
 func GetSectionRecipes(sectionID string, userID uint) ([]recipes.RecipeModel, error) {
 
 	recipesList := make([]recipes.RecipeModel, 0)
@@ -134,27 +227,263 @@ func GetSectionRecipes(sectionID string, userID uint) ([]recipes.RecipeModel, er
 	return recipesList, result.Error
 }
 
+// GetSectionPages returns the section's pages in order with the recipes their recipe
+// pages show. A recipe page whose recipe has been deleted is left out, the same as
+// GetSectionRecipes leaves the recipe out.
+func GetSectionPages(sectionID string, userID uint) ([]PageModel, map[uint]recipes.RecipeModel, error) {
+	pages := make([]PageModel, 0)
+	pageRecipes := make(map[uint]recipes.RecipeModel)
+
+	db := database.GetDB()
+	var section SectionModel
+
+	result := db.Where(map[string]interface{}{
+		"id":      sectionID,
+		"user_id": userID,
+	}).Preload("Pages", orderedPages).First(&section)
+
+	if result.Error != nil {
+		return pages, pageRecipes, result.Error
+	}
+
+	for _, page := range section.Pages {
+		if page.PageType == PageRecipe {
+			recipe, err := recipes.GetRecipe(strconv.FormatUint(uint64(page.RecipeID), 10), userID)
+			if err != nil {
+				return pages, pageRecipes, err
+			}
+			//GetRecipe finds nothing rather than failing for a deleted recipe
+			if recipe.ID == 0 {
+				continue
+			}
+			pageRecipes[page.RecipeID] = recipe
+		}
+		pages = append(pages, page)
+	}
+
+	return pages, pageRecipes, nil
+}
+
+// Update keeps the ids of sections the client sent back so shopping lists and links
+// made from a section survive the cookbook being edited around it. Sections which
+// were left out are deleted and sections without an id are added. A non-zero
+// Version is the version the change was based on, as with recipes.
 func (model *CookbookModel) Update() error {
 	db := database.GetDB()
-	tx := db.Begin()
-	tx.Where(map[string]interface{}{"cookbook_id": model.ID}).Select(clause.Associations).Delete(&SectionModel{})
-	if tx.Save(&model); tx.Error != nil {
-		tx.Rollback()
-		return tx.Error
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		version, err := database.BumpVersion(tx, &CookbookModel{}, model.ID, model.Version)
+		if err != nil {
+			return err
+		}
+		model.Version = version
+		if err := model.loadStatus(tx); err != nil {
+			return err
+		}
+
+		var previous CookbookModel
+		if err := tx.Select("id", "image").First(&previous, model.ID).Error; err != nil {
+			return err
+		}
+		previousImages, err := cookbookImages(tx, &previous)
+		if err != nil {
+			return err
+		}
+
+		result := tx.Model(model).Omit(clause.Associations).Select(
+			"Title", "SubTitle", "Image", "Blurb",
+		).Updates(model)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if err := model.syncSections(tx); err != nil {
+			return err
+		}
+
+		if err := images.ReleaseImages(tx, model.UserID, removedImages(previousImages, model.Images())); err != nil {
+			return err
+		}
+		return images.MarkImagesUsed(tx, model.UserID, model.Images())
+	})
+}
+
+// syncSections updates the sections sent with an id in place, adds the rest and
+// deletes the ones left out, the same way recipe children are synced.
+func (model *CookbookModel) syncSections(tx *gorm.DB) error {
+	var keep []uint
+	for i := range model.Sections {
+		section := &model.Sections[i]
+		section.CookbookID = model.ID
+		section.Position = i
+		if section.ID != 0 {
+			keep = append(keep, section.ID)
+		}
 	}
 
-	tx.Commit()
+	remove := tx.Where("cookbook_id = ?", model.ID)
+	if len(keep) > 0 {
+		remove = remove.Where("id NOT IN ?", keep)
+	}
+	if err := remove.Delete(&SectionModel{}).Error; err != nil {
+		return err
+	}
+
+	updated := make(map[uint]bool)
+	for i := range model.Sections {
+		section := &model.Sections[i]
+		if section.ID != 0 && !updated[section.ID] {
+			result := tx.Model(section).Where("cookbook_id = ?", model.ID).Select(
+				"Name", "Overview", "Recipes", "Position",
+			).Updates(section)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected > 0 {
+				updated[section.ID] = true
+				continue
+			}
+		}
+
+		//an id this cookbook doesn't have, or one sent twice, is added as a new section
+		section.ID = 0
+		if err := tx.Omit("Pages").Create(section).Error; err != nil {
+			return err
+		}
+	}
+	return model.syncPages(tx)
+}
+
+// syncPages does for pages what syncSections does for sections. A page may move to
+// another section of the same cookbook by sending it there with its id.
+func (model *CookbookModel) syncPages(tx *gorm.DB) error {
+	var keep []uint
+	for i := range model.Sections {
+		section := &model.Sections[i]
+		for j := range section.Pages {
+			page := &section.Pages[j]
+			page.SectionID = section.ID
+			page.UserID = model.UserID
+			page.Position = j
+			if page.ID != 0 {
+				keep = append(keep, page.ID)
+			}
+		}
+	}
+
+	//includes the sections syncSections just deleted, so their pages go with them
+	cookbookSections := tx.Session(&gorm.Session{NewDB: true}).Unscoped().Model(&SectionModel{}).Select("id").Where("cookbook_id = ?", model.ID)
+
+	remove := tx.Where("section_id IN (?)", cookbookSections)
+	if len(keep) > 0 {
+		remove = remove.Where("id NOT IN ?", keep)
+	}
+	if err := remove.Delete(&PageModel{}).Error; err != nil {
+		return err
+	}
+
+	updated := make(map[uint]bool)
+	for i := range model.Sections {
+		for j := range model.Sections[i].Pages {
+			page := &model.Sections[i].Pages[j]
+			if page.ID != 0 && !updated[page.ID] {
+				result := tx.Model(page).Where("section_id IN (?)", cookbookSections).Select(
+					"SectionID", "Position", "PageType", "RecipeID", "Title", "Body", "Image", "Photos",
+				).Updates(page)
+				if result.Error != nil {
+					return result.Error
+				}
+				if result.RowsAffected > 0 {
+					updated[page.ID] = true
+					continue
+				}
+			}
+
+			//as with sections, an unknown id is a new page
+			page.ID = 0
+			if err := tx.Create(page).Error; err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
-func GetCookbooks(userID uint, pageNum string, pageSize string) ([]CookbookModel, error) {
+// Images lists every image the cookbook uses, its cover and those on its pages.
+func (model *CookbookModel) Images() []string {
+	refs := []string{model.Image}
+	for _, section := range model.Sections {
+		for _, page := range section.Pages {
+			refs = append(refs, page.images()...)
+		}
+	}
+	return refs
+}
+
+func (page *PageModel) images() []string {
+	pageValidator, err := SerializePage(page)
+	if err != nil {
+		return nil
+	}
+	return pageValidator.Images()
+}
+
+// cookbookImages is Images for the cookbook as it's stored, read before it changes.
+func cookbookImages(tx *gorm.DB, model *CookbookModel) ([]string, error) {
+	var pages []PageModel
+	err := tx.Where(
+		"section_id IN (?)", tx.Session(&gorm.Session{NewDB: true}).Model(&SectionModel{}).Select("id").Where("cookbook_id = ?", model.ID),
+	).Find(&pages).Error
+
+	refs := []string{model.Image}
+	for _, page := range pages {
+		refs = append(refs, page.images()...)
+	}
+	return refs, err
+}
+
+func removedImages(previous []string, current []string) []string {
+	kept := make(map[string]bool)
+	for _, ref := range current {
+		kept[ref] = true
+	}
+	var removed []string
+	for _, ref := range previous {
+		if !kept[ref] {
+			removed = append(removed, ref)
+		}
+	}
+	return removed
+}
 
+func orderedPages(db *gorm.DB) *gorm.DB {
+	return db.Order("page_models.position, page_models.id")
+}
+
+func orderedSections(db *gorm.DB) *gorm.DB {
+	return db.Order("section_models.position, section_models.id")
+}
+
+func GetCookbooks(userID uint, statuses []string, pageNum string, pageSize string) ([]CookbookModel, error) {
+
+	db := database.GetDB()
+	var cookbooks []CookbookModel
+
+	result := db.Scopes(database.Paginate(pageNum, pageSize), recipes.ByStatus("cookbook_models", statuses)).Where(map[string]interface{}{
+		"user_id": userID,
+	}).Preload("Sections", orderedSections).Preload("Sections.Pages", orderedPages).Find(&cookbooks)
+
+	return cookbooks, result.Error
+}
+
+// GetAllCookbooks loads every one of the user's cookbooks with their sections and pages, whatever their status.
+func GetAllCookbooks(userID uint) ([]CookbookModel, error) {
 	db := database.GetDB()
 	var cookbooks []CookbookModel
 
-	result := db.Scopes(database.Paginate(pageNum, pageSize)).Where(map[string]interface{}{
+	result := db.Where(map[string]interface{}{
 		"user_id": userID,
-	}).Preload("Sections").Find(&cookbooks)
+	}).Preload("Sections", orderedSections).Preload("Sections.Pages", orderedPages).Order("id").Find(&cookbooks)
 
 	return cookbooks, result.Error
 }
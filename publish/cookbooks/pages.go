@@ -0,0 +1,274 @@
+package cookbooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+)
+
+const (
+	PageRecipe = "recipe"
+	PageGuide  = "guide"
+	PagePhotos = "photos"
+	PageIntro  = "intro"
+)
+
+// PageModel is one page of a section. Which of its columns are used depends on
+// PageType, see the PageContent for each type.
+type PageModel struct {
+	gorm.Model
+	UserID    uint
+	SectionID uint `gorm:"index"`
+	Position  int
+	PageType  string `gorm:"not null"`
+	RecipeID  uint
+	Title     string
+	Body      string
+	Image     string
+	Photos    string `gorm:"type:jsonb;not null;default:'[]'"`
+}
+
+// MigrateSectionPages gives sections saved before pages existed a recipe page for
+// each of their recipes, in the order the recipes were listed.
+func MigrateSectionPages(db *gorm.DB) error {
+	return db.Exec(`INSERT INTO page_models
+	(created_at, updated_at, user_id, section_id, position, page_type, recipe_id, title, body, image, photos)
+	SELECT now(), now(), section_models.user_id, section_models.id, recipe.position - 1, ?, recipe.id, '', '', '', '[]'
+	FROM section_models CROSS JOIN LATERAL unnest(section_models.recipes) WITH ORDINALITY AS recipe(id, position)
+	WHERE section_models.deleted_at IS NULL
+	AND NOT EXISTS (SELECT 1 FROM page_models WHERE page_models.section_id = section_models.id)`, PageRecipe).Error
+}
+
+// PageContent is implemented by each page type. It validates what the client sent,
+// binds it to a PageModel and reads it back out again.
+type PageContent interface {
+	Type() string
+	bindPage(page *PageModel) error
+	serializePage(page *PageModel) error
+	//preview is what a reader sees before buying the cookbook
+	preview() PageContent
+	images() []string
+}
+
+var pageTypes = map[string]func() PageContent{
+	PageRecipe: func() PageContent { return &RecipePage{} },
+	PageGuide:  func() PageContent { return &GuidePage{} },
+	PagePhotos: func() PageContent { return &PhotoSpreadPage{} },
+	PageIntro:  func() PageContent { return &IntroPage{} },
+}
+
+// RecipePage places one of the author's recipes in the section.
+type RecipePage struct {
+	RecipeID uint `json:"recipeId" validate:"required"`
+}
+
+func (p *RecipePage) Type() string { return PageRecipe }
+
+func (p *RecipePage) bindPage(page *PageModel) error {
+	page.RecipeID = p.RecipeID
+	return nil
+}
+
+func (p *RecipePage) serializePage(page *PageModel) error {
+	p.RecipeID = page.RecipeID
+	return nil
+}
+
+func (p *RecipePage) preview() PageContent { return p }
+
+func (p *RecipePage) images() []string { return nil }
+
+// GuidePage is a free-form article, a technique or a story about the food.
+type GuidePage struct {
+	Title string `json:"title" validate:"required,max=75"`
+	Body  string `json:"body"  validate:"required,max=20000"`
+}
+
+func (p *GuidePage) Type() string { return PageGuide }
+
+func (p *GuidePage) bindPage(page *PageModel) error {
+	page.Title = p.Title
+	page.Body = p.Body
+	return nil
+}
+
+func (p *GuidePage) serializePage(page *PageModel) error {
+	p.Title = page.Title
+	p.Body = page.Body
+	return nil
+}
+
+func (p *GuidePage) preview() PageContent { return &GuidePage{Title: p.Title} }
+
+func (p *GuidePage) images() []string { return nil }
+
+// PhotoSpreadPage is a run of captioned photos laid out together.
+type PhotoSpreadPage struct {
+	Title  string  `json:"title"  validate:"max=75"`
+	Photos []Photo `json:"photos" validate:"required,min=1,max=12,dive"`
+}
+
+type Photo struct {
+	Src     string `json:"src"     validate:"required"`
+	Caption string `json:"caption" validate:"max=280"`
+}
+
+func (p *PhotoSpreadPage) Type() string { return PagePhotos }
+
+func (p *PhotoSpreadPage) bindPage(page *PageModel) error {
+	photos, err := json.Marshal(p.Photos)
+	if err != nil {
+		return err
+	}
+	page.Title = p.Title
+	page.Photos = string(photos)
+	return nil
+}
+
+func (p *PhotoSpreadPage) serializePage(page *PageModel) error {
+	p.Title = page.Title
+	p.Photos = make([]Photo, 0)
+	if page.Photos == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(page.Photos), &p.Photos)
+}
+
+// preview keeps the first photo only
+func (p *PhotoSpreadPage) preview() PageContent {
+	preview := &PhotoSpreadPage{Title: p.Title, Photos: make([]Photo, 0)}
+	if len(p.Photos) > 0 {
+		preview.Photos = append(preview.Photos, p.Photos[0])
+	}
+	return preview
+}
+
+func (p *PhotoSpreadPage) images() []string {
+	var refs []string
+	for _, photo := range p.Photos {
+		refs = append(refs, photo.Src)
+	}
+	return refs
+}
+
+// IntroPage opens a chapter, usually the first page of a section.
+type IntroPage struct {
+	Title string `json:"title" validate:"required,max=75"`
+	Body  string `json:"body"  validate:"max=2000"`
+	Image string `json:"image"`
+}
+
+func (p *IntroPage) Type() string { return PageIntro }
+
+func (p *IntroPage) bindPage(page *PageModel) error {
+	page.Title = p.Title
+	page.Body = p.Body
+	page.Image = p.Image
+	return nil
+}
+
+func (p *IntroPage) serializePage(page *PageModel) error {
+	p.Title = page.Title
+	p.Body = page.Body
+	p.Image = page.Image
+	return nil
+}
+
+func (p *IntroPage) preview() PageContent { return p }
+
+func (p *IntroPage) images() []string { return []string{p.Image} }
+
+// PageValidator reads a page of any type. The page's fields sit alongside its id
+// and type, i.e. {"type": "guide", "title": "Knife Skills", "body": "..."}.
+type PageValidator struct {
+	ID      uint
+	Type    string
+	Content PageContent
+}
+
+func (v *PageValidator) UnmarshalJSON(data []byte) error {
+	var header struct {
+		ID   uint   `json:"id"`
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return err
+	}
+	v.ID = header.ID
+	v.Type = header.Type
+
+	//an unknown type is left for Validate to report
+	newContent, ok := pageTypes[header.Type]
+	if !ok {
+		v.Content = nil
+		return nil
+	}
+	v.Content = newContent()
+	return json.Unmarshal(data, v.Content)
+}
+
+func (v PageValidator) MarshalJSON() ([]byte, error) {
+	fields := make(map[string]interface{})
+	if v.Content != nil {
+		content, err := json.Marshal(v.Content)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(content, &fields); err != nil {
+			return nil, err
+		}
+	}
+	if v.ID != 0 {
+		fields["id"] = v.ID
+	}
+	fields["type"] = v.Type
+	return json.Marshal(fields)
+}
+
+func (v *PageValidator) Validate(validate *validator.Validate) []string {
+	if v.Content == nil {
+		return []string{"Type = oneof"}
+	}
+
+	var errors []string
+	if err := validate.Struct(v.Content); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			errors = append(errors, err.Field()+" = "+err.Tag())
+		}
+	}
+	return errors
+}
+
+func (v *PageValidator) BindPage(page *PageModel) error {
+	page.ID = v.ID
+	page.PageType = v.Type
+	page.Photos = "[]"
+	return v.Content.bindPage(page)
+}
+
+// SerializePage reads a stored page back into the shape clients send it in.
+func SerializePage(page *PageModel) (PageValidator, error) {
+	v := PageValidator{ID: page.ID, Type: page.PageType}
+	newContent, ok := pageTypes[page.PageType]
+	if !ok {
+		return v, fmt.Errorf("page %d has unknown type %q", page.ID, page.PageType)
+	}
+	v.Content = newContent()
+	err := v.Content.serializePage(page)
+	return v, err
+}
+
+func (v PageValidator) Preview() PageValidator {
+	if v.Content != nil {
+		v.Content = v.Content.preview()
+	}
+	return v
+}
+
+func (v *PageValidator) Images() []string {
+	if v.Content == nil {
+		return nil
+	}
+	return v.Content.images()
+}
@@ -0,0 +1,795 @@
+package cookbooks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/anthonyhawkins/savorbook/pdf"
+	"github.com/anthonyhawkins/savorbook/publish/recipes"
+	"image"
+	_ "image/gif"
+	_ "image/png"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PageSizes are the trimmed page sizes a cookbook can be printed at, in points.
+// Besides the office sizes they're the common print-on-demand trim sizes.
+var PageSizes = map[string][2]float64{
+	"letter": {612, 792},
+	"a4":     {595.28, 841.89},
+	"a5":     {419.53, 595.28},
+	"6x9":    {432, 648},
+	"7x10":   {504, 720},
+	"8x10":   {576, 720},
+}
+
+// maxBleed is half an inch, printers usually ask for an eighth.
+const maxBleed = 36
+
+// PrintOptions are the choices made for one export. Bleed is in points and is
+// added to every edge of the page, so it's no use unless the printer trims.
+type PrintOptions struct {
+	PageSize string
+	Bleed    float64
+}
+
+// ParsePrintOptions reads the page_size and bleed query parameters. The page size
+// defaults to letter, the bleed to none. A bleed is a number of points, or inches,
+// millimetres or points when it ends in in, mm or pt, like 0.125in or 3mm.
+func ParsePrintOptions(pageSize string, bleed string) (PrintOptions, error) {
+	options := PrintOptions{PageSize: strings.ToLower(pageSize)}
+	if options.PageSize == "" {
+		options.PageSize = "letter"
+	}
+	if _, ok := PageSizes[options.PageSize]; !ok {
+		sizes := make([]string, 0, len(PageSizes))
+		for size := range PageSizes {
+			sizes = append(sizes, size)
+		}
+		sort.Strings(sizes)
+		return options, fmt.Errorf("page_size must be one of %s", strings.Join(sizes, ", "))
+	}
+
+	bleed = strings.ToLower(strings.TrimSpace(bleed))
+	if bleed == "" {
+		return options, nil
+	}
+	unit := 1.0
+	for suffix, points := range map[string]float64{"in": 72, "mm": 72 / 25.4, "pt": 1} {
+		if strings.HasSuffix(bleed, suffix) {
+			bleed = strings.TrimSpace(strings.TrimSuffix(bleed, suffix))
+			unit = points
+		}
+	}
+	value, err := strconv.ParseFloat(bleed, 64)
+	//written so NaN, which every comparison is false for, is turned away too
+	if err != nil || !(value >= 0 && value*unit <= maxBleed) {
+		return options, fmt.Errorf("bleed must be between 0 and 0.5in")
+	}
+	options.Bleed = value * unit
+	return options, nil
+}
+
+var (
+	inkColor    = pdf.Gray(0.1)
+	mutedColor  = pdf.Gray(0.42)
+	accentColor = pdf.Color{R: 0.6, G: 0.24, B: 0.12}
+	tintColor   = pdf.Color{R: 0.97, G: 0.94, B: 0.9}
+)
+
+const (
+	bodySize    = 10.5
+	bodyLeading = 14.5
+	captionSize = 8.5
+	gutter      = 14
+)
+
+// printer lays a cookbook out top to bottom, starting a new page whenever the
+// next thing doesn't fit on the current one.
+type printer struct {
+	ctx    context.Context
+	userID uint
+	doc    *pdf.Document
+	page   *pdf.Page
+	y      float64
+	margin float64
+	width  float64
+
+	images      map[string]*pdf.Image
+	recipes     map[uint]recipes.RecipeModel
+	recipePages map[uint]*pdf.Page
+	pageRefs    []pageRef
+}
+
+// pageRef is a page number printed right aligned at the end of a line, filled in
+// once the page it refers to is known. The contents and cross references between
+// recipes are made of them.
+type pageRef struct {
+	page     *pdf.Page
+	y        float64
+	recipeID uint
+	target   *pdf.Page
+}
+
+// tocEntry is a line of the contents, a section or one of its titled pages.
+type tocEntry struct {
+	title  string
+	level  int
+	target *pdf.Page
+}
+
+// PrintCookbook writes the cookbook as a PDF ready to print: a cover, the contents,
+// then each section with its pages in order. Recipes are printed as they are now,
+// drafts included. Images that can't be loaded are left out rather than failing
+// the whole export.
+func PrintCookbook(ctx context.Context, model *CookbookModel, author string, options PrintOptions, w io.Writer) error {
+	pageRecipes, err := GetPageRecipes(model)
+	if err != nil {
+		return err
+	}
+	p := newPrinter(ctx, model.UserID, options)
+	p.recipes = pageRecipes
+	return p.print(model, author, w)
+}
+
+func newPrinter(ctx context.Context, userID uint, options PrintOptions) *printer {
+	size := PageSizes[options.PageSize]
+	p := &printer{
+		ctx:         ctx,
+		userID:      userID,
+		doc:         pdf.New(size[0], size[1], options.Bleed),
+		margin:      size[0] * 0.1,
+		images:      make(map[string]*pdf.Image),
+		recipes:     make(map[uint]recipes.RecipeModel),
+		recipePages: make(map[uint]*pdf.Page),
+	}
+	if p.margin > 54 {
+		p.margin = 54
+	}
+	p.width = size[0] - 2*p.margin
+	return p
+}
+
+func (p *printer) print(model *CookbookModel, author string, w io.Writer) error {
+	p.doc.Title = model.Title
+	p.doc.Author = author
+	p.cover(model, author)
+
+	entries := p.tocEntries(model)
+	contents := make([]*pdf.Page, 0)
+	if len(entries) > 0 {
+		for i := 0; i < p.tocPageCount(entries); i++ {
+			contents = append(contents, p.newPage())
+		}
+		p.doc.Bookmark("Contents", contents[0], 0)
+	}
+
+	entry := 0
+	for i, section := range model.Sections {
+		title := sectionTitle(&section, i)
+		p.sectionOpener(&section, i)
+		p.doc.Bookmark(title, p.page, 0)
+		entries[entry].target = p.page
+		entry++
+
+		for _, page := range section.Pages {
+			if !p.printPage(&page) {
+				continue
+			}
+			if title := pageTitle(&page, p.recipes); title != "" {
+				p.doc.Bookmark(title, p.page, 1)
+				entries[entry].target = p.page
+				entry++
+			}
+		}
+	}
+
+	p.contents(contents, entries)
+	p.resolvePageRefs()
+
+	_, err := p.doc.WriteTo(w)
+	return err
+}
+
+func sectionTitle(section *SectionModel, index int) string {
+	if section.Name != "" {
+		return section.Name
+	}
+	return fmt.Sprintf("Section %d", index+1)
+}
+
+func (p *printer) tocEntries(model *CookbookModel) []tocEntry {
+	entries := make([]tocEntry, 0)
+	for i, section := range model.Sections {
+		entries = append(entries, tocEntry{title: sectionTitle(&section, i)})
+		for _, page := range section.Pages {
+			if page.PageType == PageRecipe {
+				if _, ok := p.recipes[page.RecipeID]; !ok {
+					continue
+				}
+			}
+			if title := pageTitle(&page, p.recipes); title != "" {
+				entries = append(entries, tocEntry{title: title, level: 1})
+			}
+		}
+	}
+	return entries
+}
+
+// newPage starts a page with its page number printed at the foot.
+func (p *printer) newPage() *pdf.Page {
+	p.page = p.doc.AddPage()
+	p.y = p.margin
+
+	folio := strconv.Itoa(p.page.Number())
+	x := (p.doc.Width - pdf.Helvetica.Width(folio, captionSize)) / 2
+	p.page.Text(pdf.Helvetica, captionSize, mutedColor, x, p.doc.Height-p.margin/2, folio)
+	return p.page
+}
+
+func (p *printer) bottom() float64 {
+	return p.doc.Height - p.margin
+}
+
+// space makes sure height points fit below the current position, starting a new
+// page when they don't. Anything taller than a page starts a new page and overflows.
+func (p *printer) space(height float64) {
+	if p.y+height > p.bottom() && p.y > p.margin {
+		p.newPage()
+	}
+}
+
+// text flows wrapped text down the page, breaking to a new page between lines.
+func (p *printer) text(font pdf.Font, size float64, leading float64, color pdf.Color, x float64, width float64, value string) {
+	if strings.TrimSpace(value) == "" {
+		return
+	}
+	for _, line := range font.Wrap(value, size, width) {
+		p.space(leading)
+		p.page.Text(font, size, color, x, p.y+size, line)
+		p.y += leading
+	}
+}
+
+// textHeight is how much room text takes once wrapped.
+func textHeight(font pdf.Font, size float64, leading float64, width float64, value string) float64 {
+	if strings.TrimSpace(value) == "" {
+		return 0
+	}
+	return float64(len(font.Wrap(value, size, width))) * leading
+}
+
+// heading keeps a heading on the same page as the first lines under it.
+func (p *printer) heading(value string) {
+	p.y += 10
+	p.space(14 + 3*bodyLeading)
+	p.page.Text(pdf.HelveticaBold, 9.5, accentColor, p.margin, p.y+9.5, strings.ToUpper(value))
+	p.y += 18
+}
+
+// image loads the image a recipe or page refers to, once per export. Images the
+// pdf can't hold, like webp, are left out.
+func (p *printer) image(ref string) *pdf.Image {
+	if ref == "" {
+		return nil
+	}
+	if loaded, ok := p.images[ref]; ok {
+		return loaded
+	}
+	p.images[ref] = nil
+
+	data, err := readImage(p.ctx, p.userID, ref)
+	if err != nil {
+		return nil
+	}
+
+	var added *pdf.Image
+	if http.DetectContentType(data) == "image/jpeg" {
+		added, err = p.doc.AddJPEG(data)
+	} else {
+		var decoded image.Image
+		decoded, _, err = image.Decode(bytes.NewReader(data))
+		if err == nil {
+			added, err = p.doc.AddImage(decoded)
+		}
+	}
+	if err != nil {
+		return nil
+	}
+	p.images[ref] = added
+	return added
+}
+
+// fit scales an image down to fit within width by height, keeping its proportions.
+func fit(img *pdf.Image, width float64, height float64) (float64, float64) {
+	scale := width / float64(img.Width)
+	if h := height / float64(img.Height); h < scale {
+		scale = h
+	}
+	return float64(img.Width) * scale, float64(img.Height) * scale
+}
+
+// cover bleeds the cookbook's image off the top of the page, with the title, sub
+// title, author and blurb underneath. Without an image the page is tinted instead.
+func (p *printer) cover(model *CookbookModel, author string) {
+	p.page = p.doc.AddPage()
+	bleed := p.doc.Bleed
+	top := p.doc.Height * 0.38
+
+	if img := p.image(model.Image); img != nil {
+		top = p.doc.Height * 0.64
+		p.page.ImageCover(img, -bleed, -bleed, p.doc.Width+2*bleed, top+bleed)
+	} else {
+		p.page.Rect(-bleed, -bleed, p.doc.Width+2*bleed, p.doc.Height+2*bleed, tintColor)
+	}
+
+	p.y = top + 36
+	p.text(pdf.HelveticaBold, 28, 33, inkColor, p.margin, p.width, model.Title)
+	p.y += 4
+	p.text(pdf.Helvetica, 15, 19, mutedColor, p.margin, p.width, model.SubTitle)
+
+	if author != "" {
+		p.page.Text(pdf.HelveticaBold, 11, accentColor, p.margin, p.bottom(), strings.ToUpper(author))
+	}
+
+	//the blurb gets whatever room is left above the author
+	lines := pdf.HelveticaOblique.Wrap(model.Blurb, bodySize, p.width)
+	room := int((p.bottom() - 30 - p.y - 14) / bodyLeading)
+	if strings.TrimSpace(model.Blurb) == "" || room <= 0 {
+		return
+	}
+	if len(lines) > room {
+		lines = lines[:room]
+		lines[room-1] += "…"
+	}
+	p.y += 14
+	for _, line := range lines {
+		p.page.Text(pdf.HelveticaOblique, bodySize, inkColor, p.margin, p.y+bodySize, line)
+		p.y += bodyLeading
+	}
+}
+
+const (
+	tocTitleHeight   = 48
+	tocSectionHeight = 24
+	tocPageHeight    = 16
+)
+
+func tocHeight(entry tocEntry) float64 {
+	if entry.level == 0 {
+		return tocSectionHeight
+	}
+	return tocPageHeight
+}
+
+// tocLayout places each contents entry, returning the index of the contents page
+// it goes on and where on that page.
+func (p *printer) tocLayout(entries []tocEntry) ([]int, []float64) {
+	pages := make([]int, len(entries))
+	ys := make([]float64, len(entries))
+	page, y := 0, p.margin+tocTitleHeight
+	for i, entry := range entries {
+		if y+tocHeight(entry) > p.bottom() {
+			page, y = page+1, p.margin
+		}
+		pages[i], ys[i] = page, y
+		y += tocHeight(entry)
+	}
+	return pages, ys
+}
+
+func (p *printer) tocPageCount(entries []tocEntry) int {
+	pages, _ := p.tocLayout(entries)
+	return pages[len(pages)-1] + 1
+}
+
+// contents fills in the contents pages reserved at the front once every entry's page is known.
+func (p *printer) contents(pages []*pdf.Page, entries []tocEntry) {
+	if len(pages) == 0 {
+		return
+	}
+	pages[0].Text(pdf.HelveticaBold, 22, inkColor, p.margin, p.margin+22, "Contents")
+
+	onPage, ys := p.tocLayout(entries)
+	for i, entry := range entries {
+		page, y := pages[onPage[i]], ys[i]
+		font, size, indent, color := pdf.Helvetica, bodySize, 14.0, inkColor
+		if entry.level == 0 {
+			font, size, indent, color = pdf.HelveticaBold, 12, 0, accentColor
+			y += 8
+		}
+		title := truncate(font, size, p.width-indent-36, entry.title)
+		page.Text(font, size, color, p.margin+indent, y+size, title)
+		p.pageRefs = append(p.pageRefs, pageRef{page: page, y: y, target: entry.target})
+		page.Link(p.margin, y-2, p.width, size+4, entry.target)
+	}
+}
+
+// truncate shortens value to a single line of width, ending it with an ellipsis.
+func truncate(font pdf.Font, size float64, width float64, value string) string {
+	if font.Width(value, size) <= width {
+		return value
+	}
+	runes := []rune(value)
+	for len(runes) > 0 && font.Width(string(runes)+"…", size) > width {
+		runes = runes[:len(runes)-1]
+	}
+	return strings.TrimSpace(string(runes)) + "…"
+}
+
+// resolvePageRefs prints the page numbers of the contents and the references
+// between recipes, now that everything has been laid out.
+func (p *printer) resolvePageRefs() {
+	for _, ref := range p.pageRefs {
+		target := ref.target
+		if target == nil {
+			target = p.recipePages[ref.recipeID]
+		}
+		if target == nil {
+			continue
+		}
+		number := strconv.Itoa(target.Number())
+		x := p.margin + p.width - pdf.Helvetica.Width(number, bodySize)
+		ref.page.Text(pdf.Helvetica, bodySize, mutedColor, x, ref.y+bodySize, number)
+		if ref.target == nil {
+			ref.page.Link(x, ref.y, p.margin+p.width-x, bodyLeading, target)
+		}
+	}
+}
+
+func (p *printer) sectionOpener(section *SectionModel, index int) {
+	p.newPage()
+	p.y = p.doc.Height * 0.3
+	p.page.Text(pdf.HelveticaBold, 9.5, accentColor, p.margin, p.y, fmt.Sprintf("SECTION %d", index+1))
+	p.y += 14
+	if section.Name != "" {
+		p.text(pdf.HelveticaBold, 26, 31, inkColor, p.margin, p.width, section.Name)
+	}
+	p.y += 8
+	p.page.Line(p.margin, p.y, p.margin+48, p.y, 1.5, accentColor)
+	p.y += 18
+	p.text(pdf.Helvetica, 12, 17, inkColor, p.margin, p.width, section.Overview)
+}
+
+// printPage prints one of a section's pages, each starting on a new page. It's
+// false for recipe pages whose recipe has since been deleted, which print nothing.
+func (p *printer) printPage(page *PageModel) bool {
+	switch page.PageType {
+	case PageRecipe:
+		recipe, ok := p.recipes[page.RecipeID]
+		if !ok {
+			return false
+		}
+		p.recipe(&recipe)
+	case PageGuide:
+		p.newPage()
+		p.title(page.Title)
+		p.paragraphs(page.Body)
+	case PageIntro:
+		p.newPage()
+		if img := p.image(page.Image); img != nil {
+			height := (p.bottom() - p.margin) * 0.45
+			p.page.ImageCover(img, p.margin, p.y, p.width, height)
+			p.y += height + 24
+		}
+		p.title(page.Title)
+		p.paragraphs(page.Body)
+	case PagePhotos:
+		p.newPage()
+		p.title(page.Title)
+		p.photos(page)
+	}
+	return true
+}
+
+func (p *printer) title(value string) {
+	if value == "" {
+		return
+	}
+	p.text(pdf.HelveticaBold, 22, 26, inkColor, p.margin, p.width, value)
+	p.y += 10
+}
+
+// paragraphs prints body text, with a gap wherever the author left a blank line.
+func (p *printer) paragraphs(body string) {
+	for _, paragraph := range strings.Split(strings.ReplaceAll(body, "\r\n", "\n"), "\n\n") {
+		p.text(pdf.Helvetica, bodySize, bodyLeading, inkColor, p.margin, p.width, paragraph)
+		p.y += bodyLeading / 2
+	}
+}
+
+// photos lays a photo spread out two to a row, each photo as large as its
+// half of the row allows, captioned underneath.
+func (p *printer) photos(page *PageModel) {
+	serialized, err := SerializePage(page)
+	if err != nil {
+		return
+	}
+	spread := serialized.Content.(*PhotoSpreadPage)
+
+	columns := 2
+	if len(spread.Photos) == 1 {
+		columns = 1
+	}
+	cell := (p.width - gutter*float64(columns-1)) / float64(columns)
+	maxHeight := cell
+	if limit := (p.bottom() - p.margin) * 0.6; limit < maxHeight {
+		maxHeight = limit
+	}
+	for start := 0; start < len(spread.Photos); start += columns {
+		row := spread.Photos[start:]
+		if len(row) > columns {
+			row = row[:columns]
+		}
+
+		height := 0.0
+		for _, photo := range row {
+			if img := p.image(photo.Src); img != nil {
+				_, h := fit(img, cell, maxHeight)
+				h += 6 + textHeight(pdf.HelveticaOblique, captionSize, 11, cell, photo.Caption)
+				if h > height {
+					height = h
+				}
+			}
+		}
+		if height == 0 {
+			continue
+		}
+		p.space(height)
+
+		for i, photo := range row {
+			img := p.image(photo.Src)
+			if img == nil {
+				continue
+			}
+			x := p.margin + float64(i)*(cell+gutter)
+			w, h := fit(img, cell, maxHeight)
+			p.page.Image(img, x+(cell-w)/2, p.y, w, h)
+			p.caption(x, p.y+h+6, cell, photo.Caption)
+		}
+		p.y += height + gutter
+	}
+}
+
+// caption prints a caption starting at x, y without moving down the page.
+func (p *printer) caption(x float64, y float64, width float64, value string) {
+	if strings.TrimSpace(value) == "" {
+		return
+	}
+	for _, line := range pdf.HelveticaOblique.Wrap(value, captionSize, width) {
+		p.page.Text(pdf.HelveticaOblique, captionSize, mutedColor, x, y+captionSize, line)
+		y += 11
+	}
+}
+
+func (p *printer) recipe(recipe *recipes.RecipeModel) {
+	p.newPage()
+	//references to a recipe printed in more than one section go to where it's first printed
+	if _, printed := p.recipePages[recipe.ID]; !printed {
+		p.recipePages[recipe.ID] = p.page
+	}
+
+	p.title(recipe.Name)
+	var details []string
+	if recipe.PrepTime != "" {
+		details = append(details, "Prep "+recipe.PrepTime)
+	}
+	if recipe.Servings != "" {
+		details = append(details, "Serves "+recipe.Servings)
+	}
+	if len(details) > 0 {
+		p.text(pdf.HelveticaOblique, 10, 14, mutedColor, p.margin, p.width, strings.Join(details, "  ·  "))
+		p.y += 6
+	}
+	p.text(pdf.Helvetica, bodySize, bodyLeading, inkColor, p.margin, p.width, recipe.Description)
+
+	if img := p.image(recipe.Image); img != nil {
+		p.y += 8
+		w, h := fit(img, p.width, (p.bottom()-p.margin)*0.4)
+		p.space(h)
+		p.page.Image(img, p.margin+(p.width-w)/2, p.y, w, h)
+		p.y += h
+	}
+
+	if len(recipe.DependentRecipes) > 0 {
+		p.heading("You'll need")
+		for _, dependency := range recipe.DependentRecipes {
+			line := strings.TrimSpace(dependency.Qty + " " + dependency.RecipeName)
+			p.space(bodyLeading)
+			p.pageRefs = append(p.pageRefs, pageRef{page: p.page, y: p.y, recipeID: dependency.DependentRecipe})
+			p.text(pdf.Helvetica, bodySize, bodyLeading, inkColor, p.margin, p.width-36, line)
+		}
+	}
+
+	p.ingredients(recipe.IngredientGroups)
+	p.steps(recipe.Steps)
+}
+
+// ingredients lines quantities up in a column of their own, as wide as the
+// widest quantity up to a third of the page.
+func (p *printer) ingredients(groups []recipes.IngredientGroupModel) {
+	if len(groups) == 0 {
+		return
+	}
+	p.heading("Ingredients")
+
+	column := 0.0
+	for _, group := range groups {
+		for _, ingredient := range group.Ingredients {
+			if w := pdf.HelveticaBold.Width(quantity(&ingredient), bodySize) + 10; w > column {
+				column = w
+			}
+		}
+	}
+	if column > p.width/3 {
+		column = p.width / 3
+	}
+
+	for i, group := range groups {
+		if group.GroupName != "" {
+			if i > 0 {
+				p.y += 6
+			}
+			p.space(2 * bodyLeading)
+			p.text(pdf.HelveticaBold, bodySize, bodyLeading, inkColor, p.margin, p.width, group.GroupName)
+		}
+		for _, ingredient := range group.Ingredients {
+			qty := truncate(pdf.HelveticaBold, bodySize, column-10, quantity(&ingredient))
+			p.space(bodyLeading)
+			p.page.Text(pdf.HelveticaBold, bodySize, inkColor, p.margin, p.y+bodySize, qty)
+			p.text(pdf.Helvetica, bodySize, bodyLeading, inkColor, p.margin+column, p.width-column, ingredient.Name)
+		}
+	}
+}
+
+func quantity(ingredient *recipes.IngredientModel) string {
+	return strings.TrimSpace(ingredient.Qty + " " + ingredient.Unit)
+}
+
+const stepIndent = 20
+
+// steps numbers every step but tips, which are boxed and set apart from the method.
+func (p *printer) steps(steps []recipes.StepModel) {
+	if len(steps) == 0 {
+		return
+	}
+	p.heading("Method")
+
+	number := 0
+	for _, step := range steps {
+		if step.Type == "tipText" {
+			p.tip(step.Text)
+			continue
+		}
+		number++
+
+		switch step.Type {
+		case "imageLeft", "imageRight":
+			p.sideImageStep(&step, number)
+		case "imageDouble", "imageTriple":
+			p.numbered(number, step.Text)
+			columns := 2
+			if step.Type == "imageTriple" {
+				columns = 3
+			}
+			p.imageRow(step.StepImages, columns)
+		default:
+			p.numbered(number, step.Text)
+		}
+		p.y += 8
+	}
+}
+
+func (p *printer) numbered(number int, text string) {
+	p.space(bodyLeading)
+	p.page.Text(pdf.HelveticaBold, bodySize, accentColor, p.margin, p.y+bodySize, strconv.Itoa(number))
+	p.text(pdf.Helvetica, bodySize, bodyLeading, inkColor, p.margin+stepIndent, p.width-stepIndent, text)
+}
+
+// tip boxes the tip in, unless it's too long to fit on a page at all.
+func (p *printer) tip(text string) {
+	const padding = 10
+	width := p.width - 2*padding
+	height := 2*padding + 14 + textHeight(pdf.Helvetica, bodySize, bodyLeading, width, text)
+	if height > p.bottom()-p.margin {
+		p.text(pdf.HelveticaBold, 9.5, 14, accentColor, p.margin, p.width, "TIP")
+		p.text(pdf.Helvetica, bodySize, bodyLeading, inkColor, p.margin, p.width, text)
+		p.y += 8
+		return
+	}
+
+	p.space(height)
+	p.page.Rect(p.margin, p.y, p.width, height, tintColor)
+	p.page.Text(pdf.HelveticaBold, 8, accentColor, p.margin+padding, p.y+padding+8, "TIP")
+	p.y += padding + 14
+	p.text(pdf.Helvetica, bodySize, bodyLeading, inkColor, p.margin+padding, width, text)
+	p.y += padding + 8
+}
+
+// sideImageStep sets the step's first image beside its text, on the side the step
+// type names. A step too long to sit beside its image gets the image above instead.
+func (p *printer) sideImageStep(step *recipes.StepModel, number int) {
+	var img *pdf.Image
+	var caption string
+	if len(step.StepImages) > 0 {
+		img = p.image(step.StepImages[0].Image)
+		caption = step.StepImages[0].Text
+	}
+	if img == nil {
+		p.numbered(number, step.Text)
+		return
+	}
+
+	imageWidth := p.width * 0.4
+	textWidth := p.width - imageWidth - gutter - stepIndent
+	w, h := fit(img, imageWidth, (p.bottom()-p.margin)*0.35)
+	imageHeight := h + 6 + textHeight(pdf.HelveticaOblique, captionSize, 11, imageWidth, caption)
+	height := textHeight(pdf.Helvetica, bodySize, bodyLeading, textWidth, step.Text)
+	if imageHeight > height {
+		height = imageHeight
+	}
+	if height > p.bottom()-p.margin {
+		p.imageRow(step.StepImages[:1], 1)
+		p.numbered(number, step.Text)
+		return
+	}
+
+	p.space(height)
+	imageX, textX := p.margin, p.margin+imageWidth+gutter
+	if step.Type == "imageRight" {
+		imageX, textX = p.margin+p.width-imageWidth, p.margin
+	}
+	top := p.y
+	p.page.Image(img, imageX+(imageWidth-w)/2, top, w, h)
+	p.caption(imageX, top+h+6, imageWidth, caption)
+
+	p.page.Text(pdf.HelveticaBold, bodySize, accentColor, textX, top+bodySize, strconv.Itoa(number))
+	p.text(pdf.Helvetica, bodySize, bodyLeading, inkColor, textX+stepIndent, textWidth, step.Text)
+	p.y = top + height
+}
+
+// imageRow sets a step's images side by side, cropped to the same shape so the
+// row lines up, each captioned underneath.
+func (p *printer) imageRow(stepImages []recipes.StepImageModel, columns int) {
+	loaded := make([]*pdf.Image, 0)
+	captions := make([]string, 0)
+	for _, stepImage := range stepImages {
+		if img := p.image(stepImage.Image); img != nil && len(loaded) < columns {
+			loaded = append(loaded, img)
+			captions = append(captions, stepImage.Text)
+		}
+	}
+	if len(loaded) == 0 {
+		return
+	}
+
+	cell := (p.width - gutter*float64(columns-1)) / float64(columns)
+	cellHeight := cell * 0.75
+	if columns == 1 {
+		cellHeight = (p.bottom() - p.margin) * 0.35
+	}
+	height := cellHeight
+	for _, caption := range captions {
+		if h := cellHeight + 6 + textHeight(pdf.HelveticaOblique, captionSize, 11, cell, caption); h > height {
+			height = h
+		}
+	}
+
+	p.y += 6
+	p.space(height)
+	for i, img := range loaded {
+		x := p.margin + float64(i)*(cell+gutter)
+		if columns == 1 {
+			w, h := fit(img, cell, cellHeight)
+			p.page.Image(img, x+(cell-w)/2, p.y, w, h)
+		} else {
+			p.page.ImageCover(img, x, p.y, cell, cellHeight)
+		}
+		p.caption(x, p.y+cellHeight+6, cell, captions[i])
+	}
+	p.y += height
+}
@@ -1,19 +1,29 @@
 package cookbooks
 
+import (
+	"encoding/json"
+	"github.com/anthonyhawkins/savorbook/publish/recipes"
+)
+
 type CookbookResponse struct {
-	ID       uint              `json:"id"`
-	Title    string            `json:"title"`
-	SubTitle string            `json:"subTitle"`
-	Blurb    string            `json:"blurb"`
-	Image    string            `json:"image"`
-	Sections []SectionResponse `json:"sections"`
+	ID          uint              `json:"id"`
+	Title       string            `json:"title"`
+	SubTitle    string            `json:"subTitle"`
+	Blurb       string            `json:"blurb"`
+	Image       string            `json:"image"`
+	Sections    []SectionResponse `json:"sections"`
+	Version     int               `json:"version"`
+	Status      string            `json:"status"`
+	PublishedAt string            `json:"publishedAt,omitempty"`
+	Pending     bool              `json:"hasUnpublishedChanges"`
 }
 
 type SectionResponse struct {
-	ID       uint    `json:"id"`
-	Name     string  `json:"name"`
-	Overview string  `json:"overview"`
-	Recipes  []int64 `json:"recipes"`
+	ID       uint            `json:"id"`
+	Name     string          `json:"name"`
+	Overview string          `json:"overview"`
+	Recipes  []int64         `json:"recipes"`
+	Pages    []PageValidator `json:"pages"`
 }
 
 func (r *CookbookResponse) SerializeCookbook(model *CookbookModel) {
@@ -23,6 +33,12 @@ func (r *CookbookResponse) SerializeCookbook(model *CookbookModel) {
 	r.Blurb = model.Blurb
 	r.Image = model.Image
 	r.SerializeSections(model.Sections)
+	r.Version = model.Version
+	r.Status = model.Status
+	if model.PublishedAt != nil {
+		r.PublishedAt = model.PublishedAt.Format("2006-01-02T15:04:05Z07:00")
+	}
+	r.Pending = model.HasUnpublishedChanges()
 }
 
 func (r *CookbookResponse) SerializeSections(sectionModels []SectionModel) {
@@ -37,7 +53,73 @@ func (r *CookbookResponse) SerializeSections(sectionModels []SectionModel) {
 		} else {
 			section.Recipes = sectionModel.Recipes
 		}
+		section.Pages = SerializePages(sectionModel.Pages)
 		sections = append(sections, section)
 	}
 	r.Sections = sections
 }
+
+// SerializePages skips a page whose type is no longer known rather than failing the whole section.
+func SerializePages(pageModels []PageModel) []PageValidator {
+	pages := make([]PageValidator, 0)
+	for _, pageModel := range pageModels {
+		page, err := SerializePage(&pageModel)
+		if err == nil {
+			pages = append(pages, page)
+		}
+	}
+	return pages
+}
+
+// PageResponse is a page with its recipe filled in, for recipe pages.
+type PageResponse struct {
+	PageValidator
+	Position int
+	Recipe   *recipes.RecipeResponse
+}
+
+func (r PageResponse) MarshalJSON() ([]byte, error) {
+	page, err := json.Marshal(r.PageValidator)
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]interface{})
+	if err := json.Unmarshal(page, &fields); err != nil {
+		return nil, err
+	}
+	fields["position"] = r.Position
+	if r.Recipe != nil {
+		fields["recipe"] = r.Recipe
+	}
+	return json.Marshal(fields)
+}
+
+func (r *PageResponse) SerializePage(model *PageModel, recipe *recipes.RecipeModel) error {
+	page, err := SerializePage(model)
+	if err != nil {
+		return err
+	}
+	r.PageValidator = page
+	r.Position = model.Position
+	if recipe != nil {
+		r.Recipe = new(recipes.RecipeResponse)
+		r.Recipe.SerializeRecipe(recipe)
+	}
+	return nil
+}
+
+type PublishedCookbookResponse struct {
+	ID          uint              `json:"id"`
+	Version     int               `json:"version"`
+	PublishedAt string            `json:"publishedAt"`
+	Cookbook    *CookbookSnapshot `json:"cookbook"`
+}
+
+func (r *PublishedCookbookResponse) SerializePublished(model *CookbookModel, publication *CookbookPublicationModel, snapshot *CookbookSnapshot) {
+	r.ID = model.ID
+	r.Version = publication.Version
+	if model.PublishedAt != nil {
+		r.PublishedAt = model.PublishedAt.Format("2006-01-02T15:04:05Z07:00")
+	}
+	r.Cookbook = snapshot
+}
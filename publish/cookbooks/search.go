@@ -0,0 +1,44 @@
+package cookbooks
+
+import (
+	"github.com/anthonyhawkins/savorbook/publish/recipes"
+	"gorm.io/gorm"
+)
+
+// cookbook_publication_models carries a search_vector which gorm never reads or
+// writes, built from the published snapshot rather than the draft: title (A),
+// sub title (B), the names of its recipes and the titles of its other pages (C)
+// and the blurb (D). It is rebuilt each time the cookbook is published.
+const publicationVectorSQL = `
+setweight(to_tsvector('` + recipes.SearchConfig + `', coalesce(snapshot->>'title', '')), 'A') ||
+setweight(to_tsvector('` + recipes.SearchConfig + `', coalesce(snapshot->>'subTitle', '')), 'B') ||
+setweight(to_tsvector('` + recipes.SearchConfig + `', coalesce((
+	SELECT string_agg(recipe->'recipe'->>'name', ' ')
+	FROM jsonb_array_elements(snapshot->'sections') AS section, jsonb_array_elements(section->'recipes') AS recipe
+), '') || ' ' || coalesce((
+	SELECT string_agg(page->>'title', ' ')
+	FROM jsonb_array_elements(snapshot->'sections') AS section,
+	jsonb_array_elements(coalesce(section->'pages', '[]')) AS page
+), '')), 'C') ||
+setweight(to_tsvector('` + recipes.SearchConfig + `', coalesce(snapshot->>'blurb', '')), 'D')`
+
+func MigratePublicationSearch(db *gorm.DB) error {
+	statements := []string{
+		`ALTER TABLE cookbook_publication_models ADD COLUMN IF NOT EXISTS search_vector tsvector`,
+		`CREATE INDEX IF NOT EXISTS idx_cookbook_publication_models_search_vector ON cookbook_publication_models USING GIN (search_vector)`,
+		`UPDATE cookbook_publication_models SET search_vector = ` + publicationVectorSQL + ` WHERE search_vector IS NULL`,
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func refreshPublicationSearch(tx *gorm.DB, cookbookID uint) error {
+	return tx.Exec(
+		`UPDATE cookbook_publication_models SET search_vector = `+publicationVectorSQL+` WHERE cookbook_id = ?`,
+		cookbookID,
+	).Error
+}
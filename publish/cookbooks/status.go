@@ -0,0 +1,267 @@
+package cookbooks
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/anthonyhawkins/savorbook/database"
+	"github.com/anthonyhawkins/savorbook/publish/recipes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// CookbookPublicationModel is the published cookbook, frozen when it was published.
+// There is one per published cookbook, replaced each time it is published again.
+type CookbookPublicationModel struct {
+	gorm.Model
+	CookbookID uint `gorm:"uniqueIndex"`
+	UserID     uint
+	Version    int
+	Snapshot   string `gorm:"type:jsonb"`
+}
+
+// CookbookSnapshot holds everything a reader of the published cookbook sees. The
+// recipes are copied in from their revisions, so editing a recipe afterwards
+// changes nothing here until the cookbook is published again.
+type CookbookSnapshot struct {
+	Title    string            `json:"title"`
+	SubTitle string            `json:"subTitle"`
+	Blurb    string            `json:"blurb"`
+	Image    string            `json:"image"`
+	Sections []SectionSnapshot `json:"sections"`
+}
+
+// SectionSnapshot lists the section's pages in order. A recipe page only carries
+// its recipe's id, the recipe itself is in Recipes.
+type SectionSnapshot struct {
+	ID       uint                      `json:"id"`
+	Name     string                    `json:"name"`
+	Overview string                    `json:"overview"`
+	Recipes  []PublishedRecipeSnapshot `json:"recipes"`
+	Pages    []PageValidator           `json:"pages"`
+}
+
+type PublishedRecipeSnapshot struct {
+	ID       uint                   `json:"id"`
+	Revision int                    `json:"revision"`
+	Recipe   recipes.RecipeSnapshot `json:"recipe"`
+}
+
+func (publication *CookbookPublicationModel) Cookbook() (CookbookSnapshot, error) {
+	var snapshot CookbookSnapshot
+	err := json.Unmarshal([]byte(publication.Snapshot), &snapshot)
+	return snapshot, err
+}
+
+// Preview is the cookbook as shown before it's bought. Every section and page is
+// still listed, but recipes lose their ingredients, steps and sub-recipes, and the
+// other pages are cut down by their own page type.
+func (snapshot CookbookSnapshot) Preview() CookbookSnapshot {
+	preview := snapshot
+	preview.Sections = make([]SectionSnapshot, 0)
+	for _, section := range snapshot.Sections {
+		recipeList := make([]PublishedRecipeSnapshot, 0)
+		for _, recipe := range section.Recipes {
+			recipe.Recipe.DependentRecipes = make([]recipes.RecipeDependencyValidator, 0)
+			recipe.Recipe.IngredientGroups = make([]recipes.IngredientGroupValidator, 0)
+			recipe.Recipe.Steps = make([]recipes.StepValidator, 0)
+			recipeList = append(recipeList, recipe)
+		}
+		section.Recipes = recipeList
+		pageList := make([]PageValidator, 0)
+		for _, page := range section.Pages {
+			pageList = append(pageList, page.Preview())
+		}
+		section.Pages = pageList
+		preview.Sections = append(preview.Sections, section)
+	}
+	return preview
+}
+
+// HasUnpublishedChanges is true once a published cookbook has been edited since it was published.
+func (model *CookbookModel) HasUnpublishedChanges() bool {
+	return model.Status == recipes.StatusPublished && model.Version != model.PublishedVersion
+}
+
+// loadStatus reads back the lifecycle columns, which saving the cookbook's content never touches.
+func (model *CookbookModel) loadStatus(tx *gorm.DB) error {
+	return tx.Model(&CookbookModel{}).Select(
+		"status", "published_version", "published_at",
+	).Where("id = ?", model.ID).Scan(model).Error
+}
+
+// PublishCookbook freezes the cookbook as it is now, see CookbookSnapshot. A non-zero version is the version the author reviewed.
+func PublishCookbook(cookbookID string, userID uint, version int) error {
+	db := database.GetDB()
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		model, err := lockCookbook(tx, cookbookID, userID, version)
+		if err != nil {
+			return err
+		}
+		err = tx.Scopes(orderedSections).Preload("Pages", orderedPages).Where("cookbook_id = ?", model.ID).Find(&model.Sections).Error
+		if err != nil {
+			return err
+		}
+
+		snapshot, err := model.snapshot(tx)
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(snapshot)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Unscoped().Where("cookbook_id = ?", model.ID).Delete(&CookbookPublicationModel{}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Create(&CookbookPublicationModel{
+			CookbookID: model.ID,
+			UserID:     userID,
+			Version:    model.Version,
+			Snapshot:   string(data),
+		}).Error
+		if err != nil {
+			return err
+		}
+		if err := refreshPublicationSearch(tx, model.ID); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		return tx.Model(&model).Omit(clause.Associations).Select(
+			"Status", "PublishedVersion", "PublishedAt",
+		).Updates(&CookbookModel{
+			Status:           recipes.StatusPublished,
+			PublishedVersion: model.Version,
+			PublishedAt:      &now,
+		}).Error
+	})
+}
+
+func (model *CookbookModel) snapshot(tx *gorm.DB) (CookbookSnapshot, error) {
+	snapshot := CookbookSnapshot{
+		Title:    model.Title,
+		SubTitle: model.SubTitle,
+		Blurb:    model.Blurb,
+		Image:    model.Image,
+		Sections: make([]SectionSnapshot, 0),
+	}
+
+	for _, section := range model.Sections {
+		sectionSnapshot := SectionSnapshot{
+			ID:       section.ID,
+			Name:     section.Name,
+			Overview: section.Overview,
+			Recipes:  make([]PublishedRecipeSnapshot, 0),
+			Pages:    make([]PageValidator, 0),
+		}
+		for _, page := range section.Pages {
+			pageSnapshot, err := SerializePage(&page)
+			if err != nil {
+				return snapshot, err
+			}
+
+			if page.PageType == PageRecipe {
+				revision, err := recipes.RevisionToPublish(tx, page.RecipeID, model.UserID)
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					//deleted since it was added to the section
+					continue
+				}
+				if err != nil {
+					return snapshot, err
+				}
+				recipe, err := revision.Recipe()
+				if err != nil {
+					return snapshot, err
+				}
+				sectionSnapshot.Recipes = append(sectionSnapshot.Recipes, PublishedRecipeSnapshot{
+					ID:       page.RecipeID,
+					Revision: revision.Number,
+					Recipe:   recipe,
+				})
+			}
+			sectionSnapshot.Pages = append(sectionSnapshot.Pages, pageSnapshot)
+		}
+		snapshot.Sections = append(snapshot.Sections, sectionSnapshot)
+	}
+	return snapshot, nil
+}
+
+// UnpublishCookbook takes the cookbook back to a draft, which also brings an archived cookbook back out.
+func UnpublishCookbook(cookbookID string, userID uint, version int) error {
+	return withdrawCookbook(cookbookID, userID, version, recipes.StatusDraft)
+}
+
+func ArchiveCookbook(cookbookID string, userID uint, version int) error {
+	return withdrawCookbook(cookbookID, userID, version, recipes.StatusArchived)
+}
+
+func withdrawCookbook(cookbookID string, userID uint, version int, status string) error {
+	db := database.GetDB()
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		model, err := lockCookbook(tx, cookbookID, userID, version)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Unscoped().Where("cookbook_id = ?", model.ID).Delete(&CookbookPublicationModel{}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&model).Omit(clause.Associations).Select(
+			"Status", "PublishedVersion", "PublishedAt",
+		).Updates(&CookbookModel{Status: status}).Error
+	})
+}
+
+// lockCookbook holds the cookbook row until the transaction ends so a save can't slip in between checking and publishing.
+func lockCookbook(tx *gorm.DB, cookbookID string, userID uint, version int) (CookbookModel, error) {
+	var model CookbookModel
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where(map[string]interface{}{
+		"id":      cookbookID,
+		"user_id": userID,
+	}).First(&model).Error
+	if err != nil {
+		return model, err
+	}
+	if version != 0 && model.Version != version {
+		return model, database.ErrVersionConflict
+	}
+	return model, nil
+}
+
+// GetPublishedCookbook returns what readers see, or gorm.ErrRecordNotFound if the cookbook isn't published.
+func GetPublishedCookbook(cookbookID string, userID uint) (CookbookModel, CookbookPublicationModel, error) {
+	return getPublished(map[string]interface{}{
+		"id":      cookbookID,
+		"user_id": userID,
+		"status":  recipes.StatusPublished,
+	})
+}
+
+// GetPublicCookbook is GetPublishedCookbook for readers, who may open any author's published cookbook.
+func GetPublicCookbook(cookbookID string) (CookbookModel, CookbookPublicationModel, error) {
+	return getPublished(map[string]interface{}{
+		"id":     cookbookID,
+		"status": recipes.StatusPublished,
+	})
+}
+
+func getPublished(where map[string]interface{}) (CookbookModel, CookbookPublicationModel, error) {
+	db := database.GetDB()
+	var model CookbookModel
+	var publication CookbookPublicationModel
+
+	result := db.Where(where).First(&model)
+	if result.Error != nil {
+		return model, publication, result.Error
+	}
+
+	result = db.Where("cookbook_id = ?", model.ID).First(&publication)
+	return model, publication, result.Error
+}
@@ -1,6 +1,10 @@
 package cookbooks
 
-import "github.com/go-playground/validator/v10"
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+)
 
 type CookbookValidator struct {
 	Cookbook struct {
@@ -9,14 +13,18 @@ type CookbookValidator struct {
 		Blurb    string             `json:"blurb" validate:"max=500"`
 		Image    string             `json:"image" validate:"omitempty"`
 		Sections []SectionValidator `json:"sections" validate:"dive"`
+		Version  int                `json:"version,omitempty"`
 	} `json:"cookbook"`
 	Model CookbookModel `json:"-"`
 }
 
 type SectionValidator struct {
+	ID       uint   `json:"id,omitempty"`
 	Name     string `json:"name" validate:"max=75"`
 	Overview string `json:"overview" validate:"max=500"`
-	Recipes  []uint `json:"recipes" validate:"dive,numeric"`
+	//Recipes is the older way to fill a section, one recipe page per id
+	Recipes []uint          `json:"recipes,omitempty" validate:"dive,numeric"`
+	Pages   []PageValidator `json:"pages" validate:"max=200"`
 }
 
 func NewCookbookValidator() *CookbookValidator {
@@ -34,6 +42,16 @@ func (v *CookbookValidator) Validate() ([]string, error) {
 		}
 	}
 
+	//each page type validates its own fields
+	for _, section := range v.Cookbook.Sections {
+		for i := range section.Pages {
+			errors = append(errors, section.Pages[i].Validate(validate)...)
+		}
+	}
+	if err == nil && len(errors) > 0 {
+		err = fmt.Errorf("invalid pages")
+	}
+
 	return errors, err
 }
 
@@ -48,3 +66,32 @@ func (v *CookbookValidator) BindModel(userID uint) error {
 	}
 	return nil
 }
+
+// PatchDocument is the stored cookbook in the shape CookbookValidator reads, section
+// and page ids included, for PATCH requests to be applied against. Sections are
+// written out as pages, never as the older list of recipe ids.
+func (model *CookbookModel) PatchDocument() ([]byte, error) {
+	var document CookbookValidator
+	document.Cookbook.Title = model.Title
+	document.Cookbook.SubTitle = model.SubTitle
+	document.Cookbook.Blurb = model.Blurb
+	document.Cookbook.Image = model.Image
+	document.Cookbook.Sections = make([]SectionValidator, 0)
+	for _, section := range model.Sections {
+		sectionValidator := SectionValidator{
+			ID:       section.ID,
+			Name:     section.Name,
+			Overview: section.Overview,
+			Pages:    make([]PageValidator, 0),
+		}
+		for _, page := range section.Pages {
+			pageValidator, err := SerializePage(&page)
+			if err != nil {
+				return nil, err
+			}
+			sectionValidator.Pages = append(sectionValidator.Pages, pageValidator)
+		}
+		document.Cookbook.Sections = append(document.Cookbook.Sections, sectionValidator)
+	}
+	return json.Marshal(document)
+}
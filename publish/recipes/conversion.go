@@ -0,0 +1,251 @@
+package recipes
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const Original = "original"
+
+// ingredientDensities are grams per millilitre, used to turn cups of flour into grams and back.
+var ingredientDensities = map[string]float64{
+	"all-purpose flour":   0.53,
+	"all purpose flour":   0.53,
+	"plain flour":         0.53,
+	"bread flour":         0.55,
+	"cake flour":          0.48,
+	"whole wheat flour":   0.51,
+	"wholemeal flour":     0.51,
+	"self-raising flour":  0.53,
+	"self-rising flour":   0.53,
+	"almond flour":        0.41,
+	"flour":               0.53,
+	"granulated sugar":    0.85,
+	"caster sugar":        0.85,
+	"brown sugar":         0.93,
+	"powdered sugar":      0.51,
+	"icing sugar":         0.51,
+	"confectioners sugar": 0.51,
+	"sugar":               0.85,
+	"butter":              0.96,
+	"honey":               1.42,
+	"maple syrup":         1.32,
+	"cocoa powder":        0.36,
+	"cocoa":               0.36,
+	"rolled oats":         0.38,
+	"oats":                0.38,
+	"rice":                0.79,
+	"salt":                1.22,
+	"baking soda":         0.92,
+	"baking powder":       0.81,
+	"cornstarch":          0.54,
+	"cornflour":           0.54,
+	"milk":                1.03,
+	"cream":               1.01,
+	"water":               1,
+	"oil":                 0.92,
+	"olive oil":           0.92,
+	"yogurt":              1.03,
+	"chocolate chips":     0.72,
+}
+
+// densityKeys are checked longest first so "brown sugar" wins over "sugar".
+var densityKeys = sortedDensityKeys()
+
+func sortedDensityKeys() []string {
+	var keys []string
+	for key := range ingredientDensities {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return len(keys[i]) > len(keys[j])
+	})
+	return keys
+}
+
+// IngredientDensity looks up the grams per millilitre of a common staple by name.
+func IngredientDensity(name string) (float64, bool) {
+	name = strings.ToLower(name)
+	for _, key := range densityKeys {
+		if strings.Contains(name, key) {
+			return ingredientDensities[key], true
+		}
+	}
+	return 0, false
+}
+
+// ValidUnitSystem reports whether system is one RecipeGet can convert to.
+func ValidUnitSystem(system string) bool {
+	return system == Metric || system == Imperial || system == Original
+}
+
+// ConvertUnits rewrites ingredient amounts and oven temperatures in the steps into the metric or imperial system.
+func (model *RecipeModel) ConvertUnits(system string) {
+	if system != Metric && system != Imperial {
+		return
+	}
+
+	for i := range model.IngredientGroups {
+		for j := range model.IngredientGroups[i].Ingredients {
+			model.IngredientGroups[i].Ingredients[j].convertUnits(system)
+		}
+	}
+
+	for i := range model.Steps {
+		model.Steps[i].Text = ConvertTemperatures(model.Steps[i].Text, system)
+	}
+}
+
+func (model *IngredientModel) convertUnits(system string) {
+	if model.Amount == nil || model.CanonicalUnit == "" {
+		return
+	}
+	from, ok := GetUnit(model.CanonicalUnit)
+	if !ok || from.System == "" || from.System == system {
+		return
+	}
+
+	/**
+	Metric kitchens weigh dry staples while imperial ones measure them by volume,
+	so convert between the two whenever the ingredient's density is known.
+	*/
+	kind := from.Kind
+	factor := 1.0
+	if density, ok := IngredientDensity(model.Name); ok {
+		switch {
+		case system == Metric && from.Kind == Volume:
+			kind, factor = Mass, density
+		case system == Imperial && from.Kind == Mass:
+			kind, factor = Volume, 1/density
+		}
+	}
+
+	var base float64
+	if from.Kind == Temperature {
+		base = *model.Amount
+	} else {
+		base = *model.Amount * from.Factor * factor
+	}
+	to := PreferredUnit(kind, system, base)
+
+	convert := func(amount float64) float64 {
+		if from.Kind == Temperature {
+			return ConvertTemperature(amount, from, to)
+		}
+		return amount * from.Factor * factor / to.Factor
+	}
+
+	amount := convert(*model.Amount)
+	model.Amount = &amount
+	model.Qty = FormatConverted(amount, system)
+	if model.AmountMax != nil {
+		amountMax := convert(*model.AmountMax)
+		model.AmountMax = &amountMax
+		model.Qty += "-" + FormatConverted(amountMax, system)
+	}
+	model.Unit = DisplayUnit(to, amount)
+	model.CanonicalUnit = to.Name
+}
+
+// DisplayUnit pluralises the units which are written out as words, i.e. "2 cups" but "2 tbsp".
+func DisplayUnit(unit Unit, amount float64) string {
+	switch unit.Name {
+	case "cup", "pint", "quart", "gallon":
+		if amount > 1 {
+			return unit.Name + "s"
+		}
+	}
+	return unit.Name
+}
+
+// PreferredUnit picks the unit a cook in that system would reach for, given an amount in the base unit.
+func PreferredUnit(kind UnitKind, system string, base float64) Unit {
+	var name string
+	switch {
+	case kind == Temperature && system == Metric:
+		name = "°C"
+	case kind == Temperature:
+		name = "°F"
+	case kind == Volume && system == Metric:
+		name = "ml"
+		if base >= 1000 {
+			name = "l"
+		}
+	case kind == Volume:
+		switch {
+		case base >= 946.353*4:
+			name = "quart"
+		case base >= 236.588/4:
+			name = "cup"
+		case base >= 14.7868:
+			name = "tbsp"
+		default:
+			name = "tsp"
+		}
+	case kind == Mass && system == Metric:
+		name = "g"
+		if base >= 1000 {
+			name = "kg"
+		}
+	default:
+		name = "oz"
+		if base >= 453.592 {
+			name = "lb"
+		}
+	}
+	unit, _ := GetUnit(name)
+	return unit
+}
+
+// FormatConverted rounds fractions for imperial amounts and decimals for metric ones.
+func FormatConverted(amount float64, system string) string {
+	if system == Imperial {
+		return FormatAmount(amount)
+	}
+	if amount >= 10 {
+		return strconv.FormatFloat(math.Round(amount), 'f', -1, 64)
+	}
+	return strconv.FormatFloat(math.Round(amount*10)/10, 'f', -1, 64)
+}
+
+// ovenTemperature matches "350°F", "180 °C", "350 degrees F" and "200 degrees Celsius".
+var ovenTemperature = regexp.MustCompile(`(?i)\b(\d{2,3})\s*(?:°\s*|º\s*|degrees?\s+|deg\.?\s+)?(F|C|Fahrenheit|Celsius)\b`)
+
+// ConvertTemperatures rewrites temperatures in free text into the given system,
+// rounded the way oven dials are marked: 10s for Celsius and 25s for Fahrenheit.
+func ConvertTemperatures(text string, system string) string {
+	return ovenTemperature.ReplaceAllStringFunc(text, func(match string) string {
+		parts := ovenTemperature.FindStringSubmatch(match)
+		degrees, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			return match
+		}
+
+		scale := strings.ToUpper(parts[2][:1])
+		//a bare "C" or "F" straight after a small number is more likely cups or a typo than an oven
+		if degrees < 90 && len(parts[2]) == 1 && !strings.ContainsAny(match, "°º") {
+			return match
+		}
+
+		from, _ := GetUnit("°" + scale)
+		to := from
+		if system == Metric {
+			to, _ = GetUnit("°C")
+		} else if system == Imperial {
+			to, _ = GetUnit("°F")
+		}
+		if from.Name == to.Name {
+			return match
+		}
+
+		step := 10.0
+		if to.Name == "°F" {
+			step = 25
+		}
+		converted := math.Round(ConvertTemperature(degrees, from, to)/step) * step
+		return strconv.FormatFloat(converted, 'f', -1, 64) + to.Name
+	})
+}
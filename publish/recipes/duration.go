@@ -0,0 +1,137 @@
+package recipes
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// durationPart matches one amount of time, i.e. "1 hr", "1½ hours" or "30min".
+var durationPart = regexp.MustCompile(`(?i)(` + numberPattern + `)\s*(hours?|hrs?|h|minutes?|mins?|m)\b`)
+
+// unitThenNumber splits run together durations like "1h20m".
+var unitThenNumber = regexp.MustCompile(`([a-zA-Z])(\d)`)
+
+// clockDuration matches "1:30", read as hours and minutes.
+var clockDuration = regexp.MustCompile(`^\s*(\d+):(\d{2})\s*$`)
+
+// isoDuration matches the ISO 8601 durations schema.org uses, i.e. "PT1H30M" or "P0DT45M".
+var isoDuration = regexp.MustCompile(`(?i)^P(?:(\d+(?:\.\d+)?)D)?(?:T(?:(\d+(?:\.\d+)?)H)?(?:(\d+(?:\.\d+)?)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// ParseMinutes reads a free-form PrepTime such as "1 hr 30 mins", "45 minutes",
+// "1:30" or "20-30 min" into minutes. A range takes its upper end, which is what
+// matters when asking what can be made within the time. A bare number is taken
+// as minutes.
+func ParseMinutes(text string) (int, bool) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return 0, false
+	}
+
+	if match := clockDuration.FindStringSubmatch(text); match != nil {
+		hours, _ := parseNumber(match[1])
+		minutes, _ := parseNumber(match[2])
+		return int(hours*60 + minutes), true
+	}
+
+	text = unitThenNumber.ReplaceAllString(text, "$1 $2")
+	total := 0.0
+	found := false
+	for _, match := range durationPart.FindAllStringSubmatchIndex(text, -1) {
+		//a range, i.e. "20-30 min", keeps only the number next to the unit so step back over it
+		start := match[2]
+		quantity, rest, ok := parseLeadingQuantity(text[rangeStart(text, start):match[3]])
+		if !ok || strings.TrimSpace(rest) != "" {
+			quantity, _, ok = parseLeadingQuantity(text[start:match[3]])
+		}
+		if !ok {
+			continue
+		}
+		unit := strings.ToLower(text[match[4]:match[5]])
+		if strings.HasPrefix(unit, "h") {
+			total += quantity.Max * 60
+		} else {
+			total += quantity.Max
+		}
+		found = true
+	}
+
+	if !found {
+		if quantity, ok := ParseQuantity(text); ok {
+			return int(math.Round(quantity.Max)), true
+		}
+		return 0, false
+	}
+	return int(math.Round(total)), true
+}
+
+// rangeStart steps back from a number over "20-" or "20 to " so the whole range is parsed.
+func rangeStart(text string, start int) int {
+	before := strings.TrimRight(text[:start], " ")
+	for _, separator := range []string{"-", "–", "—", "to"} {
+		if strings.HasSuffix(before, separator) {
+			head := strings.TrimRight(strings.TrimSuffix(before, separator), " ")
+			i := len(head)
+			for i > 0 && (head[i-1] >= '0' && head[i-1] <= '9' || head[i-1] == '.' || head[i-1] == '/') {
+				i--
+			}
+			if i < len(head) {
+				return i
+			}
+		}
+	}
+	return start
+}
+
+// ParseISODuration reads an ISO 8601 duration such as "PT1H30M" into minutes.
+// Seconds are rounded to the nearest minute.
+func ParseISODuration(text string) (int, bool) {
+	text = strings.TrimSpace(text)
+	match := isoDuration.FindStringSubmatch(text)
+	if match == nil || text == "P" || strings.HasSuffix(strings.ToUpper(text), "T") {
+		return 0, false
+	}
+
+	total := 0.0
+	for i, minutes := range []float64{24 * 60, 60, 1, 1.0 / 60} {
+		if match[i+1] == "" {
+			continue
+		}
+		value, err := strconv.ParseFloat(match[i+1], 64)
+		if err != nil {
+			return 0, false
+		}
+		total += value * minutes
+	}
+	return int(math.Round(total)), true
+}
+
+// FormatMinutes writes minutes the way PrepTime is usually typed, i.e. "1 hr 30 min".
+func FormatMinutes(minutes int) string {
+	hours := minutes / 60
+	minutes = minutes % 60
+	switch {
+	case hours == 0:
+		return fmt.Sprintf("%d min", minutes)
+	case minutes == 0:
+		return fmt.Sprintf("%d hr", hours)
+	default:
+		return fmt.Sprintf("%d hr %d min", hours, minutes)
+	}
+}
+
+// FormatISODuration writes minutes as an ISO 8601 duration, i.e. 90 becomes "PT1H30M".
+func FormatISODuration(minutes int) string {
+	hours := minutes / 60
+	minutes = minutes % 60
+	switch {
+	case hours == 0:
+		return fmt.Sprintf("PT%dM", minutes)
+	case minutes == 0:
+		return fmt.Sprintf("PT%dH", hours)
+	default:
+		return fmt.Sprintf("PT%dH%dM", hours, minutes)
+	}
+}
@@ -0,0 +1,150 @@
+package recipes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// Fetcher downloads the page a recipe is imported from. The HTTP fetcher is used
+// unless another is set with SetFetcher, which lets tests serve pages without a network.
+type Fetcher interface {
+	Fetch(ctx context.Context, pageURL string) ([]byte, error)
+}
+
+// maxImportPage is the most that is read of an imported page, recipe blogs are large but not this large.
+const maxImportPage = 4 << 20
+
+var ErrPageTooLarge = errors.New("page is too large to import")
+
+var ErrBlockedAddress = errors.New("address is not allowed")
+
+var fetcher Fetcher = NewHTTPFetcher(10 * time.Second)
+
+func SetFetcher(f Fetcher) {
+	fetcher = f
+}
+
+func GetFetcher() Fetcher {
+	return fetcher
+}
+
+// HTTPFetcher fetches pages over http and https. Only public addresses are dialled
+// so an import can't be used to reach services inside the network.
+type HTTPFetcher struct {
+	client *http.Client
+}
+
+func NewHTTPFetcher(timeout time.Duration) *HTTPFetcher {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, conn syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+				return ErrBlockedAddress
+			}
+			return nil
+		},
+	}
+
+	return &HTTPFetcher{client: &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("too many redirects")
+			}
+			return checkScheme(req.URL)
+		},
+	}}
+}
+
+func (f *HTTPFetcher) Fetch(ctx context.Context, pageURL string) ([]byte, error) {
+	parsed, err := url.Parse(pageURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkScheme(parsed); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, parsed.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s returned %s", parsed.Host, resp.Status)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxImportPage+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxImportPage {
+		return nil, ErrPageTooLarge
+	}
+	return data, nil
+}
+
+func checkScheme(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported url scheme %q", u.Scheme)
+	}
+	return nil
+}
+
+// privateNetworks are the ranges, besides loopback and link local, which aren't reachable from the internet.
+var privateNetworks = parseNetworks(
+	"10.0.0.0/8",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"100.64.0.0/10",
+	"0.0.0.0/8",
+	"fc00::/7",
+)
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+func isPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
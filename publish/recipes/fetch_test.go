@@ -0,0 +1,75 @@
+package recipes
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		ip     string
+		public bool
+	}{
+		{ip: "93.184.216.34", public: true},
+		{ip: "8.8.8.8", public: true},
+		{ip: "172.32.0.1", public: true},
+		{ip: "100.128.0.1", public: true},
+		{ip: "2606:2800:220:1:248:1893:25c8:1946", public: true},
+		{ip: "127.0.0.1", public: false},
+		{ip: "127.255.255.254", public: false},
+		{ip: "::1", public: false},
+		{ip: "10.0.0.1", public: false},
+		{ip: "10.255.255.255", public: false},
+		{ip: "172.16.0.1", public: false},
+		{ip: "172.31.255.255", public: false},
+		{ip: "192.168.1.1", public: false},
+		{ip: "100.64.0.1", public: false},
+		{ip: "169.254.169.254", public: false},
+		{ip: "0.0.0.0", public: false},
+		{ip: "0.1.2.3", public: false},
+		{ip: "::", public: false},
+		{ip: "fe80::1", public: false},
+		{ip: "fc00::1", public: false},
+		{ip: "fd12:3456:789a::1", public: false},
+		{ip: "224.0.0.1", public: false},
+		{ip: "ff02::1", public: false},
+		{ip: "::ffff:127.0.0.1", public: false},
+		{ip: "::ffff:10.0.0.1", public: false},
+		{ip: "::ffff:192.168.0.1", public: false},
+		{ip: "::ffff:93.184.216.34", public: true},
+	}
+	for _, test := range tests {
+		ip := net.ParseIP(test.ip)
+		if ip == nil {
+			t.Fatalf("%s does not parse", test.ip)
+		}
+		if got := isPublicIP(ip); got != test.public {
+			t.Errorf("isPublicIP(%s): got %v, want %v", test.ip, got, test.public)
+		}
+	}
+}
+
+func TestHTTPFetcherBlocksLoopback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html></html>"))
+	}))
+	defer server.Close()
+
+	_, err := NewHTTPFetcher(5*time.Second).Fetch(context.Background(), server.URL)
+	if !errors.Is(err, ErrBlockedAddress) {
+		t.Fatalf("fetching %s: got %v, want %v", server.URL, err, ErrBlockedAddress)
+	}
+}
+
+func TestHTTPFetcherSchemes(t *testing.T) {
+	for _, pageURL := range []string{"file:///etc/passwd", "ftp://example.com/recipe", "gopher://example.com"} {
+		if _, err := NewHTTPFetcher(time.Second).Fetch(context.Background(), pageURL); err == nil {
+			t.Errorf("fetching %s: no error", pageURL)
+		}
+	}
+}
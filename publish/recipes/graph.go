@@ -0,0 +1,309 @@
+package recipes
+
+import (
+	"errors"
+	"github.com/anthonyhawkins/savorbook/database"
+	"gorm.io/gorm"
+	"strings"
+)
+
+var ErrDependencyCycle = errors.New("recipe dependencies form a cycle")
+
+// dependencyLock is the first key of the per-user advisory lock held while a recipe's dependencies are checked and saved.
+const dependencyLock = 9
+
+// lockDependencies holds the user's dependency graph until tx ends, so two recipes
+// saved at once can't each pass the cycle check and then form a loop together.
+func lockDependencies(tx *gorm.DB, userID uint) error {
+	return tx.Exec("SELECT pg_advisory_xact_lock(?, ?)", dependencyLock, int32(userID)).Error
+}
+
+// dependencyEdge is one row of recipe_dependency_models, read with just the columns the graph needs.
+type dependencyEdge struct {
+	RecipeID        uint
+	DependentRecipe uint
+	Qty             string
+}
+
+// DependencyGraph is every dependency between a user's recipes, loaded in one query
+// so the transitive tree can be walked without a query per level.
+type DependencyGraph struct {
+	Names map[uint]string
+	Edges map[uint][]dependencyEdge
+}
+
+type GraphNode struct {
+	RecipeID uint
+	Name     string
+	Qty      string
+	Depth    int
+	//Batches is how many times over the recipe is made for one batch of the root
+	Batches   float64
+	Total     string
+	Cycle     bool
+	Dependent []GraphNode
+}
+
+// GraphStep is a recipe in the order it has to be made, with every amount needed of it.
+type GraphStep struct {
+	RecipeID uint
+	Name     string
+	Depth    int
+	Needed   []string
+}
+
+func LoadDependencyGraph(db *gorm.DB, userID uint) (DependencyGraph, error) {
+	graph := DependencyGraph{
+		Names: make(map[uint]string),
+		Edges: make(map[uint][]dependencyEdge),
+	}
+
+	var recipes []RecipeModel
+	if err := db.Select("id", "name").Where(map[string]interface{}{
+		"user_id": userID,
+	}).Find(&recipes).Error; err != nil {
+		return graph, err
+	}
+	for _, recipe := range recipes {
+		graph.Names[recipe.ID] = recipe.Name
+	}
+
+	var edges []dependencyEdge
+	result := db.Model(&RecipeDependencyModel{}).Select(
+		"recipe_id", "dependent_recipe", "qty",
+	).Where(
+		"recipe_id IN (?)", db.Model(&RecipeModel{}).Select("id").Where("user_id = ?", userID),
+	).Order("id").Find(&edges)
+	if result.Error != nil {
+		return graph, result.Error
+	}
+	for _, edge := range edges {
+		graph.Edges[edge.RecipeID] = append(graph.Edges[edge.RecipeID], edge)
+	}
+
+	return graph, nil
+}
+
+// FindCycle returns the path from recipeID back to itself, or nil when its dependencies never loop.
+func (graph DependencyGraph) FindCycle(recipeID uint) []uint {
+	visited := make(map[uint]bool)
+	var path []uint
+
+	var visit func(id uint) bool
+	visit = func(id uint) bool {
+		path = append(path, id)
+		for _, edge := range graph.Edges[id] {
+			if edge.DependentRecipe == recipeID {
+				path = append(path, recipeID)
+				return true
+			}
+			if visited[edge.DependentRecipe] {
+				continue
+			}
+			visited[edge.DependentRecipe] = true
+			if visit(edge.DependentRecipe) {
+				return true
+			}
+		}
+		path = path[:len(path)-1]
+		return false
+	}
+
+	if visit(recipeID) {
+		return path
+	}
+	return nil
+}
+
+func (graph DependencyGraph) cycleError(cycle []uint) error {
+	var names []string
+	for _, id := range cycle {
+		names = append(names, graph.Names[id])
+	}
+	return errors.New(ErrDependencyCycle.Error() + ": " + strings.Join(names, " -> "))
+}
+
+// checkCycles swaps the recipe's saved dependencies for the ones about to be saved
+// and looks for a way back to the recipe. A new recipe can't be depended on yet, so
+// only a recipe listing itself can loop. db must be the transaction the recipe is
+// saved in, the graph is locked until it ends.
+func (model *RecipeModel) checkCycles(db *gorm.DB) error {
+	for _, dependency := range model.DependentRecipes {
+		if model.ID != 0 && dependency.DependentRecipe == model.ID {
+			return errors.New("a recipe can not depend on itself")
+		}
+	}
+	if model.ID == 0 || len(model.DependentRecipes) == 0 {
+		return nil
+	}
+
+	if err := lockDependencies(db, model.UserID); err != nil {
+		return err
+	}
+	graph, err := LoadDependencyGraph(db, model.UserID)
+	if err != nil {
+		return err
+	}
+	graph.Names[model.ID] = model.Name
+
+	var edges []dependencyEdge
+	for _, dependency := range model.DependentRecipes {
+		edges = append(edges, dependencyEdge{
+			RecipeID:        model.ID,
+			DependentRecipe: dependency.DependentRecipe,
+			Qty:             dependency.Qty,
+		})
+	}
+	graph.Edges[model.ID] = edges
+
+	if cycle := graph.FindCycle(model.ID); cycle != nil {
+		return graph.cycleError(cycle)
+	}
+	return nil
+}
+
+// Tree expands every dependency of recipeID down to the recipes which depend on
+// nothing. A recipe used twice shows up twice, once under each parent, as its
+// amounts differ. Should a loop have been saved before cycles were checked, the
+// repeated recipe is flagged and not expanded again.
+func (graph DependencyGraph) Tree(recipeID uint) GraphNode {
+	root := GraphNode{
+		RecipeID: recipeID,
+		Name:     graph.Names[recipeID],
+		Batches:  1,
+		Total:    "1",
+	}
+	graph.expand(&root, map[uint]bool{recipeID: true})
+	return root
+}
+
+func (graph DependencyGraph) expand(node *GraphNode, path map[uint]bool) {
+	node.Dependent = make([]GraphNode, 0)
+	for _, edge := range graph.Edges[node.RecipeID] {
+		child := GraphNode{
+			RecipeID: edge.DependentRecipe,
+			Name:     graph.Names[edge.DependentRecipe],
+			Qty:      edge.Qty,
+			Depth:    node.Depth + 1,
+		}
+		child.Total, child.Batches = accumulate(edge.Qty, node.Batches)
+
+		if path[child.RecipeID] {
+			child.Cycle = true
+			child.Dependent = make([]GraphNode, 0)
+		} else {
+			path[child.RecipeID] = true
+			graph.expand(&child, path)
+			delete(path, child.RecipeID)
+		}
+		node.Dependent = append(node.Dependent, child)
+	}
+}
+
+// accumulate multiplies a dependency's qty by the batches of its parent, so
+// "2 cups" of a sauce inside a recipe made 3 times over is "6 cups". Only a bare
+// count, or a count of batches, says how many times over the sub-recipe itself
+// is made; "2 cups" of it is still taken to be a single batch.
+func accumulate(qty string, parentBatches float64) (string, float64) {
+	quantity, rest, ok := parseLeadingQuantity(qty)
+	if !ok {
+		if strings.TrimSpace(qty) == "" {
+			return FormatAmount(parentBatches), parentBatches
+		}
+		return strings.TrimSpace(qty), parentBatches
+	}
+
+	total := quantity.Scale(parentBatches).String()
+	if rest = strings.TrimSpace(rest); rest != "" {
+		total += " " + rest
+	}
+
+	if isBatchCount(rest) {
+		return total, quantity.Max * parentBatches
+	}
+	return total, parentBatches
+}
+
+func isBatchCount(unit string) bool {
+	switch strings.ToLower(strings.TrimSpace(unit)) {
+	case "", "x", "batch", "batches", "recipe", "recipes":
+		return true
+	}
+	return false
+}
+
+// DependencyBatches reads how many batches of a sub-recipe its qty asks for, falling back to one.
+func DependencyBatches(qty string) float64 {
+	_, batches := accumulate(qty, 1)
+	return batches
+}
+
+// Order lists the recipes of the tree so everything a recipe depends on comes
+// before it, i.e. the "make these first" order, finishing with the root. Each
+// recipe is listed once at its deepest level with all the amounts needed of it.
+func (root GraphNode) Order() []GraphStep {
+	steps := make([]GraphStep, 0)
+	index := make(map[uint]int)
+
+	var visit func(node GraphNode)
+	visit = func(node GraphNode) {
+		if !node.Cycle {
+			for _, child := range node.Dependent {
+				visit(child)
+			}
+		}
+
+		i, ok := index[node.RecipeID]
+		if !ok {
+			index[node.RecipeID] = len(steps)
+			steps = append(steps, GraphStep{RecipeID: node.RecipeID, Name: node.Name})
+			i = len(steps) - 1
+		}
+		step := &steps[i]
+		if node.Depth > step.Depth {
+			step.Depth = node.Depth
+		}
+		if !node.Cycle {
+			step.Needed = append(step.Needed, node.Total)
+		}
+	}
+	visit(root)
+
+	/**
+	A recipe first reached through a shallow branch may also sit deeper in
+	another, so settle the order by depth, deepest first, keeping the visiting
+	order otherwise.
+	*/
+	ordered := make([]GraphStep, 0, len(steps))
+	for depth := maxStepDepth(steps); depth >= 0; depth-- {
+		for _, step := range steps {
+			if step.Depth == depth {
+				ordered = append(ordered, step)
+			}
+		}
+	}
+	return ordered
+}
+
+func maxStepDepth(steps []GraphStep) int {
+	max := 0
+	for _, step := range steps {
+		if step.Depth > max {
+			max = step.Depth
+		}
+	}
+	return max
+}
+
+func GetRecipeGraph(recipeID uint, userID uint) (GraphNode, error) {
+	db := database.GetDB()
+
+	graph, err := LoadDependencyGraph(db, userID)
+	if err != nil {
+		return GraphNode{}, err
+	}
+	if _, ok := graph.Names[recipeID]; !ok {
+		return GraphNode{}, gorm.ErrRecordNotFound
+	}
+	return graph.Tree(recipeID), nil
+}
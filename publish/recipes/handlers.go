@@ -1,11 +1,17 @@
 package recipes
 
 import (
+	"encoding/json"
 	"errors"
+	"github.com/anthonyhawkins/savorbook/database"
 	"github.com/anthonyhawkins/savorbook/middleware"
+	"github.com/anthonyhawkins/savorbook/patch"
 	"github.com/anthonyhawkins/savorbook/responses"
+	"github.com/anthonyhawkins/savorbook/users"
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
+	"io/ioutil"
+	"strconv"
 	"strings"
 )
 
@@ -44,10 +50,12 @@ func RecipeCreate(c *fiber.Ctx) error {
 
 	var recipeResponse RecipeResponse
 	recipeResponse.SerializeRecipe(&recipeValidator.Model)
+	c.Set(fiber.HeaderETag, middleware.ETag(recipeValidator.Model.Version, ""))
 
 	//Respond with Success
 	response.Success = true
 	response.Data = recipeResponse
+	response.Warnings = recipeValidator.Warnings()
 	return c.Status(fiber.StatusCreated).JSON(response)
 }
 
@@ -79,8 +87,38 @@ func RecipeGet(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(response)
 	}
 
+	factor, err := model.ScaleFactor(c.Query("servings"), c.Query("scale"))
+	if err != nil {
+		response.Message = "Unable to Scale Recipe"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+	if factor != 1 {
+		model.Scale(factor)
+	}
+
+	units := strings.ToLower(c.Query("units"))
+	if units == "" {
+		if user, err := users.FindOne(userID); err == nil {
+			units = user.Units
+		}
+	}
+	if units != "" && !ValidUnitSystem(units) {
+		response.Message = "Unable to Convert Recipe"
+		response.Errors = append(response.Errors, "units must be metric, imperial or original")
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	if middleware.NotModified(c, middleware.ETag(model.Version, units)) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+	model.ConvertUnits(units)
+
 	var recipeResponse RecipeResponse
 	recipeResponse.SerializeRecipe(&model)
+	if factor != 1 {
+		recipeResponse.Scale = factor
+	}
 
 	//Respond with Success
 	response.Success = true
@@ -89,6 +127,101 @@ func RecipeGet(c *fiber.Ctx) error {
 
 }
 
+// RecipeSearch ranks the user's recipes against q and narrows them with any of
+// tags (with tag_mode all or any), ingredient and max_prep. Filters work without
+// q too, listing the matches by name.
+func RecipeSearch(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+	userID := middleware.AuthedUserId(c.Locals("user"))
+
+	tagMode := strings.ToLower(c.Query("tag_mode", "all"))
+	if tagMode != "all" && tagMode != "any" {
+		response.Message = "Invalid Search"
+		response.Errors = append(response.Errors, "tag_mode must be all or any")
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	maxPrep, ok := ParseMaxPrep(c.Query("max_prep"))
+	if !ok {
+		response.Message = "Invalid Search"
+		response.Errors = append(response.Errors, "max_prep must be a number of minutes")
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	statuses, err := ParseStatus(c.Query("status"))
+	if err != nil {
+		response.Message = "Invalid Search"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	results, err := SearchRecipes(userID, SearchOptions{
+		Query:          c.Query("q"),
+		Tags:           ParseSearchList(strings.ToLower(c.Query("tags"))),
+		AnyTag:         tagMode == "any",
+		Ingredients:    ParseSearchList(c.Query("ingredient")),
+		MaxPrepMinutes: maxPrep,
+		Statuses:       statuses,
+		PageNum:        strings.ToLower(c.Query("page")),
+		PageSize:       strings.ToLower(c.Query("page_size")),
+	})
+
+	if err != nil {
+		response.Message = "Unable to Search Recipes"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	resultList := make([]SearchResultResponse, 0)
+	for _, result := range results {
+		var resultResponse SearchResultResponse
+		resultResponse.SerializeSearchResult(&result)
+		resultList = append(resultList, resultResponse)
+	}
+
+	//Respond with Success
+	response.Success = true
+	response.Data = resultList
+	return c.JSON(response)
+}
+
+// RecipeGraphGet returns every recipe the recipe depends on, however deep, and the order to make them in.
+func RecipeGraphGet(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+
+	userID := middleware.AuthedUserId(c.Locals("user"))
+	recipeID, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		response.Message = "Recipe Not Found"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	graph, err := GetRecipeGraph(uint(recipeID), userID)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response.Message = "Recipe Not Found"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	if err != nil {
+		response.Message = "Unable to Retrieve Recipe Graph"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	var graphResponse RecipeGraphResponse
+	graphResponse.SerializeGraph(graph)
+
+	//Respond with Success
+	response.Success = true
+	response.Data = graphResponse
+	return c.JSON(response)
+}
+
 func TagList(c *fiber.Ctx) error {
 	response := new(responses.StandardResponse)
 	response.Success = false
@@ -115,15 +248,21 @@ func RecipeList(c *fiber.Ctx) error {
 
 	recipeList := make([]RecipeResponse, 0)
 
+	statuses, err := ParseStatus(c.Query("status"))
+	if err != nil {
+		response.Message = "Invalid Status"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
 	var recipes []RecipeModel
-	var err error
 
 	if len(byName) > 0 {
-		recipes, err = FindRecipesByName(userID, byName, pageNum, pageSize)
+		recipes, err = FindRecipesByName(userID, byName, statuses, pageNum, pageSize)
 	} else if len(byTags) > 0 {
-		recipes, err = FindRecipesByTags(userID, byTags, pageNum, pageSize)
+		recipes, err = FindRecipesByTags(userID, byTags, statuses, pageNum, pageSize)
 	} else {
-		recipes, err = GetRecipes(userID, pageNum, pageSize)
+		recipes, err = GetRecipes(userID, statuses, pageNum, pageSize)
 	}
 
 	if err != nil {
@@ -174,6 +313,11 @@ func RecipeUpdate(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
 	}
 
+	expectedVersion, err := middleware.ExpectedVersion(c, existingRecipe.Version, recipeValidator.Recipe.Version)
+	if err != nil {
+		return versionError(c, response, err, recipeId, userId)
+	}
+
 	validationErrors, err := recipeValidator.Validate()
 	if err != nil {
 		response.Message = "Validation Errors"
@@ -188,8 +332,13 @@ func RecipeUpdate(c *fiber.Ctx) error {
 	}
 
 	recipeValidator.Model.ID = existingRecipe.ID
+	recipeValidator.Model.Version = expectedVersion
 
-	if err := recipeValidator.Model.Update(); err != nil {
+	err = recipeValidator.Model.Update()
+	if errors.Is(err, database.ErrVersionConflict) {
+		return versionError(c, response, err, recipeId, userId)
+	}
+	if err != nil {
 		response.Message = "Unable to Update Recipe"
 		response.Errors = append(response.Errors, err.Error())
 		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
@@ -197,10 +346,106 @@ func RecipeUpdate(c *fiber.Ctx) error {
 
 	var recipeResponse RecipeResponse
 	recipeResponse.SerializeRecipe(&recipeValidator.Model)
+	c.Set(fiber.HeaderETag, middleware.ETag(recipeValidator.Model.Version, ""))
+
+	//Respond with Success
+	response.Success = true
+	response.Data = recipeResponse
+	response.Warnings = recipeValidator.Warnings()
+	return c.JSON(response)
+}
+
+func RecipePatch(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+
+	recipeId := c.Params("id")
+	userId := middleware.AuthedUserId(c.Locals("user"))
+	existingRecipe, err := GetRecipeFull(recipeId, userId)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response.Message = "Recipe Not Found"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	if err != nil {
+		response.Message = "Unable to Retrieve Recipe"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	document, err := existingRecipe.PatchDocument()
+	if err != nil {
+		response.Message = "Unable to Retrieve Recipe"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	patched, changed, err := patch.Apply(c.Get(fiber.HeaderContentType), document, c.Body())
+	if err != nil {
+		response.Message = "Unable to Apply Patch"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(patch.Status(err)).JSON(response)
+	}
+
+	recipeValidator := NewRecipeValidator()
+	if err := json.Unmarshal(patched, recipeValidator); err != nil {
+		response.Message = "Invalid JSON"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	//the stored document has no version, so one in the result was put there by the patch
+	expectedVersion, err := middleware.ExpectedVersion(c, existingRecipe.Version, recipeValidator.Recipe.Version)
+	if err != nil {
+		return versionError(c, response, err, recipeId, userId)
+	}
+
+	var recipeResponse RecipeResponse
+	if !changed {
+		recipeResponse.SerializeRecipe(&existingRecipe)
+		c.Set(fiber.HeaderETag, middleware.ETag(existingRecipe.Version, ""))
+
+		//Respond with Success
+		response.Success = true
+		response.Data = recipeResponse
+		return c.JSON(response)
+	}
+
+	validationErrors, err := recipeValidator.Validate()
+	if err != nil {
+		response.Message = "Validation Errors"
+		response.Errors = validationErrors
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	if err := recipeValidator.BindModel(userId); err != nil {
+		response.Message = "Unable to Update Recipe"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	recipeValidator.Model.ID = existingRecipe.ID
+	recipeValidator.Model.Version = expectedVersion
+
+	err = recipeValidator.Model.Update()
+	if errors.Is(err, database.ErrVersionConflict) {
+		return versionError(c, response, err, recipeId, userId)
+	}
+	if err != nil {
+		response.Message = "Unable to Update Recipe"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	recipeResponse.SerializeRecipe(&recipeValidator.Model)
+	c.Set(fiber.HeaderETag, middleware.ETag(recipeValidator.Model.Version, ""))
 
 	//Respond with Success
 	response.Success = true
 	response.Data = recipeResponse
+	response.Warnings = recipeValidator.Warnings()
 	return c.JSON(response)
 }
 
@@ -211,7 +456,31 @@ func RecipeDelete(c *fiber.Ctx) error {
 	recipeId := c.Params("id")
 	userId := middleware.AuthedUserId(c.Locals("user"))
 
-	parentRecipes, err := DeleteRecipe(recipeId, userId)
+	existingRecipe, err := GetRecipe(recipeId, userId)
+	if err != nil {
+		response.Message = "Unable to Retrieve Recipe"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	if existingRecipe.ID == 0 {
+		response.Message = "Recipe Not Found"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	//a DELETE has no body, so the version comes from If-Match or ?version=
+	version, _ := strconv.Atoi(c.Query("version"))
+	expectedVersion, err := middleware.ExpectedVersion(c, existingRecipe.Version, version)
+	if err != nil {
+		return versionError(c, response, err, recipeId, userId)
+	}
+
+	parentRecipes, err := DeleteRecipe(recipeId, userId, expectedVersion)
+
+	if errors.Is(err, database.ErrVersionConflict) {
+		return versionError(c, response, err, recipeId, userId)
+	}
 
 	if err != nil {
 		response.Message = "Unable to Delete Recipe."
@@ -225,3 +494,421 @@ func RecipeDelete(c *fiber.Ctx) error {
 	return c.JSON(response)
 
 }
+
+// versionError answers a write that was based on a stale version, or on no version
+// at all, with the recipe as it is now so the client can merge and try again.
+func versionError(c *fiber.Ctx, response *responses.StandardResponse, err error, recipeID string, userID uint) error {
+	response.Message = "Version Conflict"
+	if errors.Is(err, middleware.ErrVersionRequired) {
+		response.Message = "Version Required"
+	}
+	response.Errors = append(response.Errors, err.Error())
+
+	if current, err := GetRecipeFull(recipeID, userID); err == nil {
+		var recipeResponse RecipeResponse
+		recipeResponse.SerializeRecipe(&current)
+		response.Data = recipeResponse
+		c.Set(fiber.HeaderETag, middleware.ETag(current.Version, ""))
+	}
+	return c.Status(middleware.VersionStatus(c, err)).JSON(response)
+}
+
+func RevisionList(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+
+	recipeID := c.Params("id")
+	userID := middleware.AuthedUserId(c.Locals("user"))
+
+	revisions, err := GetRevisions(recipeID, userID)
+	if err == nil && len(revisions) == 0 {
+		err = gorm.ErrRecordNotFound
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response.Message = "Recipe Not Found"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	if err != nil {
+		response.Message = "Unable to Retrieve Revisions"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	revisionList := make([]RevisionResponse, 0)
+	for _, revision := range revisions {
+		var revisionResponse RevisionResponse
+		revisionResponse.SerializeRevision(&revision, nil)
+		revisionList = append(revisionList, revisionResponse)
+	}
+
+	//Respond with Success
+	response.Success = true
+	response.Data = revisionList
+	return c.JSON(response)
+}
+
+func RevisionGet(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+
+	recipeID := c.Params("id")
+	userID := middleware.AuthedUserId(c.Locals("user"))
+
+	revision, err := GetRevision(recipeID, c.Params("number"), userID)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response.Message = "Revision Not Found"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	if err != nil {
+		response.Message = "Unable to Retrieve Revision"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	snapshot, err := revision.Recipe()
+	if err != nil {
+		response.Message = "Unable to Retrieve Revision"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	var revisionResponse RevisionResponse
+	revisionResponse.SerializeRevision(&revision, &snapshot)
+
+	//Respond with Success
+	response.Success = true
+	response.Data = revisionResponse
+	return c.JSON(response)
+}
+
+// RevisionDiffGet compares revision from with revision to, defaulting to the latest revision and the one before it.
+func RevisionDiffGet(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+
+	recipeID := c.Params("id")
+	userID := middleware.AuthedUserId(c.Locals("user"))
+
+	var to RecipeRevisionModel
+	var err error
+	if c.Query("to") == "" {
+		to, err = GetLatestRevision(recipeID, userID)
+	} else {
+		to, err = GetRevision(recipeID, c.Query("to"), userID)
+	}
+
+	var from RecipeRevisionModel
+	if err == nil {
+		fromNumber := c.Query("from")
+		if fromNumber == "" {
+			fromNumber = strconv.Itoa(to.Number - 1)
+		}
+		from, err = GetRevision(recipeID, fromNumber, userID)
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response.Message = "Revision Not Found"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	if err != nil {
+		response.Message = "Unable to Retrieve Revision"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	diff, err := DiffRevisions(&from, &to)
+	if err != nil {
+		response.Message = "Unable to Compare Revisions"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	var diffResponse RevisionDiffResponse
+	diffResponse.SerializeDiff(&diff)
+
+	//Respond with Success
+	response.Success = true
+	response.Data = diffResponse
+	return c.JSON(response)
+}
+
+// RevisionRestore saves an old revision as the recipe's newest one, the revisions in between are kept.
+func RevisionRestore(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+
+	recipeID := c.Params("id")
+	userID := middleware.AuthedUserId(c.Locals("user"))
+
+	existingRecipe, err := GetRecipe(recipeID, userID)
+	if err == nil && existingRecipe.ID == 0 {
+		err = gorm.ErrRecordNotFound
+	}
+	var revision RecipeRevisionModel
+	if err == nil {
+		revision, err = GetRevision(recipeID, c.Params("number"), userID)
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response.Message = "Revision Not Found"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	if err != nil {
+		response.Message = "Unable to Retrieve Revision"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	//a restore has no body, so the version comes from If-Match or ?version=
+	version, _ := strconv.Atoi(c.Query("version"))
+	expectedVersion, err := middleware.ExpectedVersion(c, existingRecipe.Version, version)
+	if err != nil {
+		return versionError(c, response, err, recipeID, userID)
+	}
+
+	recipeValidator, err := revision.RestoreValidator()
+	if err != nil {
+		response.Message = "Unable to Restore Revision"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	validationErrors, err := recipeValidator.Validate()
+	if err != nil {
+		response.Message = "Validation Errors"
+		response.Errors = validationErrors
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	if err := recipeValidator.BindModel(userID); err != nil {
+		response.Message = "Unable to Restore Revision"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	recipeValidator.Model.ID = existingRecipe.ID
+	recipeValidator.Model.Version = expectedVersion
+
+	err = recipeValidator.Model.Update()
+	if errors.Is(err, database.ErrVersionConflict) {
+		return versionError(c, response, err, recipeID, userID)
+	}
+	if err != nil {
+		response.Message = "Unable to Restore Revision"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	var recipeResponse RecipeResponse
+	recipeResponse.SerializeRecipe(&recipeValidator.Model)
+	c.Set(fiber.HeaderETag, middleware.ETag(recipeValidator.Model.Version, ""))
+
+	//Respond with Success
+	response.Success = true
+	response.Data = recipeResponse
+	response.Warnings = recipeValidator.Warnings()
+	return c.JSON(response)
+}
+
+func RecipePublish(c *fiber.Ctx) error {
+	return changeStatus(c, PublishRecipe)
+}
+
+func RecipeUnpublish(c *fiber.Ctx) error {
+	return changeStatus(c, UnpublishRecipe)
+}
+
+func RecipeArchive(c *fiber.Ctx) error {
+	return changeStatus(c, ArchiveRecipe)
+}
+
+// changeStatus runs one of the lifecycle changes. If-Match is optional here but is
+// checked when sent, so an author can publish exactly the version they reviewed.
+func changeStatus(c *fiber.Ctx, change func(recipeID string, userID uint, version int) error) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+
+	recipeId := c.Params("id")
+	userId := middleware.AuthedUserId(c.Locals("user"))
+
+	expectedVersion := 0
+	if c.Get(fiber.HeaderIfMatch) != "" {
+		existingRecipe, err := GetRecipe(recipeId, userId)
+		if err != nil || existingRecipe.ID == 0 {
+			response.Message = "Recipe Not Found"
+			response.Errors = append(response.Errors, response.Message)
+			return c.Status(fiber.StatusNotFound).JSON(response)
+		}
+		expectedVersion, err = middleware.ExpectedVersion(c, existingRecipe.Version, 0)
+		if err != nil {
+			return versionError(c, response, err, recipeId, userId)
+		}
+	}
+
+	err := change(recipeId, userId, expectedVersion)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response.Message = "Recipe Not Found"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	if errors.Is(err, database.ErrVersionConflict) {
+		return versionError(c, response, err, recipeId, userId)
+	}
+
+	if err != nil {
+		response.Message = "Unable to Change Recipe Status"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	model, err := GetRecipeFull(recipeId, userId)
+	if err != nil {
+		response.Message = "Unable to Retrieve Recipe"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	var recipeResponse RecipeResponse
+	recipeResponse.SerializeRecipe(&model)
+	c.Set(fiber.HeaderETag, middleware.ETag(model.Version, ""))
+
+	//Respond with Success
+	response.Success = true
+	response.Data = recipeResponse
+	return c.JSON(response)
+}
+
+func RecipePublishedGet(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+
+	recipeId := c.Params("id")
+	userId := middleware.AuthedUserId(c.Locals("user"))
+
+	model, revision, err := GetPublishedRecipe(recipeId, userId)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response.Message = "Recipe Not Published"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	if err != nil {
+		response.Message = "Unable to Retrieve Recipe"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	snapshot, err := revision.Recipe()
+	if err != nil {
+		response.Message = "Unable to Retrieve Recipe"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	var publishedResponse PublishedRecipeResponse
+	publishedResponse.SerializePublished(&model, &revision, &snapshot)
+
+	//Respond with Success
+	response.Success = true
+	response.Data = publishedResponse
+	return c.JSON(response)
+}
+
+// RecipeImport reads a schema.org recipe from a web page, either uploaded as "file"
+// or fetched from {"import": {"url": "..."}}. Nothing is saved, the draft is returned
+// for the author to review and send to RecipeCreate. Anything the draft would fail
+// validation on is reported as a warning to be fixed during review.
+func RecipeImport(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+
+	var page []byte
+	var source string
+
+	if strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEMultipartForm) {
+		fileHeader, err := c.FormFile("file")
+		if err != nil {
+			response.Message = "Unable to Import Recipe"
+			response.Errors = append(response.Errors, err.Error())
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+		}
+
+		file, err := fileHeader.Open()
+		if err != nil {
+			response.Message = "Unable to Import Recipe"
+			response.Errors = append(response.Errors, err.Error())
+			return c.Status(fiber.StatusInternalServerError).JSON(response)
+		}
+		defer file.Close()
+
+		page, err = ioutil.ReadAll(file)
+		if err != nil {
+			response.Message = "Unable to Import Recipe"
+			response.Errors = append(response.Errors, err.Error())
+			return c.Status(fiber.StatusInternalServerError).JSON(response)
+		}
+	} else {
+		importValidator := NewImportValidator()
+		err := c.BodyParser(importValidator)
+		if err != nil {
+			response.Message = "Invalid JSON"
+			response.Errors = append(response.Errors, err.Error())
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+		}
+
+		errs, err := importValidator.Validate()
+		if err != nil {
+			response.Message = "Validation Errors"
+			response.Errors = errs
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+		}
+
+		source = importValidator.Import.URL
+		page, err = GetFetcher().Fetch(c.Context(), source)
+		if errors.Is(err, ErrBlockedAddress) {
+			response.Message = "Unable to Fetch Page"
+			response.Errors = append(response.Errors, err.Error())
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+		}
+		if err != nil {
+			response.Message = "Unable to Fetch Page"
+			response.Errors = append(response.Errors, err.Error())
+			return c.Status(fiber.StatusBadGateway).JSON(response)
+		}
+	}
+
+	imported, err := ImportRecipe(page, source)
+	if errors.Is(err, ErrNoRecipe) {
+		response.Message = "No Recipe Found"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+	if err != nil {
+		response.Message = "Unable to Import Recipe"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	var importResponse ImportResponse
+	importResponse.SerializeImport(&imported, source)
+
+	//Respond with Success
+	response.Success = true
+	response.Data = importResponse
+	errs, _ := imported.Draft.Validate()
+	response.Warnings = append(errs, imported.Draft.Warnings()...)
+	return c.JSON(response)
+}
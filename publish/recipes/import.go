@@ -0,0 +1,584 @@
+package recipes
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrNoRecipe is returned when a page has no schema.org Recipe in either JSON-LD or microdata.
+var ErrNoRecipe = errors.New("no schema.org recipe found on the page")
+
+// ImportedRecipe is a recipe read from someone else's page. Draft is in the shape
+// RecipeCreate accepts so the author can review it and send it straight back.
+type ImportedRecipe struct {
+	Draft RecipeValidator
+	//SourceImage is the page's image, it has to be uploaded before the recipe can use it
+	SourceImage string
+}
+
+// ImportRecipe finds the schema.org Recipe on an HTML page and maps it onto a draft.
+// JSON-LD is preferred, microdata is read when a page has none. pageURL is used
+// to resolve relative image links and may be empty for uploaded pages.
+func ImportRecipe(page []byte, pageURL string) (ImportedRecipe, error) {
+	var imported ImportedRecipe
+
+	document, err := html.Parse(bytes.NewReader(page))
+	if err != nil {
+		return imported, err
+	}
+
+	recipe := findJSONLDRecipe(document)
+	if recipe == nil {
+		recipe = findMicrodataRecipe(document)
+	}
+	if recipe == nil {
+		return imported, ErrNoRecipe
+	}
+
+	draft := &imported.Draft.Recipe
+	draft.Name = cleanText(stringValue(recipe["name"]))
+	draft.Description = cleanText(stringValue(recipe["description"]))
+	draft.Servings = importYield(recipe["recipeYield"])
+	draft.PrepTime = importTime(recipe)
+	draft.Tags = importKeywords(recipe["keywords"])
+	draft.DependentRecipes = make([]RecipeDependencyValidator, 0)
+
+	ingredients := recipe["recipeIngredient"]
+	if ingredients == nil {
+		ingredients = recipe["ingredients"]
+	}
+	group := IngredientGroupValidator{Ingredients: make([]IngredientValidator, 0)}
+	for _, line := range stringValues(ingredients) {
+		if line = cleanText(line); line != "" {
+			group.Ingredients = append(group.Ingredients, parseIngredientLine(line))
+		}
+	}
+	draft.IngredientGroups = []IngredientGroupValidator{group}
+
+	draft.Steps = importSteps(recipe["recipeInstructions"], "")
+	if draft.Steps == nil {
+		draft.Steps = make([]StepValidator, 0)
+	}
+
+	imported.SourceImage = resolveURL(pageURL, imageURL(recipe["image"]))
+	return imported, nil
+}
+
+/**
+JSON-LD
+*/
+
+func findJSONLDRecipe(node *html.Node) map[string]interface{} {
+	if node.Type == html.ElementNode && node.DataAtom == atom.Script &&
+		strings.EqualFold(strings.TrimSpace(attr(node, "type")), "application/ld+json") {
+		var data interface{}
+		if err := json.Unmarshal([]byte(jsonLDBody(node)), &data); err == nil {
+			if recipe := findRecipeObject(data); recipe != nil {
+				return recipe
+			}
+		}
+	}
+
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if recipe := findJSONLDRecipe(child); recipe != nil {
+			return recipe
+		}
+	}
+	return nil
+}
+
+// jsonLDBody is the text of a script block, some sites still wrap it in a CDATA section or an html comment.
+func jsonLDBody(node *html.Node) string {
+	var body strings.Builder
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.TextNode {
+			body.WriteString(child.Data)
+		}
+	}
+
+	text := strings.TrimSpace(body.String())
+	for _, wrapper := range [][2]string{{"<![CDATA[", "]]>"}, {"<!--", "-->"}, {"//<![CDATA[", "//]]>"}} {
+		if strings.HasPrefix(text, wrapper[0]) && strings.HasSuffix(text, wrapper[1]) {
+			text = strings.TrimSpace(text[len(wrapper[0]) : len(text)-len(wrapper[1])])
+		}
+	}
+	return strings.TrimSuffix(text, ";")
+}
+
+// findRecipeObject searches JSON-LD for the first Recipe, which may be the document
+// itself, one of a list or nested in an @graph or a WebPage's mainEntity.
+func findRecipeObject(data interface{}) map[string]interface{} {
+	switch value := data.(type) {
+	case map[string]interface{}:
+		if isRecipeType(value["@type"]) {
+			return value
+		}
+		for _, key := range []string{"@graph", "mainEntity", "mainEntityOfPage", "itemListElement", "item"} {
+			if recipe := findRecipeObject(value[key]); recipe != nil {
+				return recipe
+			}
+		}
+	case []interface{}:
+		for _, item := range value {
+			if recipe := findRecipeObject(item); recipe != nil {
+				return recipe
+			}
+		}
+	}
+	return nil
+}
+
+func isRecipeType(value interface{}) bool {
+	return hasType(value, "Recipe")
+}
+
+// hasType compares schema.org types however they are written, i.e. "Recipe",
+// "schema:Recipe", "http://schema.org/Recipe" or a list of types.
+func hasType(value interface{}, name string) bool {
+	for _, schemaType := range stringValues(value) {
+		schemaType = strings.TrimSpace(schemaType)
+		if i := strings.LastIndexAny(schemaType, "/:#"); i >= 0 {
+			schemaType = schemaType[i+1:]
+		}
+		if strings.EqualFold(schemaType, name) {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+Microdata, read into the same shape JSON-LD is decoded into
+*/
+
+func findMicrodataRecipe(node *html.Node) map[string]interface{} {
+	if node.Type == html.ElementNode && hasAttr(node, "itemscope") && isRecipeType(strings.Fields(attr(node, "itemtype"))) {
+		return microdataItem(node)
+	}
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if recipe := findMicrodataRecipe(child); recipe != nil {
+			return recipe
+		}
+	}
+	return nil
+}
+
+func microdataItem(node *html.Node) map[string]interface{} {
+	item := make(map[string]interface{})
+	if itemType := strings.Fields(attr(node, "itemtype")); len(itemType) > 0 {
+		item["@type"] = itemType[0]
+	}
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		collectMicrodata(child, item)
+	}
+	return item
+}
+
+// collectMicrodata adds the properties found under node to item, stopping at nested
+// items whose own properties belong to them. A property seen twice becomes a list.
+func collectMicrodata(node *html.Node, item map[string]interface{}) {
+	if node.Type != html.ElementNode {
+		return
+	}
+
+	scoped := hasAttr(node, "itemscope")
+	if names := strings.Fields(attr(node, "itemprop")); len(names) > 0 {
+		var value interface{}
+		if scoped {
+			value = microdataItem(node)
+		} else {
+			value = microdataValue(node)
+		}
+		for _, name := range names {
+			switch existing := item[name].(type) {
+			case nil:
+				item[name] = value
+			case []interface{}:
+				item[name] = append(existing, value)
+			default:
+				item[name] = []interface{}{existing, value}
+			}
+		}
+	}
+
+	if scoped {
+		return
+	}
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		collectMicrodata(child, item)
+	}
+}
+
+func microdataValue(node *html.Node) string {
+	switch node.DataAtom {
+	case atom.Meta:
+		return attr(node, "content")
+	case atom.Img, atom.Audio, atom.Embed, atom.Iframe, atom.Source, atom.Track, atom.Video:
+		return attr(node, "src")
+	case atom.A, atom.Area, atom.Link:
+		return attr(node, "href")
+	case atom.Object:
+		return attr(node, "data")
+	case atom.Data, atom.Meter:
+		return attr(node, "value")
+	case atom.Time:
+		if hasAttr(node, "datetime") {
+			return attr(node, "datetime")
+		}
+	}
+	if hasAttr(node, "content") {
+		return attr(node, "content")
+	}
+	return nodeText(node)
+}
+
+func attr(node *html.Node, name string) string {
+	for _, attribute := range node.Attr {
+		if attribute.Key == name {
+			return attribute.Val
+		}
+	}
+	return ""
+}
+
+func hasAttr(node *html.Node, name string) bool {
+	for _, attribute := range node.Attr {
+		if attribute.Key == name {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeText is the text under node with block elements kept on their own lines,
+// so instructions written as a list or paragraphs can be split into steps.
+func nodeText(node *html.Node) string {
+	var text strings.Builder
+	var walk func(node *html.Node)
+	walk = func(node *html.Node) {
+		switch node.Type {
+		case html.TextNode:
+			text.WriteString(node.Data)
+			return
+		case html.ElementNode:
+			switch node.DataAtom {
+			case atom.Script, atom.Style, atom.Template:
+				return
+			case atom.Br:
+				text.WriteString("\n")
+				return
+			}
+		}
+		block := isBlock(node)
+		if block {
+			text.WriteString("\n")
+		}
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+		if block {
+			text.WriteString("\n")
+		}
+	}
+	walk(node)
+	return text.String()
+}
+
+func isBlock(node *html.Node) bool {
+	if node.Type != html.ElementNode {
+		return false
+	}
+	switch node.DataAtom {
+	case atom.P, atom.Div, atom.Li, atom.Ol, atom.Ul, atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6,
+		atom.Section, atom.Article, atom.Blockquote, atom.Tr, atom.Dd, atom.Dt:
+		return true
+	}
+	return false
+}
+
+/**
+Mapping schema.org properties onto the recipe
+*/
+
+var spaces = regexp.MustCompile(`[ \t\r\f\v\x{00a0}]+`)
+
+// textLines decodes entities and markup some sites leave in their JSON-LD and
+// returns the non-empty lines with their whitespace collapsed.
+func textLines(text string) []string {
+	if strings.ContainsAny(text, "<&") {
+		if nodes, err := html.ParseFragment(strings.NewReader(text), &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}); err == nil {
+			var decoded strings.Builder
+			for _, node := range nodes {
+				decoded.WriteString(nodeText(node))
+			}
+			text = decoded.String()
+		}
+	}
+
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(spaces.ReplaceAllString(line, " ")); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func cleanText(text string) string {
+	return strings.Join(textLines(text), " ")
+}
+
+// stringValue reads a property as text. Lists give their first value and objects
+// their text, name or @value, i.e. a QuantitativeValue or a Person.
+func stringValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []interface{}:
+		for _, item := range v {
+			if text := stringValue(item); text != "" {
+				return text
+			}
+		}
+	case []string:
+		if len(v) > 0 {
+			return v[0]
+		}
+	case map[string]interface{}:
+		for _, key := range []string{"text", "name", "@value", "value"} {
+			if text := stringValue(v[key]); text != "" {
+				return text
+			}
+		}
+	}
+	return ""
+}
+
+func stringValues(value interface{}) []string {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []string:
+		return v
+	case []interface{}:
+		var values []string
+		for _, item := range v {
+			if text := stringValue(item); text != "" {
+				values = append(values, text)
+			}
+		}
+		return values
+	}
+	if text := stringValue(value); text != "" {
+		return []string{text}
+	}
+	return nil
+}
+
+// parseIngredientLine splits "1 1/2 cups plain flour, sifted" into qty, unit and name.
+// Anything which doesn't start with a quantity is kept whole as the name.
+func parseIngredientLine(line string) IngredientValidator {
+	ingredient := IngredientValidator{Name: line}
+
+	_, rest, ok := parseLeadingQuantity(line)
+	if !ok {
+		return ingredient
+	}
+	ingredient.Qty = strings.Join(strings.Fields(line[:len(line)-len(rest)]), " ")
+
+	//a package size, i.e. "1 (14 oz) can tomatoes", moves to the end of the name
+	size := ""
+	rest = strings.TrimSpace(rest)
+	if strings.HasPrefix(rest, "(") {
+		if end := strings.Index(rest, ")"); end > 0 {
+			size = rest[:end+1]
+			rest = rest[end+1:]
+		}
+	}
+
+	words := strings.Fields(rest)
+	for n := 2; n >= 1; n-- {
+		if len(words) < n {
+			continue
+		}
+		unitText := strings.TrimRight(strings.Join(words[:n], " "), ",")
+		if unit, ok := LookupUnit(unitText); ok && unit.Kind != Temperature {
+			ingredient.Unit = strings.TrimSuffix(unitText, ".")
+			words = words[n:]
+			break
+		}
+	}
+
+	if len(words) > 0 && strings.EqualFold(words[0], "of") {
+		words = words[1:]
+	}
+	ingredient.Name = strings.Trim(strings.Join(words, " "), " ,;")
+	if ingredient.Name != "" && size != "" {
+		ingredient.Name += " " + size
+	}
+	if ingredient.Name == "" {
+		ingredient.Name = line
+		ingredient.Qty = ""
+		ingredient.Unit = ""
+	}
+	return ingredient
+}
+
+// importSteps flattens recipeInstructions into steps. Text, lists of text, HowToStep
+// and HowToTip are all read; HowToSection has no counterpart in a recipe so its
+// name leads the first step of the section, i.e. "For the sauce: Melt the butter".
+func importSteps(value interface{}, section string) []StepValidator {
+	var steps []StepValidator
+	add := func(stepType string, text string) {
+		if section != "" {
+			text = section + ": " + text
+			section = ""
+		}
+		steps = append(steps, StepValidator{Type: stepType, Text: text, StepImages: make([]StepImageValidator, 0)})
+	}
+
+	switch v := value.(type) {
+	case string:
+		for _, line := range textLines(v) {
+			add("text", stripStepNumber(line))
+		}
+	case []interface{}:
+		for _, item := range v {
+			for _, step := range importSteps(item, section) {
+				steps = append(steps, step)
+				section = ""
+			}
+		}
+	case map[string]interface{}:
+		switch {
+		case hasType(v["@type"], "HowToSection") || (v["itemListElement"] != nil && !hasType(v["@type"], "HowToStep")):
+			name := cleanText(stringValue(v["name"]))
+			if section != "" && name != "" {
+				name = section + ": " + name
+			} else if name == "" {
+				name = section
+			}
+			steps = append(steps, importSteps(v["itemListElement"], name)...)
+		case hasType(v["@type"], "HowToTip"):
+			if text := cleanText(stringValue(v)); text != "" {
+				add("tipText", text)
+			}
+		default:
+			text := cleanText(stringValue(v["text"]))
+			if text == "" {
+				text = cleanText(stringValue(v["name"]))
+			}
+			if text != "" {
+				add("text", stripStepNumber(text))
+			} else if v["itemListElement"] != nil {
+				//a HowToStep made up of HowToDirection and HowToTip items
+				steps = append(steps, importSteps(v["itemListElement"], section)...)
+			}
+		}
+	}
+	return steps
+}
+
+var stepNumber = regexp.MustCompile(`^(?i:step\s*)?\d{1,2}[.):]\s+`)
+
+// stripStepNumber drops a number a site typed into the step, steps are numbered when shown.
+func stripStepNumber(text string) string {
+	return stepNumber.ReplaceAllString(text, "")
+}
+
+// importYield keeps the most descriptive yield, sites often give both "4" and "4 servings".
+func importYield(value interface{}) string {
+	yield := ""
+	for _, text := range stringValues(value) {
+		if text = cleanText(text); len(text) > len(yield) {
+			yield = text
+		}
+	}
+	return yield
+}
+
+// importTime reads totalTime, or prepTime and cookTime added together, as a PrepTime.
+func importTime(recipe map[string]interface{}) string {
+	minutes, ok := importMinutes(recipe["totalTime"])
+	if !ok {
+		prep, prepOK := importMinutes(recipe["prepTime"])
+		cook, cookOK := importMinutes(recipe["cookTime"])
+		minutes, ok = prep+cook, prepOK || cookOK
+	}
+	if !ok || minutes <= 0 {
+		return ""
+	}
+	return FormatMinutes(minutes)
+}
+
+func importMinutes(value interface{}) (int, bool) {
+	text := strings.TrimSpace(stringValue(value))
+	if minutes, ok := ParseISODuration(text); ok {
+		return minutes, true
+	}
+	return ParseMinutes(text)
+}
+
+var notAlphanumeric = regexp.MustCompile(`[^a-z0-9]+`)
+
+// importKeywords turns keywords, either a list or comma separated, into tags.
+// Tags are alphanumeric so spaces and punctuation are dropped, "Gluten-Free" becomes "glutenfree".
+func importKeywords(value interface{}) []string {
+	tags := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, keywords := range stringValues(value) {
+		for _, keyword := range strings.Split(keywords, ",") {
+			tag := notAlphanumeric.ReplaceAllString(strings.ToLower(cleanText(keyword)), "")
+			if tag != "" && !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// imageURL reads the image property, which may be a URL, an ImageObject or a list of either.
+func imageURL(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case []interface{}:
+		for _, item := range v {
+			if image := imageURL(item); image != "" {
+				return image
+			}
+		}
+	case map[string]interface{}:
+		for _, key := range []string{"url", "contentUrl", "@id"} {
+			if image := imageURL(v[key]); image != "" {
+				return image
+			}
+		}
+	}
+	return ""
+}
+
+func resolveURL(base string, ref string) string {
+	if ref == "" || base == "" {
+		return ref
+	}
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+	refURL, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return baseURL.ResolveReference(refURL).String()
+}
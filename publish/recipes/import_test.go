@@ -0,0 +1,328 @@
+package recipes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const jsonLDPage = `<!DOCTYPE html>
+<html>
+<head>
+<title>Country Bread | A Baking Blog</title>
+<script type="application/ld+json">
+{
+	"@context": "https://schema.org",
+	"@graph": [
+		{"@type": "WebSite", "name": "A Baking Blog"},
+		{
+			"@type": "Recipe",
+			"name": "Country   Bread",
+			"description": "A crusty loaf &amp; a soft crumb.",
+			"image": [{"@type": "ImageObject", "url": "/images/bread.jpg"}],
+			"recipeYield": ["2", "2 loaves"],
+			"totalTime": "PT1H30M",
+			"prepTime": "PT20M",
+			"keywords": "Bread, Gluten-Free, sourdough, bread",
+			"recipeIngredient": [
+				"500 g bread flour",
+				"1 1/2 tsp salt",
+				"1 (7 g) packet of yeast",
+				"water"
+			],
+			"recipeInstructions": [
+				{
+					"@type": "HowToSection",
+					"name": "Dough",
+					"itemListElement": [
+						{"@type": "HowToStep", "text": "1. Mix the flour, salt and yeast."},
+						{"@type": "HowToStep", "text": "Knead for <b>10 minutes</b>."}
+					]
+				},
+				{
+					"@type": "HowToSection",
+					"name": "Bake",
+					"itemListElement": [
+						{"@type": "HowToStep", "text": "Bake at 230C for 40 minutes."},
+						{"@type": "HowToTip", "text": "A tray of water makes a better crust."}
+					]
+				}
+			]
+		}
+	]
+}
+</script>
+</head>
+<body><h1>Not the recipe name</h1></body>
+</html>`
+
+const microdataPage = `<!DOCTYPE html>
+<html>
+<body>
+<article itemscope itemtype="http://schema.org/Recipe">
+	<h1 itemprop="name">Pancakes</h1>
+	<div itemprop="author" itemscope itemtype="http://schema.org/Person"><span itemprop="name">A. Cook</span></div>
+	<img itemprop="image" src="pancakes.jpg" alt="">
+	<p itemprop="description">Thin and quick.</p>
+	<meta itemprop="prepTime" content="PT10M">
+	<meta itemprop="cookTime" content="PT20M">
+	<span itemprop="recipeYield">8 pancakes</span>
+	<meta itemprop="keywords" content="breakfast, quick">
+	<ul>
+		<li itemprop="recipeIngredient">1 cup milk</li>
+		<li itemprop="recipeIngredient">2 eggs</li>
+	</ul>
+	<ol itemprop="recipeInstructions">
+		<li>Whisk everything together.</li>
+		<li>Fry in a hot pan.</li>
+	</ol>
+</article>
+</body>
+</html>`
+
+type fetchFunc func(ctx context.Context, pageURL string) ([]byte, error)
+
+func (f fetchFunc) Fetch(ctx context.Context, pageURL string) ([]byte, error) {
+	return f(ctx, pageURL)
+}
+
+var errNotFound = errors.New("page not found")
+
+// servePages swaps in a fetcher serving pages by url for the rest of the test.
+func servePages(t *testing.T, pages map[string]string) {
+	previous := GetFetcher()
+	SetFetcher(fetchFunc(func(ctx context.Context, pageURL string) ([]byte, error) {
+		if pageURL == "https://internal.example.com/" {
+			return nil, ErrBlockedAddress
+		}
+		page, ok := pages[pageURL]
+		if !ok {
+			return nil, errNotFound
+		}
+		return []byte(page), nil
+	}))
+	t.Cleanup(func() { SetFetcher(previous) })
+}
+
+type importResult struct {
+	Success  bool           `json:"success"`
+	Message  string         `json:"message"`
+	Data     ImportResponse `json:"data"`
+	Errors   []string       `json:"errors"`
+	Warnings []string       `json:"warnings"`
+}
+
+func importURL(t *testing.T, pageURL string) (int, importResult) {
+	t.Helper()
+	app := fiber.New()
+	app.Post("/recipes/import", RecipeImport)
+
+	body, _ := json.Marshal(map[string]interface{}{"import": map[string]string{"url": pageURL}})
+	req := httptest.NewRequest("POST", "/recipes/import", strings.NewReader(string(body)))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var result importResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, result
+}
+
+func TestImportJSONLD(t *testing.T) {
+	servePages(t, map[string]string{"https://example.com/bread": jsonLDPage})
+
+	status, result := importURL(t, "https://example.com/bread")
+	if status != fiber.StatusOK || !result.Success {
+		t.Fatalf("import: %d %s %q", status, result.Message, result.Errors)
+	}
+
+	recipe := result.Data.Recipe
+	if recipe.Name != "Country Bread" {
+		t.Errorf("name: got %q", recipe.Name)
+	}
+	if recipe.Description != "A crusty loaf & a soft crumb." {
+		t.Errorf("description: got %q", recipe.Description)
+	}
+	if recipe.Servings != "2 loaves" {
+		t.Errorf("servings: got %q, want the most descriptive yield", recipe.Servings)
+	}
+	if recipe.PrepTime != "1 hr 30 min" {
+		t.Errorf("prep time: got %q, want totalTime over prepTime", recipe.PrepTime)
+	}
+	if want := []string{"bread", "glutenfree", "sourdough"}; !reflect.DeepEqual(recipe.Tags, want) {
+		t.Errorf("tags: got %q, want %q", recipe.Tags, want)
+	}
+	if result.Data.Source != "https://example.com/bread" {
+		t.Errorf("source: got %q", result.Data.Source)
+	}
+	if result.Data.SourceImage != "https://example.com/images/bread.jpg" {
+		t.Errorf("source image: got %q", result.Data.SourceImage)
+	}
+
+	if len(recipe.IngredientGroups) != 1 {
+		t.Fatalf("ingredient groups: got %d", len(recipe.IngredientGroups))
+	}
+	ingredients := []IngredientValidator{
+		{Name: "bread flour", Qty: "500", Unit: "g"},
+		{Name: "salt", Qty: "1 1/2", Unit: "tsp"},
+		{Name: "yeast (7 g)", Qty: "1", Unit: "packet"},
+		{Name: "water"},
+	}
+	if got := recipe.IngredientGroups[0].Ingredients; !reflect.DeepEqual(got, ingredients) {
+		t.Errorf("ingredients:\ngot  %+v\nwant %+v", got, ingredients)
+	}
+
+	steps := []StepValidator{
+		{Type: "text", Text: "Dough: Mix the flour, salt and yeast.", StepImages: []StepImageValidator{}},
+		{Type: "text", Text: "Knead for 10 minutes.", StepImages: []StepImageValidator{}},
+		{Type: "text", Text: "Bake: Bake at 230C for 40 minutes.", StepImages: []StepImageValidator{}},
+		{Type: "tipText", Text: "A tray of water makes a better crust.", StepImages: []StepImageValidator{}},
+	}
+	if !reflect.DeepEqual(recipe.Steps, steps) {
+		t.Errorf("steps:\ngot  %+v\nwant %+v", recipe.Steps, steps)
+	}
+}
+
+func TestImportMicrodata(t *testing.T) {
+	servePages(t, map[string]string{"https://example.com/recipes/pancakes": microdataPage})
+
+	status, result := importURL(t, "https://example.com/recipes/pancakes")
+	if status != fiber.StatusOK || !result.Success {
+		t.Fatalf("import: %d %s %q", status, result.Message, result.Errors)
+	}
+
+	recipe := result.Data.Recipe
+	if recipe.Name != "Pancakes" {
+		t.Errorf("name: got %q, the author's name belongs to the author", recipe.Name)
+	}
+	if recipe.Description != "Thin and quick." {
+		t.Errorf("description: got %q", recipe.Description)
+	}
+	if recipe.Servings != "8 pancakes" {
+		t.Errorf("servings: got %q", recipe.Servings)
+	}
+	if recipe.PrepTime != "30 min" {
+		t.Errorf("prep time: got %q, want prepTime and cookTime added", recipe.PrepTime)
+	}
+	if want := []string{"breakfast", "quick"}; !reflect.DeepEqual(recipe.Tags, want) {
+		t.Errorf("tags: got %q, want %q", recipe.Tags, want)
+	}
+	if result.Data.SourceImage != "https://example.com/recipes/pancakes.jpg" {
+		t.Errorf("source image: got %q", result.Data.SourceImage)
+	}
+
+	ingredients := []IngredientValidator{
+		{Name: "milk", Qty: "1", Unit: "cup"},
+		{Name: "eggs", Qty: "2"},
+	}
+	if got := recipe.IngredientGroups[0].Ingredients; !reflect.DeepEqual(got, ingredients) {
+		t.Errorf("ingredients:\ngot  %+v\nwant %+v", got, ingredients)
+	}
+
+	var steps []string
+	for _, step := range recipe.Steps {
+		steps = append(steps, step.Text)
+	}
+	if want := []string{"Whisk everything together.", "Fry in a hot pan."}; !reflect.DeepEqual(steps, want) {
+		t.Errorf("steps: got %q, want %q", steps, want)
+	}
+}
+
+func TestImportPrefersJSONLD(t *testing.T) {
+	page := strings.Replace(microdataPage, "<body>", `<body><script type="application/ld+json">{"@type":"Recipe","name":"Crêpes"}</script>`, 1)
+	servePages(t, map[string]string{"https://example.com/crepes": page})
+
+	_, result := importURL(t, "https://example.com/crepes")
+	if result.Data.Recipe.Name != "Crêpes" {
+		t.Errorf("name: got %q, want the JSON-LD recipe", result.Data.Recipe.Name)
+	}
+}
+
+func TestImportFailures(t *testing.T) {
+	servePages(t, map[string]string{
+		"https://example.com/about": `<html><body><p>No recipes here.</p></body></html>`,
+	})
+
+	tests := []struct {
+		url     string
+		status  int
+		message string
+	}{
+		{url: "https://example.com/about", status: fiber.StatusUnprocessableEntity, message: "No Recipe Found"},
+		{url: "https://internal.example.com/", status: fiber.StatusUnprocessableEntity, message: "Unable to Fetch Page"},
+		{url: "https://example.com/missing", status: fiber.StatusBadGateway, message: "Unable to Fetch Page"},
+		{url: "not a url", status: fiber.StatusUnprocessableEntity, message: "Validation Errors"},
+	}
+	for _, test := range tests {
+		status, result := importURL(t, test.url)
+		if status != test.status || result.Message != test.message || result.Success {
+			t.Errorf("%s: got %d %q, want %d %q", test.url, status, result.Message, test.status, test.message)
+		}
+	}
+}
+
+func TestImportYield(t *testing.T) {
+	tests := []struct {
+		yield interface{}
+		want  string
+	}{
+		{yield: "4 servings", want: "4 servings"},
+		{yield: 6.0, want: "6"},
+		{yield: []interface{}{"12", "12 cookies"}, want: "12 cookies"},
+		{yield: map[string]interface{}{"@type": "QuantitativeValue", "value": "3"}, want: "3"},
+		{yield: nil, want: ""},
+	}
+	for _, test := range tests {
+		if got := importYield(test.yield); got != test.want {
+			t.Errorf("importYield(%v): got %q, want %q", test.yield, got, test.want)
+		}
+	}
+}
+
+func TestImportTime(t *testing.T) {
+	tests := []struct {
+		recipe map[string]interface{}
+		want   string
+	}{
+		{recipe: map[string]interface{}{"totalTime": "PT45M"}, want: "45 min"},
+		{recipe: map[string]interface{}{"totalTime": "PT2H"}, want: "2 hr"},
+		{recipe: map[string]interface{}{"totalTime": "P0DT1H15M"}, want: "1 hr 15 min"},
+		{recipe: map[string]interface{}{"prepTime": "PT15M", "cookTime": "PT1H"}, want: "1 hr 15 min"},
+		{recipe: map[string]interface{}{"cookTime": "PT25M"}, want: "25 min"},
+		{recipe: map[string]interface{}{"totalTime": "PT0M"}, want: ""},
+		{recipe: map[string]interface{}{}, want: ""},
+	}
+	for _, test := range tests {
+		if got := importTime(test.recipe); got != test.want {
+			t.Errorf("importTime(%v): got %q, want %q", test.recipe, got, test.want)
+		}
+	}
+}
+
+func TestImportKeywords(t *testing.T) {
+	tests := []struct {
+		keywords interface{}
+		want     []string
+	}{
+		{keywords: "Dinner, Quick & Easy, dinner", want: []string{"dinner", "quickeasy"}},
+		{keywords: []interface{}{"Vegan", "Gluten-Free"}, want: []string{"vegan", "glutenfree"}},
+		{keywords: "", want: []string{}},
+		{keywords: nil, want: []string{}},
+	}
+	for _, test := range tests {
+		if got := importKeywords(test.keywords); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("importKeywords(%v): got %q, want %q", test.keywords, got, test.want)
+		}
+	}
+}
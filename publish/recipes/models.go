@@ -4,9 +4,12 @@ import (
 	"errors"
 	"fmt"
 	"github.com/anthonyhawkins/savorbook/database"
+	"github.com/anthonyhawkins/savorbook/images"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type RecipeModel struct {
@@ -16,12 +19,21 @@ type RecipeModel struct {
 	Image            string
 	Description      string
 	PrepTime         string
+	PrepMinutes      *int
 	Servings         string
 	Tags             []TagModel              `gorm:"foreignKey:RecipeID;constraint:OnDelete:CASCADE"`
 	DependentRecipes []RecipeDependencyModel `gorm:"foreignKey:RecipeID;constraint:OnDelete:CASCADE"`
 	ParentRecipes    []RecipeDependencyModel `gorm:"-"`
 	IngredientGroups []IngredientGroupModel  `gorm:"foreignKey:RecipeID;constraint:OnDelete:CASCADE"`
 	Steps            []StepModel             `gorm:"foreignKey:RecipeID;constraint:OnDelete:CASCADE"`
+	Version          int                     `gorm:"not null;default:1"`
+	//Status is draft, published or archived, readers only ever see the PublishedRevision
+	Status            string `gorm:"not null;default:'draft';index"`
+	PublishedRevision *int
+	PublishedVersion  int
+	PublishedAt       *time.Time
+	//restoredFrom is the revision number being restored by this save, if any
+	restoredFrom int
 }
 
 type TagModel struct {
@@ -34,6 +46,7 @@ type TagModel struct {
 type IngredientGroupModel struct {
 	gorm.Model
 	GroupName   string
+	Position    int
 	Ingredients []IngredientModel `gorm:"foreignKey:IngredientGroupID;constraint:OnDelete:CASCADE"`
 	RecipeID    uint
 }
@@ -43,6 +56,11 @@ type IngredientModel struct {
 	Name              string
 	Qty               string
 	Unit              string
+	Amount            *float64
+	AmountMax         *float64
+	CanonicalUnit     string
+	Parsed            bool
+	Position          int
 	IngredientGroupID uint
 }
 
@@ -50,15 +68,17 @@ type StepModel struct {
 	gorm.Model
 	Type       string
 	Text       string
+	Position   int
 	StepImages []StepImageModel `gorm:"foreignKey:StepID;constraint:OnDelete:CASCADE"`
 	RecipeID   uint
 }
 
 type StepImageModel struct {
 	gorm.Model
-	Image  string
-	Text   string
-	StepID uint
+	Image    string
+	Text     string
+	Position int
+	StepID   uint
 }
 
 type RecipeDependencyModel struct {
@@ -72,12 +92,37 @@ type RecipeDependencyModel struct {
 func SaveRecipe(recipe *RecipeModel) error {
 	db := database.GetDB()
 
-	if err := recipe.CheckDependencies(db); err != nil {
-		return err
-	}
+	//ids only mean something when updating, a new recipe gets new children
+	recipe.resetChildIDs()
+	recipe.Version = 1
+	recipe.Status = StatusDraft
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := recipe.CheckDependencies(tx); err != nil {
+			return err
+		}
+		if err := tx.Save(recipe).Error; err != nil {
+			return err
+		}
+		if err := refreshSearchIndex(tx, recipe.ID); err != nil {
+			return err
+		}
+		if err := writeRevision(tx, recipe, RevisionCreated); err != nil {
+			return err
+		}
+		return images.LinkRecipeImages(tx, recipe.UserID, recipe.ID, recipe.imageRefs())
+	})
+}
 
-	err := db.Save(recipe).Error
-	return err
+// imageRefs lists every uploaded image the recipe points at.
+func (model *RecipeModel) imageRefs() []string {
+	refs := []string{model.Image}
+	for _, step := range model.Steps {
+		for _, stepImage := range step.StepImages {
+			refs = append(refs, stepImage.Image)
+		}
+	}
+	return refs
 }
 
 func GetRecipeParents(recipeID string) ([]RecipeDependencyModel, error) {
@@ -102,7 +147,8 @@ func GetRecipeParents(recipeID string) ([]RecipeDependencyModel, error) {
 
 }
 
-func DeleteRecipe(recipeID string, userID uint) ([]RecipeDependencyModel, error) {
+// DeleteRecipe only deletes the recipe while it is still at version, unless version is 0.
+func DeleteRecipe(recipeID string, userID uint, version int) ([]RecipeDependencyModel, error) {
 	db := database.GetDB()
 
 	parentRecipes, _ := GetRecipeParents(recipeID)
@@ -111,47 +157,334 @@ func DeleteRecipe(recipeID string, userID uint) ([]RecipeDependencyModel, error)
 		return parentRecipes, errors.New("this recipe is listed as a dependent for another recipe")
 	}
 
-	result := db.Where(map[string]interface{}{
+	query := db.Where(map[string]interface{}{
 		"id":      recipeID,
 		"user_id": userID,
-	}).Delete(&RecipeModel{})
+	})
+	if version != 0 {
+		query = query.Where("version = ?", version)
+	}
+	result := query.Delete(&RecipeModel{})
 
 	if result.Error != nil {
 		return parentRecipes, errors.New("unable to delete recipe")
 	}
+	if result.RowsAffected == 0 && version != 0 {
+		return parentRecipes, database.ErrVersionConflict
+	}
+
+	if result.RowsAffected > 0 {
+		if id, err := strconv.ParseUint(recipeID, 10, 64); err == nil {
+			images.LinkRecipeImages(db, userID, uint(id), nil)
+		}
+	}
 
 	return parentRecipes, nil
 }
 
+// Update saves the recipe and brings its children in line with it in one
+// transaction. Children are matched by the ids handed out in the responses:
+// matches are updated in place, children without an id (or with one belonging to
+// another recipe) are inserted and the ones left out are deleted. Old versions
+// live on in the recipe's revisions, so removed children are deleted for good
+// rather than soft deleted. A non-zero Version is the version the change was based
+// on; the update fails with database.ErrVersionConflict if the recipe has moved on.
 func (model *RecipeModel) Update() error {
 	db := database.GetDB()
 
-	if err := model.CheckDependencies(db); err != nil {
+	return db.Transaction(func(tx *gorm.DB) error {
+		version, err := database.BumpVersion(tx, &RecipeModel{}, model.ID, model.Version)
+		if err != nil {
+			return err
+		}
+		model.Version = version
+		if err := model.CheckDependencies(tx); err != nil {
+			return err
+		}
+		if err := model.loadStatus(tx); err != nil {
+			return err
+		}
+
+		err = tx.Model(model).Select(
+			"Name", "Image", "Description", "PrepTime", "PrepMinutes", "Servings",
+		).Omit(clause.Associations).Updates(model).Error
+		if err != nil {
+			return err
+		}
+
+		if err := model.syncTags(tx); err != nil {
+			return err
+		}
+		if err := model.syncDependencies(tx); err != nil {
+			return err
+		}
+		if err := model.syncIngredientGroups(tx); err != nil {
+			return err
+		}
+		if err := model.syncSteps(tx); err != nil {
+			return err
+		}
+
+		if err := refreshSearchIndex(tx, model.ID); err != nil {
+			return err
+		}
+
+		source := RevisionUpdated
+		if model.restoredFrom != 0 {
+			source = RevisionRestored
+		}
+		if err := writeRevision(tx, model, source); err != nil {
+			return err
+		}
+
+		return images.LinkRecipeImages(tx, model.UserID, model.ID, model.imageRefs())
+	})
+}
+
+func (model *RecipeModel) resetChildIDs() {
+	for i := range model.IngredientGroups {
+		model.IngredientGroups[i].ID = 0
+		for j := range model.IngredientGroups[i].Ingredients {
+			model.IngredientGroups[i].Ingredients[j].ID = 0
+		}
+	}
+	for i := range model.Steps {
+		model.Steps[i].ID = 0
+		for j := range model.Steps[i].StepImages {
+			model.Steps[i].StepImages[j].ID = 0
+		}
+	}
+}
+
+// syncTags matches tags by their text, there is nothing else to a tag.
+func (model *RecipeModel) syncTags(tx *gorm.DB) error {
+	var existing []TagModel
+	if err := tx.Where("recipe_id = ?", model.ID).Find(&existing).Error; err != nil {
 		return err
 	}
 
-	/**
-	When a user updates a list, items which need to be deleted are not included in the list
-	but we need to ensure they are not orphaned. For now delete the existing list and replace
-	with the desired list.
-	Alternatives would be when user deletes something in the UI, keep track of "ids_to_delete"
-	in another list and send that as well or as a different call. Then delete the ids here.
-	*/
-	tx := db.Begin()
-	//tx.Model(&model).Association("Tags").Replace(model.Tags)
-	tx.Where(map[string]interface{}{"recipe_id": model.ID}).Select(clause.Associations).Delete(&TagModel{})
-	tx.Where(map[string]interface{}{"recipe_id": model.ID}).Select(clause.Associations).Delete(&IngredientGroupModel{})
-	tx.Where(map[string]interface{}{"recipe_id": model.ID}).Select(clause.Associations).Delete(&StepModel{})
-	tx.Where(map[string]interface{}{"recipe_id": model.ID}).Select(clause.Associations).Delete(&RecipeDependencyModel{})
+	byTag := make(map[string]TagModel)
+	for _, tag := range existing {
+		byTag[tag.Tag] = tag
+	}
 
-	if tx.Save(&model); tx.Error != nil {
-		tx.Rollback()
-		return tx.Error
+	for i := range model.Tags {
+		tag := &model.Tags[i]
+		if current, ok := byTag[tag.Tag]; ok {
+			*tag = current
+			delete(byTag, tag.Tag)
+			continue
+		}
+		tag.RecipeID = model.ID
+		tag.UserID = model.UserID
+		if err := tx.Create(tag).Error; err != nil {
+			return err
+		}
 	}
 
-	tx.Commit()
+	var remove []uint
+	for _, tag := range byTag {
+		remove = append(remove, tag.ID)
+	}
+	return deleteByIDs(tx, &TagModel{}, remove)
+}
 
-	return nil
+// syncDependencies matches dependencies by the recipe depended on.
+func (model *RecipeModel) syncDependencies(tx *gorm.DB) error {
+	var existing []RecipeDependencyModel
+	if err := tx.Where("recipe_id = ?", model.ID).Find(&existing).Error; err != nil {
+		return err
+	}
+
+	byRecipe := make(map[uint]RecipeDependencyModel)
+	for _, dependency := range existing {
+		byRecipe[dependency.DependentRecipe] = dependency
+	}
+
+	for i := range model.DependentRecipes {
+		dependency := &model.DependentRecipes[i]
+		dependency.RecipeID = model.ID
+		current, ok := byRecipe[dependency.DependentRecipe]
+		if !ok {
+			if err := tx.Create(dependency).Error; err != nil {
+				return err
+			}
+			continue
+		}
+
+		dependency.ID = current.ID
+		delete(byRecipe, dependency.DependentRecipe)
+		if err := tx.Model(dependency).Select("Qty").Updates(dependency).Error; err != nil {
+			return err
+		}
+	}
+
+	var remove []uint
+	for _, dependency := range byRecipe {
+		remove = append(remove, dependency.ID)
+	}
+	return deleteByIDs(tx, &RecipeDependencyModel{}, remove)
+}
+
+// syncIngredientGroups matches ingredients across all of the recipe's groups, so an
+// ingredient dragged into another group keeps its id.
+func (model *RecipeModel) syncIngredientGroups(tx *gorm.DB) error {
+	var existingGroups []IngredientGroupModel
+	if err := tx.Where("recipe_id = ?", model.ID).Preload("Ingredients").Find(&existingGroups).Error; err != nil {
+		return err
+	}
+
+	groupIDs := make(map[uint]bool)
+	ingredientIDs := make(map[uint]bool)
+	for _, group := range existingGroups {
+		groupIDs[group.ID] = true
+		for _, ingredient := range group.Ingredients {
+			ingredientIDs[ingredient.ID] = true
+		}
+	}
+
+	keptGroups := make(map[uint]bool)
+	keptIngredients := make(map[uint]bool)
+	for i := range model.IngredientGroups {
+		group := &model.IngredientGroups[i]
+		group.RecipeID = model.ID
+
+		if groupIDs[group.ID] && !keptGroups[group.ID] {
+			err := tx.Model(group).Select("GroupName", "Position").Omit(clause.Associations).Updates(group).Error
+			if err != nil {
+				return err
+			}
+		} else {
+			group.ID = 0
+			if err := tx.Omit(clause.Associations).Create(group).Error; err != nil {
+				return err
+			}
+		}
+		keptGroups[group.ID] = true
+
+		for j := range group.Ingredients {
+			ingredient := &group.Ingredients[j]
+			ingredient.IngredientGroupID = group.ID
+
+			if ingredientIDs[ingredient.ID] && !keptIngredients[ingredient.ID] {
+				err := tx.Model(ingredient).Select(
+					"Name", "Qty", "Unit", "Amount", "AmountMax", "CanonicalUnit", "Parsed", "Position", "IngredientGroupID",
+				).Updates(ingredient).Error
+				if err != nil {
+					return err
+				}
+			} else {
+				ingredient.ID = 0
+				if err := tx.Create(ingredient).Error; err != nil {
+					return err
+				}
+			}
+			keptIngredients[ingredient.ID] = true
+		}
+	}
+
+	var removeIngredients, removeGroups []uint
+	for id := range ingredientIDs {
+		if !keptIngredients[id] {
+			removeIngredients = append(removeIngredients, id)
+		}
+	}
+	for id := range groupIDs {
+		if !keptGroups[id] {
+			removeGroups = append(removeGroups, id)
+		}
+	}
+	if err := deleteByIDs(tx, &IngredientModel{}, removeIngredients); err != nil {
+		return err
+	}
+	return deleteByIDs(tx, &IngredientGroupModel{}, removeGroups)
+}
+
+func (model *RecipeModel) syncSteps(tx *gorm.DB) error {
+	var existingSteps []StepModel
+	if err := tx.Where("recipe_id = ?", model.ID).Preload("StepImages").Find(&existingSteps).Error; err != nil {
+		return err
+	}
+
+	stepIDs := make(map[uint]bool)
+	imageIDs := make(map[uint]bool)
+	for _, step := range existingSteps {
+		stepIDs[step.ID] = true
+		for _, stepImage := range step.StepImages {
+			imageIDs[stepImage.ID] = true
+		}
+	}
+
+	keptSteps := make(map[uint]bool)
+	keptImages := make(map[uint]bool)
+	for i := range model.Steps {
+		step := &model.Steps[i]
+		step.RecipeID = model.ID
+
+		if stepIDs[step.ID] && !keptSteps[step.ID] {
+			err := tx.Model(step).Select("Type", "Text", "Position").Omit(clause.Associations).Updates(step).Error
+			if err != nil {
+				return err
+			}
+		} else {
+			step.ID = 0
+			if err := tx.Omit(clause.Associations).Create(step).Error; err != nil {
+				return err
+			}
+		}
+		keptSteps[step.ID] = true
+
+		for j := range step.StepImages {
+			stepImage := &step.StepImages[j]
+			stepImage.StepID = step.ID
+
+			if imageIDs[stepImage.ID] && !keptImages[stepImage.ID] {
+				err := tx.Model(stepImage).Select("Image", "Text", "Position", "StepID").Updates(stepImage).Error
+				if err != nil {
+					return err
+				}
+			} else {
+				stepImage.ID = 0
+				if err := tx.Create(stepImage).Error; err != nil {
+					return err
+				}
+			}
+			keptImages[stepImage.ID] = true
+		}
+	}
+
+	var removeImages, removeSteps []uint
+	for id := range imageIDs {
+		if !keptImages[id] {
+			removeImages = append(removeImages, id)
+		}
+	}
+	for id := range stepIDs {
+		if !keptSteps[id] {
+			removeSteps = append(removeSteps, id)
+		}
+	}
+	if err := deleteByIDs(tx, &StepImageModel{}, removeImages); err != nil {
+		return err
+	}
+	return deleteByIDs(tx, &StepModel{}, removeSteps)
+}
+
+func deleteByIDs(tx *gorm.DB, model interface{}, ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return tx.Unscoped().Where("id IN ?", ids).Delete(model).Error
+}
+
+// byPosition keeps children in the order they were sent, rows from before positions were kept fall back to id order.
+func byPosition(db *gorm.DB) *gorm.DB {
+	return db.Order("position, id")
+}
+
+func orderedChildren(db *gorm.DB) *gorm.DB {
+	return db.Preload("Steps", byPosition).Preload("Steps.StepImages", byPosition).
+		Preload("IngredientGroups", byPosition).Preload("IngredientGroups.Ingredients", byPosition)
 }
 
 func (model *RecipeModel) setTags(tags []string) error {
@@ -193,7 +526,7 @@ func (model *RecipeModel) CheckDependencies(db *gorm.DB) error {
 		return errors.New("one or more dependent recipes does not exist")
 	}
 
-	return nil
+	return model.checkCycles(db)
 }
 
 func (model *RecipeModel) setDependencies(dependents []RecipeDependencyValidator) error {
@@ -210,8 +543,10 @@ func (model *RecipeModel) setDependencies(dependents []RecipeDependencyValidator
 
 func (model *RecipeModel) setIngredientGroups(ingredientGroupValidators []IngredientGroupValidator) error {
 	var groups []IngredientGroupModel
-	for _, groupValidator := range ingredientGroupValidators {
+	for i, groupValidator := range ingredientGroupValidators {
 		var group IngredientGroupModel
+		group.ID = groupValidator.ID
+		group.Position = i
 		group.GroupName = groupValidator.GroupName
 		if err := group.setIngredients(groupValidator.Ingredients); err != nil {
 			return err
@@ -224,11 +559,14 @@ func (model *RecipeModel) setIngredientGroups(ingredientGroupValidators []Ingred
 
 func (model *IngredientGroupModel) setIngredients(ingredientValidators []IngredientValidator) error {
 	var ingredients []IngredientModel
-	for _, ingredientValidator := range ingredientValidators {
+	for i, ingredientValidator := range ingredientValidators {
 		var ingredient IngredientModel
+		ingredient.ID = ingredientValidator.ID
+		ingredient.Position = i
 		ingredient.Name = ingredientValidator.Name
 		ingredient.Qty = ingredientValidator.Qty
 		ingredient.Unit = ingredientValidator.Unit
+		ingredient.parseAmount()
 		ingredients = append(ingredients, ingredient)
 	}
 	model.Ingredients = ingredients
@@ -237,8 +575,10 @@ func (model *IngredientGroupModel) setIngredients(ingredientValidators []Ingredi
 
 func (model *RecipeModel) setSteps(stepValidators []StepValidator) error {
 	var steps []StepModel
-	for _, stepValidator := range stepValidators {
+	for i, stepValidator := range stepValidators {
 		var step StepModel
+		step.ID = stepValidator.ID
+		step.Position = i
 		step.Type = stepValidator.Type
 		step.Text = stepValidator.Text
 		if err := step.setStepImages(stepValidator.StepImages); err != nil {
@@ -252,8 +592,10 @@ func (model *RecipeModel) setSteps(stepValidators []StepValidator) error {
 
 func (model *StepModel) setStepImages(stepImageValidators []StepImageValidator) error {
 	var images []StepImageModel
-	for _, stepImageValidator := range stepImageValidators {
+	for i, stepImageValidator := range stepImageValidators {
 		var stepImage StepImageModel
+		stepImage.ID = stepImageValidator.ID
+		stepImage.Position = i
 		stepImage.Text = stepImageValidator.Text
 		stepImage.Image = stepImageValidator.Image
 		images = append(images, stepImage)
@@ -262,6 +604,110 @@ func (model *StepModel) setStepImages(stepImageValidators []StepImageValidator)
 	return nil
 }
 
+// BaseServings reads how many servings the recipe makes from its free-form Servings, i.e. "4" or "4-6 people".
+func (model *RecipeModel) BaseServings() (float64, bool) {
+	quantity, _, ok := parseLeadingQuantity(model.Servings)
+	if !ok || quantity.Min <= 0 {
+		return 0, false
+	}
+	return quantity.Min, true
+}
+
+// ScaleFactor works out how much to scale the recipe by, either from a target
+// number of servings or from an explicit factor such as "2" or "1/2".
+func (model *RecipeModel) ScaleFactor(servings string, scale string) (float64, error) {
+	if servings != "" {
+		target, ok := ParseQuantity(servings)
+		if !ok || target.IsRange() || target.Min <= 0 {
+			return 1, errors.New("servings must be a positive number")
+		}
+		base, ok := model.BaseServings()
+		if !ok {
+			return 1, errors.New("recipe servings are not a number, use scale instead")
+		}
+		return target.Min / base, nil
+	}
+
+	if scale != "" {
+		factor, ok := ParseQuantity(scale)
+		if !ok || factor.IsRange() || factor.Min <= 0 {
+			return 1, errors.New("scale must be a positive number")
+		}
+		return factor.Min, nil
+	}
+
+	return 1, nil
+}
+
+// Scale multiplies the servings and every ingredient and dependent recipe quantity by factor.
+func (model *RecipeModel) Scale(factor float64) {
+	model.Servings = ScaleQuantityText(model.Servings, factor)
+	for i := range model.IngredientGroups {
+		for j := range model.IngredientGroups[i].Ingredients {
+			ingredient := &model.IngredientGroups[i].Ingredients[j]
+			ingredient.Qty = ScaleQuantityText(ingredient.Qty, factor)
+			ingredient.scaleAmount(factor)
+		}
+	}
+	for i := range model.DependentRecipes {
+		model.DependentRecipes[i].Qty = ScaleQuantityText(model.DependentRecipes[i].Qty, factor)
+	}
+}
+
+// parseAmount fills in the structured amount and canonical unit from the ingredient's Qty and Unit text.
+func (model *IngredientModel) parseAmount() {
+	quantity, unit := ParseAmount(model.Qty, model.Unit)
+
+	model.Amount = nil
+	model.AmountMax = nil
+	if quantity != nil {
+		model.Amount = &quantity.Min
+		if quantity.IsRange() {
+			model.AmountMax = &quantity.Max
+		}
+	}
+
+	model.CanonicalUnit = ""
+	if unit != nil {
+		model.CanonicalUnit = unit.Name
+	}
+	model.Parsed = true
+}
+
+// scaleAmount keeps the structured amount in step with a scaled Qty.
+func (model *IngredientModel) scaleAmount(factor float64) {
+	if model.Amount != nil {
+		amount := *model.Amount * factor
+		model.Amount = &amount
+	}
+	if model.AmountMax != nil {
+		amountMax := *model.AmountMax * factor
+		model.AmountMax = &amountMax
+	}
+}
+
+// MigrateIngredientAmounts backfills the structured amount of ingredients saved before it existed.
+func MigrateIngredientAmounts(db *gorm.DB) error {
+	var ingredients []IngredientModel
+	//rows that predate the column hold NULL rather than false
+	result := db.Where("parsed IS NOT TRUE").FindInBatches(&ingredients, 500, func(tx *gorm.DB, batch int) error {
+		for _, ingredient := range ingredients {
+			ingredient.parseAmount()
+			err := db.Model(&IngredientModel{}).Where("id = ?", ingredient.ID).Updates(map[string]interface{}{
+				"amount":         ingredient.Amount,
+				"amount_max":     ingredient.AmountMax,
+				"canonical_unit": ingredient.CanonicalUnit,
+				"parsed":         true,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return result.Error
+}
+
 /**
 GET RECIPE
 */
@@ -288,7 +734,7 @@ func GetRecipeFull(recipeID string, userID uint) (RecipeModel, error) {
 		"user_id": userID,
 	}).Preload("Tags", func(db *gorm.DB) *gorm.DB {
 		return db.Order("tag_models.tag")
-	}).Preload("Steps.StepImages").Preload("IngredientGroups.Ingredients").First(&model)
+	}).Scopes(orderedChildren).First(&model)
 
 	if result.Error != nil {
 		return model, result.Error
@@ -317,13 +763,12 @@ func GetRecipeFull(recipeID string, userID uint) (RecipeModel, error) {
 	return model, err
 }
 
-func GetRecipes(userID uint, pageNum string, pageSize string) ([]RecipeModel, error) {
+func GetRecipes(userID uint, statuses []string, pageNum string, pageSize string) ([]RecipeModel, error) {
 
 	db := database.GetDB()
 	var recipes []RecipeModel
 
-	selects := []string{"id", "user_id", "name", "image", "description", "prep_time", "servings"}
-	result := db.Scopes(database.Paginate(pageNum, pageSize)).Select(selects).Where(map[string]interface{}{
+	result := db.Scopes(database.Paginate(pageNum, pageSize), ByStatus("recipe_models", statuses)).Select(listSelects).Where(map[string]interface{}{
 		"user_id": userID,
 	}).Preload("Tags", func(db *gorm.DB) *gorm.DB {
 		return db.Order("tag_models.tag")
@@ -332,6 +777,31 @@ func GetRecipes(userID uint, pageNum string, pageSize string) ([]RecipeModel, er
 	return recipes, result.Error
 }
 
+// GetRecipeIDs lists the ids of every one of the user's recipes, whatever their status.
+func GetRecipeIDs(userID uint) ([]uint, error) {
+	db := database.GetDB()
+	var recipeIDs []uint
+
+	result := db.Model(&RecipeModel{}).Where(map[string]interface{}{
+		"user_id": userID,
+	}).Order("id").Pluck("id", &recipeIDs)
+
+	return recipeIDs, result.Error
+}
+
+// GetRecipesWithIngredients loads all of the user's recipes with their ingredients but not their steps.
+func GetRecipesWithIngredients(userID uint) ([]RecipeModel, error) {
+	db := database.GetDB()
+	var recipes []RecipeModel
+
+	selects := []string{"id", "user_id", "name", "image", "description", "prep_time", "servings"}
+	result := db.Select(selects).Where(map[string]interface{}{
+		"user_id": userID,
+	}).Preload("IngredientGroups", byPosition).Preload("IngredientGroups.Ingredients", byPosition).Order("name").Find(&recipes)
+
+	return recipes, result.Error
+}
+
 func GetRecipesByIDs(userID uint, recipeIDs []uint) ([]RecipeModel, error) {
 	db := database.GetDB()
 	var recipes []RecipeModel
@@ -342,13 +812,12 @@ func GetRecipesByIDs(userID uint, recipeIDs []uint) ([]RecipeModel, error) {
 	return recipes, result.Error
 }
 
-func FindRecipesByName(userID uint, searchString string, pageNum string, pageSize string) ([]RecipeModel, error) {
+func FindRecipesByName(userID uint, searchString string, statuses []string, pageNum string, pageSize string) ([]RecipeModel, error) {
 
 	db := database.GetDB()
 	var recipes []RecipeModel
 
-	selects := []string{"id", "user_id", "name", "image", "description", "prep_time", "servings"}
-	result := db.Scopes(database.Paginate(pageNum, pageSize)).Select(selects).Where(map[string]interface{}{
+	result := db.Scopes(database.Paginate(pageNum, pageSize), ByStatus("recipe_models", statuses)).Select(listSelects).Where(map[string]interface{}{
 		"user_id": userID,
 	}).Where("LOWER(name) LIKE ?", "%"+searchString+"%").Preload("Tags", func(db *gorm.DB) *gorm.DB {
 		return db.Order("tag_models.tag")
@@ -357,14 +826,14 @@ func FindRecipesByName(userID uint, searchString string, pageNum string, pageSiz
 	return recipes, result.Error
 }
 
-func FindRecipesByTags(userID uint, searchString string, pageNum string, pageSize string) ([]RecipeModel, error) {
+func FindRecipesByTags(userID uint, searchString string, statuses []string, pageNum string, pageSize string) ([]RecipeModel, error) {
 
 	tags := strings.Split(strings.ToLower(searchString), ",")
 
 	db := database.GetDB()
 	var recipes []RecipeModel
 
-	result := db.Scopes(database.Paginate(pageNum, pageSize)).Model(&RecipeModel{}).Distinct().Preload("Tags", func(db *gorm.DB) *gorm.DB {
+	result := db.Scopes(database.Paginate(pageNum, pageSize), ByStatus("recipe_models", statuses)).Model(&RecipeModel{}).Distinct().Preload("Tags", func(db *gorm.DB) *gorm.DB {
 		return db.Order("tag_models.tag")
 	}).Joins(
 		`left join tag_models 
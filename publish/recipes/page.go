@@ -0,0 +1,225 @@
+package recipes
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+)
+
+// siteName is shown in link previews alongside the recipe.
+const siteName = "Savorbook"
+
+// maxPreviewDescription is about as much of a description as link previews show.
+const maxPreviewDescription = 200
+
+var recipePageTemplate = template.Must(template.New("recipe").Funcs(template.FuncMap{
+	"ingredient": IngredientLine,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+{{- if .Description}}
+<meta name="description" content="{{.Description}}">
+{{- end}}
+{{- if .URL}}
+<link rel="canonical" href="{{.URL}}">
+{{- end}}
+<meta property="og:type" content="article">
+<meta property="og:site_name" content="{{.SiteName}}">
+<meta property="og:title" content="{{.Name}}">
+{{- if .Description}}
+<meta property="og:description" content="{{.Description}}">
+{{- end}}
+{{- if .URL}}
+<meta property="og:url" content="{{.URL}}">
+{{- end}}
+{{- if .Image}}
+<meta property="og:image" content="{{.Image}}">
+<meta property="og:image:alt" content="{{.Name}}">
+<meta name="twitter:card" content="summary_large_image">
+{{- else}}
+<meta name="twitter:card" content="summary">
+{{- end}}
+<meta name="twitter:title" content="{{.Name}}">
+{{- if .Description}}
+<meta name="twitter:description" content="{{.Description}}">
+{{- end}}
+{{- if .Image}}
+<meta name="twitter:image" content="{{.Image}}">
+<meta name="twitter:image:alt" content="{{.Name}}">
+{{- end}}
+<script type="application/ld+json">{{.Schema}}</script>
+</head>
+<body>
+<article>
+<h1>{{.Name}}</h1>
+{{- if .Author}}
+<p class="author">By {{.Author}}</p>
+{{- end}}
+{{- if .Image}}
+<img src="{{.Image}}" alt="{{.Name}}">
+{{- end}}
+{{- if .Recipe.Description}}
+<p class="description">{{.Recipe.Description}}</p>
+{{- end}}
+{{- if or .Recipe.PrepTime .Recipe.Servings}}
+<dl class="details">
+{{- if .Recipe.PrepTime}}
+<dt>Time</dt><dd>{{if .TotalTime}}<time datetime="{{.TotalTime}}">{{.Recipe.PrepTime}}</time>{{else}}{{.Recipe.PrepTime}}{{end}}</dd>
+{{- end}}
+{{- if .Recipe.Servings}}
+<dt>Serves</dt><dd>{{.Recipe.Servings}}</dd>
+{{- end}}
+</dl>
+{{- end}}
+{{- if .Dependencies}}
+<section class="needs">
+<h2>You'll need</h2>
+<ul>
+{{- range .Dependencies}}
+<li>{{ingredient .Qty "" .Recipe.Name}}</li>
+{{- end}}
+</ul>
+</section>
+{{- end}}
+<section class="ingredients">
+<h2>Ingredients</h2>
+{{- range .Recipe.IngredientGroups}}
+{{- if .GroupName}}
+<h3>{{.GroupName}}</h3>
+{{- end}}
+<ul>
+{{- range .Ingredients}}
+<li>{{ingredient .Qty .Unit .Name}}</li>
+{{- end}}
+</ul>
+{{- end}}
+</section>
+{{- range .Sections}}
+<section class="method">
+<h2>{{.Name}}</h2>
+<ol>
+{{- range .Steps}}
+<li id="{{.Anchor}}"><p>{{.Text}}</p>
+{{- range .Images}}
+<figure><img src="{{.Src}}" alt="{{.Text}}">{{if .Text}}<figcaption>{{.Text}}</figcaption>{{end}}</figure>
+{{- end}}
+{{- range .Tips}}
+<aside class="tip">{{.}}</aside>
+{{- end}}
+</li>
+{{- end}}
+</ol>
+</section>
+{{- end}}
+</article>
+</body>
+</html>
+`))
+
+type recipePage struct {
+	SiteName     string
+	Title        string
+	Name         string
+	Description  string
+	URL          string
+	Image        string
+	Author       string
+	TotalTime    string
+	Schema       SchemaRecipe
+	Recipe       *RecipeSnapshot
+	Dependencies []PublishedDependency
+	Sections     []recipePageSection
+}
+
+type recipePageSection struct {
+	Name  string
+	Steps []recipePageStep
+}
+
+type recipePageStep struct {
+	Anchor string
+	Text   string
+	Images []recipePageImage
+	Tips   []string
+}
+
+type recipePageImage struct {
+	Src  string
+	Text string
+}
+
+// WriteRecipePage renders a published recipe as a standalone HTML page, with the
+// schema.org JSON-LD and the Open Graph and Twitter card tags link previews are built from.
+func WriteRecipePage(w io.Writer, snapshot *RecipeSnapshot, dependencies []PublishedDependency, page SchemaPage) error {
+	schema := NewSchemaRecipe(snapshot, dependencies, page)
+
+	view := recipePage{
+		SiteName:     siteName,
+		Title:        snapshot.Name + " | " + siteName,
+		Name:         snapshot.Name,
+		Description:  previewDescription(snapshot.Description),
+		URL:          page.URL,
+		Image:        resolveURL(page.BaseURL, snapshot.Image),
+		Author:       page.Author,
+		TotalTime:    schema.TotalTime,
+		Schema:       schema,
+		Recipe:       snapshot,
+		Dependencies: dependencies,
+	}
+
+	//steps and their tips are grouped the way schemaSteps groups them so the JSON-LD step links land on them
+	for i, dependency := range dependencies {
+		view.Sections = append(view.Sections, recipePageSection{
+			Name:  dependency.Recipe.Name,
+			Steps: pageSteps(dependency.Recipe.Steps, page, fmt.Sprintf("dependency-%d-step", i+1)),
+		})
+	}
+	view.Sections = append(view.Sections, recipePageSection{
+		Name:  "Method",
+		Steps: pageSteps(snapshot.Steps, page, "step"),
+	})
+
+	return recipePageTemplate.Execute(w, view)
+}
+
+func pageSteps(steps []StepValidator, page SchemaPage, anchor string) []recipePageStep {
+	var pageSteps []recipePageStep
+	for _, step := range steps {
+		text := strings.TrimSpace(step.Text)
+		if text == "" {
+			continue
+		}
+		if step.Type == "tipText" && len(pageSteps) > 0 {
+			previous := &pageSteps[len(pageSteps)-1]
+			previous.Tips = append(previous.Tips, text)
+			continue
+		}
+
+		pageStep := recipePageStep{Anchor: fmt.Sprintf("%s-%d", anchor, len(pageSteps)+1), Text: text}
+		for _, image := range step.StepImages {
+			if src := resolveURL(page.BaseURL, image.Image); src != "" {
+				pageStep.Images = append(pageStep.Images, recipePageImage{Src: src, Text: image.Text})
+			}
+		}
+		pageSteps = append(pageSteps, pageStep)
+	}
+	return pageSteps
+}
+
+// previewDescription shortens a description to a sentence or so, cut at a word.
+func previewDescription(description string) string {
+	description = strings.Join(strings.Fields(description), " ")
+	if len([]rune(description)) <= maxPreviewDescription {
+		return description
+	}
+	runes := []rune(description)[:maxPreviewDescription]
+	cut := strings.LastIndex(string(runes), " ")
+	if cut <= 0 {
+		cut = len(string(runes))
+	}
+	return strings.TrimRight(string(runes)[:cut], " ,.;:") + "…"
+}
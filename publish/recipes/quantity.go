@@ -0,0 +1,191 @@
+package recipes
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var unicodeFractions = map[rune]float64{
+	'½': 1.0 / 2, '⅓': 1.0 / 3, '⅔': 2.0 / 3, '¼': 1.0 / 4, '¾': 3.0 / 4,
+	'⅕': 1.0 / 5, '⅖': 2.0 / 5, '⅗': 3.0 / 5, '⅘': 4.0 / 5, '⅙': 1.0 / 6,
+	'⅚': 5.0 / 6, '⅛': 1.0 / 8, '⅜': 3.0 / 8, '⅝': 5.0 / 8, '⅞': 7.0 / 8,
+}
+
+const unicodeFractionClass = `[½⅓⅔¼¾⅕⅖⅗⅘⅙⅚⅛⅜⅝⅞]`
+
+// Order matters, Go tries the alternatives left to right so the longer forms
+// ("1 1/2", "1½") have to come before the plain integer.
+var numberPattern = `(?:\d+\s+\d+\s*/\s*\d+|\d+\s*` + unicodeFractionClass + `|` + unicodeFractionClass +
+	`|\d+\s*/\s*\d+|\d*\.\d+|\d+)`
+
+var leadingQuantity = regexp.MustCompile(`^\s*(` + numberPattern + `)(?:\s*(?:-|–|—|to)\s*(` + numberPattern + `))?`)
+
+// kitchenFractions are the fractions quantities are rounded to when they are formatted.
+var kitchenFractions = []struct {
+	value float64
+	text  string
+}{
+	{0, ""}, {1.0 / 8, "1/8"}, {1.0 / 4, "1/4"}, {1.0 / 3, "1/3"}, {3.0 / 8, "3/8"},
+	{1.0 / 2, "1/2"}, {5.0 / 8, "5/8"}, {2.0 / 3, "2/3"}, {3.0 / 4, "3/4"}, {7.0 / 8, "7/8"}, {1, ""},
+}
+
+// Quantity is an amount or a range of amounts, i.e. "2" or "2-3".
+type Quantity struct {
+	Min float64
+	Max float64
+}
+
+func (q Quantity) IsRange() bool {
+	return q.Max != q.Min
+}
+
+func (q Quantity) Scale(factor float64) Quantity {
+	return Quantity{Min: q.Min * factor, Max: q.Max * factor}
+}
+
+func (q Quantity) String() string {
+	if q.IsRange() {
+		return FormatAmount(q.Min) + "-" + FormatAmount(q.Max)
+	}
+	return FormatAmount(q.Min)
+}
+
+// ParseQuantity parses a whole string as a quantity, i.e. "1 1/2", "½", "2-3" or "0.75".
+func ParseQuantity(text string) (Quantity, bool) {
+	quantity, rest, ok := parseLeadingQuantity(text)
+	if !ok || strings.TrimSpace(rest) != "" {
+		return Quantity{}, false
+	}
+	return quantity, true
+}
+
+func parseLeadingQuantity(text string) (Quantity, string, bool) {
+	match := leadingQuantity.FindStringSubmatchIndex(text)
+	if match == nil {
+		return Quantity{}, text, false
+	}
+
+	min, ok := parseNumber(text[match[2]:match[3]])
+	if !ok {
+		return Quantity{}, text, false
+	}
+	max := min
+	if match[4] >= 0 {
+		if max, ok = parseNumber(text[match[4]:match[5]]); !ok {
+			return Quantity{}, text, false
+		}
+	}
+
+	return Quantity{Min: min, Max: max}, text[match[1]:], true
+}
+
+func parseNumber(text string) (float64, bool) {
+	text = strings.TrimSpace(text)
+	total := 0.0
+
+	//trailing unicode fraction, i.e. "1½" or "½"
+	if r, size := utf8.DecodeLastRuneInString(text); size > 0 {
+		if fraction, ok := unicodeFractions[r]; ok {
+			total += fraction
+			text = strings.TrimSpace(text[:len(text)-size])
+			if text == "" {
+				return total, true
+			}
+		}
+	}
+
+	//mixed number, i.e. "1 1/2"
+	if fields := strings.Fields(text); len(fields) == 2 && !strings.Contains(fields[0], "/") {
+		whole, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return 0, false
+		}
+		total += whole
+		text = fields[1]
+	}
+
+	if slash := strings.Index(text, "/"); slash >= 0 {
+		numerator, err := strconv.ParseFloat(strings.TrimSpace(text[:slash]), 64)
+		if err != nil {
+			return 0, false
+		}
+		denominator, err := strconv.ParseFloat(strings.TrimSpace(text[slash+1:]), 64)
+		if err != nil || denominator == 0 {
+			return 0, false
+		}
+		return total + numerator/denominator, true
+	}
+
+	value, err := strconv.ParseFloat(strings.TrimSpace(strings.ReplaceAll(text, " ", "")), 64)
+	if err != nil {
+		return 0, false
+	}
+	return total + value, true
+}
+
+// FormatAmount rounds an amount to something that can be measured in a kitchen.
+// Small and medium amounts become the nearest common fraction, larger amounts
+// are rounded to whole numbers.
+func FormatAmount(value float64) string {
+	if value <= 0 {
+		return "0"
+	}
+	if value >= 20 {
+		return strconv.FormatFloat(math.Round(value), 'f', -1, 64)
+	}
+	if value < 1.0/16 {
+		return strconv.FormatFloat(value, 'f', 2, 64)
+	}
+
+	whole := math.Floor(value)
+	remainder := value - whole
+
+	best := kitchenFractions[0]
+	for _, fraction := range kitchenFractions {
+		if math.Abs(remainder-fraction.value) < math.Abs(remainder-best.value) {
+			best = fraction
+		}
+	}
+	if best.value == 1 {
+		whole++
+	}
+
+	switch {
+	case whole == 0 && best.text == "":
+		return "0"
+	case whole == 0:
+		return best.text
+	case best.text == "":
+		return strconv.FormatFloat(whole, 'f', -1, 64)
+	default:
+		return strconv.FormatFloat(whole, 'f', -1, 64) + " " + best.text
+	}
+}
+
+// ScaleQuantityText scales the quantity at the start of a free-form string and
+// keeps the rest of it, i.e. "2 cups" becomes "4 cups". Strings which don't start
+// with a quantity, such as "a pinch", are returned as they are.
+func ScaleQuantityText(text string, factor float64) string {
+	if factor == 1 {
+		return text
+	}
+	quantity, rest, ok := parseLeadingQuantity(text)
+	if !ok {
+		return text
+	}
+	return quantity.Scale(factor).String() + rest
+}
+
+// ReplaceQuantityText swaps the quantity at the start of a free-form string for
+// value and keeps the rest of it, i.e. "2 cups" with 1.5 becomes "1 1/2 cups".
+// Strings which don't start with a quantity are replaced by the value alone.
+func ReplaceQuantityText(text string, value float64) string {
+	_, rest, ok := parseLeadingQuantity(text)
+	if !ok {
+		return FormatAmount(value)
+	}
+	return FormatAmount(value) + rest
+}
@@ -12,6 +12,11 @@ type RecipeResponse struct {
 	DependentRecipes []DependentRecipeResponse `json:"dependentRecipes"`
 	IngredientGroups []IngredientGroupResponse `json:"ingredientGroups"`
 	Steps            []StepResponse            `json:"steps"`
+	Scale            float64                   `json:"scale,omitempty"`
+	Version          int                       `json:"version"`
+	Status           string                    `json:"status"`
+	PublishedAt      string                    `json:"publishedAt,omitempty"`
+	Pending          bool                      `json:"hasUnpublishedChanges"`
 }
 
 type DependentRecipeResponse struct {
@@ -33,10 +38,13 @@ type IngredientGroupResponse struct {
 }
 
 type IngredientResponse struct {
-	ID   uint   `json:"id"`
-	Name string `json:"name"`
-	Qty  string `json:"qty"`
-	Unit string `json:"unit"`
+	ID            uint     `json:"id"`
+	Name          string   `json:"name"`
+	Qty           string   `json:"qty"`
+	Unit          string   `json:"unit"`
+	Amount        *float64 `json:"amount"`
+	AmountMax     *float64 `json:"amountMax,omitempty"`
+	CanonicalUnit string   `json:"canonicalUnit"`
 }
 
 type StepResponse struct {
@@ -64,6 +72,12 @@ func (r *RecipeResponse) SerializeRecipe(model *RecipeModel) {
 	r.serializeSteps(model.Steps)
 	r.serializeIngredientGroups(model.IngredientGroups)
 	r.ParentRecipes = SerializeParentRecipes(model.ParentRecipes)
+	r.Version = model.Version
+	r.Status = model.Status
+	if model.PublishedAt != nil {
+		r.PublishedAt = model.PublishedAt.Format("2006-01-02T15:04:05Z07:00")
+	}
+	r.Pending = model.HasUnpublishedChanges()
 }
 
 func SerializeTags(tagModels []TagModel) []string {
@@ -107,6 +121,9 @@ func (r *IngredientGroupResponse) serializeIngredients(ingredientModels []Ingred
 		ingredient.Name = ingredientModel.Name
 		ingredient.Qty = ingredientModel.Qty
 		ingredient.Unit = ingredientModel.Unit
+		ingredient.Amount = ingredientModel.Amount
+		ingredient.AmountMax = ingredientModel.AmountMax
+		ingredient.CanonicalUnit = ingredientModel.CanonicalUnit
 		ingredients = append(ingredients, ingredient)
 	}
 	r.Ingredients = ingredients
@@ -147,3 +164,174 @@ func SerializeParentRecipes(recipeParents []RecipeDependencyModel) []ParentRecip
 	}
 	return parents
 }
+
+type SearchResultResponse struct {
+	RecipeResponse
+	Rank        float64 `json:"rank"`
+	NameSnippet string  `json:"nameSnippet,omitempty"`
+	Snippet     string  `json:"snippet,omitempty"`
+}
+
+func (r *SearchResultResponse) SerializeSearchResult(result *SearchResult) {
+	r.SerializeRecipe(&result.Recipe)
+	r.Rank = result.Rank
+	r.NameSnippet = result.NameSnippet
+	r.Snippet = result.Snippet
+}
+
+type RecipeGraphResponse struct {
+	Tree  GraphNodeResponse   `json:"tree"`
+	Order []GraphStepResponse `json:"order"`
+	Depth int                 `json:"depth"`
+}
+
+type GraphNodeResponse struct {
+	ID               uint                `json:"id"`
+	Name             string              `json:"name"`
+	Qty              string              `json:"qty"`
+	Depth            int                 `json:"depth"`
+	Batches          float64             `json:"batches"`
+	Total            string              `json:"total"`
+	Cycle            bool                `json:"cycle,omitempty"`
+	DependentRecipes []GraphNodeResponse `json:"dependentRecipes"`
+}
+
+type GraphStepResponse struct {
+	ID     uint     `json:"id"`
+	Name   string   `json:"name"`
+	Depth  int      `json:"depth"`
+	Needed []string `json:"needed"`
+}
+
+func (r *RecipeGraphResponse) SerializeGraph(root GraphNode) {
+	r.Tree.serializeNode(root)
+	r.Order = make([]GraphStepResponse, 0)
+	for _, step := range root.Order() {
+		r.Order = append(r.Order, GraphStepResponse{
+			ID:     step.RecipeID,
+			Name:   step.Name,
+			Depth:  step.Depth,
+			Needed: step.Needed,
+		})
+		if step.Depth > r.Depth {
+			r.Depth = step.Depth
+		}
+	}
+}
+
+func (r *GraphNodeResponse) serializeNode(node GraphNode) {
+	r.ID = node.RecipeID
+	r.Name = node.Name
+	r.Qty = node.Qty
+	r.Depth = node.Depth
+	r.Batches = node.Batches
+	r.Total = node.Total
+	r.Cycle = node.Cycle
+	r.DependentRecipes = make([]GraphNodeResponse, 0)
+	for _, child := range node.Dependent {
+		var dependent GraphNodeResponse
+		dependent.serializeNode(child)
+		r.DependentRecipes = append(r.DependentRecipes, dependent)
+	}
+}
+
+type RevisionResponse struct {
+	Number       int             `json:"number"`
+	Created      string          `json:"created"`
+	Source       string          `json:"source"`
+	RestoredFrom *int            `json:"restoredFrom,omitempty"`
+	Recipe       *RecipeSnapshot `json:"recipe,omitempty"`
+}
+
+type RevisionDiffResponse struct {
+	From         int                   `json:"from"`
+	To           int                   `json:"to"`
+	Fields       []FieldChangeResponse `json:"fields"`
+	TagsAdded    []string              `json:"tagsAdded"`
+	TagsRemoved  []string              `json:"tagsRemoved"`
+	Ingredients  []ListChangeResponse  `json:"ingredients"`
+	Steps        []ListChangeResponse  `json:"steps"`
+	Dependencies []ListChangeResponse  `json:"dependencies"`
+}
+
+type FieldChangeResponse struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+type ListChangeResponse struct {
+	Change   string      `json:"change"`
+	Group    string      `json:"group,omitempty"`
+	Position int         `json:"position"`
+	From     interface{} `json:"from,omitempty"`
+	To       interface{} `json:"to,omitempty"`
+}
+
+func (r *RevisionResponse) SerializeRevision(model *RecipeRevisionModel, snapshot *RecipeSnapshot) {
+	r.Number = model.Number
+	r.Created = model.CreatedAt.Format("2006-01-02T15:04:05Z07:00")
+	r.Source = model.Source
+	r.RestoredFrom = model.RestoredFrom
+	r.Recipe = snapshot
+}
+
+func (r *RevisionDiffResponse) SerializeDiff(diff *RevisionDiff) {
+	r.From = diff.From
+	r.To = diff.To
+	r.TagsAdded = diff.TagsAdded
+	r.TagsRemoved = diff.TagsRemoved
+	r.Fields = make([]FieldChangeResponse, 0)
+	for _, field := range diff.Fields {
+		r.Fields = append(r.Fields, FieldChangeResponse{Field: field.Field, From: field.From, To: field.To})
+	}
+	r.Ingredients = serializeListChanges(diff.Ingredients)
+	r.Steps = serializeListChanges(diff.Steps)
+	r.Dependencies = serializeListChanges(diff.Dependencies)
+}
+
+func serializeListChanges(listChanges []ListChange) []ListChangeResponse {
+	changes := make([]ListChangeResponse, 0)
+	for _, listChange := range listChanges {
+		changes = append(changes, ListChangeResponse{
+			Change:   listChange.Change,
+			Group:    listChange.Group,
+			Position: listChange.Position,
+			From:     listChange.From,
+			To:       listChange.To,
+		})
+	}
+	return changes
+}
+
+type PublishedRecipeResponse struct {
+	ID          uint            `json:"id"`
+	Revision    int             `json:"revision"`
+	Version     int             `json:"version"`
+	PublishedAt string          `json:"publishedAt"`
+	Recipe      *RecipeSnapshot `json:"recipe"`
+}
+
+func (r *PublishedRecipeResponse) SerializePublished(model *RecipeModel, revision *RecipeRevisionModel, snapshot *RecipeSnapshot) {
+	r.ID = model.ID
+	r.Revision = revision.Number
+	r.Version = model.PublishedVersion
+	if model.PublishedAt != nil {
+		r.PublishedAt = model.PublishedAt.Format("2006-01-02T15:04:05Z07:00")
+	}
+	r.Recipe = snapshot
+}
+
+// ImportResponse is an imported draft. The embedded validator puts the recipe under
+// "recipe", in the shape RecipeCreate accepts.
+type ImportResponse struct {
+	RecipeValidator
+	Source      string `json:"source,omitempty"`
+	SourceImage string `json:"sourceImage,omitempty"`
+}
+
+func (r *ImportResponse) SerializeImport(imported *ImportedRecipe, source string) {
+	r.RecipeValidator = imported.Draft
+	r.Source = source
+	r.SourceImage = imported.SourceImage
+}
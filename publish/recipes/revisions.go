@@ -0,0 +1,452 @@
+package recipes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/anthonyhawkins/savorbook/database"
+	"gorm.io/gorm"
+	"strings"
+)
+
+const (
+	RevisionCreated  = "created"
+	RevisionUpdated  = "updated"
+	RevisionRestored = "restored"
+	RevisionMigrated = "migrated"
+)
+
+// RecipeRevisionModel is an immutable snapshot of a recipe, written every time the recipe is saved.
+type RecipeRevisionModel struct {
+	gorm.Model
+	RecipeID     uint `gorm:"uniqueIndex:idx_recipe_revision"`
+	Number       int  `gorm:"uniqueIndex:idx_recipe_revision"`
+	UserID       uint
+	Source       string
+	RestoredFrom *int
+	Snapshot     string `gorm:"type:jsonb"`
+}
+
+// RecipeSnapshot is the recipe as it was sent, in the same shape RecipeValidator
+// reads, so a revision can be restored by running it back through validation.
+type RecipeSnapshot struct {
+	Name             string                      `json:"name"`
+	Image            string                      `json:"image"`
+	Description      string                      `json:"description"`
+	PrepTime         string                      `json:"prepTime"`
+	Servings         string                      `json:"servings"`
+	Tags             []string                    `json:"tags"`
+	DependentRecipes []RecipeDependencyValidator `json:"dependentRecipes"`
+	IngredientGroups []IngredientGroupValidator  `json:"ingredientGroups"`
+	Steps            []StepValidator             `json:"steps"`
+}
+
+// snapshotOf leaves out child ids unless asked for them, revisions outlive the rows
+// they were taken from.
+func snapshotOf(model *RecipeModel, withIDs bool) RecipeSnapshot {
+	id := func(id uint) uint {
+		if withIDs {
+			return id
+		}
+		return 0
+	}
+
+	snapshot := RecipeSnapshot{
+		Name:             model.Name,
+		Image:            model.Image,
+		Description:      model.Description,
+		PrepTime:         model.PrepTime,
+		Servings:         model.Servings,
+		Tags:             make([]string, 0),
+		DependentRecipes: make([]RecipeDependencyValidator, 0),
+		IngredientGroups: make([]IngredientGroupValidator, 0),
+		Steps:            make([]StepValidator, 0),
+	}
+	for _, tag := range model.Tags {
+		snapshot.Tags = append(snapshot.Tags, tag.Tag)
+	}
+	for _, dependency := range model.DependentRecipes {
+		snapshot.DependentRecipes = append(snapshot.DependentRecipes, RecipeDependencyValidator{
+			DependentRecipe: dependency.DependentRecipe,
+			Qty:             dependency.Qty,
+		})
+	}
+	for _, group := range model.IngredientGroups {
+		groupSnapshot := IngredientGroupValidator{
+			ID:          id(group.ID),
+			GroupName:   group.GroupName,
+			Ingredients: make([]IngredientValidator, 0),
+		}
+		for _, ingredient := range group.Ingredients {
+			groupSnapshot.Ingredients = append(groupSnapshot.Ingredients, IngredientValidator{
+				ID:   id(ingredient.ID),
+				Name: ingredient.Name,
+				Qty:  ingredient.Qty,
+				Unit: ingredient.Unit,
+			})
+		}
+		snapshot.IngredientGroups = append(snapshot.IngredientGroups, groupSnapshot)
+	}
+	for _, step := range model.Steps {
+		stepSnapshot := StepValidator{
+			ID:         id(step.ID),
+			Type:       step.Type,
+			Text:       step.Text,
+			StepImages: make([]StepImageValidator, 0),
+		}
+		for _, stepImage := range step.StepImages {
+			stepSnapshot.StepImages = append(stepSnapshot.StepImages, StepImageValidator{
+				ID:    id(stepImage.ID),
+				Image: stepImage.Image,
+				Text:  stepImage.Text,
+			})
+		}
+		snapshot.Steps = append(snapshot.Steps, stepSnapshot)
+	}
+	return snapshot
+}
+
+// writeRevision numbers and stores a snapshot of the recipe inside the transaction
+// which saved it. Saving the recipe row has already locked it, so two saves of the
+// same recipe can't be handed the same number.
+func writeRevision(tx *gorm.DB, model *RecipeModel, source string) error {
+	data, err := json.Marshal(snapshotOf(model, false))
+	if err != nil {
+		return err
+	}
+
+	var latest int
+	result := tx.Model(&RecipeRevisionModel{}).Select("COALESCE(MAX(number), 0)").Where(
+		"recipe_id = ?", model.ID,
+	).Scan(&latest)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	revision := RecipeRevisionModel{
+		RecipeID: model.ID,
+		Number:   latest + 1,
+		UserID:   model.UserID,
+		Source:   source,
+		Snapshot: string(data),
+	}
+	if source == RevisionRestored {
+		revision.RestoredFrom = &model.restoredFrom
+	}
+	return tx.Create(&revision).Error
+}
+
+func (revision *RecipeRevisionModel) Recipe() (RecipeSnapshot, error) {
+	var snapshot RecipeSnapshot
+	err := json.Unmarshal([]byte(revision.Snapshot), &snapshot)
+	return snapshot, err
+}
+
+// RestoreValidator loads the revision into a RecipeValidator so it's checked like any other save.
+func (revision *RecipeRevisionModel) RestoreValidator() (*RecipeValidator, error) {
+	data, err := json.Marshal(map[string]json.RawMessage{
+		"recipe": json.RawMessage(revision.Snapshot),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	recipeValidator := NewRecipeValidator()
+	if err := json.Unmarshal(data, recipeValidator); err != nil {
+		return nil, err
+	}
+	recipeValidator.Model.restoredFrom = revision.Number
+	return recipeValidator, nil
+}
+
+func GetRevisions(recipeID string, userID uint) ([]RecipeRevisionModel, error) {
+	db := database.GetDB()
+	var revisions []RecipeRevisionModel
+
+	result := db.Select(
+		"id", "created_at", "recipe_id", "number", "user_id", "source", "restored_from",
+	).Where(map[string]interface{}{
+		"recipe_id": recipeID,
+		"user_id":   userID,
+	}).Order("number desc").Find(&revisions)
+
+	return revisions, result.Error
+}
+
+func GetRevision(recipeID string, number string, userID uint) (RecipeRevisionModel, error) {
+	db := database.GetDB()
+	var revision RecipeRevisionModel
+
+	result := db.Where(map[string]interface{}{
+		"recipe_id": recipeID,
+		"number":    number,
+		"user_id":   userID,
+	}).First(&revision)
+
+	return revision, result.Error
+}
+
+func GetLatestRevision(recipeID string, userID uint) (RecipeRevisionModel, error) {
+	db := database.GetDB()
+	var revision RecipeRevisionModel
+
+	result := db.Where(map[string]interface{}{
+		"recipe_id": recipeID,
+		"user_id":   userID,
+	}).Order("number desc").First(&revision)
+
+	return revision, result.Error
+}
+
+// MigrateRecipeRevisions gives recipes saved before revisions existed a first
+// revision of how they look now, so there is something to diff and restore to.
+func MigrateRecipeRevisions(db *gorm.DB) error {
+	var recipes []RecipeModel
+	result := db.Select("id", "user_id").Where(
+		"id NOT IN (?)", db.Model(&RecipeRevisionModel{}).Select("recipe_id"),
+	).FindInBatches(&recipes, 100, func(tx *gorm.DB, batch int) error {
+		for _, recipe := range recipes {
+			model, err := GetRecipeFull(fmt.Sprint(recipe.ID), recipe.UserID)
+			if err != nil {
+				return err
+			}
+			if err := writeRevision(db, &model, RevisionMigrated); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return result.Error
+}
+
+type FieldChange struct {
+	Field string
+	From  string
+	To    string
+}
+
+// ListChange is one entry added to, removed from or changed in a list, i.e. an ingredient or a step.
+type ListChange struct {
+	Change   string
+	Group    string
+	Position int
+	From     interface{}
+	To       interface{}
+}
+
+type RevisionDiff struct {
+	From         int
+	To           int
+	Fields       []FieldChange
+	TagsAdded    []string
+	TagsRemoved  []string
+	Ingredients  []ListChange
+	Steps        []ListChange
+	Dependencies []ListChange
+}
+
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeChanged = "changed"
+)
+
+var ErrSameRevision = errors.New("pick two different revisions to compare")
+
+func DiffRevisions(from *RecipeRevisionModel, to *RecipeRevisionModel) (RevisionDiff, error) {
+	diff := RevisionDiff{
+		From:         from.Number,
+		To:           to.Number,
+		Fields:       make([]FieldChange, 0),
+		TagsAdded:    make([]string, 0),
+		TagsRemoved:  make([]string, 0),
+		Ingredients:  make([]ListChange, 0),
+		Steps:        make([]ListChange, 0),
+		Dependencies: make([]ListChange, 0),
+	}
+	if from.Number == to.Number {
+		return diff, ErrSameRevision
+	}
+
+	before, err := from.Recipe()
+	if err != nil {
+		return diff, err
+	}
+	after, err := to.Recipe()
+	if err != nil {
+		return diff, err
+	}
+
+	fields := []struct {
+		name   string
+		before string
+		after  string
+	}{
+		{"name", before.Name, after.Name},
+		{"image", before.Image, after.Image},
+		{"description", before.Description, after.Description},
+		{"prepTime", before.PrepTime, after.PrepTime},
+		{"servings", before.Servings, after.Servings},
+	}
+	for _, field := range fields {
+		if field.before != field.after {
+			diff.Fields = append(diff.Fields, FieldChange{Field: field.name, From: field.before, To: field.after})
+		}
+	}
+
+	diff.TagsAdded, diff.TagsRemoved = diffSets(before.Tags, after.Tags)
+	diff.Ingredients = diffIngredients(before.IngredientGroups, after.IngredientGroups)
+	diff.Steps = diffSteps(before.Steps, after.Steps)
+	diff.Dependencies = diffDependencies(before.DependentRecipes, after.DependentRecipes)
+	return diff, nil
+}
+
+func diffSets(before []string, after []string) ([]string, []string) {
+	added, removed := make([]string, 0), make([]string, 0)
+	seen := make(map[string]bool)
+	for _, item := range before {
+		seen[item] = true
+	}
+	for _, item := range after {
+		if !seen[item] {
+			added = append(added, item)
+		}
+		delete(seen, item)
+	}
+	for _, item := range before {
+		if seen[item] {
+			removed = append(removed, item)
+		}
+	}
+	return added, removed
+}
+
+// diffIngredients matches ingredients by group and name, so moving an ingredient
+// within its group is not a change but a new amount for it is.
+func diffIngredients(before []IngredientGroupValidator, after []IngredientGroupValidator) []ListChange {
+	changes := make([]ListChange, 0)
+
+	type located struct {
+		group      string
+		position   int
+		ingredient IngredientValidator
+	}
+	key := func(group string, ingredient IngredientValidator) string {
+		return strings.ToLower(group) + "\x00" + strings.ToLower(strings.TrimSpace(ingredient.Name))
+	}
+
+	old := make(map[string]located)
+	var oldOrder []string
+	for _, group := range before {
+		for i, ingredient := range group.Ingredients {
+			k := key(group.GroupName, ingredient)
+			if _, ok := old[k]; !ok {
+				oldOrder = append(oldOrder, k)
+			}
+			old[k] = located{group.GroupName, i, ingredient}
+		}
+	}
+
+	for _, group := range after {
+		for i, ingredient := range group.Ingredients {
+			k := key(group.GroupName, ingredient)
+			previous, ok := old[k]
+			switch {
+			case !ok:
+				changes = append(changes, ListChange{Change: ChangeAdded, Group: group.GroupName, Position: i, To: ingredient})
+			case previous.ingredient != ingredient:
+				changes = append(changes, ListChange{Change: ChangeChanged, Group: group.GroupName, Position: i, From: previous.ingredient, To: ingredient})
+			}
+			delete(old, k)
+		}
+	}
+
+	for _, k := range oldOrder {
+		if previous, ok := old[k]; ok {
+			changes = append(changes, ListChange{Change: ChangeRemoved, Group: previous.group, Position: previous.position, From: previous.ingredient})
+		}
+	}
+	return changes
+}
+
+// diffSteps lines the two lists of steps up by their longest common run, so adding
+// a step near the top doesn't show every step after it as changed. A step removed
+// and another added in its place are reported as the one step changing.
+func diffSteps(before []StepValidator, after []StepValidator) []ListChange {
+	changes := make([]ListChange, 0)
+	same := func(a StepValidator, b StepValidator) bool {
+		return stepKey(a) == stepKey(b)
+	}
+
+	//lengths[i][j] is the longest common run of before[i:] and after[j:]
+	lengths := make([][]int, len(before)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(after)+1)
+	}
+	for i := len(before) - 1; i >= 0; i-- {
+		for j := len(after) - 1; j >= 0; j-- {
+			if same(before[i], after[j]) {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else if lengths[i+1][j] >= lengths[i][j+1] {
+				lengths[i][j] = lengths[i+1][j]
+			} else {
+				lengths[i][j] = lengths[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(before) || j < len(after) {
+		switch {
+		case i < len(before) && j < len(after) && same(before[i], after[j]):
+			i++
+			j++
+		case i < len(before) && j < len(after) && lengths[i+1][j] == lengths[i][j+1]:
+			changes = append(changes, ListChange{Change: ChangeChanged, Position: j, From: before[i], To: after[j]})
+			i++
+			j++
+		case j < len(after) && (i == len(before) || lengths[i][j+1] >= lengths[i+1][j]):
+			changes = append(changes, ListChange{Change: ChangeAdded, Position: j, To: after[j]})
+			j++
+		default:
+			changes = append(changes, ListChange{Change: ChangeRemoved, Position: i, From: before[i]})
+			i++
+		}
+	}
+	return changes
+}
+
+func stepKey(step StepValidator) string {
+	parts := []string{step.Type, step.Text}
+	for _, image := range step.StepImages {
+		parts = append(parts, image.Image, image.Text)
+	}
+	return strings.Join(parts, "\x00")
+}
+
+func diffDependencies(before []RecipeDependencyValidator, after []RecipeDependencyValidator) []ListChange {
+	changes := make([]ListChange, 0)
+
+	old := make(map[uint]RecipeDependencyValidator)
+	for _, dependency := range before {
+		old[dependency.DependentRecipe] = dependency
+	}
+
+	for i, dependency := range after {
+		previous, ok := old[dependency.DependentRecipe]
+		switch {
+		case !ok:
+			changes = append(changes, ListChange{Change: ChangeAdded, Position: i, To: dependency})
+		case previous.Qty != dependency.Qty:
+			changes = append(changes, ListChange{Change: ChangeChanged, Position: i, From: previous, To: dependency})
+		}
+		delete(old, dependency.DependentRecipe)
+	}
+
+	for i, dependency := range before {
+		if _, ok := old[dependency.DependentRecipe]; ok {
+			changes = append(changes, ListChange{Change: ChangeRemoved, Position: i, From: dependency})
+		}
+	}
+	return changes
+}
@@ -0,0 +1,234 @@
+package recipes
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SchemaRecipe is a published recipe as schema.org Recipe JSON-LD, which search
+// engines read for rich results.
+type SchemaRecipe struct {
+	Context            string         `json:"@context"`
+	Type               string         `json:"@type"`
+	Name               string         `json:"name"`
+	Description        string         `json:"description,omitempty"`
+	Image              []string       `json:"image,omitempty"`
+	Author             *SchemaPerson  `json:"author,omitempty"`
+	DatePublished      string         `json:"datePublished,omitempty"`
+	DateModified       string         `json:"dateModified,omitempty"`
+	TotalTime          string         `json:"totalTime,omitempty"`
+	RecipeYield        []string       `json:"recipeYield,omitempty"`
+	Keywords           string         `json:"keywords,omitempty"`
+	RecipeIngredient   []string       `json:"recipeIngredient"`
+	RecipeInstructions []interface{}  `json:"recipeInstructions"`
+	URL                string         `json:"url,omitempty"`
+	MainEntityOfPage   *SchemaWebPage `json:"mainEntityOfPage,omitempty"`
+}
+
+type SchemaPerson struct {
+	Type string `json:"@type"`
+	Name string `json:"name"`
+}
+
+type SchemaWebPage struct {
+	Type string `json:"@type"`
+	ID   string `json:"@id"`
+}
+
+type SchemaSection struct {
+	Type            string       `json:"@type"`
+	Name            string       `json:"name"`
+	ItemListElement []SchemaStep `json:"itemListElement"`
+}
+
+// SchemaStep is a HowToStep. A tip written after a step is kept with it, the step's
+// text then moves into a HowToDirection alongside the HowToTip.
+type SchemaStep struct {
+	Type            string            `json:"@type"`
+	Text            string            `json:"text"`
+	URL             string            `json:"url,omitempty"`
+	Image           []string          `json:"image,omitempty"`
+	ItemListElement []SchemaHowToItem `json:"itemListElement,omitempty"`
+}
+
+// SchemaHowToItem is a HowToDirection or HowToTip within a step.
+type SchemaHowToItem struct {
+	Type string `json:"@type"`
+	Text string `json:"text"`
+}
+
+// PublishedDependency is a recipe this one depends on, as its readers see it.
+type PublishedDependency struct {
+	Qty    string
+	Recipe RecipeSnapshot
+}
+
+// SchemaPage is where a recipe is shown. Image references are resolved against
+// BaseURL as schema.org and link previews need absolute urls.
+type SchemaPage struct {
+	URL           string
+	BaseURL       string
+	Author        string
+	DatePublished *time.Time
+	DateModified  time.Time
+}
+
+// GetPublishedSnapshot returns the revision of a recipe its readers see, or
+// gorm.ErrRecordNotFound if the recipe isn't published.
+func GetPublishedSnapshot(recipeID string, userID uint) (RecipeModel, RecipeRevisionModel, RecipeSnapshot, error) {
+	model, revision, err := GetPublishedRecipe(recipeID, userID)
+	if err != nil {
+		return model, revision, RecipeSnapshot{}, err
+	}
+	snapshot, err := revision.Recipe()
+	return model, revision, snapshot, err
+}
+
+// GetPublishedDependencies loads the published recipes a snapshot depends on.
+// Dependencies the author hasn't published are left out, readers can't see them.
+func GetPublishedDependencies(snapshot *RecipeSnapshot, userID uint) ([]PublishedDependency, error) {
+	dependencies := make([]PublishedDependency, 0)
+	for _, dependency := range snapshot.DependentRecipes {
+		_, _, recipe, err := GetPublishedSnapshot(strconv.FormatUint(uint64(dependency.DependentRecipe), 10), userID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return dependencies, err
+		}
+		dependencies = append(dependencies, PublishedDependency{Qty: dependency.Qty, Recipe: recipe})
+	}
+	return dependencies, nil
+}
+
+// NewSchemaRecipe maps a published recipe onto schema.org. Each published dependency
+// becomes a HowToSection of its own steps, ahead of a section for the recipe's
+// steps, so the whole method is there for anyone cooking from the page.
+func NewSchemaRecipe(snapshot *RecipeSnapshot, dependencies []PublishedDependency, page SchemaPage) SchemaRecipe {
+	schema := SchemaRecipe{
+		Context:            "https://schema.org",
+		Type:               "Recipe",
+		Name:               snapshot.Name,
+		Description:        snapshot.Description,
+		Keywords:           strings.Join(snapshot.Tags, ", "),
+		RecipeIngredient:   make([]string, 0),
+		RecipeInstructions: make([]interface{}, 0),
+		URL:                page.URL,
+	}
+
+	if image := resolveURL(page.BaseURL, snapshot.Image); image != "" {
+		schema.Image = []string{image}
+	}
+	if page.Author != "" {
+		schema.Author = &SchemaPerson{Type: "Person", Name: page.Author}
+	}
+	if page.DatePublished != nil {
+		schema.DatePublished = page.DatePublished.UTC().Format(time.RFC3339)
+	}
+	if !page.DateModified.IsZero() {
+		schema.DateModified = page.DateModified.UTC().Format(time.RFC3339)
+	}
+	if page.URL != "" {
+		schema.MainEntityOfPage = &SchemaWebPage{Type: "WebPage", ID: page.URL}
+	}
+	//PrepTime is the time the whole recipe takes, it's what recipe search filters on
+	if minutes, ok := ParseMinutes(snapshot.PrepTime); ok && minutes > 0 {
+		schema.TotalTime = FormatISODuration(minutes)
+	}
+	schema.RecipeYield = SchemaYield(snapshot.Servings)
+
+	for _, dependency := range dependencies {
+		schema.RecipeIngredient = append(schema.RecipeIngredient, IngredientLine(dependency.Qty, "", dependency.Recipe.Name))
+	}
+	for _, group := range snapshot.IngredientGroups {
+		for _, ingredient := range group.Ingredients {
+			schema.RecipeIngredient = append(schema.RecipeIngredient, IngredientLine(ingredient.Qty, ingredient.Unit, ingredient.Name))
+		}
+	}
+
+	if len(dependencies) == 0 {
+		for _, step := range schemaSteps(snapshot.Steps, page, "step") {
+			schema.RecipeInstructions = append(schema.RecipeInstructions, step)
+		}
+		return schema
+	}
+	for i, dependency := range dependencies {
+		schema.RecipeInstructions = append(schema.RecipeInstructions, SchemaSection{
+			Type:            "HowToSection",
+			Name:            dependency.Recipe.Name,
+			ItemListElement: schemaSteps(dependency.Recipe.Steps, page, fmt.Sprintf("dependency-%d-step", i+1)),
+		})
+	}
+	schema.RecipeInstructions = append(schema.RecipeInstructions, SchemaSection{
+		Type:            "HowToSection",
+		Name:            snapshot.Name,
+		ItemListElement: schemaSteps(snapshot.Steps, page, "step"),
+	})
+	return schema
+}
+
+// schemaSteps numbers steps from 1 with anchors, i.e. #step-2, that match the
+// recipe page so search results can link to a step.
+func schemaSteps(steps []StepValidator, page SchemaPage, anchor string) []SchemaStep {
+	schemaSteps := make([]SchemaStep, 0)
+	for _, step := range steps {
+		text := strings.TrimSpace(step.Text)
+		if text == "" {
+			continue
+		}
+
+		if step.Type == "tipText" && len(schemaSteps) > 0 {
+			previous := &schemaSteps[len(schemaSteps)-1]
+			if len(previous.ItemListElement) == 0 {
+				previous.ItemListElement = append(previous.ItemListElement, SchemaHowToItem{Type: "HowToDirection", Text: previous.Text})
+			}
+			previous.ItemListElement = append(previous.ItemListElement, SchemaHowToItem{Type: "HowToTip", Text: text})
+			continue
+		}
+
+		schemaStep := SchemaStep{Type: "HowToStep", Text: text}
+		if page.URL != "" {
+			schemaStep.URL = fmt.Sprintf("%s#%s-%d", page.URL, anchor, len(schemaSteps)+1)
+		}
+		for _, image := range step.StepImages {
+			if src := resolveURL(page.BaseURL, image.Image); src != "" {
+				schemaStep.Image = append(schemaStep.Image, src)
+			}
+		}
+		schemaSteps = append(schemaSteps, schemaStep)
+	}
+	return schemaSteps
+}
+
+// SchemaYield gives the number of servings ahead of the servings as written,
+// i.e. "4 to 6 people" becomes ["4", "4 to 6 people"].
+func SchemaYield(servings string) []string {
+	servings = strings.TrimSpace(servings)
+	if servings == "" {
+		return nil
+	}
+	quantity, rest, ok := parseLeadingQuantity(servings)
+	if !ok {
+		return []string{servings}
+	}
+	count := strconv.FormatFloat(quantity.Min, 'f', -1, 64)
+	if strings.TrimSpace(rest) == "" && count == servings {
+		return []string{servings}
+	}
+	return []string{count, servings}
+}
+
+// IngredientLine writes an ingredient the way it's read, i.e. "1 1/2 cups flour".
+func IngredientLine(qty string, unit string, name string) string {
+	var parts []string
+	for _, part := range []string{qty, unit, name} {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,246 @@
+package recipes
+
+import (
+	"github.com/anthonyhawkins/savorbook/database"
+	"gorm.io/gorm"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const SearchConfig = "english"
+
+// recipe_models carries two tsvectors which gorm never reads or writes:
+//
+// search_vector  name (A), tags (B), ingredient names (C) and description (D)
+// step_vector    the text of every step
+//
+// Postgres only has four weights, so step text lives in its own vector and is
+// ranked at a fraction of the lowest weight. Both are rebuilt from the saved rows
+// by refreshSearchIndex whenever a recipe is saved.
+const searchVectorSQL = `
+setweight(to_tsvector('` + SearchConfig + `', coalesce(recipe_models.name, '')), 'A') ||
+setweight(to_tsvector('` + SearchConfig + `', coalesce((
+	SELECT string_agg(tag_models.tag, ' ') FROM tag_models
+	WHERE tag_models.recipe_id = recipe_models.id AND tag_models.deleted_at IS NULL
+), '')), 'B') ||
+setweight(to_tsvector('` + SearchConfig + `', coalesce((
+	SELECT string_agg(ingredient_models.name, ' ') FROM ingredient_models
+	JOIN ingredient_group_models ON ingredient_group_models.id = ingredient_models.ingredient_group_id
+	WHERE ingredient_group_models.recipe_id = recipe_models.id
+	AND ingredient_group_models.deleted_at IS NULL AND ingredient_models.deleted_at IS NULL
+), '')), 'C') ||
+setweight(to_tsvector('` + SearchConfig + `', coalesce(recipe_models.description, '')), 'D')`
+
+const stepVectorSQL = `
+to_tsvector('` + SearchConfig + `', coalesce((
+	SELECT string_agg(step_models.text, ' ') FROM step_models
+	WHERE step_models.recipe_id = recipe_models.id AND step_models.deleted_at IS NULL
+), ''))`
+
+// stepTextSQL is the text snippets are cut from when the description alone has no match.
+const stepTextSQL = `coalesce((
+	SELECT string_agg(step_models.text, ' ' ORDER BY step_models.id) FROM step_models
+	WHERE step_models.recipe_id = recipe_models.id AND step_models.deleted_at IS NULL
+), '')`
+
+// rankSQL weighs D, C, B and A, in the order ts_rank expects them, then adds step matches at a tenth of D.
+const rankSQL = `ts_rank('{0.2, 0.4, 0.7, 1.0}', recipe_models.search_vector, query) + ` +
+	`0.02 * ts_rank(recipe_models.step_vector, query)`
+
+const headlineOptions = `StartSel=<mark>, StopSel=</mark>, MaxWords=30, MinWords=12, MaxFragments=2, FragmentDelimiter=" … "`
+
+func MigrateSearchIndex(db *gorm.DB) error {
+	statements := []string{
+		`ALTER TABLE recipe_models ADD COLUMN IF NOT EXISTS search_vector tsvector`,
+		`ALTER TABLE recipe_models ADD COLUMN IF NOT EXISTS step_vector tsvector`,
+		`CREATE INDEX IF NOT EXISTS idx_recipe_models_search_vector ON recipe_models USING GIN (search_vector)`,
+		`CREATE INDEX IF NOT EXISTS idx_recipe_models_step_vector ON recipe_models USING GIN (step_vector)`,
+		`UPDATE recipe_models SET search_vector = ` + searchVectorSQL + `, step_vector = ` + stepVectorSQL +
+			` WHERE search_vector IS NULL`,
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+
+	var recipes []RecipeModel
+	result := db.Select("id", "prep_time").Where("prep_minutes IS NULL AND prep_time <> ''").FindInBatches(&recipes, 500, func(tx *gorm.DB, batch int) error {
+		for _, recipe := range recipes {
+			recipe.setPrepMinutes()
+			if recipe.PrepMinutes == nil {
+				continue
+			}
+			if err := db.Model(&RecipeModel{}).Where("id = ?", recipe.ID).Update("prep_minutes", recipe.PrepMinutes).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return result.Error
+}
+
+// refreshSearchIndex rebuilds the recipe's search vectors from what tx has saved so far.
+func refreshSearchIndex(tx *gorm.DB, recipeID uint) error {
+	return tx.Exec(
+		`UPDATE recipe_models SET search_vector = `+searchVectorSQL+`, step_vector = `+stepVectorSQL+` WHERE id = ?`,
+		recipeID,
+	).Error
+}
+
+func (model *RecipeModel) setPrepMinutes() {
+	model.PrepMinutes = nil
+	if minutes, ok := ParseMinutes(model.PrepTime); ok {
+		model.PrepMinutes = &minutes
+	}
+}
+
+type SearchOptions struct {
+	Query string
+	//Tags must all be present, unless AnyTag is set
+	Tags           []string
+	AnyTag         bool
+	Ingredients    []string
+	MaxPrepMinutes int
+	Statuses       []string
+	PageNum        string
+	PageSize       string
+}
+
+type SearchResult struct {
+	Recipe      RecipeModel
+	Rank        float64
+	NameSnippet string
+	Snippet     string
+}
+
+type searchRow struct {
+	ID          uint
+	Rank        float64
+	NameSnippet string
+	Snippet     string
+}
+
+var searchTerm = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+// PrefixQuery turns what was typed into a tsquery where every word has to match
+// and the last word may be half typed, so "choc chip cook" finds chocolate chip
+// cookies. Only letters and digits are kept so user input can never break the
+// tsquery syntax.
+func PrefixQuery(text string) string {
+	text = strings.NewReplacer("'", "", "’", "").Replace(strings.ToLower(text))
+	terms := searchTerm.FindAllString(text, -1)
+	for i := range terms {
+		terms[i] += ":*"
+	}
+	return strings.Join(terms, " & ")
+}
+
+func SearchRecipes(userID uint, options SearchOptions) ([]SearchResult, error) {
+	db := database.GetDB()
+	results := make([]SearchResult, 0)
+
+	query := db.Model(&RecipeModel{}).Scopes(
+		database.Paginate(options.PageNum, options.PageSize), ByStatus("recipe_models", options.Statuses),
+	).Where(
+		"recipe_models.user_id = ?", userID,
+	)
+
+	terms := PrefixQuery(options.Query)
+	if terms != "" {
+		query = query.Select(
+			"recipe_models.id, "+rankSQL+" AS rank, "+
+				"ts_headline('"+SearchConfig+"', recipe_models.name, query, 'HighlightAll=true') AS name_snippet, "+
+				"ts_headline('"+SearchConfig+"', CASE WHEN to_tsvector('"+SearchConfig+"', recipe_models.description) @@ query "+
+				"THEN recipe_models.description ELSE "+stepTextSQL+" END, query, '"+headlineOptions+"') AS snippet",
+		).Joins(
+			"CROSS JOIN to_tsquery('"+SearchConfig+"', ?) AS query", terms,
+		).Where(
+			"(recipe_models.search_vector @@ query OR recipe_models.step_vector @@ query)",
+		).Order("rank DESC").Order("recipe_models.name")
+	} else {
+		query = query.Select("recipe_models.id").Order("recipe_models.name")
+	}
+
+	if len(options.Tags) > 0 {
+		tagged := db.Model(&TagModel{}).Select("recipe_id").Where("user_id = ? AND tag IN ?", userID, options.Tags)
+		if !options.AnyTag {
+			tagged = tagged.Group("recipe_id").Having("COUNT(DISTINCT tag) = ?", len(options.Tags))
+		}
+		query = query.Where("recipe_models.id IN (?)", tagged)
+	}
+
+	for _, ingredient := range options.Ingredients {
+		query = query.Where("recipe_models.id IN (?)", db.Model(&IngredientGroupModel{}).Select(
+			"ingredient_group_models.recipe_id",
+		).Joins(
+			"JOIN ingredient_models ON ingredient_models.ingredient_group_id = ingredient_group_models.id AND ingredient_models.deleted_at IS NULL",
+		).Where("ingredient_models.name ILIKE ?", "%"+escapeLike(ingredient)+"%"))
+	}
+
+	if options.MaxPrepMinutes > 0 {
+		query = query.Where("recipe_models.prep_minutes <= ?", options.MaxPrepMinutes)
+	}
+
+	var rows []searchRow
+	if err := query.Scan(&rows).Error; err != nil {
+		return results, err
+	}
+	if len(rows) == 0 {
+		return results, nil
+	}
+
+	var ids []uint
+	for _, row := range rows {
+		ids = append(ids, row.ID)
+	}
+
+	var recipes []RecipeModel
+	err := db.Select(listSelects).Preload("Tags", func(db *gorm.DB) *gorm.DB {
+		return db.Order("tag_models.tag")
+	}).Find(&recipes, ids).Error
+	if err != nil {
+		return results, err
+	}
+
+	byID := make(map[uint]RecipeModel)
+	for _, recipe := range recipes {
+		byID[recipe.ID] = recipe
+	}
+	for _, row := range rows {
+		results = append(results, SearchResult{
+			Recipe:      byID[row.ID],
+			Rank:        row.Rank,
+			NameSnippet: row.NameSnippet,
+			Snippet:     row.Snippet,
+		})
+	}
+	return results, nil
+}
+
+func escapeLike(text string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(text)
+}
+
+// ParseSearchList splits a comma separated query parameter, dropping blanks.
+func ParseSearchList(text string) []string {
+	var items []string
+	for _, item := range strings.Split(text, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// ParseMaxPrep accepts minutes or anything ParseMinutes understands, i.e. "90" or "1h30m".
+func ParseMaxPrep(text string) (int, bool) {
+	if text == "" {
+		return 0, true
+	}
+	if minutes, err := strconv.Atoi(text); err == nil {
+		return minutes, minutes >= 0
+	}
+	return ParseMinutes(text)
+}
@@ -0,0 +1,188 @@
+package recipes
+
+import (
+	"errors"
+	"github.com/anthonyhawkins/savorbook/database"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strings"
+	"time"
+)
+
+const (
+	StatusDraft     = "draft"
+	StatusPublished = "published"
+	StatusArchived  = "archived"
+)
+
+var ErrInvalidStatus = errors.New("status must be draft, published, archived or all")
+
+// listSelects are the columns recipe lists load, enough for a card.
+var listSelects = []string{
+	"id", "user_id", "name", "image", "description", "prep_time", "servings",
+	"version", "status", "published_revision", "published_version", "published_at",
+}
+
+// ParseStatus reads a comma separated status filter for a list. Archived recipes are
+// put away, so leaving the filter out lists drafts and published recipes only; "all"
+// lists everything.
+func ParseStatus(text string) ([]string, error) {
+	text = strings.ToLower(strings.TrimSpace(text))
+	if text == "" {
+		return []string{StatusDraft, StatusPublished}, nil
+	}
+	if text == "all" {
+		return nil, nil
+	}
+
+	var statuses []string
+	for _, status := range ParseSearchList(text) {
+		if status != StatusDraft && status != StatusPublished && status != StatusArchived {
+			return nil, ErrInvalidStatus
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// ByStatus limits a query on table to the given statuses, or leaves it alone for none.
+func ByStatus(table string, statuses []string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if len(statuses) == 0 {
+			return db
+		}
+		return db.Where(table+".status IN ?", statuses)
+	}
+}
+
+// HasUnpublishedChanges is true once a published recipe has been edited since it was published.
+func (model *RecipeModel) HasUnpublishedChanges() bool {
+	return model.Status == StatusPublished && model.Version != model.PublishedVersion
+}
+
+// loadStatus reads back the lifecycle columns, which saving the recipe's content never touches.
+func (model *RecipeModel) loadStatus(tx *gorm.DB) error {
+	return tx.Model(&RecipeModel{}).Select(
+		"status", "published_revision", "published_version", "published_at",
+	).Where("id = ?", model.ID).Scan(model).Error
+}
+
+// PublishRecipe makes the recipe's latest revision its published version. Revisions
+// are never changed once written, so readers keep seeing exactly what was published
+// while the author carries on editing the draft; publishing again moves them on to
+// the newest revision. A non-zero version is the version the author reviewed.
+func PublishRecipe(recipeID string, userID uint, version int) error {
+	db := database.GetDB()
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		model, err := lockRecipe(tx, recipeID, userID, version)
+		if err != nil {
+			return err
+		}
+
+		var revision RecipeRevisionModel
+		err = tx.Where("recipe_id = ?", model.ID).Order("number desc").First(&revision).Error
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		return tx.Model(&model).Select(
+			"Status", "PublishedRevision", "PublishedVersion", "PublishedAt",
+		).Updates(&RecipeModel{
+			Status:            StatusPublished,
+			PublishedRevision: &revision.Number,
+			PublishedVersion:  model.Version,
+			PublishedAt:       &now,
+		}).Error
+	})
+}
+
+// UnpublishRecipe takes the recipe back to a draft, which also brings an archived recipe back out.
+func UnpublishRecipe(recipeID string, userID uint, version int) error {
+	return withdrawRecipe(recipeID, userID, version, StatusDraft)
+}
+
+func ArchiveRecipe(recipeID string, userID uint, version int) error {
+	return withdrawRecipe(recipeID, userID, version, StatusArchived)
+}
+
+func withdrawRecipe(recipeID string, userID uint, version int, status string) error {
+	db := database.GetDB()
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		model, err := lockRecipe(tx, recipeID, userID, version)
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&model).Select(
+			"Status", "PublishedRevision", "PublishedVersion", "PublishedAt",
+		).Updates(&RecipeModel{Status: status}).Error
+	})
+}
+
+// lockRecipe holds the recipe row until the transaction ends so a save can't slip in between checking and publishing.
+func lockRecipe(tx *gorm.DB, recipeID string, userID uint, version int) (RecipeModel, error) {
+	var model RecipeModel
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "user_id", "version").Where(map[string]interface{}{
+		"id":      recipeID,
+		"user_id": userID,
+	}).First(&model).Error
+	if err != nil {
+		return model, err
+	}
+	if version != 0 && model.Version != version {
+		return model, database.ErrVersionConflict
+	}
+	return model, nil
+}
+
+// GetPublishedRecipe returns the revision readers see, or gorm.ErrRecordNotFound if the recipe isn't published.
+func GetPublishedRecipe(recipeID string, userID uint) (RecipeModel, RecipeRevisionModel, error) {
+	db := database.GetDB()
+	var model RecipeModel
+	var revision RecipeRevisionModel
+
+	result := db.Select(listSelects).Where(map[string]interface{}{
+		"id":      recipeID,
+		"user_id": userID,
+		"status":  StatusPublished,
+	}).First(&model)
+	if result.Error != nil {
+		return model, revision, result.Error
+	}
+	if model.PublishedRevision == nil {
+		return model, revision, gorm.ErrRecordNotFound
+	}
+
+	result = db.Where(map[string]interface{}{
+		"recipe_id": model.ID,
+		"number":    *model.PublishedRevision,
+	}).First(&revision)
+
+	return model, revision, result.Error
+}
+
+// RevisionToPublish is the revision of a recipe that goes into a published cookbook:
+// its published revision if it has one, otherwise the latest, so the cookbook
+// shows what the author has already put out where there is something.
+func RevisionToPublish(tx *gorm.DB, recipeID uint, userID uint) (RecipeRevisionModel, error) {
+	var model RecipeModel
+	var revision RecipeRevisionModel
+
+	err := tx.Select("id", "status", "published_revision").Where(map[string]interface{}{
+		"id":      recipeID,
+		"user_id": userID,
+	}).First(&model).Error
+	if err != nil {
+		return revision, err
+	}
+
+	query := tx.Where("recipe_id = ?", model.ID)
+	if model.Status == StatusPublished && model.PublishedRevision != nil {
+		query = query.Where("number = ?", *model.PublishedRevision)
+	}
+	err = query.Order("number desc").First(&revision).Error
+	return revision, err
+}
@@ -0,0 +1,166 @@
+package recipes
+
+import (
+	"strings"
+)
+
+type UnitKind string
+
+const (
+	Volume      UnitKind = "volume"
+	Mass        UnitKind = "mass"
+	Count       UnitKind = "count"
+	Temperature UnitKind = "temperature"
+)
+
+const (
+	Metric   = "metric"
+	Imperial = "imperial"
+)
+
+// Unit is a canonical unit of measure. Factor converts an amount into the base
+// unit of its kind: millilitres for volume and grams for mass. Count units are
+// only ever compared with themselves, a clove is not a can. Units without a
+// System, like spoons and pinches, are used by metric and imperial kitchens alike.
+type Unit struct {
+	Name    string
+	Kind    UnitKind
+	System  string
+	Factor  float64
+	Aliases []string
+}
+
+var unitRegistry = []Unit{
+	//volume
+	{Name: "ml", Kind: Volume, System: Metric, Factor: 1, Aliases: []string{"milliliter", "milliliters", "millilitre", "millilitres", "mls", "cc"}},
+	{Name: "cl", Kind: Volume, System: Metric, Factor: 10, Aliases: []string{"centiliter", "centiliters", "centilitre", "centilitres"}},
+	{Name: "dl", Kind: Volume, System: Metric, Factor: 100, Aliases: []string{"deciliter", "deciliters", "decilitre", "decilitres"}},
+	{Name: "l", Kind: Volume, System: Metric, Factor: 1000, Aliases: []string{"liter", "liters", "litre", "litres", "lt", "ltr"}},
+	{Name: "pinch", Kind: Volume, Factor: 0.31, Aliases: []string{"pinches"}},
+	{Name: "dash", Kind: Volume, Factor: 0.62, Aliases: []string{"dashes"}},
+	{Name: "tsp", Kind: Volume, Factor: 4.92892, Aliases: []string{"teaspoon", "teaspoons", "tsps", "ts"}},
+	{Name: "tbsp", Kind: Volume, Factor: 14.7868, Aliases: []string{"tablespoon", "tablespoons", "tbsps", "tbs", "tbl", "tbls", "tblsp"}},
+	{Name: "fl oz", Kind: Volume, System: Imperial, Factor: 29.5735, Aliases: []string{"fluid ounce", "fluid ounces", "floz", "fl. oz", "fl.oz"}},
+	{Name: "cup", Kind: Volume, System: Imperial, Factor: 236.588, Aliases: []string{"cups", "c"}},
+	{Name: "pint", Kind: Volume, System: Imperial, Factor: 473.176, Aliases: []string{"pints", "pt", "pts"}},
+	{Name: "quart", Kind: Volume, System: Imperial, Factor: 946.353, Aliases: []string{"quarts", "qt", "qts"}},
+	{Name: "gallon", Kind: Volume, System: Imperial, Factor: 3785.41, Aliases: []string{"gallons", "gal", "gals"}},
+
+	//mass
+	{Name: "mg", Kind: Mass, System: Metric, Factor: 0.001, Aliases: []string{"milligram", "milligrams", "milligramme", "milligrammes"}},
+	{Name: "g", Kind: Mass, System: Metric, Factor: 1, Aliases: []string{"gram", "grams", "gramme", "grammes", "gr", "grm"}},
+	{Name: "kg", Kind: Mass, System: Metric, Factor: 1000, Aliases: []string{"kilogram", "kilograms", "kilogramme", "kilogrammes", "kilo", "kilos", "kgs"}},
+	{Name: "oz", Kind: Mass, System: Imperial, Factor: 28.3495, Aliases: []string{"ounce", "ounces", "ozs"}},
+	{Name: "lb", Kind: Mass, System: Imperial, Factor: 453.592, Aliases: []string{"pound", "pounds", "lbs", "#"}},
+
+	//count
+	{Name: "piece", Kind: Count, Factor: 1, Aliases: []string{"pieces", "pc", "pcs", "each", "ea", "whole"}},
+	{Name: "clove", Kind: Count, Factor: 1, Aliases: []string{"cloves"}},
+	{Name: "slice", Kind: Count, Factor: 1, Aliases: []string{"slices"}},
+	{Name: "can", Kind: Count, Factor: 1, Aliases: []string{"cans", "tin", "tins"}},
+	{Name: "package", Kind: Count, Factor: 1, Aliases: []string{"packages", "pkg", "pkgs", "packet", "packets"}},
+	{Name: "bunch", Kind: Count, Factor: 1, Aliases: []string{"bunches"}},
+	{Name: "sprig", Kind: Count, Factor: 1, Aliases: []string{"sprigs"}},
+	{Name: "stick", Kind: Count, Factor: 1, Aliases: []string{"sticks"}},
+	{Name: "head", Kind: Count, Factor: 1, Aliases: []string{"heads"}},
+	{Name: "leaf", Kind: Count, Factor: 1, Aliases: []string{"leaves"}},
+	{Name: "handful", Kind: Count, Factor: 1, Aliases: []string{"handfuls"}},
+
+	//temperature, converted with ConvertTemperature rather than Factor
+	{Name: "°C", Kind: Temperature, System: Metric, Aliases: []string{"c°", "celsius", "centigrade", "degc", "deg c", "degrees c", "degrees celsius"}},
+	{Name: "°F", Kind: Temperature, System: Imperial, Aliases: []string{"f°", "fahrenheit", "degf", "deg f", "degrees f", "degrees fahrenheit"}},
+}
+
+var unitAliases = buildUnitAliases()
+
+func buildUnitAliases() map[string]Unit {
+	aliases := make(map[string]Unit)
+	for _, unit := range unitRegistry {
+		aliases[strings.ToLower(unit.Name)] = unit
+		for _, alias := range unit.Aliases {
+			aliases[alias] = unit
+		}
+	}
+	return aliases
+}
+
+// LookupUnit finds the canonical unit for free-form unit text, i.e. "Tbsp.",
+// "tablespoons" and "T" are all tbsp. A lone "T" and "t" follow the usual recipe
+// convention of tablespoon and teaspoon, which is why they are checked before
+// the text is lower cased.
+func LookupUnit(text string) (Unit, bool) {
+	text = strings.TrimSpace(text)
+	switch text {
+	case "T", "Tb", "TB":
+		return unitAliases["tbsp"], true
+	case "t":
+		return unitAliases["tsp"], true
+	}
+
+	normalized := strings.ToLower(strings.TrimSuffix(text, "."))
+	normalized = strings.Join(strings.Fields(normalized), " ")
+	if unit, ok := unitAliases[normalized]; ok {
+		return unit, true
+	}
+	if unit, ok := unitAliases[strings.TrimPrefix(normalized, "°")]; ok {
+		return unit, true
+	}
+	return Unit{}, false
+}
+
+func GetUnit(name string) (Unit, bool) {
+	for _, unit := range unitRegistry {
+		if unit.Name == name {
+			return unit, true
+		}
+	}
+	return Unit{}, false
+}
+
+// ConvertAmount converts between units of the same kind, count units only convert to themselves.
+func ConvertAmount(amount float64, from Unit, to Unit) (float64, bool) {
+	if from.Name == to.Name {
+		return amount, true
+	}
+	if from.Kind != to.Kind || from.Kind == Count {
+		return 0, false
+	}
+	if from.Kind == Temperature {
+		return ConvertTemperature(amount, from, to), true
+	}
+	return amount * from.Factor / to.Factor, true
+}
+
+func ConvertTemperature(degrees float64, from Unit, to Unit) float64 {
+	switch {
+	case from.Name == "°F" && to.Name == "°C":
+		return (degrees - 32) * 5 / 9
+	case from.Name == "°C" && to.Name == "°F":
+		return degrees*9/5 + 32
+	}
+	return degrees
+}
+
+// ParseAmount reads the numeric amount and canonical unit out of an ingredient's
+// free-form qty and unit. A unit written into the qty, i.e. "2 cups", is used
+// when no unit was given separately.
+func ParseAmount(qty string, unitText string) (*Quantity, *Unit) {
+	quantity, rest, ok := parseLeadingQuantity(qty)
+	if ok && strings.TrimSpace(rest) != "" && strings.TrimSpace(unitText) == "" {
+		unitText = rest
+	} else if ok && strings.TrimSpace(rest) != "" {
+		ok = false
+	}
+
+	var parsedQuantity *Quantity
+	if ok {
+		parsedQuantity = &quantity
+	}
+
+	var parsedUnit *Unit
+	if unit, found := LookupUnit(unitText); found {
+		parsedUnit = &unit
+	}
+
+	return parsedQuantity, parsedUnit
+}
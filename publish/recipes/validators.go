@@ -1,6 +1,10 @@
 package recipes
 
-import "github.com/go-playground/validator/v10"
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+)
 
 type RecipeValidator struct {
 	Recipe struct {
@@ -13,6 +17,7 @@ type RecipeValidator struct {
 		DependentRecipes []RecipeDependencyValidator `json:"dependentRecipes"`
 		IngredientGroups []IngredientGroupValidator  `json:"ingredientGroups"    validate:"required,dive"`
 		Steps            []StepValidator             `json:"steps"               validate:"required,dive"`
+		Version          int                         `json:"version,omitempty"`
 	} `json:"recipe"`
 	Model RecipeModel `json:"-"`
 }
@@ -23,23 +28,27 @@ type RecipeDependencyValidator struct {
 }
 
 type IngredientGroupValidator struct {
+	ID          uint                  `json:"id,omitempty"`
 	GroupName   string                `json:"groupName"   validate:"max=50"`
 	Ingredients []IngredientValidator `json:"ingredients" validate:"required,dive"`
 }
 
 type IngredientValidator struct {
+	ID   uint   `json:"id,omitempty"`
 	Name string `json:"name" validate:"required,max=32"`
 	Qty  string `json:"qty"  validate:"omitempty,max=6"`
 	Unit string `json:"unit" validate:"omitempty,max=12"`
 }
 
 type StepValidator struct {
+	ID         uint                 `json:"id,omitempty"`
 	Type       string               `json:"type"        validate:"oneof=text tipText imageLeft imageRight imageDouble imageTriple"`
 	Text       string               `json:"text"        validate:"max=865"`
 	StepImages []StepImageValidator `json:"images"      validate:"dive"`
 }
 
 type StepImageValidator struct {
+	ID    uint   `json:"id,omitempty"`
 	Image string `json:"src"`
 	Text  string `json:"text"`
 }
@@ -63,11 +72,25 @@ func (v *RecipeValidator) Validate() ([]string, error) {
 	return errors, err
 }
 
+// Warnings lists problems which don't fail validation, such as ingredient units that aren't recognised.
+func (v *RecipeValidator) Warnings() []string {
+	var warnings []string
+	for _, group := range v.Recipe.IngredientGroups {
+		for _, ingredient := range group.Ingredients {
+			if _, unit := ParseAmount(ingredient.Qty, ingredient.Unit); unit == nil && ingredient.Unit != "" {
+				warnings = append(warnings, fmt.Sprintf("Unit - unknown unit %q for %s", ingredient.Unit, ingredient.Name))
+			}
+		}
+	}
+	return warnings
+}
+
 func (v *RecipeValidator) BindModel(userID uint) error {
 	v.Model.UserID = userID
 	v.Model.Name = v.Recipe.Name
 	v.Model.Description = v.Recipe.Description
 	v.Model.PrepTime = v.Recipe.PrepTime
+	v.Model.setPrepMinutes()
 	v.Model.Servings = v.Recipe.Servings
 	v.Model.Image = v.Recipe.Image
 	if err := v.Model.setTags(v.Recipe.Tags); err != nil {
@@ -84,3 +107,37 @@ func (v *RecipeValidator) BindModel(userID uint) error {
 	}
 	return nil
 }
+
+// PatchDocument is the stored recipe in the shape RecipeValidator reads, child ids
+// included, for PATCH requests to be applied against.
+func (model *RecipeModel) PatchDocument() ([]byte, error) {
+	var document struct {
+		Recipe RecipeSnapshot `json:"recipe"`
+	}
+	document.Recipe = snapshotOf(model, true)
+	return json.Marshal(document)
+}
+
+type ImportValidator struct {
+	Import struct {
+		URL string `json:"url" validate:"required,url,max=2048"`
+	} `json:"import"`
+}
+
+func NewImportValidator() *ImportValidator {
+	return &ImportValidator{}
+}
+
+func (v *ImportValidator) Validate() ([]string, error) {
+	var errors []string
+	validate := validator.New()
+
+	err := validate.Struct(v)
+	if err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			errors = append(errors, err.Field()+" - "+err.Tag())
+		}
+	}
+
+	return errors, err
+}
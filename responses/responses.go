@@ -1,8 +1,9 @@
 package responses
 
 type StandardResponse struct {
-	Success bool        `json:"success"`
-	Message string      `json:"message"`
-	Data    interface{} `json:"data"`
-	Errors  []string    `json:"errors"`
+	Success  bool        `json:"success"`
+	Message  string      `json:"message"`
+	Data     interface{} `json:"data"`
+	Errors   []string    `json:"errors"`
+	Warnings []string    `json:"warnings,omitempty"`
 }
@@ -1,10 +1,17 @@
 package router
 
 import (
+	"github.com/anthonyhawkins/savorbook/account"
 	"github.com/anthonyhawkins/savorbook/images"
+	"github.com/anthonyhawkins/savorbook/images/storage"
+	"github.com/anthonyhawkins/savorbook/library"
 	"github.com/anthonyhawkins/savorbook/middleware"
+	"github.com/anthonyhawkins/savorbook/pantry"
 	"github.com/anthonyhawkins/savorbook/publish/cookbooks"
 	"github.com/anthonyhawkins/savorbook/publish/recipes"
+	"github.com/anthonyhawkins/savorbook/sharing"
+	"github.com/anthonyhawkins/savorbook/shopping"
+	"github.com/anthonyhawkins/savorbook/store"
 	"github.com/anthonyhawkins/savorbook/users"
 	"github.com/gofiber/fiber/v2"
 )
@@ -27,25 +34,109 @@ func SetupRoutes(app *fiber.App) {
 	auth.Get("/account", middleware.Protected(), users.GetAccount)
 	auth.Put("/account", middleware.Protected(), users.UpdateAccount)
 	auth.Put("/account/password", middleware.Protected(), users.UpdatePassword)
+	auth.Get("/account/export", middleware.Protected(), account.AccountExport)
+	auth.Post("/account/import", middleware.Protected(), account.AccountImport)
+	auth.Post("/account/import/uploads", middleware.Protected(), account.AccountUploadStart)
+	auth.Put("/account/import/uploads/:id", middleware.Protected(), account.AccountUploadPart)
+	auth.Post("/account/import/uploads/:id/finish", middleware.Protected(), account.AccountUploadFinish)
+	auth.Delete("/account/import/uploads/:id", middleware.Protected(), account.AccountUploadCancel)
 
 	// Publishing
 	publish := api.Group("/publish")
 	publish.Post("/recipes", middleware.Protected(), recipes.RecipeCreate)
 	publish.Get("/recipes", middleware.Protected(), recipes.RecipeList)
 	publish.Get("/recipes/tags", middleware.Protected(), recipes.TagList)
+	publish.Get("/recipes/search", middleware.Protected(), recipes.RecipeSearch)
+	publish.Post("/recipes/import", middleware.Protected(), recipes.RecipeImport)
 	publish.Get("/recipes/:id", middleware.Protected(), recipes.RecipeGet)
+	publish.Get("/recipes/:id/graph", middleware.Protected(), recipes.RecipeGraphGet)
+	publish.Get("/recipes/:id/revisions", middleware.Protected(), recipes.RevisionList)
+	publish.Get("/recipes/:id/revisions/diff", middleware.Protected(), recipes.RevisionDiffGet)
+	publish.Get("/recipes/:id/revisions/:number", middleware.Protected(), recipes.RevisionGet)
+	publish.Post("/recipes/:id/revisions/:number/restore", middleware.Protected(), recipes.RevisionRestore)
+	publish.Get("/recipes/:id/published", middleware.Protected(), recipes.RecipePublishedGet)
+	publish.Post("/recipes/:id/publish", middleware.Protected(), recipes.RecipePublish)
+	publish.Post("/recipes/:id/unpublish", middleware.Protected(), recipes.RecipeUnpublish)
+	publish.Post("/recipes/:id/archive", middleware.Protected(), recipes.RecipeArchive)
 	publish.Put("/recipes/:id", middleware.Protected(), recipes.RecipeUpdate)
+	publish.Patch("/recipes/:id", middleware.Protected(), recipes.RecipePatch)
 	publish.Delete("/recipes/:id", middleware.Protected(), recipes.RecipeDelete)
 
 	publish.Post("/cookbooks", middleware.Protected(), cookbooks.CookbookCreate)
 	publish.Get("/cookbooks", middleware.Protected(), cookbooks.CookbookList)
 	publish.Get("/cookbooks/:id", middleware.Protected(), cookbooks.CookbookGet)
+	publish.Get("/cookbooks/:id/published", middleware.Protected(), cookbooks.CookbookPublishedGet)
+	publish.Get("/cookbooks/:id/export.pdf", middleware.Protected(), cookbooks.CookbookExportPDF)
+	publish.Get("/cookbooks/:id/export.epub", middleware.Protected(), cookbooks.CookbookExportEPUB)
+	publish.Post("/cookbooks/:id/publish", middleware.Protected(), cookbooks.CookbookPublish)
+	publish.Post("/cookbooks/:id/unpublish", middleware.Protected(), cookbooks.CookbookUnpublish)
+	publish.Post("/cookbooks/:id/archive", middleware.Protected(), cookbooks.CookbookArchive)
 	publish.Put("/cookbooks/:id", middleware.Protected(), cookbooks.CookbookUpdate)
+	publish.Patch("/cookbooks/:id", middleware.Protected(), cookbooks.CookbookPatch)
 	publish.Delete("/cookbooks/:id", middleware.Protected(), cookbooks.CookbookDelete)
 	publish.Get("/sections/:id/recipes", middleware.Protected(), cookbooks.SectionRecipesGet)
-	//library := api.Group("/library")
-	//store := api.Group("/store")
+	publish.Get("/sections/:id/pages", middleware.Protected(), cookbooks.SectionPagesGet)
+
+	//Shopping
+	shoppingGroup := api.Group("/shopping")
+	shoppingGroup.Post("/lists", middleware.Protected(), shopping.ShoppingListCreate)
+	shoppingGroup.Get("/lists", middleware.Protected(), shopping.ShoppingListList)
+	shoppingGroup.Get("/lists/:id", middleware.Protected(), shopping.ShoppingListGet)
+	shoppingGroup.Put("/lists/:id", middleware.Protected(), shopping.ShoppingListUpdate)
+	shoppingGroup.Delete("/lists/:id", middleware.Protected(), shopping.ShoppingListDelete)
+	shoppingGroup.Put("/lists/:id/items/:itemId", middleware.Protected(), shopping.ShoppingListItemUpdate)
+
+	//Pantry
+	pantryGroup := api.Group("/pantry")
+	pantryGroup.Post("/items", middleware.Protected(), pantry.PantryItemCreate)
+	pantryGroup.Get("/items", middleware.Protected(), pantry.PantryItemList)
+	pantryGroup.Put("/items/:id", middleware.Protected(), pantry.PantryItemUpdate)
+	pantryGroup.Delete("/items/:id", middleware.Protected(), pantry.PantryItemDelete)
+	pantryGroup.Get("/cook", middleware.Protected(), pantry.WhatCanICook)
+	pantryGroup.Post("/cook/:id", middleware.Protected(), pantry.CookRecipe)
+
+	//Share Links
+	sharingGroup := api.Group("/sharing")
+	sharingGroup.Post("/links", middleware.Protected(), sharing.ShareLinkCreate)
+	sharingGroup.Get("/links", middleware.Protected(), sharing.ShareLinkList)
+	sharingGroup.Delete("/links/:id", middleware.Protected(), sharing.ShareLinkRevoke)
+
+	//Shared, readable by anyone holding the link's token
+	shared := api.Group("/shared")
+	shared.Get("/:token", sharing.SharedGet)
+	shared.Get("/:token/recipes/:recipeId", sharing.SharedRecipeGet)
+
+	//Library of published cookbooks, browsable by anyone
+	libraryGroup := api.Group("/library")
+	libraryGroup.Get("/authors/:username", library.AuthorGet)
+	libraryGroup.Get("/authors/:username/recipes/:id", library.AuthorRecipeGet)
+	libraryGroup.Get("/authors/:username/recipes/:id/page", library.AuthorRecipePage)
+	libraryGroup.Get("/authors/:username/recipes/:id/schema", library.AuthorRecipeSchema)
+	libraryGroup.Get("/cookbooks", library.LibraryCookbookList)
+	libraryGroup.Get("/cookbooks/:id", middleware.OptionalAuth(), library.LibraryCookbookGet)
+	libraryGroup.Get("/saved", middleware.Protected(), library.SavedCookbookList)
+	libraryGroup.Put("/saved/:id", middleware.Protected(), library.SavedCookbookAdd)
+	libraryGroup.Delete("/saved/:id", middleware.Protected(), library.SavedCookbookRemove)
+
+	//Store
+	storeGroup := api.Group("/store")
+	storeGroup.Get("/listings/:id", store.ListingGet)
+	storeGroup.Put("/listings/:id", middleware.Protected(), store.ListingSet)
+	storeGroup.Delete("/listings/:id", middleware.Protected(), store.ListingRemove)
+	storeGroup.Post("/checkout", middleware.Protected(), store.CheckoutCreate)
+	storeGroup.Get("/orders", middleware.Protected(), store.OrderList)
+	storeGroup.Get("/orders/:id", middleware.Protected(), store.OrderGet)
+	storeGroup.Get("/sales", middleware.Protected(), store.SaleList)
+	storeGroup.Get("/sales/totals", middleware.Protected(), store.SalesTotalList)
+	storeGroup.Post("/sales/:id/refund", middleware.Protected(), store.SaleRefund)
 
 	api.Post("/images", middleware.Protected(), images.UploadImage)
+	api.Get("/images", middleware.Protected(), images.ImageList)
+	api.Delete("/images/:id", middleware.Protected(), images.ImageDelete)
+
+	//Images kept on local disk are served directly, other backends serve their own URLs
+	if local, ok := storage.GetStorage().(*storage.LocalStorage); ok {
+		app.Static(local.Prefix, local.Dir)
+	}
 
 }
@@ -0,0 +1,298 @@
+package sharing
+
+import (
+	"errors"
+	"fmt"
+	"github.com/anthonyhawkins/savorbook/middleware"
+	"github.com/anthonyhawkins/savorbook/publish/cookbooks"
+	"github.com/anthonyhawkins/savorbook/publish/recipes"
+	"github.com/anthonyhawkins/savorbook/responses"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"strconv"
+	"strings"
+)
+
+func ShareLinkCreate(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+
+	userID := middleware.AuthedUserId(c.Locals("user"))
+
+	shareLinkValidator := NewShareLinkValidator()
+	if err := c.BodyParser(shareLinkValidator); err != nil {
+		response.Message = "Invalid JSON"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	validationErrors, err := shareLinkValidator.Validate()
+	if err != nil {
+		response.Message = "Validation Errors"
+		response.Errors = validationErrors
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	if err := shareLinkValidator.BindModel(userID); err != nil {
+		response.Message = "Unable to Create Share Link"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	err = CreateShareLink(&shareLinkValidator.Model)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response.Message = "Nothing to Share"
+		response.Errors = append(response.Errors, fmt.Sprintf("%s %d not found", shareLinkValidator.Model.Kind, shareLinkValidator.Model.ItemID))
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	if err != nil {
+		response.Message = "Unable to Create Share Link"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	var linkResponse ShareLinkResponse
+	linkResponse.SerializeShareLink(&shareLinkValidator.Model)
+
+	//Respond with Success
+	response.Success = true
+	response.Data = linkResponse
+	return c.Status(fiber.StatusCreated).JSON(response)
+}
+
+func ShareLinkList(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+	userID := middleware.AuthedUserId(c.Locals("user"))
+	pageNum := strings.ToLower(c.Query("page"))
+	pageSize := strings.ToLower(c.Query("page_size"))
+
+	linkList := make([]ShareLinkResponse, 0)
+
+	links, err := GetShareLinks(userID, strings.ToLower(c.Query("kind")), c.Query("id"), pageNum, pageSize)
+	if err != nil {
+		response.Message = "Unable to Retrieve Share Links"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	for _, link := range links {
+		var linkResponse ShareLinkResponse
+		linkResponse.SerializeShareLink(&link)
+		linkList = append(linkList, linkResponse)
+	}
+
+	//Respond with Success
+	response.Success = true
+	response.Data = linkList
+	return c.JSON(response)
+}
+
+func ShareLinkRevoke(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+
+	linkID := c.Params("id")
+	userID := middleware.AuthedUserId(c.Locals("user"))
+
+	link, err := RevokeShareLink(linkID, userID)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response.Message = "Share Link Not Found"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	if err != nil {
+		response.Message = "Unable to Revoke Share Link"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	var linkResponse ShareLinkResponse
+	linkResponse.SerializeShareLink(&link)
+
+	//Respond with Success
+	response.Success = true
+	response.Message = "Share Link Revoked"
+	response.Data = linkResponse
+	return c.JSON(response)
+}
+
+// openLink answers for a token which doesn't work, returning ok when the link can be used.
+func openLink(c *fiber.Ctx, response *responses.StandardResponse) (ShareLinkModel, bool, error) {
+	//a revoked link has to stop working straight away, so nothing is kept in a cache
+	c.Set(fiber.HeaderCacheControl, "no-store")
+
+	link, err := OpenShareLink(c.Params("token"))
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response.Message = "Link Not Found"
+		response.Errors = append(response.Errors, response.Message)
+		return link, false, c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	if errors.Is(err, ErrLinkGone) {
+		response.Message = "Link No Longer Available"
+		response.Errors = append(response.Errors, err.Error())
+		return link, false, c.Status(fiber.StatusGone).JSON(response)
+	}
+
+	if err != nil {
+		response.Message = "Unable to Open Link"
+		response.Errors = append(response.Errors, response.Message)
+		return link, false, c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+	return link, true, nil
+}
+
+func SharedGet(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+
+	link, ok, err := openLink(c, response)
+	if !ok {
+		return err
+	}
+
+	var sharedResponse SharedResponse
+	sharedResponse.Kind = link.Kind
+	sharedResponse.ExpiresAt = formatTime(link.ExpiresAt)
+
+	switch link.Kind {
+	case KindRecipe:
+		recipeResponse, status, err := sharedRecipe(c, link.ItemID, link.UserID)
+		if err != nil {
+			response.Message = "Unable to Retrieve Recipe"
+			response.Errors = append(response.Errors, err.Error())
+			return c.Status(status).JSON(response)
+		}
+		sharedResponse.Recipe = &recipeResponse
+	case KindCookbook:
+		cookbookResponse, status, err := sharedCookbook(link.ItemID, link.UserID)
+		if err != nil {
+			response.Message = "Unable to Retrieve Cookbook"
+			response.Errors = append(response.Errors, err.Error())
+			return c.Status(status).JSON(response)
+		}
+		sharedResponse.Cookbook = &cookbookResponse
+	}
+
+	if err := link.CountView(); err != nil {
+		fmt.Println("Unable to count share link view", link.ID, err)
+	}
+
+	//Respond with Success
+	response.Success = true
+	response.Data = sharedResponse
+	return c.JSON(response)
+}
+
+// SharedRecipeGet opens one recipe through a link, for the recipes of a shared cookbook and the sub-recipes of a shared recipe.
+func SharedRecipeGet(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+
+	link, ok, err := openLink(c, response)
+	if !ok {
+		return err
+	}
+
+	recipeID, err := strconv.ParseUint(c.Params("recipeId"), 10, 64)
+	reached := false
+	if err == nil {
+		reached, err = link.Reaches(uint(recipeID))
+	}
+	if err != nil || !reached {
+		response.Message = "Recipe Not Found"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	recipeResponse, status, err := sharedRecipe(c, uint(recipeID), link.UserID)
+	if err != nil {
+		response.Message = "Unable to Retrieve Recipe"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(status).JSON(response)
+	}
+
+	//Respond with Success
+	response.Success = true
+	response.Data = recipeResponse
+	return c.JSON(response)
+}
+
+// sharedRecipe loads the whole recipe, scaled and converted the same way RecipeGet does from servings, scale and units.
+func sharedRecipe(c *fiber.Ctx, recipeID uint, ownerID uint) (recipes.RecipeResponse, int, error) {
+	var recipeResponse recipes.RecipeResponse
+
+	model, err := recipes.GetRecipeFull(fmt.Sprint(recipeID), ownerID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return recipeResponse, fiber.StatusNotFound, errors.New("the shared recipe has been deleted")
+	}
+	if err != nil {
+		return recipeResponse, fiber.StatusInternalServerError, err
+	}
+
+	factor, err := model.ScaleFactor(c.Query("servings"), c.Query("scale"))
+	if err != nil {
+		return recipeResponse, fiber.StatusUnprocessableEntity, err
+	}
+	if factor != 1 {
+		model.Scale(factor)
+	}
+
+	units := strings.ToLower(c.Query("units"))
+	if units != "" && !recipes.ValidUnitSystem(units) {
+		return recipeResponse, fiber.StatusUnprocessableEntity, errors.New("units must be metric, imperial or original")
+	}
+	model.ConvertUnits(units)
+
+	recipeResponse.SerializeRecipe(&model)
+	if factor != 1 {
+		recipeResponse.Scale = factor
+	}
+	return recipeResponse, fiber.StatusOK, nil
+}
+
+func sharedCookbook(cookbookID uint, ownerID uint) (SharedCookbookResponse, int, error) {
+	var cookbookResponse SharedCookbookResponse
+
+	model, err := cookbooks.GetCookbook(fmt.Sprint(cookbookID), ownerID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return cookbookResponse, fiber.StatusNotFound, errors.New("the shared cookbook has been deleted")
+	}
+	if err != nil {
+		return cookbookResponse, fiber.StatusInternalServerError, err
+	}
+
+	cookbookResponse.ID = model.ID
+	cookbookResponse.Title = model.Title
+	cookbookResponse.SubTitle = model.SubTitle
+	cookbookResponse.Blurb = model.Blurb
+	cookbookResponse.Image = model.Image
+	cookbookResponse.Sections = make([]SharedSectionResponse, 0)
+
+	for _, section := range model.Sections {
+		sectionRecipes, err := cookbooks.GetSectionRecipes(fmt.Sprint(section.ID), ownerID)
+		if err != nil {
+			return cookbookResponse, fiber.StatusInternalServerError, err
+		}
+
+		sectionResponse := SharedSectionResponse{
+			ID:       section.ID,
+			Name:     section.Name,
+			Overview: section.Overview,
+			Recipes:  make([]recipes.RecipeResponse, 0),
+		}
+		for _, recipe := range sectionRecipes {
+			var recipeResponse recipes.RecipeResponse
+			recipeResponse.SerializeRecipe(&recipe)
+			sectionResponse.Recipes = append(sectionResponse.Recipes, recipeResponse)
+		}
+		cookbookResponse.Sections = append(cookbookResponse.Sections, sectionResponse)
+	}
+	return cookbookResponse, fiber.StatusOK, nil
+}
@@ -0,0 +1,184 @@
+package sharing
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/anthonyhawkins/savorbook/database"
+	"github.com/anthonyhawkins/savorbook/publish/cookbooks"
+	"github.com/anthonyhawkins/savorbook/publish/recipes"
+	"gorm.io/gorm"
+	"time"
+)
+
+const (
+	KindRecipe   = "recipe"
+	KindCookbook = "cookbook"
+)
+
+var ErrLinkGone = errors.New("this link has expired or been revoked")
+
+// ShareLinkModel lets anyone holding the token read one recipe or cookbook without
+// logging in. Revoked links are kept rather than deleted so their views still count.
+type ShareLinkModel struct {
+	gorm.Model
+	UserID       uint   `gorm:"index"`
+	Token        string `gorm:"uniqueIndex"`
+	Kind         string
+	ItemID       uint
+	ExpiresAt    *time.Time
+	RevokedAt    *time.Time
+	Views        int
+	LastViewedAt *time.Time
+}
+
+// newToken is 256 random bits, far too many to guess, encoded to sit in a URL as is.
+func newToken() (string, error) {
+	data := make([]byte, 32)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func (link *ShareLinkModel) Active() bool {
+	if link.RevokedAt != nil {
+		return false
+	}
+	return link.ExpiresAt == nil || link.ExpiresAt.After(time.Now())
+}
+
+// CreateShareLink mints the token, once the recipe or cookbook is known to belong to the link's owner.
+func CreateShareLink(link *ShareLinkModel) error {
+	itemID := fmt.Sprint(link.ItemID)
+	switch link.Kind {
+	case KindRecipe:
+		recipe, err := recipes.GetRecipe(itemID, link.UserID)
+		if err != nil {
+			return err
+		}
+		if recipe.ID == 0 {
+			return gorm.ErrRecordNotFound
+		}
+	case KindCookbook:
+		if _, err := cookbooks.GetCookbook(itemID, link.UserID); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown kind %q", link.Kind)
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return err
+	}
+	link.Token = token
+
+	db := database.GetDB()
+	return db.Create(link).Error
+}
+
+func GetShareLinks(userID uint, kind string, itemID string, pageNum string, pageSize string) ([]ShareLinkModel, error) {
+	db := database.GetDB()
+	var links []ShareLinkModel
+
+	query := db.Scopes(database.Paginate(pageNum, pageSize)).Where("user_id = ?", userID)
+	if kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	if itemID != "" {
+		query = query.Where("item_id = ?", itemID)
+	}
+	result := query.Order("id desc").Find(&links)
+
+	return links, result.Error
+}
+
+// RevokeShareLink stops the link working for good. Revoking it twice keeps the first time.
+func RevokeShareLink(linkID string, userID uint) (ShareLinkModel, error) {
+	db := database.GetDB()
+	var link ShareLinkModel
+
+	result := db.Model(&ShareLinkModel{}).Where(map[string]interface{}{
+		"id":      linkID,
+		"user_id": userID,
+	}).Update("revoked_at", gorm.Expr("COALESCE(revoked_at, ?)", time.Now()))
+	if result.Error != nil {
+		return link, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return link, gorm.ErrRecordNotFound
+	}
+
+	result = db.First(&link, linkID)
+	return link, result.Error
+}
+
+// OpenShareLink finds the link for a token, failing with ErrLinkGone once it has expired or been revoked.
+func OpenShareLink(token string) (ShareLinkModel, error) {
+	db := database.GetDB()
+	var link ShareLinkModel
+
+	result := db.Where("token = ?", token).First(&link)
+	if result.Error != nil {
+		return link, result.Error
+	}
+	if !link.Active() {
+		return link, ErrLinkGone
+	}
+	return link, nil
+}
+
+func (link *ShareLinkModel) CountView() error {
+	db := database.GetDB()
+	return db.Model(link).UpdateColumns(map[string]interface{}{
+		"views":          gorm.Expr("views + 1"),
+		"last_viewed_at": time.Now(),
+	}).Error
+}
+
+// Reaches reports whether the link gives access to a recipe: the shared recipe, any
+// recipe in the shared cookbook's sections, and the sub-recipes any of those depend
+// on, since a recipe can't be made without them.
+func (link *ShareLinkModel) Reaches(recipeID uint) (bool, error) {
+	var roots []uint
+	switch link.Kind {
+	case KindRecipe:
+		roots = append(roots, link.ItemID)
+	case KindCookbook:
+		cookbook, err := cookbooks.GetCookbook(fmt.Sprint(link.ItemID), link.UserID)
+		if err != nil {
+			return false, err
+		}
+		for _, section := range cookbook.Sections {
+			for _, id := range section.Recipes {
+				roots = append(roots, uint(id))
+			}
+		}
+	}
+
+	db := database.GetDB()
+	graph, err := recipes.LoadDependencyGraph(db, link.UserID)
+	if err != nil {
+		return false, err
+	}
+	for _, root := range roots {
+		if reaches(graph.Tree(root), recipeID) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func reaches(node recipes.GraphNode, recipeID uint) bool {
+	if node.RecipeID == recipeID {
+		return true
+	}
+	for _, dependent := range node.Dependent {
+		if reaches(dependent, recipeID) {
+			return true
+		}
+	}
+	return false
+}
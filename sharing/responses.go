@@ -0,0 +1,62 @@
+package sharing
+
+import (
+	"github.com/anthonyhawkins/savorbook/publish/recipes"
+	"time"
+)
+
+type ShareLinkResponse struct {
+	ID           uint   `json:"id"`
+	Token        string `json:"token"`
+	Path         string `json:"path"`
+	Kind         string `json:"kind"`
+	ItemID       uint   `json:"itemId"`
+	ExpiresAt    string `json:"expiresAt,omitempty"`
+	RevokedAt    string `json:"revokedAt,omitempty"`
+	Active       bool   `json:"active"`
+	Views        int    `json:"views"`
+	LastViewedAt string `json:"lastViewedAt,omitempty"`
+}
+
+type SharedResponse struct {
+	Kind      string                  `json:"kind"`
+	ExpiresAt string                  `json:"expiresAt,omitempty"`
+	Recipe    *recipes.RecipeResponse `json:"recipe,omitempty"`
+	Cookbook  *SharedCookbookResponse `json:"cookbook,omitempty"`
+}
+
+type SharedCookbookResponse struct {
+	ID       uint                    `json:"id"`
+	Title    string                  `json:"title"`
+	SubTitle string                  `json:"subTitle"`
+	Blurb    string                  `json:"blurb"`
+	Image    string                  `json:"image"`
+	Sections []SharedSectionResponse `json:"sections"`
+}
+
+type SharedSectionResponse struct {
+	ID       uint                     `json:"id"`
+	Name     string                   `json:"name"`
+	Overview string                   `json:"overview"`
+	Recipes  []recipes.RecipeResponse `json:"recipes"`
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format("2006-01-02T15:04:05Z07:00")
+}
+
+func (r *ShareLinkResponse) SerializeShareLink(model *ShareLinkModel) {
+	r.ID = model.ID
+	r.Token = model.Token
+	r.Path = "/api/shared/" + model.Token
+	r.Kind = model.Kind
+	r.ItemID = model.ItemID
+	r.ExpiresAt = formatTime(model.ExpiresAt)
+	r.RevokedAt = formatTime(model.RevokedAt)
+	r.Active = model.Active()
+	r.Views = model.Views
+	r.LastViewedAt = formatTime(model.LastViewedAt)
+}
@@ -0,0 +1,52 @@
+package sharing
+
+import (
+	"errors"
+	"github.com/go-playground/validator/v10"
+	"time"
+)
+
+type ShareLinkValidator struct {
+	Share struct {
+		Kind      string `json:"kind"      validate:"required,oneof=recipe cookbook"`
+		ID        uint   `json:"id"        validate:"required"`
+		ExpiresAt string `json:"expiresAt" validate:"omitempty,max=40"`
+	} `json:"share"`
+	Model ShareLinkModel `json:"-"`
+}
+
+func NewShareLinkValidator() *ShareLinkValidator {
+	return &ShareLinkValidator{}
+}
+
+func (v *ShareLinkValidator) Validate() ([]string, error) {
+	var errors []string
+	validate := validator.New()
+	err := validate.Struct(v)
+	if err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			message := err.Field() + " = " + err.Tag()
+			errors = append(errors, message)
+		}
+	}
+
+	return errors, err
+}
+
+func (v *ShareLinkValidator) BindModel(userID uint) error {
+	v.Model.UserID = userID
+	v.Model.Kind = v.Share.Kind
+	v.Model.ItemID = v.Share.ID
+
+	if v.Share.ExpiresAt != "" {
+		expiresAt, err := time.Parse(time.RFC3339, v.Share.ExpiresAt)
+		if err != nil {
+			return errors.New("expiresAt must be a date and time such as 2021-06-01T18:00:00Z")
+		}
+		if !expiresAt.After(time.Now()) {
+			return errors.New("expiresAt must be in the future")
+		}
+		v.Model.ExpiresAt = &expiresAt
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package shopping
+
+import (
+	"sort"
+	"strings"
+)
+
+const otherAisle = "Other"
+
+// Aisles are listed in the order a list is shown, roughly the way a shop is walked.
+var Aisles = []string{
+	"Produce",
+	"Meat & Seafood",
+	"Dairy & Eggs",
+	"Bakery",
+	"Baking",
+	"Spices & Seasonings",
+	"Pantry",
+	"Frozen",
+	"Beverages",
+	otherAisle,
+}
+
+var aisleKeywords = map[string][]string{
+	"Produce": {
+		"apple", "avocado", "banana", "basil", "bean sprout", "berries", "blueberr", "broccoli", "cabbage",
+		"carrot", "cauliflower", "celery", "chili", "chilli", "cilantro", "coriander", "cucumber", "eggplant",
+		"garlic", "ginger", "grape", "herb", "kale", "leek", "lemon", "lettuce", "lime", "mango", "mint",
+		"mushroom", "onion", "orange", "parsley", "peach", "pear", "pepper", "potato", "raspberr", "rosemary",
+		"scallion", "shallot", "spinach", "squash", "strawberr", "thyme", "tomato", "zucchini",
+	},
+	"Meat & Seafood": {
+		"bacon", "beef", "chicken", "chorizo", "cod", "fish", "ham", "lamb", "mince", "pork", "prawn",
+		"salmon", "sausage", "shrimp", "steak", "tuna", "turkey",
+	},
+	"Dairy & Eggs": {
+		"butter", "buttermilk", "cheddar", "cheese", "cream", "egg", "feta", "milk", "mozzarella",
+		"parmesan", "ricotta", "sour cream", "yogurt", "yoghurt",
+	},
+	"Bakery": {
+		"bagel", "baguette", "bread", "bun", "pita", "roll", "tortilla",
+	},
+	"Baking": {
+		"baking powder", "baking soda", "chocolate", "cocoa", "cornstarch", "cornflour", "flour", "honey",
+		"maple syrup", "sugar", "vanilla", "yeast",
+	},
+	"Spices & Seasonings": {
+		"black pepper", "cinnamon", "cumin", "ground pepper", "curry", "nutmeg", "oregano", "paprika", "peppercorn", "salt", "seasoning",
+		"spice", "turmeric",
+	},
+	"Pantry": {
+		"bean", "broth", "chickpea", "coconut milk", "lentil", "mayonnaise", "mustard", "noodle", "nut",
+		"oats", "oil", "pasta", "rolled oats", "rice", "sauce", "stock", "tomato paste", "vinegar",
+	},
+	"Frozen": {
+		"frozen", "ice cream", "peas",
+	},
+	"Beverages": {
+		"beer", "coffee", "juice", "soda", "tea", "wine",
+	},
+}
+
+// aisleMatchers are tried longest keyword first so "coconut milk" lands in the pantry, not with the milk.
+var aisleMatchers = buildAisleMatchers()
+
+type aisleMatcher struct {
+	keyword string
+	aisle   string
+}
+
+func buildAisleMatchers() []aisleMatcher {
+	var matchers []aisleMatcher
+	for aisle, keywords := range aisleKeywords {
+		for _, keyword := range keywords {
+			matchers = append(matchers, aisleMatcher{keyword: keyword, aisle: aisle})
+		}
+	}
+	sort.Slice(matchers, func(i, j int) bool {
+		if len(matchers[i].keyword) != len(matchers[j].keyword) {
+			return len(matchers[i].keyword) > len(matchers[j].keyword)
+		}
+		return matchers[i].keyword < matchers[j].keyword
+	})
+	return matchers
+}
+
+func AisleFor(ingredient string) string {
+	name := strings.ToLower(ingredient)
+	for _, matcher := range aisleMatchers {
+		if strings.Contains(name, matcher.keyword) {
+			return matcher.aisle
+		}
+	}
+	return otherAisle
+}
+
+func aisleOrder(aisle string) int {
+	for i, name := range Aisles {
+		if name == aisle {
+			return i
+		}
+	}
+	return len(Aisles)
+}
@@ -0,0 +1,275 @@
+package shopping
+
+import (
+	"errors"
+	"fmt"
+	"github.com/anthonyhawkins/savorbook/publish/recipes"
+	"sort"
+	"strings"
+)
+
+// maxDependencyDepth stops runaway expansion should recipes ever depend on each other in a loop.
+const maxDependencyDepth = 10
+
+var ErrDependencyLoop = errors.New("recipe dependencies loop back on themselves")
+
+// Builder collects the ingredients of several recipes and their sub-recipes and
+// merges matching ingredients into single lines. Amounts are summed in the base
+// unit of their kind (millilitres, grams) so "1 cup" and "250 ml" of milk become
+// one line. When one recipe weighs an ingredient and another measures it by
+// volume, the volume is weighed too if the ingredient's density is known.
+type Builder struct {
+	UserID uint
+	System string
+	lines  map[string]*line
+	order  int
+}
+
+type line struct {
+	name     string
+	unit     string
+	units    map[string]bool
+	system   string
+	amount   float64
+	volume   float64
+	mass     float64
+	measured bool
+	notes    []string
+	sources  []string
+	order    int
+}
+
+func NewBuilder(userID uint, system string) *Builder {
+	return &Builder{
+		UserID: userID,
+		System: system,
+		lines:  make(map[string]*line),
+	}
+}
+
+// AddRecipe adds the full recipe, scaled the same way RecipeGet scales it, along with everything it depends on.
+func (b *Builder) AddRecipe(recipeID uint, servings string, scale string) error {
+	model, err := recipes.GetRecipeFull(fmt.Sprint(recipeID), b.UserID)
+	if err != nil {
+		return err
+	}
+	factor, err := model.ScaleFactor(servings, scale)
+	if err != nil {
+		return err
+	}
+	return b.addModel(model, factor, nil)
+}
+
+func (b *Builder) addModel(model recipes.RecipeModel, factor float64, path []uint) error {
+	for _, visited := range path {
+		if visited == model.ID {
+			return ErrDependencyLoop
+		}
+	}
+	if len(path) >= maxDependencyDepth {
+		return ErrDependencyLoop
+	}
+
+	//batches come from the unscaled qty, as graph.go's accumulate does, so a dependency
+	//without a batch count, i.e. "" or "1 cup", still follows the parent's scale
+	batches := make([]float64, len(model.DependentRecipes))
+	for i, dependency := range model.DependentRecipes {
+		batches[i] = recipes.DependencyBatches(dependency.Qty) * factor
+	}
+
+	model.Scale(factor)
+	for _, group := range model.IngredientGroups {
+		for _, ingredient := range group.Ingredients {
+			b.addIngredient(ingredient, model.Name)
+		}
+	}
+
+	path = append(path, model.ID)
+	for i, dependency := range model.DependentRecipes {
+		dependent, err := recipes.GetRecipeFull(fmt.Sprint(dependency.DependentRecipe), b.UserID)
+		if err != nil {
+			return err
+		}
+		if err := b.addModel(dependent, batches[i], path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *Builder) addIngredient(ingredient recipes.IngredientModel, source string) {
+	name := strings.TrimSpace(ingredient.Name)
+	if name == "" {
+		return
+	}
+	normalized := normalizeName(name)
+
+	amount := 0.0
+	measured := ingredient.Amount != nil
+	if ingredient.AmountMax != nil {
+		//buy enough for the top of the range
+		amount = *ingredient.AmountMax
+	} else if ingredient.Amount != nil {
+		amount = *ingredient.Amount
+	}
+
+	kind := recipes.UnitKind("")
+	unitName := ""
+	system := ""
+	if unit, ok := recipes.GetUnit(ingredient.CanonicalUnit); ok && unit.Kind != recipes.Temperature {
+		unitName = unit.Name
+		system = unit.System
+		kind = unit.Kind
+	}
+
+	key := normalized
+	if kind != recipes.Volume && kind != recipes.Mass {
+		key += "|" + unitName
+	}
+
+	current, ok := b.lines[key]
+	if !ok {
+		current = &line{
+			name:  name,
+			unit:  unitName,
+			units: make(map[string]bool),
+			order: b.order,
+		}
+		b.order++
+		b.lines[key] = current
+	}
+
+	if measured {
+		unit, _ := recipes.GetUnit(unitName)
+		switch kind {
+		case recipes.Volume:
+			current.volume += amount * unit.Factor
+		case recipes.Mass:
+			current.mass += amount * unit.Factor
+		default:
+			current.amount += amount
+		}
+		current.measured = true
+		if unitName != "" {
+			current.units[unitName] = true
+		}
+		if current.system == "" {
+			current.system = system
+		}
+	} else if note := strings.TrimSpace(ingredient.Qty + " " + ingredient.Unit); note != "" {
+		current.notes = append(current.notes, note)
+	}
+
+	for _, existing := range current.sources {
+		if existing == source {
+			return
+		}
+	}
+	current.sources = append(current.sources, source)
+}
+
+// normalizeName lets "Eggs" and "egg" share a line.
+func normalizeName(name string) string {
+	name = strings.ToLower(strings.Join(strings.Fields(name), " "))
+	switch {
+	case strings.HasSuffix(name, "oes"):
+		return strings.TrimSuffix(name, "es")
+	case strings.HasSuffix(name, "ies"):
+		return strings.TrimSuffix(name, "ies") + "y"
+	case strings.HasSuffix(name, "s") && !strings.HasSuffix(name, "ss"):
+		return strings.TrimSuffix(name, "s")
+	}
+	return name
+}
+
+// Items returns the merged lines ordered by aisle, then by the order they were first added.
+func (b *Builder) Items() []ShoppingListItemModel {
+	var lines []*line
+	for _, current := range b.lines {
+		lines = append(lines, current)
+	}
+
+	sort.Slice(lines, func(i, j int) bool {
+		left, right := aisleOrder(AisleFor(lines[i].name)), aisleOrder(AisleFor(lines[j].name))
+		if left != right {
+			return left < right
+		}
+		return lines[i].order < lines[j].order
+	})
+
+	items := make([]ShoppingListItemModel, 0)
+	for i, current := range lines {
+		item := current.item(b.System)
+		item.Position = i
+		items = append(items, item)
+	}
+	return items
+}
+
+func (current *line) item(preferredSystem string) ShoppingListItemModel {
+	item := ShoppingListItemModel{
+		Name:     current.name,
+		Category: AisleFor(current.name),
+		Sources:  current.sources,
+	}
+
+	system := preferredSystem
+	if system != recipes.Metric && system != recipes.Imperial {
+		system = current.system
+	}
+	if system == "" {
+		system = recipes.Metric
+	}
+
+	var notes []string
+	if current.measured {
+		kind, base := recipes.UnitKind(""), 0.0
+		switch {
+		case current.volume > 0 && current.mass > 0:
+			kind, base = recipes.Mass, current.mass
+			if density, ok := recipes.IngredientDensity(current.name); ok {
+				base += current.volume * density
+			} else {
+				//no way to weigh it, so the volume is listed alongside
+				unit := recipes.PreferredUnit(recipes.Volume, system, current.volume)
+				volume := current.volume / unit.Factor
+				notes = append(notes, recipes.FormatConverted(volume, system)+" "+recipes.DisplayUnit(unit, volume))
+			}
+		case current.volume > 0:
+			kind, base = recipes.Volume, current.volume
+		case current.mass > 0:
+			kind, base = recipes.Mass, current.mass
+		}
+
+		if kind != "" {
+			//a single unit the shopper already knows is kept, i.e. three recipes of tbsp stay tbsp
+			unit, ok := recipes.GetUnit(current.unit)
+			if len(current.units) != 1 || !ok || unit.Kind != kind || (unit.System != "" && unit.System != system) {
+				unit = recipes.PreferredUnit(kind, system, base)
+			}
+			amount := base / unit.Factor
+			item.Qty = recipes.FormatConverted(amount, system)
+			item.Unit = recipes.DisplayUnit(unit, amount)
+			item.Amount = &amount
+			item.CanonicalUnit = unit.Name
+		} else {
+			amount := current.amount
+			item.Qty = recipes.FormatAmount(amount)
+			item.Unit = current.unit
+			item.Amount = &amount
+			item.CanonicalUnit = current.unit
+		}
+	}
+
+	notes = append(notes, current.notes...)
+	if len(notes) > 0 {
+		joined := strings.Join(notes, ", ")
+		if item.Qty == "" {
+			item.Qty = joined
+		} else {
+			item.Qty += " + " + joined
+		}
+	}
+
+	return item
+}
@@ -0,0 +1,294 @@
+package shopping
+
+import (
+	"errors"
+	"fmt"
+	"github.com/anthonyhawkins/savorbook/middleware"
+	"github.com/anthonyhawkins/savorbook/publish/cookbooks"
+	"github.com/anthonyhawkins/savorbook/responses"
+	"github.com/anthonyhawkins/savorbook/users"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+func ShoppingListCreate(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+
+	userID := middleware.AuthedUserId(c.Locals("user"))
+
+	listValidator := NewShoppingListValidator()
+	if err := c.BodyParser(listValidator); err != nil {
+		response.Message = "Invalid JSON"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	errs, err := listValidator.Validate()
+	if err != nil {
+		response.Message = "Validation Errors"
+		response.Errors = errs
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	if len(listValidator.ShoppingList.Recipes) == 0 && len(listValidator.ShoppingList.Sections) == 0 {
+		response.Message = "Validation Errors"
+		response.Errors = append(response.Errors, "at least one recipe or section is required")
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	units := listValidator.ShoppingList.Units
+	if units == "" {
+		if user, err := users.FindOne(userID); err == nil {
+			units = user.Units
+		}
+	}
+
+	builder := NewBuilder(userID, units)
+	for _, recipe := range listValidator.ShoppingList.Recipes {
+		if err := builder.AddRecipe(recipe.ID, recipe.Servings, recipe.Scale); err != nil {
+			return buildError(c, response, fmt.Sprintf("Recipe %d", recipe.ID), err)
+		}
+	}
+
+	for _, section := range listValidator.ShoppingList.Sections {
+		sectionRecipes, err := cookbooks.GetSectionRecipes(fmt.Sprint(section.ID), userID)
+		if err != nil {
+			return buildError(c, response, fmt.Sprintf("Section %d", section.ID), err)
+		}
+		for _, recipe := range sectionRecipes {
+			if err := builder.AddRecipe(recipe.ID, section.Servings, section.Scale); err != nil {
+				return buildError(c, response, fmt.Sprintf("Recipe %d", recipe.ID), err)
+			}
+		}
+	}
+
+	model := ShoppingListModel{
+		UserID: userID,
+		Name:   listValidator.ShoppingList.Name,
+		Items:  builder.Items(),
+	}
+	if model.Name == "" {
+		model.Name = "Shopping List " + time.Now().Format("Jan 2")
+	}
+
+	if err := CreateShoppingList(&model); err != nil {
+		response.Message = "Unable to Create Shopping List"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	var listResponse ShoppingListResponse
+	listResponse.SerializeShoppingList(&model)
+
+	//Respond with Success
+	response.Success = true
+	response.Data = listResponse
+	return c.Status(fiber.StatusCreated).JSON(response)
+}
+
+func buildError(c *fiber.Ctx, response *responses.StandardResponse, source string, err error) error {
+	response.Message = "Unable to Create Shopping List"
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response.Errors = append(response.Errors, source+" Not Found")
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+	response.Errors = append(response.Errors, source+": "+err.Error())
+	return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+}
+
+func ShoppingListGet(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+
+	listID := c.Params("id")
+	userID := middleware.AuthedUserId(c.Locals("user"))
+
+	model, err := GetShoppingList(listID, userID)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response.Message = "Shopping List Not Found"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	if err != nil {
+		response.Message = "Unable to Retrieve Shopping List"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	var listResponse ShoppingListResponse
+	listResponse.SerializeShoppingList(&model)
+	response.Success = true
+	response.Data = listResponse
+	return c.JSON(response)
+}
+
+func ShoppingListList(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+	userID := middleware.AuthedUserId(c.Locals("user"))
+	pageNum := strings.ToLower(c.Query("page"))
+	pageSize := strings.ToLower(c.Query("page_size"))
+
+	listResponses := make([]ShoppingListResponse, 0)
+
+	lists, err := GetShoppingLists(userID, pageNum, pageSize)
+
+	if err != nil {
+		response.Success = true
+		response.Data = listResponses
+		response.Message = "No Shopping Lists Found"
+		response.Errors = append(response.Errors, response.Message)
+		return c.JSON(response)
+	}
+
+	for _, list := range lists {
+		var listResponse ShoppingListResponse
+		listResponse.SerializeShoppingList(&list)
+		listResponses = append(listResponses, listResponse)
+	}
+
+	//Respond with Success
+	response.Success = true
+	response.Data = listResponses
+	return c.JSON(response)
+}
+
+func ShoppingListUpdate(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+
+	listID := c.Params("id")
+	userID := middleware.AuthedUserId(c.Locals("user"))
+	existingList, err := GetShoppingList(listID, userID)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response.Message = "Shopping List Not Found"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	if err != nil {
+		response.Message = "Unable to Retrieve Shopping List"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	listValidator := NewShoppingListUpdateValidator()
+	if err := c.BodyParser(listValidator); err != nil {
+		response.Message = "Invalid JSON"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	validationErrors, err := listValidator.Validate()
+	if err != nil {
+		response.Message = "Validation Errors"
+		response.Errors = validationErrors
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	listValidator.BindModel(existingList)
+
+	if err := listValidator.Model.Update(); err != nil {
+		response.Message = "Unable to Update Shopping List"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	var listResponse ShoppingListResponse
+	listResponse.SerializeShoppingList(&listValidator.Model)
+
+	//Respond with Success
+	response.Success = true
+	response.Data = listResponse
+	return c.JSON(response)
+}
+
+// ShoppingListItemUpdate edits a single item, mostly to tick it off while walking the aisles.
+func ShoppingListItemUpdate(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+
+	listID := c.Params("id")
+	itemID := c.Params("itemId")
+	userID := middleware.AuthedUserId(c.Locals("user"))
+
+	list, err := GetShoppingList(listID, userID)
+	var item ShoppingListItemModel
+	if err == nil {
+		item, err = GetShoppingListItem(itemID, list.ID)
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response.Message = "Shopping List Item Not Found"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	if err != nil {
+		response.Message = "Unable to Retrieve Shopping List Item"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	itemValidator := NewItemUpdateValidator()
+	if err := c.BodyParser(itemValidator); err != nil {
+		response.Message = "Invalid JSON"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	validationErrors, err := itemValidator.Validate()
+	if err != nil {
+		response.Message = "Validation Errors"
+		response.Errors = validationErrors
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	itemValidator.BindModel(&item)
+
+	if err := item.Update(); err != nil {
+		response.Message = "Unable to Update Shopping List Item"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	var itemResponse ItemResponse
+	itemResponse.SerializeItem(&item)
+
+	//Respond with Success
+	response.Success = true
+	response.Data = itemResponse
+	return c.JSON(response)
+}
+
+func ShoppingListDelete(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+
+	listID := c.Params("id")
+	userID := middleware.AuthedUserId(c.Locals("user"))
+
+	err := DeleteShoppingList(listID, userID)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response.Message = "Shopping List Not Found"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	if err != nil {
+		response.Message = "Unable to Delete Shopping List"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	response.Success = true
+	response.Message = "Shopping List Deleted"
+	return c.JSON(response)
+}
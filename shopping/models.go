@@ -0,0 +1,148 @@
+package shopping
+
+import (
+	"github.com/anthonyhawkins/savorbook/database"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+type ShoppingListModel struct {
+	gorm.Model
+	UserID uint
+	Name   string
+	Items  []ShoppingListItemModel `gorm:"foreignKey:ShoppingListID;constraint:OnDelete:CASCADE"`
+}
+
+type ShoppingListItemModel struct {
+	gorm.Model
+	ShoppingListID uint
+	Name           string
+	Qty            string
+	Unit           string
+	Amount         *float64
+	CanonicalUnit  string
+	Category       string
+	Checked        bool
+	Position       int
+	Sources        pq.StringArray `gorm:"type:text[]"`
+}
+
+func CreateShoppingList(list *ShoppingListModel) error {
+	db := database.GetDB()
+	return db.Create(list).Error
+}
+
+func GetShoppingList(listID string, userID uint) (ShoppingListModel, error) {
+	db := database.GetDB()
+	var model ShoppingListModel
+
+	result := db.Where(map[string]interface{}{
+		"id":      listID,
+		"user_id": userID,
+	}).Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Order("shopping_list_item_models.position")
+	}).First(&model)
+
+	return model, result.Error
+}
+
+func GetShoppingLists(userID uint, pageNum string, pageSize string) ([]ShoppingListModel, error) {
+	db := database.GetDB()
+	var lists []ShoppingListModel
+
+	result := db.Scopes(database.Paginate(pageNum, pageSize)).Where(map[string]interface{}{
+		"user_id": userID,
+	}).Order("id desc").Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Order("shopping_list_item_models.position")
+	}).Find(&lists)
+
+	return lists, result.Error
+}
+
+func DeleteShoppingList(listID string, userID uint) error {
+	db := database.GetDB()
+
+	result := db.Where(map[string]interface{}{
+		"id":      listID,
+		"user_id": userID,
+	}).Delete(&ShoppingListModel{})
+
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// Update keeps the ids of items the client sent back so checking an item on one
+// device doesn't invalidate the list on another. Items which were left out are
+// deleted and items without an id are added.
+func (model *ShoppingListModel) Update() error {
+	db := database.GetDB()
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(model).Update("name", model.Name).Error; err != nil {
+			return err
+		}
+
+		var keep []uint
+		for i := range model.Items {
+			item := &model.Items[i]
+			item.ShoppingListID = model.ID
+			item.Position = i
+			if item.ID != 0 {
+				keep = append(keep, item.ID)
+			}
+		}
+
+		remove := tx.Where("shopping_list_id = ?", model.ID)
+		if len(keep) > 0 {
+			remove = remove.Where("id NOT IN ?", keep)
+		}
+		if err := remove.Delete(&ShoppingListItemModel{}).Error; err != nil {
+			return err
+		}
+
+		for i := range model.Items {
+			item := &model.Items[i]
+			if item.ID == 0 {
+				if err := tx.Create(item).Error; err != nil {
+					return err
+				}
+				continue
+			}
+
+			result := tx.Model(item).Where("shopping_list_id = ?", model.ID).Select(
+				"Name", "Qty", "Unit", "Amount", "CanonicalUnit", "Category", "Checked", "Position",
+			).Updates(item)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return gorm.ErrRecordNotFound
+			}
+		}
+		return nil
+	})
+}
+
+func GetShoppingListItem(itemID string, listID uint) (ShoppingListItemModel, error) {
+	db := database.GetDB()
+	var item ShoppingListItemModel
+
+	result := db.Where(map[string]interface{}{
+		"id":               itemID,
+		"shopping_list_id": listID,
+	}).First(&item)
+
+	return item, result.Error
+}
+
+func (model *ShoppingListItemModel) Update() error {
+	db := database.GetDB()
+	return db.Model(model).Select(
+		"Name", "Qty", "Unit", "Amount", "CanonicalUnit", "Category", "Checked",
+	).Updates(model).Error
+}
@@ -0,0 +1,73 @@
+package shopping
+
+type ShoppingListResponse struct {
+	ID      uint            `json:"id"`
+	Name    string          `json:"name"`
+	Created string          `json:"created"`
+	Aisles  []AisleResponse `json:"aisles"`
+}
+
+type AisleResponse struct {
+	Name  string         `json:"name"`
+	Items []ItemResponse `json:"items"`
+}
+
+type ItemResponse struct {
+	ID       uint     `json:"id"`
+	Name     string   `json:"name"`
+	Qty      string   `json:"qty"`
+	Unit     string   `json:"unit"`
+	Category string   `json:"category"`
+	Checked  bool     `json:"checked"`
+	Sources  []string `json:"sources"`
+}
+
+func (r *ShoppingListResponse) SerializeShoppingList(model *ShoppingListModel) {
+	r.ID = model.ID
+	r.Name = model.Name
+	r.Created = model.CreatedAt.Format("2006-01-02")
+	r.SerializeAisles(model.Items)
+}
+
+// SerializeAisles groups the items by aisle, in the order the aisles are walked.
+func (r *ShoppingListResponse) SerializeAisles(itemModels []ShoppingListItemModel) {
+	grouped := make(map[string][]ItemResponse)
+	var names []string
+	for _, itemModel := range itemModels {
+		var item ItemResponse
+		item.SerializeItem(&itemModel)
+		if _, ok := grouped[item.Category]; !ok {
+			names = append(names, item.Category)
+		}
+		grouped[item.Category] = append(grouped[item.Category], item)
+	}
+
+	aisles := make([]AisleResponse, 0)
+	for _, name := range Aisles {
+		if items, ok := grouped[name]; ok {
+			aisles = append(aisles, AisleResponse{Name: name, Items: items})
+			delete(grouped, name)
+		}
+	}
+	//aisles the shopper made up go last
+	for _, name := range names {
+		if items, ok := grouped[name]; ok {
+			aisles = append(aisles, AisleResponse{Name: name, Items: items})
+		}
+	}
+	r.Aisles = aisles
+}
+
+func (r *ItemResponse) SerializeItem(model *ShoppingListItemModel) {
+	r.ID = model.ID
+	r.Name = model.Name
+	r.Qty = model.Qty
+	r.Unit = model.Unit
+	r.Category = model.Category
+	r.Checked = model.Checked
+	if model.Sources == nil {
+		r.Sources = make([]string, 0)
+	} else {
+		r.Sources = model.Sources
+	}
+}
@@ -0,0 +1,122 @@
+package shopping
+
+import "github.com/go-playground/validator/v10"
+
+type ShoppingListValidator struct {
+	ShoppingList struct {
+		Name     string            `json:"name"     validate:"max=75"`
+		Recipes  []SourceValidator `json:"recipes"  validate:"dive"`
+		Sections []SourceValidator `json:"sections" validate:"dive"`
+		Units    string            `json:"units"    validate:"omitempty,oneof=metric imperial original"`
+	} `json:"shoppingList"`
+}
+
+// SourceValidator is a recipe or cookbook section to shop for, optionally scaled the same way RecipeGet is.
+type SourceValidator struct {
+	ID       uint   `json:"id"       validate:"required"`
+	Servings string `json:"servings" validate:"omitempty,max=12"`
+	Scale    string `json:"scale"    validate:"omitempty,max=12"`
+}
+
+type ShoppingListUpdateValidator struct {
+	ShoppingList struct {
+		Name  string          `json:"name"  validate:"max=75"`
+		Items []ItemValidator `json:"items" validate:"dive"`
+	} `json:"shoppingList"`
+	Model ShoppingListModel `json:"-"`
+}
+
+type ItemValidator struct {
+	ID       uint   `json:"id"`
+	Name     string `json:"name"     validate:"required,max=75"`
+	Qty      string `json:"qty"      validate:"max=75"`
+	Unit     string `json:"unit"     validate:"max=12"`
+	Category string `json:"category" validate:"max=32"`
+	Checked  bool   `json:"checked"`
+}
+
+type ItemUpdateValidator struct {
+	Item ItemValidator `json:"item"`
+}
+
+func NewShoppingListValidator() *ShoppingListValidator {
+	return &ShoppingListValidator{}
+}
+
+func NewShoppingListUpdateValidator() *ShoppingListUpdateValidator {
+	return &ShoppingListUpdateValidator{}
+}
+
+func NewItemUpdateValidator() *ItemUpdateValidator {
+	return &ItemUpdateValidator{}
+}
+
+func validate(v interface{}) ([]string, error) {
+	var errors []string
+	validate := validator.New()
+	err := validate.Struct(v)
+	if err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			message := err.Field() + " = " + err.Tag()
+			errors = append(errors, message)
+		}
+	}
+
+	return errors, err
+}
+
+func (v *ShoppingListValidator) Validate() ([]string, error) {
+	return validate(v)
+}
+
+func (v *ShoppingListUpdateValidator) Validate() ([]string, error) {
+	return validate(v)
+}
+
+func (v *ItemUpdateValidator) Validate() ([]string, error) {
+	return validate(v)
+}
+
+// BindModel replaces the name and items of an existing list, keeping the list's id.
+func (v *ShoppingListUpdateValidator) BindModel(model ShoppingListModel) {
+	v.Model = model
+	if v.ShoppingList.Name != "" {
+		v.Model.Name = v.ShoppingList.Name
+	}
+
+	existing := make(map[uint]ShoppingListItemModel)
+	for _, item := range model.Items {
+		existing[item.ID] = item
+	}
+
+	items := make([]ShoppingListItemModel, 0)
+	for _, itemValidator := range v.ShoppingList.Items {
+		item, ok := existing[itemValidator.ID]
+		if !ok {
+			item = ShoppingListItemModel{}
+		}
+		itemValidator.bind(&item)
+		items = append(items, item)
+	}
+	v.Model.Items = items
+}
+
+func (v *ItemUpdateValidator) BindModel(item *ShoppingListItemModel) {
+	v.Item.bind(item)
+}
+
+// bind copies the editable fields, the parsed amount is dropped once the shopper rewrites the qty by hand.
+func (v ItemValidator) bind(item *ShoppingListItemModel) {
+	if item.Qty != v.Qty || item.Unit != v.Unit {
+		item.Amount = nil
+		item.CanonicalUnit = ""
+	}
+	item.Name = v.Name
+	item.Qty = v.Qty
+	item.Unit = v.Unit
+	item.Checked = v.Checked
+	item.Category = v.Category
+	if item.Category == "" {
+		item.Category = AisleFor(item.Name)
+	}
+}
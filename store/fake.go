@@ -0,0 +1,56 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// FakeProvider takes no money and is meant for local development. Every token is
+// accepted except tok_decline, which is declined, and tok_error, which fails the
+// way an unreachable provider would.
+//
+// Nothing is kept in memory, so refunds still work when a prefork child other
+// than the one that took the charge handles them.
+type FakeProvider struct{}
+
+const (
+	FakeTokenDecline = "tok_decline"
+	FakeTokenError   = "tok_error"
+)
+
+func NewFakeProvider() *FakeProvider {
+	return &FakeProvider{}
+}
+
+func (p *FakeProvider) Name() string {
+	return "fake"
+}
+
+func (p *FakeProvider) Charge(ctx context.Context, charge Charge) (Payment, error) {
+	switch charge.Token {
+	case FakeTokenDecline:
+		return Payment{}, ErrDeclined
+	case FakeTokenError:
+		return Payment{}, fmt.Errorf("fake provider unavailable")
+	}
+	if charge.Amount <= 0 {
+		return Payment{}, fmt.Errorf("fake provider cannot charge %d %s", charge.Amount, charge.Currency)
+	}
+	return Payment{Ref: "fake_ch_" + fakeRef()}, nil
+}
+
+func (p *FakeProvider) Refund(ctx context.Context, paymentRef string, amount int64, currency string) (string, error) {
+	if !strings.HasPrefix(paymentRef, "fake_ch_") {
+		return "", fmt.Errorf("fake provider has no payment %q", paymentRef)
+	}
+	return "fake_re_" + fakeRef(), nil
+}
+
+func fakeRef() string {
+	bytes := make([]byte, 12)
+	rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
@@ -0,0 +1,341 @@
+package store
+
+import (
+	"errors"
+	"github.com/anthonyhawkins/savorbook/middleware"
+	"github.com/anthonyhawkins/savorbook/responses"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"strconv"
+	"strings"
+)
+
+func ListingGet(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+
+	cookbookID, _ := strconv.Atoi(c.Params("id"))
+	listing, err := GetListing(uint(cookbookID))
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response.Message = "Cookbook Not For Sale"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	if err != nil {
+		response.Message = "Unable to Retrieve Listing"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	var listingResponse ListingResponse
+	listingResponse.SerializeListing(&listing)
+
+	//Respond with Success
+	response.Success = true
+	response.Data = listingResponse
+	return c.JSON(response)
+}
+
+func ListingSet(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+	userID := middleware.AuthedUserId(c.Locals("user"))
+
+	cookbookID, err := strconv.Atoi(c.Params("id"))
+	if err != nil || cookbookID <= 0 {
+		response.Message = "Cookbook Not Found"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	listingValidator := NewListingValidator()
+	if err := c.BodyParser(listingValidator); err != nil {
+		response.Message = "Invalid JSON"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	validationErrors, err := listingValidator.Validate()
+	if err != nil {
+		response.Message = "Validation Errors"
+		response.Errors = validationErrors
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	listingValidator.BindModel(userID, uint(cookbookID))
+	err = SetListing(&listingValidator.Model)
+
+	//only published cookbooks can be sold
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response.Message = "Published Cookbook Not Found"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	if err != nil {
+		response.Message = "Unable to Price Cookbook"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	listing, err := GetListing(uint(cookbookID))
+	if err != nil {
+		response.Message = "Unable to Retrieve Listing"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	var listingResponse ListingResponse
+	listingResponse.SerializeListing(&listing)
+
+	//Respond with Success
+	response.Success = true
+	response.Data = listingResponse
+	return c.JSON(response)
+}
+
+func ListingRemove(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+	userID := middleware.AuthedUserId(c.Locals("user"))
+
+	err := RemoveListing(c.Params("id"), userID)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response.Message = "Cookbook Not For Sale"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	if err != nil {
+		response.Message = "Unable to Remove Listing"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	//Respond with Success
+	response.Success = true
+	response.Message = "Cookbook Taken Off Sale"
+	return c.JSON(response)
+}
+
+func CheckoutCreate(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+	userID := middleware.AuthedUserId(c.Locals("user"))
+
+	checkoutValidator := NewCheckoutValidator()
+	if err := c.BodyParser(checkoutValidator); err != nil {
+		response.Message = "Invalid JSON"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	validationErrors, err := checkoutValidator.Validate()
+	if err != nil {
+		response.Message = "Validation Errors"
+		response.Errors = validationErrors
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	checkout := checkoutValidator.Order
+	order, err := Checkout(
+		c.Context(), userID, strconv.Itoa(int(checkout.CookbookID)), checkout.PaymentToken, checkout.Price, checkout.Currency,
+	)
+
+	var orderResponse OrderResponse
+	orderResponse.SerializeOrder(&order)
+
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		response.Message = "Cookbook Not Found"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	case errors.Is(err, ErrNotForSale), errors.Is(err, ErrOwnCookbook):
+		response.Message = "Unable to Check Out"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	case errors.Is(err, ErrAlreadyOwned), errors.Is(err, ErrPriceChanged):
+		response.Message = "Unable to Check Out"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusConflict).JSON(response)
+	case errors.Is(err, ErrDeclined):
+		response.Message = "Payment Declined"
+		response.Errors = append(response.Errors, err.Error())
+		response.Data = orderResponse
+		return c.Status(fiber.StatusPaymentRequired).JSON(response)
+	case err != nil && order.Status == OrderFailed:
+		//the provider itself failed, the failed order is kept so the buyer can see what happened
+		response.Message = "Payment Failed"
+		response.Errors = append(response.Errors, err.Error())
+		response.Data = orderResponse
+		return c.Status(fiber.StatusBadGateway).JSON(response)
+	case err != nil:
+		response.Message = "Unable to Check Out"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	//Respond with Success
+	response.Success = true
+	response.Data = orderResponse
+	return c.Status(fiber.StatusCreated).JSON(response)
+}
+
+func OrderList(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+	userID := middleware.AuthedUserId(c.Locals("user"))
+
+	orders, err := GetOrders(userID, strings.ToLower(c.Query("page")), strings.ToLower(c.Query("page_size")))
+	if err != nil {
+		response.Message = "Unable to Retrieve Orders"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	//Respond with Success
+	response.Success = true
+	response.Data = SerializeOrders(orders)
+	return c.JSON(response)
+}
+
+func OrderGet(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+	userID := middleware.AuthedUserId(c.Locals("user"))
+
+	order, err := GetOrder(c.Params("id"), userID)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response.Message = "Order Not Found"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	if err != nil {
+		response.Message = "Unable to Retrieve Order"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	var orderResponse OrderResponse
+	orderResponse.SerializeOrder(&order)
+
+	//Respond with Success
+	response.Success = true
+	response.Data = orderResponse
+	return c.JSON(response)
+}
+
+func SaleList(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+	userID := middleware.AuthedUserId(c.Locals("user"))
+
+	status := strings.ToLower(c.Query("status"))
+	switch status {
+	case "", OrderPending, OrderPaid, OrderFailed, OrderRefunded:
+	default:
+		response.Message = "Validation Errors"
+		response.Errors = append(response.Errors, "status must be one of pending, paid, failed or refunded")
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	orders, err := GetSales(userID, status, strings.ToLower(c.Query("page")), strings.ToLower(c.Query("page_size")))
+	if err != nil {
+		response.Message = "Unable to Retrieve Sales"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	//Respond with Success
+	response.Success = true
+	response.Data = SerializeOrders(orders)
+	return c.JSON(response)
+}
+
+func SalesTotalList(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+	userID := middleware.AuthedUserId(c.Locals("user"))
+
+	totals, err := GetSalesTotals(userID)
+	if err != nil {
+		response.Message = "Unable to Retrieve Sales"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	totalList := make([]SalesTotalResponse, 0)
+	for _, total := range totals {
+		var totalResponse SalesTotalResponse
+		totalResponse.SerializeTotal(&total)
+		totalList = append(totalList, totalResponse)
+	}
+
+	//Respond with Success
+	response.Success = true
+	response.Data = totalList
+	return c.JSON(response)
+}
+
+func SaleRefund(c *fiber.Ctx) error {
+	response := new(responses.StandardResponse)
+	response.Success = false
+	userID := middleware.AuthedUserId(c.Locals("user"))
+
+	refundValidator := NewRefundValidator()
+	//a refund needs no body, a reason is optional
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(refundValidator); err != nil {
+			response.Message = "Invalid JSON"
+			response.Errors = append(response.Errors, err.Error())
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+		}
+	}
+
+	validationErrors, err := refundValidator.Validate()
+	if err != nil {
+		response.Message = "Validation Errors"
+		response.Errors = validationErrors
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	order, err := RefundOrder(c.Context(), c.Params("id"), userID, refundValidator.Refund.Reason)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response.Message = "Order Not Found"
+		response.Errors = append(response.Errors, response.Message)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	if errors.Is(err, ErrNotRefundable) {
+		response.Message = "Unable to Refund Order"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusConflict).JSON(response)
+	}
+
+	if errors.Is(err, ErrRefundFailed) {
+		response.Message = "Unable to Refund Order"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusBadGateway).JSON(response)
+	}
+
+	if err != nil {
+		response.Message = "Unable to Refund Order"
+		response.Errors = append(response.Errors, err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	var orderResponse OrderResponse
+	orderResponse.SerializeOrder(&order)
+
+	//Respond with Success
+	response.Success = true
+	response.Message = "Order Refunded"
+	response.Data = orderResponse
+	return c.JSON(response)
+}
@@ -0,0 +1,368 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/anthonyhawkins/savorbook/database"
+	"github.com/anthonyhawkins/savorbook/publish/cookbooks"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strconv"
+	"time"
+)
+
+const (
+	OrderPending  = "pending"
+	OrderPaid     = "paid"
+	OrderFailed   = "failed"
+	OrderRefunded = "refunded"
+)
+
+var (
+	ErrNotForSale    = errors.New("cookbook is not for sale")
+	ErrOwnCookbook   = errors.New("authors cannot buy their own cookbooks")
+	ErrAlreadyOwned  = errors.New("cookbook already purchased")
+	ErrPriceChanged  = errors.New("price has changed since checkout began")
+	ErrNotRefundable = errors.New("only paid orders can be refunded")
+	ErrRefundFailed  = errors.New("payment provider could not refund")
+)
+
+// ListingModel puts a published cookbook up for sale. A cookbook without one is free to read.
+type ListingModel struct {
+	gorm.Model
+	CookbookID uint `gorm:"uniqueIndex"`
+	UserID     uint `gorm:"index"`
+	//Price is in the currency's minor unit, cents for usd
+	Price    int64
+	Currency string
+}
+
+// OrderModel is one checkout. Title, Amount and Currency are copied from the
+// cookbook and its listing so the order history stays true after either changes.
+type OrderModel struct {
+	gorm.Model
+	BuyerID       uint `gorm:"index"`
+	SellerID      uint `gorm:"index"`
+	CookbookID    uint `gorm:"index"`
+	Title         string
+	Amount        int64
+	Currency      string
+	Status        string `gorm:"not null;default:'pending';index"`
+	Provider      string
+	PaymentRef    string
+	FailureReason string
+	PaidAt        *time.Time
+	RefundRef     string
+	RefundReason  string
+	RefundedAt    *time.Time
+}
+
+// EntitlementModel unlocks a priced cookbook for a buyer. It outlives price changes
+// and the listing being removed, only a refund revokes it.
+type EntitlementModel struct {
+	gorm.Model
+	UserID     uint `gorm:"uniqueIndex:idx_entitlement"`
+	CookbookID uint `gorm:"uniqueIndex:idx_entitlement"`
+	OrderID    uint
+	RevokedAt  *time.Time
+}
+
+// SalesTotal sums an author's sales in one currency.
+type SalesTotal struct {
+	Currency string
+	Orders   int
+	Refunds  int
+	Gross    int64
+	Refunded int64
+}
+
+func (total *SalesTotal) Net() int64 {
+	return total.Gross - total.Refunded
+}
+
+// SetListing prices one of the author's published cookbooks, replacing any earlier price.
+func SetListing(listing *ListingModel) error {
+	db := database.GetDB()
+
+	if _, _, err := cookbooks.GetPublishedCookbook(strconv.Itoa(int(listing.CookbookID)), listing.UserID); err != nil {
+		return err
+	}
+
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "cookbook_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"price", "currency", "updated_at"}),
+	}).Create(listing).Error
+}
+
+func GetListing(cookbookID uint) (ListingModel, error) {
+	db := database.GetDB()
+	var listing ListingModel
+	err := db.Where("cookbook_id = ?", cookbookID).First(&listing).Error
+	return listing, err
+}
+
+// RemoveListing takes the cookbook off sale, making it free to read. Buyers keep their entitlements.
+func RemoveListing(cookbookID string, userID uint) error {
+	db := database.GetDB()
+
+	result := db.Unscoped().Where(map[string]interface{}{
+		"cookbook_id": cookbookID,
+		"user_id":     userID,
+	}).Delete(&ListingModel{})
+
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// HasEntitlement is true while the user holds an unrevoked entitlement to the cookbook.
+func HasEntitlement(userID uint, cookbookID uint) (bool, error) {
+	db := database.GetDB()
+	var count int64
+	err := db.Model(&EntitlementModel{}).Where(map[string]interface{}{
+		"user_id":     userID,
+		"cookbook_id": cookbookID,
+		"revoked_at":  nil,
+	}).Count(&count).Error
+	return count > 0, err
+}
+
+// Unlocked reports whether the user may read all of the cookbook: authors always
+// can, anyone can when it isn't for sale, and buyers can once they own it.
+func Unlocked(userID uint, cookbook *cookbooks.CookbookModel) (bool, *ListingModel, error) {
+	listing, err := GetListing(cookbook.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return true, nil, nil
+	}
+	if err != nil {
+		return false, nil, err
+	}
+	if userID == 0 {
+		return false, &listing, nil
+	}
+	if userID == cookbook.UserID {
+		return true, &listing, nil
+	}
+	owned, err := HasEntitlement(userID, cookbook.ID)
+	return owned, &listing, err
+}
+
+// GetEntitledCookbookIDs lists every cookbook the user has bought and still owns.
+func GetEntitledCookbookIDs(userID uint) ([]uint, error) {
+	db := database.GetDB()
+	cookbookIDs := make([]uint, 0)
+	err := db.Model(&EntitlementModel{}).Where(map[string]interface{}{
+		"user_id":    userID,
+		"revoked_at": nil,
+	}).Pluck("cookbook_id", &cookbookIDs).Error
+	return cookbookIDs, err
+}
+
+// openOrderSQL matches the orders a buyer can hold only one of per cookbook, a
+// pending order whose charge is under way or a paid one. Failed and refunded
+// orders don't count, so the buyer can try again or buy again.
+const openOrderSQL = "status IN ('" + OrderPending + "', '" + OrderPaid + "')"
+
+// MigrateOrders adds the partial unique index Checkout relies on, which gorm tags can't express.
+func MigrateOrders(db *gorm.DB) error {
+	return db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_order_open ON order_models (buyer_id, cookbook_id) WHERE ` + openOrderSQL).Error
+}
+
+// Checkout charges the buyer for the cookbook at its listed price. Price and
+// currency, when given, are what the buyer was shown and must still match.
+//
+// The order is written as pending before the provider is called and settled
+// afterwards, so a charge that fails part way is still on record. A pending order
+// left behind by a crash blocks the buyer until it is settled by hand, as the
+// charge may have gone through.
+func Checkout(ctx context.Context, buyerID uint, cookbookID string, token string, price *int64, currency string) (OrderModel, error) {
+	db := database.GetDB()
+	var order OrderModel
+
+	model, publication, err := cookbooks.GetPublicCookbook(cookbookID)
+	if err != nil {
+		return order, err
+	}
+	//the buyer pays for the published book, which may have been retitled in draft since
+	snapshot, err := publication.Cookbook()
+	if err != nil {
+		return order, err
+	}
+
+	listing, err := GetListing(model.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return order, ErrNotForSale
+	}
+	if err != nil {
+		return order, err
+	}
+
+	if model.UserID == buyerID {
+		return order, ErrOwnCookbook
+	}
+	if (price != nil && *price != listing.Price) || (currency != "" && currency != listing.Currency) {
+		return order, ErrPriceChanged
+	}
+
+	owned, err := HasEntitlement(buyerID, model.ID)
+	if err != nil {
+		return order, err
+	}
+	if owned {
+		return order, ErrAlreadyOwned
+	}
+
+	provider := GetProvider()
+	order = OrderModel{
+		BuyerID:    buyerID,
+		SellerID:   model.UserID,
+		CookbookID: model.ID,
+		Title:      snapshot.Title,
+		Amount:     listing.Price,
+		Currency:   listing.Currency,
+		Status:     OrderPending,
+		Provider:   provider.Name(),
+	}
+	//only one order per buyer and cookbook may be open or paid, so of two checkouts
+	//racing past HasEntitlement the second writes nothing and is never charged
+	result := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "buyer_id"}, {Name: "cookbook_id"}},
+		Where:     clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: openOrderSQL}}},
+		DoNothing: true,
+	}).Create(&order)
+	if result.Error != nil {
+		return order, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return OrderModel{}, ErrAlreadyOwned
+	}
+
+	payment, err := provider.Charge(ctx, Charge{
+		Amount:      order.Amount,
+		Currency:    order.Currency,
+		Token:       token,
+		Description: order.Title,
+		Reference:   "order-" + strconv.Itoa(int(order.ID)),
+	})
+	if err != nil {
+		order.Status = OrderFailed
+		order.FailureReason = err.Error()
+		//the buyer is told why the charge failed, an order stuck pending blocks their next checkout so it's logged
+		if updateErr := db.Model(&order).Select("Status", "FailureReason").Updates(&order).Error; updateErr != nil {
+			fmt.Println("unable to mark order", order.ID, "failed:", updateErr)
+		}
+		return order, err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		order.Status = OrderPaid
+		order.PaymentRef = payment.Ref
+		order.PaidAt = &now
+		if err := tx.Model(&order).Select("Status", "PaymentRef", "PaidAt").Updates(&order).Error; err != nil {
+			return err
+		}
+
+		//buying again after a refund brings the old entitlement back
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "cookbook_id"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{"order_id": order.ID, "revoked_at": nil, "updated_at": now}),
+		}).Create(&EntitlementModel{
+			UserID:     buyerID,
+			CookbookID: model.ID,
+			OrderID:    order.ID,
+		}).Error
+	})
+
+	return order, err
+}
+
+// GetOrders lists the buyer's orders, newest first.
+func GetOrders(buyerID uint, pageNum string, pageSize string) ([]OrderModel, error) {
+	return findOrders(map[string]interface{}{"buyer_id": buyerID}, pageNum, pageSize)
+}
+
+// GetSales lists the orders for the author's cookbooks, newest first, optionally only those in one status.
+func GetSales(sellerID uint, status string, pageNum string, pageSize string) ([]OrderModel, error) {
+	where := map[string]interface{}{"seller_id": sellerID}
+	if status != "" {
+		where["status"] = status
+	}
+	return findOrders(where, pageNum, pageSize)
+}
+
+func findOrders(where map[string]interface{}, pageNum string, pageSize string) ([]OrderModel, error) {
+	db := database.GetDB()
+	orders := make([]OrderModel, 0)
+	err := db.Scopes(database.Paginate(pageNum, pageSize)).Where(where).Order("id DESC").Find(&orders).Error
+	return orders, err
+}
+
+// GetOrder returns the order to either the buyer or the seller.
+func GetOrder(orderID string, userID uint) (OrderModel, error) {
+	db := database.GetDB()
+	var order OrderModel
+	err := db.Where("id = ?", orderID).Where(
+		db.Where("buyer_id = ?", userID).Or("seller_id = ?", userID),
+	).First(&order).Error
+	return order, err
+}
+
+// GetSalesTotals sums the author's paid and refunded orders per currency.
+func GetSalesTotals(sellerID uint) ([]SalesTotal, error) {
+	db := database.GetDB()
+	totals := make([]SalesTotal, 0)
+	err := db.Model(&OrderModel{}).Select(
+		"currency, count(*) AS orders, count(refunded_at) AS refunds, "+
+			"sum(amount) AS gross, coalesce(sum(amount) FILTER (WHERE status = ?), 0) AS refunded", OrderRefunded,
+	).Where("seller_id = ? AND status IN ?", sellerID, []string{OrderPaid, OrderRefunded}).
+		Group("currency").Order("currency").Scan(&totals).Error
+	return totals, err
+}
+
+// RefundOrder refunds a paid order in full and revokes the buyer's entitlement.
+// The order stays locked while the provider refunds it, so it can't be refunded twice.
+func RefundOrder(ctx context.Context, orderID string, sellerID uint, reason string) (OrderModel, error) {
+	db := database.GetDB()
+	var order OrderModel
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where(map[string]interface{}{
+			"id":        orderID,
+			"seller_id": sellerID,
+		}).First(&order).Error
+		if err != nil {
+			return err
+		}
+		if order.Status != OrderPaid {
+			return ErrNotRefundable
+		}
+
+		refundRef, err := GetProvider().Refund(ctx, order.PaymentRef, order.Amount, order.Currency)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrRefundFailed, err)
+		}
+
+		now := time.Now()
+		order.Status = OrderRefunded
+		order.RefundRef = refundRef
+		order.RefundReason = reason
+		order.RefundedAt = &now
+		err = tx.Model(&order).Select("Status", "RefundRef", "RefundReason", "RefundedAt").Updates(&order).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&EntitlementModel{}).Where(map[string]interface{}{
+			"order_id":   order.ID,
+			"revoked_at": nil,
+		}).Update("revoked_at", now).Error
+	})
+
+	return order, err
+}
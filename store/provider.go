@@ -0,0 +1,55 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/anthonyhawkins/savorbook/config"
+	"strings"
+)
+
+// Provider is implemented by each payment provider. The active provider is
+// chosen by the PAYMENT_PROVIDER setting, only fake is built in so far.
+type Provider interface {
+	Name() string
+	Charge(ctx context.Context, charge Charge) (Payment, error)
+	Refund(ctx context.Context, paymentRef string, amount int64, currency string) (string, error)
+}
+
+// Charge is a single payment taken from a buyer. Amount is in the currency's minor unit, cents for usd.
+type Charge struct {
+	Amount      int64
+	Currency    string
+	Token       string
+	Description string
+	//Reference ties the payment back to the order it pays for
+	Reference string
+}
+
+// Payment is what the provider hands back once a charge has gone through.
+type Payment struct {
+	Ref string
+}
+
+// ErrDeclined is returned by Charge when the provider refuses the payment.
+var ErrDeclined = errors.New("payment declined")
+
+var active Provider
+
+func Init() (Provider, error) {
+	name := strings.ToLower(config.Get("PAYMENT_PROVIDER"))
+
+	var err error
+	switch name {
+	case "", "fake":
+		active = NewFakeProvider()
+	default:
+		err = fmt.Errorf("unknown payment provider %q", name)
+	}
+
+	return active, err
+}
+
+func GetProvider() Provider {
+	return active
+}
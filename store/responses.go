@@ -0,0 +1,88 @@
+package store
+
+import "time"
+
+type ListingResponse struct {
+	CookbookID uint   `json:"cookbookId"`
+	Price      int64  `json:"price"`
+	Currency   string `json:"currency"`
+	Updated    string `json:"updated"`
+}
+
+type OrderResponse struct {
+	ID            uint   `json:"id"`
+	CookbookID    uint   `json:"cookbookId"`
+	Title         string `json:"title"`
+	BuyerID       uint   `json:"buyerId"`
+	SellerID      uint   `json:"sellerId"`
+	Amount        int64  `json:"amount"`
+	Currency      string `json:"currency"`
+	Status        string `json:"status"`
+	Provider      string `json:"provider"`
+	PaymentRef    string `json:"paymentRef,omitempty"`
+	FailureReason string `json:"failureReason,omitempty"`
+	Created       string `json:"created"`
+	PaidAt        string `json:"paidAt,omitempty"`
+	RefundReason  string `json:"refundReason,omitempty"`
+	RefundedAt    string `json:"refundedAt,omitempty"`
+}
+
+type SalesTotalResponse struct {
+	Currency string `json:"currency"`
+	Orders   int    `json:"orders"`
+	Refunds  int    `json:"refunds"`
+	Gross    int64  `json:"gross"`
+	Refunded int64  `json:"refunded"`
+	Net      int64  `json:"net"`
+}
+
+func (r *ListingResponse) SerializeListing(model *ListingModel) {
+	r.CookbookID = model.CookbookID
+	r.Price = model.Price
+	r.Currency = model.Currency
+	r.Updated = model.UpdatedAt.Format("2006-01-02T15:04:05Z07:00")
+}
+
+func (r *OrderResponse) SerializeOrder(model *OrderModel) {
+	r.ID = model.ID
+	r.CookbookID = model.CookbookID
+	r.Title = model.Title
+	r.BuyerID = model.BuyerID
+	r.SellerID = model.SellerID
+	r.Amount = model.Amount
+	r.Currency = model.Currency
+	r.Status = model.Status
+	r.Provider = model.Provider
+	r.PaymentRef = model.PaymentRef
+	r.FailureReason = model.FailureReason
+	r.Created = model.CreatedAt.Format("2006-01-02T15:04:05Z07:00")
+	r.PaidAt = formatTime(model.PaidAt)
+	r.RefundReason = model.RefundReason
+	r.RefundedAt = formatTime(model.RefundedAt)
+}
+
+func SerializeOrders(models []OrderModel) []OrderResponse {
+	orders := make([]OrderResponse, 0)
+	for _, model := range models {
+		var order OrderResponse
+		order.SerializeOrder(&model)
+		orders = append(orders, order)
+	}
+	return orders
+}
+
+func (r *SalesTotalResponse) SerializeTotal(total *SalesTotal) {
+	r.Currency = total.Currency
+	r.Orders = total.Orders
+	r.Refunds = total.Refunds
+	r.Gross = total.Gross
+	r.Refunded = total.Refunded
+	r.Net = total.Net()
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format("2006-01-02T15:04:05Z07:00")
+}
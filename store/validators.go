@@ -0,0 +1,76 @@
+package store
+
+import (
+	"github.com/go-playground/validator/v10"
+	"strings"
+)
+
+type ListingValidator struct {
+	Listing struct {
+		Price    int64  `json:"price"    validate:"required,gt=0,lte=100000000"`
+		Currency string `json:"currency" validate:"required,len=3,alpha"`
+	} `json:"listing"`
+	Model ListingModel `json:"-"`
+}
+
+func NewListingValidator() *ListingValidator {
+	return &ListingValidator{}
+}
+
+func (v *ListingValidator) Validate() ([]string, error) {
+	return validate(v)
+}
+
+func (v *ListingValidator) BindModel(userID uint, cookbookID uint) {
+	v.Model.UserID = userID
+	v.Model.CookbookID = cookbookID
+	v.Model.Price = v.Listing.Price
+	v.Model.Currency = strings.ToLower(v.Listing.Currency)
+}
+
+type CheckoutValidator struct {
+	Order struct {
+		CookbookID   uint   `json:"cookbookId"   validate:"required"`
+		PaymentToken string `json:"paymentToken" validate:"required,max=255"`
+		//Price and Currency are what the buyer was shown, checkout fails if the listing has since changed
+		Price    *int64 `json:"price"    validate:"omitempty,gt=0"`
+		Currency string `json:"currency" validate:"omitempty,len=3,alpha"`
+	} `json:"order"`
+}
+
+func NewCheckoutValidator() *CheckoutValidator {
+	return &CheckoutValidator{}
+}
+
+func (v *CheckoutValidator) Validate() ([]string, error) {
+	v.Order.Currency = strings.ToLower(v.Order.Currency)
+	return validate(v)
+}
+
+type RefundValidator struct {
+	Refund struct {
+		Reason string `json:"reason" validate:"max=500"`
+	} `json:"refund"`
+}
+
+func NewRefundValidator() *RefundValidator {
+	return &RefundValidator{}
+}
+
+func (v *RefundValidator) Validate() ([]string, error) {
+	return validate(v)
+}
+
+func validate(v interface{}) ([]string, error) {
+	var errors []string
+	validate := validator.New()
+	err := validate.Struct(v)
+	if err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			message := err.Field() + " = " + err.Tag()
+			errors = append(errors, message)
+		}
+	}
+
+	return errors, err
+}
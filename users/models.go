@@ -13,6 +13,7 @@ type UserModel struct {
 	Salt         string
 	PasswordHash string
 	Status       string
+	Units        string `gorm:"default:original"`
 }
 
 func (model *UserModel) Exists() bool {
@@ -68,3 +69,11 @@ func FindOne(userID uint) (*UserModel, error) {
 	result := db.First(&user, userID)
 	return user, result.Error
 }
+
+// FindByUsername looks a user up the way their public pages are addressed, ignoring case.
+func FindByUsername(username string) (*UserModel, error) {
+	db := database.GetDB()
+	var user = new(UserModel)
+	result := db.Where("LOWER(username) = LOWER(?)", username).First(&user)
+	return user, result.Error
+}
@@ -12,6 +12,14 @@ type UserResponse struct {
 	Username    string `json:"username"`
 	DisplayName string `json:"displayName"`
 	Bio         string `gorm:"column:bio" json:"bio"`
+	Units       string `json:"units"`
+}
+
+// ProfileResponse is what anyone may see of a user, on their author page.
+type ProfileResponse struct {
+	Username    string `json:"username"`
+	DisplayName string `json:"displayName"`
+	Bio         string `json:"bio"`
 }
 
 func (r *LoginResponse) SerializeLogin(model *UserModel, accessToken string) {
@@ -26,4 +34,11 @@ func (r *UserResponse) SerializeUser(model *UserModel) {
 	r.UserID = model.ID
 	r.DisplayName = model.DisplayName
 	r.Bio = model.Bio
+	r.Units = model.Units
+}
+
+func (r *ProfileResponse) SerializeProfile(model *UserModel) {
+	r.Username = model.Username
+	r.DisplayName = model.DisplayName
+	r.Bio = model.Bio
 }
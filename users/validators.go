@@ -27,6 +27,7 @@ type UserValidator struct {
 		Username    string `json:"username" validate:"required,min=3,max=32"`
 		DisplayName string `json:"displayName" validate:"max=32"`
 		Email       string `json:"email" validate:"required,email,min=6,max=32"`
+		Units       string `json:"units" validate:"omitempty,oneof=metric imperial original"`
 	} `json:"user"`
 	Model UserModel
 }
@@ -122,5 +123,8 @@ func (v *UserValidator) BindModel() error {
 	v.Model.Email = v.User.Email
 	v.Model.Username = v.User.Username
 	v.Model.DisplayName = v.User.DisplayName
+	if v.User.Units != "" {
+		v.Model.Units = v.User.Units
+	}
 	return nil
 }